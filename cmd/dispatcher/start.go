@@ -3,10 +3,14 @@ package main
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/spf13/viper"
 
 	"github.com/lawrencegripper/ion/internal/app/dispatcher"
+	"github.com/lawrencegripper/ion/internal/app/dispatcher/providers"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+	"github.com/lawrencegripper/ion/internal/pkg/servicebus"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -30,7 +34,9 @@ func NewCmdStart() *cobra.Command {
 
 			printConfig()
 
-			if cfg.ClientID == "" || cfg.ClientSecret == "" || cfg.TenantID == "" || cfg.SubscriptionID == "" {
+			// Azure credentials are only needed by the Azure services
+			requiresAzure := cfg.Broker == servicebus.BrokerName || cfg.Provider == providers.AzureBatchProviderName
+			if requiresAzure && (cfg.ClientID == "" || cfg.ClientSecret == "" || cfg.TenantID == "" || cfg.SubscriptionID == "") {
 				return errConfigurationMissing
 			}
 			if cfg.Job == nil {
@@ -39,6 +45,12 @@ func NewCmdStart() *cobra.Command {
 			if cfg.Handler == nil {
 				return errors.New("Handler config can't be nil")
 			}
+			if _, ok := providers.Lookup(cfg.Provider); !ok {
+				return fmt.Errorf("unknown provider '%s', registered providers: %s", cfg.Provider, strings.Join(providers.Registered(), ", "))
+			}
+			if _, ok := messaging.LookupBroker(cfg.Broker); !ok {
+				return fmt.Errorf("unknown broker '%s', registered brokers: %s", cfg.Broker, strings.Join(messaging.RegisteredBrokers(), ", "))
+			}
 			//TODO: validate handler config
 
 			return nil
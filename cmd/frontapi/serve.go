@@ -32,11 +32,15 @@ func init() {
 	flags.Int("job.retrycount", 0, "Max number of times a job can be retried")
 
 	// document store flags
+	flags.String("mongodb-connection-string", "", "MongoDB connection string, Cosmos DB is connected to with the name, password and port when it's not set")
 	flags.String("mongodb-name", "", "MongoDB Name")
 	flags.String("mongodb-collection", "", "MongoDB Database Collection")
 	flags.String("mongodb-password", "", "MongoDB server password")
 	flags.Int("mongodb-port", 27017, "MongoDB server port")
 
+	// schema registry flags
+	flags.String("schemaregistryendpoint", "", "Management server endpoint to fetch event schemas from, ingested events are validated against them")
+
 	// Add 'dispatcher start' flags
 	flags.String("clientid", "", "ClientID of Service Principal for Azure access")
 	flags.String("clientsecret", "", "Client Secrete of Service Principal for Azure access")
@@ -75,10 +79,12 @@ var serveCmd = &cobra.Command{
 		cfg.ResourceGroup = viper.GetString("resourcegroup")
 		cfg.PrintConfig = viper.GetBool("printconfig")
 
+		cfg.Handler.MongoDBDocumentStorageProvider.ConnectionString = viper.GetString("mongodb-connection-string")
 		cfg.Handler.MongoDBDocumentStorageProvider.Name = viper.GetString("mongodb-name")
 		cfg.Handler.MongoDBDocumentStorageProvider.Collection = viper.GetString("mongodb-collection")
 		cfg.Handler.MongoDBDocumentStorageProvider.Password = viper.GetString("mongodb-password")
 		cfg.Handler.MongoDBDocumentStorageProvider.Port = viper.GetInt("mongodb-port")
+		cfg.Handler.SchemaRegistryEndpoint = viper.GetString("schemaregistryendpoint")
 
 		// job.*
 		cfg.Job.RetryCount = viper.GetInt("job.retrycount")
@@ -0,0 +1,152 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+	"github.com/spf13/cobra"
+	"pack.ag/amqp"
+)
+
+type deadletterOptions struct {
+	subName    string
+	eventType  string
+	timeout    int
+	wait       int
+	max        int
+	messageIDs []string
+	all        bool
+}
+
+var deadletterOpts deadletterOptions
+
+// deadletterCmd represents the deadletter command
+var deadletterCmd = &cobra.Command{
+	Use:   "deadletter",
+	Short: "inspect and resubmit events which have been dead lettered on a subscription",
+	RunE:  Event,
+}
+
+// deadLetterQueue is a batch of messages received from a subscription's dead letter queue.
+// The messages are locked until they're accepted, which removes them from the queue, or released.
+type deadLetterQueue struct {
+	receiver *amqp.Receiver
+	messages []*amqp.Message
+}
+
+// receiveDeadLetters locks up to `--max` messages from the dead letter queue, it stops once
+// no message has been received for `--wait` seconds
+func receiveDeadLetters() (*deadLetterQueue, error) {
+	dlqPath := fmt.Sprintf("/%s/subscriptions/%s/$deadletterqueue", deadletterOpts.eventType, deadletterOpts.subName)
+
+	receiver, err := amqpSession.NewReceiver(
+		amqp.LinkSourceAddress(dlqPath),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating receiver link: %+v", err)
+	}
+
+	queue := &deadLetterQueue{
+		receiver: receiver,
+	}
+	for len(queue.messages) < deadletterOpts.max {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(deadletterOpts.wait)*time.Second)
+		msg, err := receiver.Receive(ctx)
+		cancel()
+		if err == context.DeadlineExceeded {
+			break
+		}
+		if err != nil {
+			queue.close()
+			return nil, fmt.Errorf("error reading dead lettered event: %+v", err)
+		}
+		if msg == nil {
+			break
+		}
+		queue.messages = append(queue.messages, msg)
+	}
+	return queue, nil
+}
+
+// selected returns the messages chosen with `--message-id`, or all the messages with `--all`
+func (q *deadLetterQueue) selected() []*amqp.Message {
+	if deadletterOpts.all {
+		return append([]*amqp.Message{}, q.messages...)
+	}
+	ids := make(map[string]bool, len(deadletterOpts.messageIDs))
+	for _, id := range deadletterOpts.messageIDs {
+		ids[id] = true
+	}
+	selected := []*amqp.Message{}
+	for _, msg := range q.messages {
+		if ids[getMessageID(msg)] {
+			selected = append(selected, msg)
+		}
+	}
+	return selected
+}
+
+// accept removes the message from the dead letter queue
+func (q *deadLetterQueue) accept(msg *amqp.Message) {
+	msg.Accept()
+	for i, m := range q.messages {
+		if m == msg {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			break
+		}
+	}
+}
+
+// close releases the messages which haven't been accepted so they stay on the dead letter queue
+func (q *deadLetterQueue) close() {
+	for _, msg := range q.messages {
+		msg.Release()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(deadletterOpts.timeout)*time.Second)
+	q.receiver.Close(ctx) //nolint: errcheck
+	cancel()
+}
+
+// validateSelection checks the messages to act on have been chosen
+func validateSelection() error {
+	if !deadletterOpts.all && len(deadletterOpts.messageIDs) == 0 {
+		return fmt.Errorf("either --message-id or --all must be set")
+	}
+	return nil
+}
+
+func getMessageID(msg *amqp.Message) string {
+	if msg.Properties == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", msg.Properties.MessageID)
+}
+
+// getDeadLetterReason returns why the message was dead lettered
+func getDeadLetterReason(msg *amqp.Message) (string, string) {
+	reason, _ := msg.ApplicationProperties[messaging.DeadLetterReasonProperty].(string)
+	description, _ := msg.ApplicationProperties[messaging.DeadLetterDescriptionProperty].(string)
+	return reason, description
+}
+
+func init() {
+
+	// Persistent flags for the deadletter sub commands
+	deadletterCmd.PersistentFlags().StringVar(&deadletterOpts.subName, "sub-name", "", "the name of AQMP subscription whose dead letter queue to read from")
+	deadletterCmd.PersistentFlags().StringVar(&deadletterOpts.eventType, "event-type", "", "the event type name")
+	deadletterCmd.PersistentFlags().IntVar(&deadletterOpts.timeout, "timeout", 15, "timeout in seconds for a connection to the messaging bus")
+	deadletterCmd.PersistentFlags().IntVar(&deadletterOpts.wait, "wait", 5, "seconds to wait for another dead lettered event before stopping")
+	deadletterCmd.PersistentFlags().IntVar(&deadletterOpts.max, "max", 100, "the maximum number of dead lettered events to read")
+
+	// Mark required flags
+	deadletterCmd.MarkPersistentFlagRequired("sub-name")   //nolint: errcheck
+	deadletterCmd.MarkPersistentFlagRequired("event-type") //nolint: errcheck
+
+	// Add deadletter sub commands
+	deadletterCmd.AddCommand(deadletterListCmd)
+	deadletterCmd.AddCommand(deadletterShowCmd)
+	deadletterCmd.AddCommand(deadletterResubmitCmd)
+	deadletterCmd.AddCommand(deadletterPurgeCmd)
+}
@@ -0,0 +1,38 @@
+package event
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// deadletterListCmd represents the deadletter list command
+var deadletterListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list the events on a subscription's dead letter queue",
+	RunE:  DeadLetterList,
+}
+
+// DeadLetterList lists the dead lettered events with the reason they were dead lettered, it doesn't remove them
+func DeadLetterList(cmd *cobra.Command, args []string) error {
+	queue, err := receiveDeadLetters()
+	if err != nil {
+		return err
+	}
+	defer queue.close()
+
+	if len(queue.messages) == 0 {
+		fmt.Println("no dead lettered events")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MESSAGE ID\tREASON\tDESCRIPTION") //nolint: errcheck
+	for _, msg := range queue.messages {
+		reason, description := getDeadLetterReason(msg)
+		fmt.Fprintf(w, "%s\t%s\t%s\n", getMessageID(msg), reason, description) //nolint: errcheck
+	}
+	return w.Flush()
+}
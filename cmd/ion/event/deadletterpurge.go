@@ -0,0 +1,42 @@
+package event
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// deadletterPurgeCmd represents the deadletter purge command
+var deadletterPurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "permanently delete dead lettered events",
+	RunE:  DeadLetterPurge,
+}
+
+// DeadLetterPurge removes the selected events from the dead letter queue
+func DeadLetterPurge(cmd *cobra.Command, args []string) error {
+	if err := validateSelection(); err != nil {
+		return err
+	}
+
+	queue, err := receiveDeadLetters()
+	if err != nil {
+		return err
+	}
+	defer queue.close()
+
+	purged := 0
+	for _, msg := range queue.selected() {
+		queue.accept(msg)
+		purged++
+	}
+	fmt.Printf("purged %d dead lettered events\n", purged)
+	return nil
+}
+
+func init() {
+
+	// Local flags for the purge command
+	deadletterPurgeCmd.Flags().StringSliceVar(&deadletterOpts.messageIDs, "message-id", []string{}, "ids of the dead lettered events to purge")
+	deadletterPurgeCmd.Flags().BoolVar(&deadletterOpts.all, "all", false, "purge all the dead lettered events")
+}
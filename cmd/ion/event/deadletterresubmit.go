@@ -0,0 +1,85 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+	"github.com/spf13/cobra"
+	"github.com/twinj/uuid"
+	"pack.ag/amqp"
+)
+
+// deadletterResubmitCmd represents the deadletter resubmit command
+var deadletterResubmitCmd = &cobra.Command{
+	Use:   "resubmit",
+	Short: "resubmit dead lettered events to the topic they were originally published to",
+	RunE:  DeadLetterResubmit,
+}
+
+// DeadLetterResubmit publishes the selected dead lettered events again and removes them from the dead letter queue
+func DeadLetterResubmit(cmd *cobra.Command, args []string) error {
+	if err := validateSelection(); err != nil {
+		return err
+	}
+
+	queue, err := receiveDeadLetters()
+	if err != nil {
+		return err
+	}
+	defer queue.close()
+
+	sender, err := amqpSession.NewSender(
+		amqp.LinkTargetAddress(deadletterOpts.eventType),
+	)
+	if err != nil {
+		return fmt.Errorf("creating sender link: %+v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(deadletterOpts.timeout)*time.Second)
+		sender.Close(ctx) //nolint: errcheck
+		cancel()
+	}()
+
+	resubmitted := 0
+	for _, msg := range queue.selected() {
+		// Copy the event without the dead letter properties. The content type, which decodes
+		// CloudEvents binary mode events, is kept but the message gets a new id so the dispatcher
+		// doesn't confuse it with jobs run for the dead lettered message
+		resubmit := amqp.NewMessage(msg.GetData())
+		resubmit.Properties = &amqp.MessageProperties{}
+		if msg.Properties != nil {
+			*resubmit.Properties = *msg.Properties
+		}
+		resubmit.Properties.MessageID = uuid.NewV4().String()
+		resubmit.ApplicationProperties = map[string]interface{}{}
+		for key, value := range msg.ApplicationProperties {
+			if key == messaging.DeadLetterReasonProperty || key == messaging.DeadLetterDescriptionProperty {
+				continue
+			}
+			resubmit.ApplicationProperties[key] = value
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(deadletterOpts.timeout)*time.Second)
+		err := sender.Send(ctx, resubmit)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("error resubmitting event %s: %+v", getMessageID(msg), err)
+		}
+
+		// Remove the event from the dead letter queue now it's been resubmitted
+		queue.accept(msg)
+		resubmitted++
+		fmt.Printf("resubmitted %s\n", getMessageID(msg))
+	}
+	fmt.Printf("resubmitted %d dead lettered events\n", resubmitted)
+	return nil
+}
+
+func init() {
+
+	// Local flags for the resubmit command
+	deadletterResubmitCmd.Flags().StringSliceVar(&deadletterOpts.messageIDs, "message-id", []string{}, "ids of the dead lettered events to resubmit")
+	deadletterResubmitCmd.Flags().BoolVar(&deadletterOpts.all, "all", false, "resubmit all the dead lettered events")
+}
@@ -0,0 +1,62 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+// deadletterShowCmd represents the deadletter show command
+var deadletterShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "show dead lettered events, with the reason they were dead lettered",
+	RunE:  DeadLetterShow,
+}
+
+// DeadLetterShow prints the selected dead lettered events, it doesn't remove them
+func DeadLetterShow(cmd *cobra.Command, args []string) error {
+	if err := validateSelection(); err != nil {
+		return err
+	}
+
+	queue, err := receiveDeadLetters()
+	if err != nil {
+		return err
+	}
+	defer queue.close()
+
+	selected := queue.selected()
+	if len(selected) == 0 {
+		fmt.Println("no matching dead lettered events")
+		return nil
+	}
+
+	for _, msg := range selected {
+		reason, description := getDeadLetterReason(msg)
+		fmt.Printf("message id:  %s\n", getMessageID(msg))
+		fmt.Printf("reason:      %s\n", reason)
+		fmt.Printf("description: %s\n", description)
+
+		// Events dead lettered because they're malformed can't be decoded, so print them as they are
+		var event common.Event
+		if err := json.Unmarshal(msg.GetData(), &event); err != nil {
+			fmt.Printf("event (raw):\n%s\n\n", string(msg.GetData()))
+			continue
+		}
+		b, err := json.MarshalIndent(event, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error encoding event: %+v", err)
+		}
+		fmt.Printf("event:\n%s\n\n", string(b))
+	}
+	return nil
+}
+
+func init() {
+
+	// Local flags for the show command
+	deadletterShowCmd.Flags().StringSliceVar(&deadletterOpts.messageIDs, "message-id", []string{}, "ids of the dead lettered events to show")
+	deadletterShowCmd.Flags().BoolVar(&deadletterOpts.all, "all", false, "show all the dead lettered events")
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/lawrencegripper/ion/cmd/ion/event"
 	"github.com/lawrencegripper/ion/cmd/ion/module"
 	"github.com/lawrencegripper/ion/cmd/ion/root"
+	"github.com/lawrencegripper/ion/cmd/ion/schema"
 	"github.com/lawrencegripper/ion/cmd/ion/trace"
 )
 
@@ -15,6 +16,7 @@ func main() {
 	event.Register()
 	dev.Register()
 	trace.Register()
+	schema.Register()
 
 	// Execute root
 	root.Execute()
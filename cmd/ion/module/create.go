@@ -3,6 +3,8 @@ package module
 import (
 	"context"
 	"fmt"
+	"strings"
+
 	"github.com/lawrencegripper/ion/internal/pkg/management/module"
 
 	"github.com/joho/godotenv"
@@ -14,11 +16,20 @@ type createOptions struct {
 	name               string
 	eventSubscriptions string
 	eventPublications  string
+	subscriptionFilter string
+	join               bool
 	instanceCount      int32
 	retryCount         int32
 	configMapFilepath  string
 	moduleImage        string
 	handlerImage       string
+	serviceAccount     string
+	nodeSelector       []string
+	tolerations        []string
+	prepareResources   module.ContainerResources
+	workerResources    module.ContainerResources
+	commitResources    module.ContainerResources
+	retryPolicy        module.RetryPolicy
 }
 
 var createOpts createOptions
@@ -42,16 +53,34 @@ func Create(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	nodeSelector := make(map[string]string, len(createOpts.nodeSelector))
+	for _, pair := range createOpts.nodeSelector {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("invalid node selector '%s', expected key=value", pair)
+		}
+		nodeSelector[kv[0]] = kv[1]
+	}
+
 	createRequest := &module.ModuleCreateRequest{
 		Modulename:         createOpts.name,
 		Eventsubscriptions: createOpts.eventSubscriptions,
 		Eventpublications:  createOpts.eventPublications,
+		Subscriptionfilter: createOpts.subscriptionFilter,
+		Join:               createOpts.join,
 		Moduleimage:        createOpts.moduleImage,
 		Handlerimage:       createOpts.handlerImage,
 		Instancecount:      createOpts.instanceCount,
 		Retrycount:         createOpts.retryCount,
 		Provider:           createOpts.provider,
 		Configmap:          configMap,
+		Prepareresources:   &createOpts.prepareResources,
+		Workerresources:    &createOpts.workerResources,
+		Commitresources:    &createOpts.commitResources,
+		Nodeselector:       nodeSelector,
+		Tolerations:        createOpts.tolerations,
+		Serviceaccountname: createOpts.serviceAccount,
+		Retrypolicy:        &createOpts.retryPolicy,
 	}
 
 	fmt.Println("creating module")
@@ -69,12 +98,24 @@ func init() {
 	createCmd.Flags().StringVarP(&createOpts.name, "name", "n", "", "the module name")
 	createCmd.Flags().StringVarP(&createOpts.eventSubscriptions, "event-subscriptions", "i", "", "events to which the module subscribes")
 	createCmd.Flags().StringVarP(&createOpts.eventPublications, "event-publications", "o", "", "the events the module can publish")
+	createCmd.Flags().StringVar(&createOpts.subscriptionFilter, "subscription-filter", "", "conditions on event data, such as 'mime=video/*,confidence>0.8', an event must match to be dispatched to the module")
+	createCmd.Flags().BoolVar(&createOpts.join, "join", false, "run the module once an event of every subscribed type has arrived with the same correlation id")
 	createCmd.Flags().StringVarP(&createOpts.moduleImage, "module-image", "m", "", "the docker image for your module")
 	createCmd.Flags().StringVar(&createOpts.configMapFilepath, "config-map-file", "", "a .env file defining environment variables required by the module")
 	createCmd.Flags().StringVar(&createOpts.handlerImage, "handler-image", "dotjson/ion-handler", "the docker image for your module")
 	createCmd.Flags().StringVarP(&createOpts.provider, "provider", "p", "kubernetes", "provider for modules compute resouces (Kubernetes, AzureBatch)")
 	createCmd.Flags().Int32Var(&createOpts.instanceCount, "instance-count", 1, "the number of dispatcher instance to create")
 	createCmd.Flags().Int32Var(&createOpts.retryCount, "retry-count", 1, "the number of dispatcher instance to create")
+	createCmd.Flags().Int32Var(&createOpts.retryPolicy.Initialdelaysecs, "retry-initial-delay", 0, "seconds to wait before retrying a failed job, 0 retries immediately")
+	createCmd.Flags().Float64Var(&createOpts.retryPolicy.Multiplier, "retry-multiplier", 2, "multiplier applied to the retry delay after each failed attempt")
+	createCmd.Flags().Int32Var(&createOpts.retryPolicy.Maxdelaysecs, "retry-max-delay", 300, "max seconds to wait before retrying a failed job")
+	createCmd.Flags().Float64Var(&createOpts.retryPolicy.Jitter, "retry-jitter", 0.2, "fraction of the retry delay, between 0 and 1, randomly removed to spread out retries")
+	createCmd.Flags().StringVar(&createOpts.serviceAccount, "service-account", "", "the kubernetes service account the module's jobs run as")
+	createCmd.Flags().StringSliceVar(&createOpts.nodeSelector, "node-selector", []string{}, "node labels, as key=value, required to run the module's jobs")
+	createCmd.Flags().StringSliceVar(&createOpts.tolerations, "toleration", []string{}, "taints, as key[=value][:effect], the module's jobs tolerate")
+	addResourceFlags("prepare", &createOpts.prepareResources)
+	addResourceFlags("worker", &createOpts.workerResources)
+	addResourceFlags("commit", &createOpts.commitResources)
 
 	// Mark requried flags
 	createCmd.MarkFlagRequired("name")                //nolint: errcheck
@@ -82,3 +123,12 @@ func init() {
 	createCmd.MarkFlagRequired("event-publications")  //nolint: errcheck
 	createCmd.MarkFlagRequired("module-image")        //nolint: errcheck
 }
+
+// addResourceFlags adds flags to set the resources of one of the module's containers
+func addResourceFlags(container string, resources *module.ContainerResources) {
+	createCmd.Flags().StringVar(&resources.Cpurequest, container+"-cpu-request", "", "the cpu requested for the "+container+" container, for example 500m")
+	createCmd.Flags().StringVar(&resources.Cpulimit, container+"-cpu-limit", "", "the cpu limit of the "+container+" container")
+	createCmd.Flags().StringVar(&resources.Memoryrequest, container+"-memory-request", "", "the memory requested for the "+container+" container, for example 512Mi")
+	createCmd.Flags().StringVar(&resources.Memorylimit, container+"-memory-limit", "", "the memory limit of the "+container+" container")
+	createCmd.Flags().Int32Var(&resources.Gpu, container+"-gpu", 0, "the number of gpus for the "+container+" container")
+}
@@ -0,0 +1,45 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lawrencegripper/ion/internal/pkg/management/schema"
+	"github.com/spf13/cobra"
+)
+
+type deleteOptions struct {
+	eventType string
+}
+
+var deleteOpts deleteOptions
+
+// deleteCmd represents the delete command
+var deleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "delete the JSON schema for an event type, its events will no longer be validated",
+	RunE:  Delete,
+}
+
+// Delete the JSON schema for an event type
+func Delete(cmd *cobra.Command, args []string) error {
+	deleteRequest := &schema.SchemaDeleteRequest{
+		Eventtype: deleteOpts.eventType,
+	}
+
+	_, err := Client.Delete(context.Background(), deleteRequest)
+	if err != nil {
+		return fmt.Errorf("failed to delete schema: %+v", err)
+	}
+	fmt.Printf("deleted schema for event type %s\n", deleteOpts.eventType)
+	return nil
+}
+
+func init() {
+
+	// Local flags for the delete command
+	deleteCmd.Flags().StringVarP(&deleteOpts.eventType, "event-type", "e", "", "the event type")
+
+	// Mark required flags
+	deleteCmd.MarkFlagRequired("event-type") //nolint: errcheck
+}
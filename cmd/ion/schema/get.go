@@ -0,0 +1,45 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lawrencegripper/ion/internal/pkg/management/schema"
+	"github.com/spf13/cobra"
+)
+
+type getOptions struct {
+	eventType string
+}
+
+var getOpts getOptions
+
+// getCmd represents the get command
+var getCmd = &cobra.Command{
+	Use:   "get",
+	Short: "get the JSON schema registered for an event type",
+	RunE:  Get,
+}
+
+// Get prints the JSON schema for an event type
+func Get(cmd *cobra.Command, args []string) error {
+	getRequest := &schema.SchemaGetRequest{
+		Eventtype: getOpts.eventType,
+	}
+
+	getResponse, err := Client.Get(context.Background(), getRequest)
+	if err != nil {
+		return fmt.Errorf("failed to get schema: %+v", err)
+	}
+	fmt.Println(getResponse.Schema)
+	return nil
+}
+
+func init() {
+
+	// Local flags for the get command
+	getCmd.Flags().StringVarP(&getOpts.eventType, "event-type", "e", "", "the event type")
+
+	// Mark required flags
+	getCmd.MarkFlagRequired("event-type") //nolint: errcheck
+}
@@ -0,0 +1,30 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lawrencegripper/ion/internal/pkg/management/schema"
+	"github.com/spf13/cobra"
+)
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list the event types which have a JSON schema registered",
+	RunE:  List,
+}
+
+// List the event types with a registered schema
+func List(cmd *cobra.Command, args []string) error {
+	listResponse, err := Client.List(context.Background(), &schema.SchemaListRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to list schemas: %+v", err)
+	}
+	for _, eventType := range listResponse.Eventtypes {
+		fmt.Printf("%s\n", eventType)
+	}
+	return nil
+}
+
+func init() {}
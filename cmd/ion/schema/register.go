@@ -0,0 +1,55 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/lawrencegripper/ion/internal/pkg/management/schema"
+	"github.com/spf13/cobra"
+)
+
+type registerOptions struct {
+	eventType  string
+	schemaFile string
+}
+
+var registerOpts registerOptions
+
+// registerCmd represents the register command
+var registerCmd = &cobra.Command{
+	Use:   "register",
+	Short: "register the JSON schema for an event type, replacing its existing schema",
+	RunE:  RegisterSchema,
+}
+
+// RegisterSchema registers a JSON schema for an event type
+func RegisterSchema(cmd *cobra.Command, args []string) error {
+	document, err := ioutil.ReadFile(registerOpts.schemaFile)
+	if err != nil {
+		return fmt.Errorf("failed to read schema file %s: %+v", registerOpts.schemaFile, err)
+	}
+
+	registerRequest := &schema.SchemaRegisterRequest{
+		Eventtype: registerOpts.eventType,
+		Schema:    string(document),
+	}
+
+	_, err = Client.Register(context.Background(), registerRequest)
+	if err != nil {
+		return fmt.Errorf("failed to register schema: %+v", err)
+	}
+	fmt.Printf("registered schema for event type %s\n", registerOpts.eventType)
+	return nil
+}
+
+func init() {
+
+	// Local flags for the register command
+	registerCmd.Flags().StringVarP(&registerOpts.eventType, "event-type", "e", "", "the event type whose data the schema describes")
+	registerCmd.Flags().StringVarP(&registerOpts.schemaFile, "file", "f", "", "path to the JSON schema file")
+
+	// Mark required flags
+	registerCmd.MarkFlagRequired("event-type") //nolint: errcheck
+	registerCmd.MarkFlagRequired("file")       //nolint: errcheck
+}
@@ -0,0 +1,69 @@
+package schema
+
+import (
+	"fmt"
+	"github.com/lawrencegripper/ion/cmd/ion/root"
+	"github.com/lawrencegripper/ion/internal/pkg/management/schema"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"time"
+)
+
+//Client A shared GRPC schema server client
+var Client schema.SchemaServiceClient
+var managementEndpoint string
+var timeoutSec int
+
+// schemaCmd represents the schema command
+var schemaCmd = &cobra.Command{
+	Use:               "schema",
+	Short:             "execute commands to manage the JSON schemas events' data is validated against",
+	PersistentPreRunE: Setup,
+	Run:               Schema,
+}
+
+// Schema prints help
+func Schema(cmd *cobra.Command, args []string) {
+	cmd.Help() // nolint: errcheck
+}
+
+// Setup is called before Run and is used to setup any
+// persistent components needed by sub commands.
+func Setup(cmd *cobra.Command, args []string) error {
+
+	if cmd.HasSubCommands() {
+		return nil
+	}
+
+	// Initialize a global GRPC connection to the management server
+	conn, err := grpc.Dial(managementEndpoint,
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithTimeout(time.Duration(timeoutSec)*time.Second))
+
+	if err != nil {
+		return fmt.Errorf("failed to connect to server %s: %+v", managementEndpoint, err)
+	}
+	Client = schema.NewSchemaServiceClient(conn)
+	return nil
+}
+
+// Register adds to root command
+func Register() {
+
+	// Add schema sub commands
+	schemaCmd.AddCommand(registerCmd)
+	schemaCmd.AddCommand(deleteCmd)
+	schemaCmd.AddCommand(getCmd)
+	schemaCmd.AddCommand(listCmd)
+
+	// Add schema to root command
+	root.RootCmd.AddCommand(schemaCmd)
+}
+
+func init() {
+
+	// Local flags for the root command
+	schemaCmd.PersistentFlags().StringVar(&managementEndpoint, "endpoint", "localhost:9000", "management server endpoint")
+	schemaCmd.PersistentFlags().IntVar(&timeoutSec, "timeout", 30, "timeout in seconds for cli to connect to management server")
+}
@@ -0,0 +1,248 @@
+package join
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+)
+
+// Errors returned by a Store for an event which can't be added to its correlation's join,
+// adding an event which has already been recorded isn't an error so redeliveries are joined
+var (
+	ErrDuplicateEventType = errors.New("the join already has a different event of the type")
+	ErrJoinCompleted      = errors.New("the join has already been completed")
+)
+
+// Store records the events which have arrived for each correlation. Implementations must
+// be safe to share between dispatchers, a join is completed by exactly one of its events.
+type Store interface {
+	// Add records the event against its correlation and returns the IDs of the events
+	// recorded so far by event type. It returns ErrDuplicateEventType or ErrJoinCompleted
+	// when the event can't be added to the join.
+	Add(correlationID, eventType, eventID string) (map[string]string, error)
+	// Complete claims the join for the event, it returns false if the join has
+	// already been completed by another event
+	Complete(correlationID, eventID string) (bool, error)
+	Close()
+}
+
+// evictInterval is how often the in-memory store removes completed and expired joins
+const evictInterval = time.Duration(1) * time.Minute
+
+// Joiner holds a module's events until an event of every joined type has arrived with the
+// same correlation ID, the message which completes the join is dispatched with the IDs of
+// the other events so the handler can prepare the data from all of them
+type Joiner struct {
+	eventTypes []string
+	store      Store
+}
+
+// NewJoiner creates a joiner which waits for an event of each of the types
+func NewJoiner(eventTypes []string, store Store) (*Joiner, error) {
+	if len(eventTypes) < 2 {
+		return nil, fmt.Errorf("a join requires at least 2 event types, got %d", len(eventTypes))
+	}
+	if store == nil {
+		return nil, fmt.Errorf("a join requires a store")
+	}
+	return &Joiner{
+		eventTypes: eventTypes,
+		store:      store,
+	}, nil
+}
+
+// Join records the message's event. When it completes the join the message to dispatch is
+// returned with true, otherwise the module is waiting for more events and the message can
+// be accepted. Events which can't be joined return a *messaging.PoisonMessageError.
+func (j *Joiner) Join(message messaging.Message) (messaging.Message, bool, error) {
+	event, err := message.EventData()
+	if err != nil {
+		return nil, false, err
+	}
+	if event.Context == nil || event.Context.CorrelationID == "" || event.Context.EventID == "" {
+		return nil, false, &messaging.PoisonMessageError{
+			Reason: messaging.DeadLetterReasonInvalidEvent,
+			Err:    fmt.Errorf("an event must have a correlation ID and event ID to be joined"),
+		}
+	}
+	eventType, ok := j.joinedType(event.Type)
+	if !ok {
+		return nil, false, &messaging.PoisonMessageError{
+			Reason: messaging.DeadLetterReasonInvalidEvent,
+			Err:    fmt.Errorf("event type '%s' isn't one of the joined event types %s", event.Type, strings.Join(j.eventTypes, ",")),
+		}
+	}
+
+	events, err := j.store.Add(event.Context.CorrelationID, eventType, event.Context.EventID)
+	if err == ErrDuplicateEventType || err == ErrJoinCompleted {
+		return nil, false, &messaging.PoisonMessageError{
+			Reason: messaging.DeadLetterReasonInvalidEvent,
+			Err:    fmt.Errorf("event %s can't be joined with correlation %s: %v", event.Context.EventID, event.Context.CorrelationID, err),
+		}
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed recording event for join: %v", err)
+	}
+	var joinedEventIDs []string
+	for _, t := range j.eventTypes {
+		eventID, ok := events[t]
+		if !ok {
+			return nil, false, nil
+		}
+		if t != eventType {
+			joinedEventIDs = append(joinedEventIDs, eventID)
+		}
+	}
+
+	completed, err := j.store.Complete(event.Context.CorrelationID, event.Context.EventID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed completing join: %v", err)
+	}
+	if !completed {
+		return nil, false, nil
+	}
+	return &joinedMessage{Message: message, joinedEventIDs: joinedEventIDs}, true, nil
+}
+
+// Close closes the store
+func (j *Joiner) Close() {
+	j.store.Close()
+}
+
+// joinedType returns the event type as it's listed in the join
+func (j *Joiner) joinedType(eventType string) (string, bool) {
+	for _, t := range j.eventTypes {
+		if strings.EqualFold(t, eventType) {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+// joinedMessage adds the IDs of the events joined with the message to its event's context
+type joinedMessage struct {
+	messaging.Message
+	joinedEventIDs []string
+}
+
+// Unwrap returns the message which completed the join
+func (m *joinedMessage) Unwrap() messaging.Message {
+	return m.Message
+}
+
+// EventData returns the message's event with the IDs of the events joined with it
+func (m *joinedMessage) EventData() (common.Event, error) {
+	event, err := m.Message.EventData()
+	if err != nil {
+		return event, err
+	}
+	context := *event.Context
+	context.JoinedEventIDs = m.joinedEventIDs
+	event.Context = &context
+	return event, nil
+}
+
+// MemoryStore keeps joins in the dispatcher's process so they're lost when it restarts,
+// it's used when the dispatcher has no MongoDB to store them in. Completed joins are kept
+// for the retention, so a redelivery of the completing message is dispatched again, then
+// removed. Joins which aren't completed are removed once they're older than the expiry.
+type MemoryStore struct {
+	mu        sync.Mutex
+	joins     map[string]*memoryJoin
+	retention time.Duration
+	expiry    time.Duration
+	evictedAt time.Time
+	now       func() time.Time
+}
+
+type memoryJoin struct {
+	events      map[string]string
+	completedBy string
+	createdAt   time.Time
+	completedAt time.Time
+}
+
+//Check at compile time if we implement the interface
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty in-memory store, an expiry of 0 keeps joins which aren't
+// completed until the dispatcher restarts
+func NewMemoryStore(retention, expiry time.Duration) *MemoryStore {
+	return &MemoryStore{
+		joins:     map[string]*memoryJoin{},
+		retention: retention,
+		expiry:    expiry,
+		now:       time.Now,
+	}
+}
+
+// Add records the event against its correlation
+func (s *MemoryStore) Add(correlationID, eventType, eventID string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evict()
+
+	join, ok := s.joins[correlationID]
+	if !ok {
+		join = &memoryJoin{events: map[string]string{}, createdAt: s.now()}
+		s.joins[correlationID] = join
+	}
+	recorded, exists := join.events[eventType]
+	if exists && recorded != eventID {
+		return nil, ErrDuplicateEventType
+	}
+	if !exists && join.completedBy != "" {
+		return nil, ErrJoinCompleted
+	}
+	join.events[eventType] = eventID
+	events := make(map[string]string, len(join.events))
+	for t, id := range join.events {
+		events[t] = id
+	}
+	return events, nil
+}
+
+// Complete claims the join for the event
+func (s *MemoryStore) Complete(correlationID, eventID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	join, ok := s.joins[correlationID]
+	if !ok {
+		return false, fmt.Errorf("no join for correlation %s", correlationID)
+	}
+	if join.completedBy != "" && join.completedBy != eventID {
+		return false, nil
+	}
+	if join.completedBy == "" {
+		join.completedBy = eventID
+		join.completedAt = s.now()
+	}
+	return true, nil
+}
+
+// evict removes the completed joins older than the retention and the joins which have expired,
+// it checks the joins at most once every evictInterval
+func (s *MemoryStore) evict() {
+	now := s.now()
+	if now.Sub(s.evictedAt) < evictInterval {
+		return
+	}
+	s.evictedAt = now
+	for correlationID, join := range s.joins {
+		completed := join.completedBy != "" && now.Sub(join.completedAt) > s.retention
+		expired := s.expiry > 0 && now.Sub(join.createdAt) > s.expiry
+		if completed || expired {
+			delete(s.joins, correlationID)
+		}
+	}
+}
+
+// Close does nothing for the in-memory store
+func (s *MemoryStore) Close() {
+}
@@ -0,0 +1,147 @@
+package join
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+)
+
+type mockMessage struct {
+	event common.Event
+}
+
+func (m *mockMessage) ID() string                                  { return m.event.Context.EventID }
+func (m *mockMessage) DeliveryCount() int                          { return 1 }
+func (m *mockMessage) Body() []byte                                { return nil }
+func (m *mockMessage) Accept() error                               { return nil }
+func (m *mockMessage) Reject() error                               { return nil }
+func (m *mockMessage) DeadLetter(reason, description string) error { return nil }
+func (m *mockMessage) EventData() (common.Event, error)            { return m.event, nil }
+
+func newMessage(eventType, eventID, correlationID string) messaging.Message {
+	return &mockMessage{event: common.Event{
+		Type:    eventType,
+		Context: &common.Context{EventID: eventID, CorrelationID: correlationID},
+	}}
+}
+
+func TestJoinWaitsForEveryEventType(t *testing.T) {
+	joiner, err := NewJoiner([]string{"audio", "video", "subtitles"}, NewMemoryStore(time.Hour, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []messaging.Message{newMessage("audio", "a1", "c1"), newMessage("video", "v1", "c1"), newMessage("audio", "a2", "c2")} {
+		_, ready, err := joiner.Join(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ready {
+			t.Errorf("Expected message %s to wait for the rest of its join", m.ID())
+		}
+	}
+
+	joined, ready, err := joiner.Join(newMessage("SUBTITLES", "s1", "c1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ready {
+		t.Fatal("Expected the last event type to complete the join")
+	}
+	event, err := joined.EventData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"a1", "v1"}; !reflect.DeepEqual(event.Context.JoinedEventIDs, expected) {
+		t.Errorf("Joined event IDs incorrect Expected: %v Got: %v", expected, event.Context.JoinedEventIDs)
+	}
+	if event.Context.EventID != "s1" {
+		t.Errorf("Expected the completing event's context to be kept Got: %v", event.Context.EventID)
+	}
+}
+
+func TestJoinCompletedOnce(t *testing.T) {
+	joiner, err := NewJoiner([]string{"audio", "video"}, NewMemoryStore(time.Hour, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := joiner.Join(newMessage("audio", "a1", "c1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ready, _ := joiner.Join(newMessage("video", "v1", "c1")); !ready {
+		t.Fatal("Expected the join to complete")
+	}
+
+	// A redelivery of the completing message is dispatched again so a failed job is retried
+	if _, ready, _ := joiner.Join(newMessage("video", "v1", "c1")); !ready {
+		t.Error("Expected a redelivered completing message to be dispatched again")
+	}
+	// A redelivery of an event which was joined waits without dispatching a second job
+	if _, ready, err := joiner.Join(newMessage("audio", "a1", "c1")); ready || err != nil {
+		t.Errorf("Expected a redelivered joined message to wait Got: %t %v", ready, err)
+	}
+	// Another event arriving after the join completed can't be joined
+	_, ready, err := joiner.Join(newMessage("audio", "a2", "c1"))
+	if _, ok := err.(*messaging.PoisonMessageError); !ok || ready {
+		t.Errorf("Expected an event arriving after the join completed to be a poison message Got: %v", err)
+	}
+}
+
+func TestJoinRejectsDuplicateEventType(t *testing.T) {
+	joiner, err := NewJoiner([]string{"audio", "video"}, NewMemoryStore(time.Hour, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := joiner.Join(newMessage("audio", "a1", "c1")); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = joiner.Join(newMessage("audio", "a2", "c1"))
+	if _, ok := err.(*messaging.PoisonMessageError); !ok {
+		t.Errorf("Expected a second event of the same type to be a poison message Got: %v", err)
+	}
+	// The first event is still joined
+	joined, ready, err := joiner.Join(newMessage("video", "v1", "c1"))
+	if err != nil || !ready {
+		t.Fatalf("Expected the join to complete Got: %t %v", ready, err)
+	}
+	event, _ := joined.EventData()
+	if expected := []string{"a1"}; !reflect.DeepEqual(event.Context.JoinedEventIDs, expected) {
+		t.Errorf("Joined event IDs incorrect Expected: %v Got: %v", expected, event.Context.JoinedEventIDs)
+	}
+}
+
+func TestMemoryStoreEvictsJoins(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore(time.Hour, time.Hour*24)
+	store.now = func() time.Time { return now }
+
+	if _, err := store.Add("expired", "audio", "a1"); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Hour * 22)
+	for _, correlationID := range []string{"completed", "waiting"} {
+		if _, err := store.Add(correlationID, "audio", "a1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if completed, err := store.Complete("completed", "a1"); !completed || err != nil {
+		t.Fatalf("Expected the join to complete Got: %t %v", completed, err)
+	}
+
+	now = now.Add(time.Hour * 3)
+	if _, err := store.Add("new", "audio", "a1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.joins["completed"]; ok {
+		t.Error("Expected the completed join to be removed after the retention")
+	}
+	if _, ok := store.joins["expired"]; ok {
+		t.Error("Expected the join which wasn't completed to be removed after the expiry")
+	}
+	if _, ok := store.joins["waiting"]; !ok {
+		t.Error("Expected the join which hasn't expired to be kept")
+	}
+}
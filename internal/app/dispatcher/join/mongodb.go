@@ -0,0 +1,150 @@
+package join
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/documentstorage/mongodb"
+	mongo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// cSpell:ignore mongodb, bson, upsert
+
+// joinDocument is the events which have arrived for a correlation, keyed by event type
+type joinDocument struct {
+	Module        string                 `bson:"module"`
+	CorrelationID string                 `bson:"correlationId"`
+	Events        map[string]joinedEvent `bson:"events"`
+	CompletedBy   string                 `bson:"completedBy,omitempty"`
+	CreatedAt     time.Time              `bson:"createdAt"`
+}
+
+// joinedEvent keeps the event's type as its key in the join may have been escaped
+type joinedEvent struct {
+	Type    string `bson:"type"`
+	EventID string `bson:"eventId"`
+}
+
+// MongoDBStore keeps joins in a MongoDB collection so they're shared by the module's
+// dispatchers and survive restarts. Joins are keyed by module and correlation ID so modules
+// can share the collection. Joins are removed once they're older than the expiry, so the
+// events of a join which is never completed don't build up.
+type MongoDBStore struct {
+	db         *mongodb.MongoDB
+	moduleName string
+}
+
+//Check at compile time if we implement the interface
+var _ Store = (*MongoDBStore)(nil)
+
+// NewMongoDBStore connects to the collection and ensures its indexes, an expiry of 0 keeps joins forever
+func NewMongoDBStore(config *mongodb.Config, moduleName string, expiry time.Duration) (*MongoDBStore, error) {
+	db, err := mongodb.NewMongoDB(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed connecting to mongo: %+v", err)
+	}
+	err = db.Collection.EnsureIndex(mongo.Index{
+		Key:    []string{"module", "correlationId"},
+		Unique: true,
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed creating correlation index: %+v", err)
+	}
+	if expiry > 0 {
+		err = db.Collection.EnsureIndex(mongo.Index{
+			Key:         []string{"createdAt"},
+			ExpireAfter: expiry,
+		})
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed creating expiry index: %+v", err)
+		}
+	}
+	return &MongoDBStore{db: db, moduleName: moduleName}, nil
+}
+
+// Add records the event against its correlation, creating the join if it's the first event.
+// The join is only updated when it doesn't have an event of the type and isn't completed, or
+// it already has the event, otherwise the upsert inserts a duplicate which the index rejects.
+func (s *MongoDBStore) Add(correlationID, eventType, eventID string) (map[string]string, error) {
+	key := "events." + eventTypeKey(eventType)
+	change := mongo.Change{
+		Update: bson.M{
+			"$set":         bson.M{key: joinedEvent{Type: eventType, EventID: eventID}},
+			"$setOnInsert": bson.M{"createdAt": time.Now().UTC()},
+		},
+		Upsert:    true,
+		ReturnNew: true,
+	}
+	query := s.join(correlationID)
+	query["$or"] = []bson.M{
+		{key + ".eventId": eventID},
+		{key: bson.M{"$exists": false}, "completedBy": bson.M{"$exists": false}},
+	}
+	document := joinDocument{}
+	_, err := s.db.Collection.Find(query).Apply(change, &document)
+	if mongo.IsDup(err) {
+		// Another dispatcher created the join at the same time, it now exists so update it
+		_, err = s.db.Collection.Find(query).Apply(change, &document)
+	}
+	if mongo.IsDup(err) {
+		return nil, s.rejected(correlationID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(map[string]string, len(document.Events))
+	for _, event := range document.Events {
+		events[event.Type] = event.EventID
+	}
+	return events, nil
+}
+
+// Complete claims the join for the event unless another event has already completed it
+func (s *MongoDBStore) Complete(correlationID, eventID string) (bool, error) {
+	change := mongo.Change{
+		Update: bson.M{"$set": bson.M{"completedBy": eventID}},
+	}
+	query := s.join(correlationID)
+	query["$or"] = []bson.M{
+		{"completedBy": bson.M{"$exists": false}},
+		{"completedBy": eventID},
+	}
+	_, err := s.db.Collection.Find(query).Apply(change, nil)
+	if err == mongo.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Close closes the connection to MongoDB
+func (s *MongoDBStore) Close() {
+	s.db.Close()
+}
+
+// join returns the query for the module's join of the correlation
+func (s *MongoDBStore) join(correlationID string) bson.M {
+	return bson.M{"module": s.moduleName, "correlationId": correlationID}
+}
+
+// rejected returns why an event couldn't be added to the join
+func (s *MongoDBStore) rejected(correlationID string) error {
+	document := joinDocument{}
+	err := s.db.Collection.Find(s.join(correlationID)).One(&document)
+	if err != nil {
+		return fmt.Errorf("failed reading join: %+v", err)
+	}
+	if document.CompletedBy != "" {
+		return ErrJoinCompleted
+	}
+	return ErrDuplicateEventType
+}
+
+// eventTypeKey returns the event type as a field name, MongoDB doesn't allow '.' or a leading '$'
+func eventTypeKey(eventType string) string {
+	return strings.NewReplacer(".", "_", "$", "_").Replace(eventType)
+}
@@ -1,7 +1,6 @@
 package providers
 
 import (
-	"github.com/Azure/azure-sdk-for-go/services/servicebus/mgmt/2017-04-01/servicebus"
 	"github.com/joho/godotenv"
 	"github.com/lawrencegripper/ion/internal/pkg/common"
 	"github.com/lawrencegripper/ion/internal/pkg/messaging"
@@ -10,29 +9,66 @@ import (
 
 	"os"
 	"strconv"
+	"strings"
 )
 
-// GetSharedHandlerArgs gets the shared arguments used by the handler container
-func GetSharedHandlerArgs(c *types.Configuration, sbKeys servicebus.AccessKeys) []string {
-	return []string{
+const (
+	// AzureBlobProviderName configures the handler to store blobs in Azure Blob Storage
+	AzureBlobProviderName = "azureblob"
+	// S3BlobProviderName configures the handler to store blobs in an S3 compatible store
+	S3BlobProviderName = "s3"
+)
+
+// eventTypeEnvVar tells the module which of the events it subscribes to triggered the job
+const eventTypeEnvVar = "ION_EVENT_TYPE"
+
+// GetSharedHandlerArgs gets the shared arguments used by the handler container,
+// `eventProviderArgs` configure the handler to publish events to the dispatcher's broker
+func GetSharedHandlerArgs(c *types.Configuration, eventProviderArgs []string) []string {
+	args := []string{
 		"start",
 		"--context.name=" + c.ModuleName,
-		"--azureblobprovider.enabled=true",
-		"--azureblobprovider.blobaccountname=" + c.Handler.AzureBlobStorageProvider.BlobAccountName,
-		"--azureblobprovider.blobaccountkey=" + c.Handler.AzureBlobStorageProvider.BlobAccountKey,
 		"--mongodbdocprovider.enabled=true",
 		"--mongodbdocprovider.collection=" + c.Handler.MongoDBDocumentStorageProvider.Collection,
 		"--mongodbdocprovider.name=" + c.Handler.MongoDBDocumentStorageProvider.Name,
 		"--mongodbdocprovider.password=" + c.Handler.MongoDBDocumentStorageProvider.Password,
 		"--mongodbdocprovider.port=" + strconv.Itoa(c.Handler.MongoDBDocumentStorageProvider.Port),
-		"--servicebuseventprovider.enabled=true",
-		"--servicebuseventprovider.namespace=" + c.ServiceBusNamespace,
-		"--servicebuseventprovider.topic=" + c.SubscribesToEvent,
-		"--servicebuseventprovider.key=" + *sbKeys.PrimaryKey,
-		"--servicebuseventprovider.authorizationrulename=" + *sbKeys.KeyName,
 		"--loglevel=" + c.LogLevel,
 		"--printconfig=" + strconv.FormatBool(c.Handler.PrintConfig),
 		"--valideventtypes=" + c.EventsPublished,
+		"--eventencoding=" + c.EventEncoding,
+	}
+	if c.Handler.MongoDBDocumentStorageProvider.ConnectionString != "" {
+		args = append(args, "--mongodbdocprovider.connectionstring="+c.Handler.MongoDBDocumentStorageProvider.ConnectionString)
+	}
+	args = append(args, getBlobProviderArgs(c.Handler)...)
+	if c.Handler.BlobParallelism > 0 {
+		args = append(args, "--blobparallelism="+strconv.Itoa(c.Handler.BlobParallelism))
+	}
+	if c.Handler.SchemaRegistryEndpoint != "" {
+		args = append(args, "--schemaregistryendpoint="+c.Handler.SchemaRegistryEndpoint)
+	}
+	return append(args, eventProviderArgs...)
+}
+
+// getBlobProviderArgs configures the handler's blob provider, Azure Blob Storage is used unless S3 is selected
+func getBlobProviderArgs(c *types.HandlerConfig) []string {
+	if c.BlobProvider == S3BlobProviderName {
+		s3 := c.S3BlobStorageProvider
+		return []string{
+			"--s3blobprovider.enabled=true",
+			"--s3blobprovider.endpoint=" + s3.Endpoint,
+			"--s3blobprovider.accesskeyid=" + s3.AccessKeyID,
+			"--s3blobprovider.secretaccesskey=" + s3.SecretAccessKey,
+			"--s3blobprovider.bucket=" + s3.Bucket,
+			"--s3blobprovider.region=" + s3.Region,
+			"--s3blobprovider.usessl=" + strconv.FormatBool(s3.UseSSL),
+		}
+	}
+	return []string{
+		"--azureblobprovider.enabled=true",
+		"--azureblobprovider.blobaccountname=" + c.AzureBlobStorageProvider.BlobAccountName,
+		"--azureblobprovider.blobaccountkey=" + c.AzureBlobStorageProvider.BlobAccountKey,
 	}
 }
 
@@ -46,12 +82,16 @@ func getMessageHandlerArgs(m messaging.Message) ([]string, error) {
 		context = &common.Context{} // Use type defaults if no context
 	}
 	log.WithField("correlationid", context.CorrelationID).Debug("generating handler args for message")
-	return []string{
+	args := []string{
 		"--azureblobprovider.containername=" + context.CorrelationID,
 		"--context.eventid=" + context.EventID,
 		"--context.correlationid=" + context.CorrelationID,
 		"--context.parenteventid=" + context.ParentEventID,
-	}, nil
+	}
+	if len(context.JoinedEventIDs) > 0 {
+		args = append(args, "--context.joinedeventids="+strings.Join(context.JoinedEventIDs, ","))
+	}
+	return args, nil
 }
 
 func getModuleEnvironmentVars(configLocation string) (map[string]string, error) {
@@ -1,7 +1,10 @@
 package providers
 
 import (
+	"strings"
 	"testing"
+
+	"github.com/lawrencegripper/ion/internal/pkg/types"
 )
 
 func TestGetEnvVaraibles(t *testing.T) {
@@ -32,3 +35,52 @@ func TestGetEnvVaraibles_MissingFile(t *testing.T) {
 	}
 	t.Log(err)
 }
+
+func TestGetSharedHandlerArgs_BlobProvider(t *testing.T) {
+	c := &types.Configuration{
+		Handler: &types.HandlerConfig{
+			AzureBlobStorageProvider: &types.AzureBlobConfig{BlobAccountName: "account"},
+			S3BlobStorageProvider: &types.S3BlobConfig{
+				Endpoint: "minio:9000",
+				Bucket:   "ion",
+			},
+			MongoDBDocumentStorageProvider: &types.MongoDBConfig{},
+		},
+	}
+
+	args := strings.Join(GetSharedHandlerArgs(c, nil), " ")
+	if !strings.Contains(args, "--azureblobprovider.enabled=true") || strings.Contains(args, "--s3blobprovider") {
+		t.Errorf("Expected azure blob storage by default Got: %s", args)
+	}
+
+	c.Handler.BlobProvider = S3BlobProviderName
+	args = strings.Join(GetSharedHandlerArgs(c, nil), " ")
+	for _, expected := range []string{"--s3blobprovider.enabled=true", "--s3blobprovider.endpoint=minio:9000", "--s3blobprovider.bucket=ion", "--s3blobprovider.usessl=false"} {
+		if !strings.Contains(args, expected) {
+			t.Errorf("Expected %s Got: %s", expected, args)
+		}
+	}
+	if strings.Contains(args, "--azureblobprovider.enabled") {
+		t.Errorf("Expected azure blob storage not to be enabled Got: %s", args)
+	}
+}
+
+func TestGetSharedHandlerArgs_MongoDBConnectionString(t *testing.T) {
+	c := &types.Configuration{
+		Handler: &types.HandlerConfig{
+			AzureBlobStorageProvider:       &types.AzureBlobConfig{},
+			MongoDBDocumentStorageProvider: &types.MongoDBConfig{Name: "ion"},
+		},
+	}
+
+	args := strings.Join(GetSharedHandlerArgs(c, nil), " ")
+	if strings.Contains(args, "--mongodbdocprovider.connectionstring") {
+		t.Errorf("Expected no connection string for Cosmos DB Got: %s", args)
+	}
+
+	c.Handler.MongoDBDocumentStorageProvider.ConnectionString = "mongodb://mongo:27017/ion"
+	args = strings.Join(GetSharedHandlerArgs(c, nil), " ")
+	if !strings.Contains(args, "--mongodbdocprovider.connectionstring=mongodb://mongo:27017/ion") {
+		t.Errorf("Expected the connection string Got: %s", args)
+	}
+}
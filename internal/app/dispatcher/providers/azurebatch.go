@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Azure/go-autorest/autorest/azure"
 
@@ -17,16 +18,63 @@ import (
 	"github.com/lawrencegripper/ion/internal/pkg/types"
 	"github.com/lawrencegripper/pod2docker"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
 	apiv1 "k8s.io/api/core/v1"
 	v1resource "k8s.io/apimachinery/pkg/api/resource"
 )
 
 //Check providers match interface at compile time
 var _ Provider = &AzureBatch{}
+var _ Recoverer = &AzureBatch{}
+
+// Environment settings added to each task so the source message can be recovered after a restart
+const (
+	messageIDTaskSetting     = "ION_MESSAGE_ID"
+	deliveryCountTaskSetting = "ION_DELIVERY_COUNT"
+)
+
+func init() {
+	Register(Registration{
+		Name: AzureBatchProviderName,
+		AddFlags: func(flags *pflag.FlagSet) {
+			flags.Bool("azurebatch.requiresgpu", false, "Module requries gpu")
+			flags.String("azurebatch.resourcegroup", "", "")
+			flags.String("azurebatch.poolid", "", "")
+			flags.String("azurebatch.jobid", "", "")
+			flags.String("azurebatch.batchaccountname", "", "")
+			flags.String("azurebatch.batchaccountlocation", "", "")
+			flags.String("azurebatch.imagerepositoryserver", "", "")
+			flags.String("azurebatch.imagerepositoryusername", "", "")
+			flags.String("azurebatch.imagerepositorypassword", "", "")
+		},
+		Configure: func(config *types.Configuration, settings Settings) error {
+			config.AzureBatch = &types.AzureBatchConfig{
+				RequiresGPU:             settings.GetBool("azurebatch.requiresgpu"),
+				ResourceGroup:           settings.GetString("azurebatch.resourcegroup"),
+				PoolID:                  settings.GetString("azurebatch.poolid"),
+				JobID:                   settings.GetString("azurebatch.jobid"),
+				BatchAccountName:        settings.GetString("azurebatch.batchaccountname"),
+				BatchAccountLocation:    settings.GetString("azurebatch.batchaccountlocation"),
+				ImageRepositoryServer:   settings.GetString("azurebatch.imagerepositoryserver"),
+				ImageRepositoryUsername: settings.GetString("azurebatch.imagerepositoryusername"),
+				ImageRepositoryPassword: settings.GetString("azurebatch.imagerepositorypassword"),
+			}
+			return nil
+		},
+		New: func(config *types.Configuration, sharedHandlerArgs []string) (Provider, error) {
+			p, err := NewAzureBatchProvider(config, sharedHandlerArgs)
+			if err != nil {
+				return nil, err
+			}
+			return p, nil
+		},
+	})
+}
 
 // AzureBatch schedules jobs onto k8s from the queue and monitors their progress
 type AzureBatch struct {
-	inprogressJobStore map[string]messaging.Message
+	inprogressJobStore *InflightStore
+	recoveredJobs      *recoveredJobStore
 	jobID              string
 	handlerArgs        []string
 	workerEnvVars      map[string]interface{}
@@ -55,10 +103,11 @@ func NewAzureBatchProvider(config *types.Configuration, sharedHandlerArgs []stri
 	}
 	b := AzureBatch{}
 	b.handlerArgs = sharedHandlerArgs
-	b.inprogressJobStore = make(map[string]messaging.Message)
+	b.inprogressJobStore = NewInflightStore()
+	b.recoveredJobs = newRecoveredJobStore()
 	b.batchConfig = config.AzureBatch
 	b.jobConfig = config.Job
-	b.jobID = config.Hostname + "-" + config.ModuleName
+	b.jobID = config.DispatcherName()
 	b.workerEnvVars = make(map[string]interface{})
 	ctx, cancel := context.WithCancel(context.Background())
 	b.ctx = ctx
@@ -142,16 +191,12 @@ func NewAzureBatchProvider(config *types.Configuration, sharedHandlerArgs []stri
 
 //GetActiveMessages gets the currently active messages
 func (b *AzureBatch) GetActiveMessages() []messaging.Message {
-	activeMessages := make([]messaging.Message, 0, len(b.inprogressJobStore))
-	for _, m := range b.inprogressJobStore {
-		activeMessages = append(activeMessages, m)
-	}
-	return activeMessages
+	return b.inprogressJobStore.Messages()
 }
 
 // InProgressCount will show how many tasks are currently in progress
 func (b *AzureBatch) InProgressCount() int {
-	return len(b.inprogressJobStore)
+	return b.inprogressJobStore.Count()
 }
 
 // Dispatch will dispatch a job onto Azure Batch
@@ -163,6 +208,22 @@ func (b *AzureBatch) Dispatch(message messaging.Message) error {
 		return fmt.Errorf("invalid properties. Provider cannot be nil")
 	}
 
+	// Adopt the task from before a restart, if there was one, rather than running the message twice
+	if recovered, ok := b.recoveredJobs.claim(message.ID()); ok {
+		contextualLogger := log.WithField("task", recovered.name).WithField("messageID", message.ID())
+		if !recovered.failed {
+			contextualLogger.Info("adopting task created before dispatcher restart")
+			b.inprogressJobStore.Add(message)
+			return nil
+		}
+		// Task IDs are the message ID so the failed task must be removed before it's replaced
+		contextualLogger.Info("task created before dispatcher restart failed, dispatching a new task")
+		_, err := b.removeTask(&batch.CloudTask{ID: to.StringPtr(recovered.name)})
+		if err != nil {
+			contextualLogger.WithError(err).Error("failed to remove recovered task from batch")
+		}
+	}
+
 	perJobArgs, err := getMessageHandlerArgs(message)
 	if err != nil {
 		return fmt.Errorf("failed generating handler args from message: %v", err)
@@ -171,6 +232,10 @@ func (b *AzureBatch) Dispatch(message messaging.Message) error {
 	//Prevent later append calls overwriting original backing array: https://stackoverflow.com/a/40036950/3437018
 	fullHandlerArgs = fullHandlerArgs[:len(fullHandlerArgs):len(fullHandlerArgs)]
 
+	eventData, err := message.EventData()
+	if err != nil {
+		return fmt.Errorf("failed getting event data from message: %v", err)
+	}
 	workerEnvVars := []apiv1.EnvVar{
 		{
 			Name:  "SHARED_SECRET",
@@ -184,6 +249,10 @@ func (b *AzureBatch) Dispatch(message messaging.Message) error {
 		}
 		workerEnvVars = append(workerEnvVars, envVar)
 	}
+	workerEnvVars = append(workerEnvVars, apiv1.EnvVar{
+		Name:  eventTypeEnvVar,
+		Value: eventData.Type,
+	})
 
 	pullPolicy := apiv1.PullIfNotPresent
 	if b.jobConfig.PullAlways {
@@ -277,6 +346,16 @@ func (b *AzureBatch) Dispatch(message messaging.Message) error {
 		Constraints: &batch.TaskConstraints{
 			MaxWallClockTime: to.StringPtr(fmt.Sprintf("PT%dM", b.jobConfig.MaxRunningTimeMins)),
 		},
+		EnvironmentSettings: &[]batch.EnvironmentSetting{
+			{
+				Name:  to.StringPtr(messageIDTaskSetting),
+				Value: to.StringPtr(message.ID()),
+			},
+			{
+				Name:  to.StringPtr(deliveryCountTaskSetting),
+				Value: to.StringPtr(strconv.Itoa(message.DeliveryCount())),
+			},
+		},
 		UserIdentity: &batch.UserIdentity{
 			AutoUser: &batch.AutoUserSpecification{
 				ElevationLevel: batch.Admin,
@@ -294,11 +373,68 @@ func (b *AzureBatch) Dispatch(message messaging.Message) error {
 		return err
 	}
 
-	b.inprogressJobStore[message.ID()] = message
+	b.inprogressJobStore.Add(message)
 
 	return nil
 }
 
+// Recover rebuilds the in-flight state from the tasks this dispatcher created before it restarted
+func (b *AzureBatch) Recover() error {
+	if b == nil {
+		return fmt.Errorf("invalid properties. Provider cannot be nil")
+	}
+	tasks, err := b.listTasks()
+	if err != nil {
+		return err
+	}
+	if tasks == nil {
+		return fmt.Errorf("task list returned nil")
+	}
+
+	now := time.Now()
+	for _, t := range *tasks {
+		if t.ID == nil {
+			log.WithField("task", t).Error("task seen with nil id... skipping recovery")
+			continue
+		}
+		contextualLogger := log.WithFields(logFieldsForTask(&t))
+
+		// Tasks are created with the message ID as their ID, prefer the setting in case that changes
+		messageID := *t.ID
+		deliveryCount := 0
+		if t.EnvironmentSettings != nil {
+			for _, setting := range *t.EnvironmentSettings {
+				if setting.Name == nil || setting.Value == nil {
+					continue
+				}
+				switch *setting.Name {
+				case messageIDTaskSetting:
+					messageID = *setting.Value
+				case deliveryCountTaskSetting:
+					deliveryCount, err = strconv.Atoi(*setting.Value)
+					if err != nil {
+						contextualLogger.WithError(err).Warning("task seen with invalid delivery count setting")
+					}
+				}
+			}
+		}
+
+		failed := t.State == batch.TaskStateCompleted &&
+			(t.ExecutionInfo == nil || t.ExecutionInfo.ExitCode == nil || *t.ExecutionInfo.ExitCode != 0)
+
+		b.recoveredJobs.add(messageID, recoveredJob{
+			name:          *t.ID,
+			deliveryCount: deliveryCount,
+			failed:        failed,
+			recoveredAt:   now,
+		})
+		contextualLogger.WithField("messageID", messageID).WithField("failed", failed).Info("recovered task created before dispatcher restart")
+	}
+
+	log.WithField("recoveredJobs", b.recoveredJobs.count()).Info("recovered in-flight state from azure batch")
+	return nil
+}
+
 // Reconcile will check inprogress tasks against and accept/reject messages were the job has completed/failed
 func (b *AzureBatch) Reconcile() error {
 	if b == nil {
@@ -322,8 +458,17 @@ func (b *AzureBatch) Reconcile() error {
 		messageID := *messageIDPtr
 		contextualLogger := log.WithFields(logFieldsForTask(&t)).WithField("messageID", messageID)
 
-		sourceMessage, ok := b.inprogressJobStore[messageID]
+		sourceMessage, ok := b.inprogressJobStore.Get(messageID)
 		if !ok {
+			// Was it recovered after a restart and its message never redelivered?
+			if _, expired := b.recoveredJobs.expire(messageID, *t.ID, time.Now()); expired {
+				contextualLogger.Warning("cancelling task recovered after dispatcher restart as its message wasn't redelivered")
+				_, err = b.removeTask(&t)
+				if err != nil {
+					contextualLogger.WithError(err).Error("failed to cancel recovered task in batch")
+				}
+				continue
+			}
 			contextualLogger.Info("job seen which dispatcher stared but doesn't have source message... likely following a dispatcher restart")
 			continue
 		}
@@ -359,7 +504,7 @@ func (b *AzureBatch) Reconcile() error {
 				}
 
 				//Remove the message from the inflight message store
-				delete(b.inprogressJobStore, messageID)
+				b.inprogressJobStore.Remove(messageID)
 				continue
 			} else {
 				//Task has failed!
@@ -392,7 +537,7 @@ func (b *AzureBatch) Reconcile() error {
 				}
 
 				//Remove the message from the inflight message store
-				delete(b.inprogressJobStore, messageID)
+				b.inprogressJobStore.Remove(messageID)
 				continue
 			}
 		}
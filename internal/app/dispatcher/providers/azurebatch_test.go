@@ -4,12 +4,12 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/to"
 
 	"github.com/Azure/azure-sdk-for-go/services/batch/2017-09-01.6.0/batch"
-	"github.com/lawrencegripper/ion/internal/pkg/messaging"
 	"github.com/lawrencegripper/ion/internal/pkg/types"
 )
 
@@ -27,7 +27,8 @@ func NewMockAzureBatchProvider(createTask func(taskDetails batch.TaskAddParamete
 	}
 	b.jobID = mockDispatcherName
 
-	b.inprogressJobStore = map[string]messaging.Message{}
+	b.inprogressJobStore = NewInflightStore()
+	b.recoveredJobs = newRecoveredJobStore()
 	b.createTask = createTask
 	b.listTasks = listTasks
 	b.removeTask = func(t *batch.CloudTask) (autorest.Response, error) {
@@ -321,3 +322,149 @@ func TestAzureBatchReconcileJobFailed(t *testing.T) {
 		t.Error("Reconcile should remove jobs from the inmemory store once it has accepted or rejected them")
 	}
 }
+
+func TestAzureBatchRecoverAdoptsRunningTask(t *testing.T) {
+	inMemMockTaskStore := []batch.CloudTask{
+		{
+			ID:    to.StringPtr(mockMessageID),
+			State: batch.TaskStateRunning,
+			EnvironmentSettings: &[]batch.EnvironmentSetting{
+				{Name: to.StringPtr(messageIDTaskSetting), Value: to.StringPtr(mockMessageID)},
+				{Name: to.StringPtr(deliveryCountTaskSetting), Value: to.StringPtr("1")},
+			},
+		},
+	}
+
+	create := func(taskDetails batch.TaskAddParameter) (autorest.Response, error) {
+		t.Error("Expected running task to be adopted not recreated")
+		return autorest.Response{}, nil
+	}
+
+	list := func() (*[]batch.CloudTask, error) {
+		return &inMemMockTaskStore, nil
+	}
+
+	b, _ := NewMockAzureBatchProvider(create, list)
+
+	err := b.Recover()
+	if err != nil {
+		t.Error(err)
+	}
+
+	wasAccepted := false
+	err = b.Dispatch(MockMessage{
+		MessageID:          mockMessageID,
+		DeliveryCountValue: 2,
+		Accepted: func() {
+			wasAccepted = true
+		},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	task := &inMemMockTaskStore[0]
+	task.State = batch.TaskStateCompleted
+	task.ExecutionInfo = &batch.TaskExecutionInformation{
+		ExitCode: to.Int32Ptr(0),
+	}
+	err = b.Reconcile()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !wasAccepted {
+		t.Error("Expected redelivered message to be accepted when adopted task completed")
+	}
+}
+
+func TestAzureBatchRecoverReplacesFailedTask(t *testing.T) {
+	inMemMockTaskStore := []batch.CloudTask{
+		{
+			ID:    to.StringPtr(mockMessageID),
+			State: batch.TaskStateCompleted,
+			ExecutionInfo: &batch.TaskExecutionInformation{
+				ExitCode: to.Int32Ptr(1),
+			},
+		},
+	}
+
+	created := 0
+	create := func(taskDetails batch.TaskAddParameter) (autorest.Response, error) {
+		created++
+		return autorest.Response{}, nil
+	}
+
+	list := func() (*[]batch.CloudTask, error) {
+		return &inMemMockTaskStore, nil
+	}
+
+	b, _ := NewMockAzureBatchProvider(create, list)
+
+	removed := []string{}
+	b.removeTask = func(t *batch.CloudTask) (autorest.Response, error) {
+		removed = append(removed, *t.ID)
+		return autorest.Response{}, nil
+	}
+
+	err := b.Recover()
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = b.Dispatch(MockMessage{
+		MessageID:          mockMessageID,
+		DeliveryCountValue: 2,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(removed) != 1 || removed[0] != mockMessageID {
+		t.Errorf("Expected failed task to be removed before being replaced Got: %v", removed)
+	}
+	if created != 1 {
+		t.Errorf("Expected a new task to be created Got: %v", created)
+	}
+}
+
+func TestAzureBatchRecoverCancelsUnclaimedTask(t *testing.T) {
+	inMemMockTaskStore := []batch.CloudTask{
+		{
+			ID:    to.StringPtr(mockMessageID),
+			State: batch.TaskStateRunning,
+		},
+	}
+
+	list := func() (*[]batch.CloudTask, error) {
+		return &inMemMockTaskStore, nil
+	}
+
+	b, _ := NewMockAzureBatchProvider(nil, list)
+
+	removed := []string{}
+	b.removeTask = func(t *batch.CloudTask) (autorest.Response, error) {
+		removed = append(removed, *t.ID)
+		return autorest.Response{}, nil
+	}
+
+	err := b.Recover()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Simulate the timeout passing without the message being redelivered
+	b.recoveredJobs.add(mockMessageID, recoveredJob{
+		name:        mockMessageID,
+		recoveredAt: time.Now().Add(-recoveryClaimTimeout),
+	})
+
+	err = b.Reconcile()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(removed) != 1 {
+		t.Errorf("Expected unclaimed task to be cancelled Got: %v", removed)
+	}
+}
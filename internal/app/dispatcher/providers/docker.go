@@ -0,0 +1,447 @@
+package providers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+	"github.com/lawrencegripper/ion/internal/pkg/types"
+	"github.com/lawrencegripper/pod2docker"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+const podScriptName = "pod.sh"
+
+//Check providers match interface at compile time
+var _ Provider = &Docker{}
+
+func init() {
+	Register(Registration{
+		Name: DockerProviderName,
+		AddFlags: func(flags *pflag.FlagSet) {
+			flags.String("docker.workingdir", "", "Directory used to store pod scripts and logs")
+			flags.String("docker.imagerepositoryserver", "", "")
+			flags.String("docker.imagerepositoryusername", "", "")
+			flags.String("docker.imagerepositorypassword", "", "")
+		},
+		Configure: func(config *types.Configuration, settings Settings) error {
+			config.Docker = &types.DockerConfig{
+				WorkingDir:              settings.GetString("docker.workingdir"),
+				ImageRepositoryServer:   settings.GetString("docker.imagerepositoryserver"),
+				ImageRepositoryUsername: settings.GetString("docker.imagerepositoryusername"),
+				ImageRepositoryPassword: settings.GetString("docker.imagerepositorypassword"),
+			}
+			return nil
+		},
+		New: func(config *types.Configuration, sharedHandlerArgs []string) (Provider, error) {
+			p, err := NewDockerProvider(config, sharedHandlerArgs)
+			if err != nil {
+				return nil, err
+			}
+			return p, nil
+		},
+	})
+}
+
+// Docker schedules jobs as containers on the local docker host and monitors their progress
+type Docker struct {
+	inflightJobStore *InflightStore
+	pods             map[string]*dockerPod
+	podsMu           sync.Mutex
+	moduleName       string
+	workingDir       string
+	handlerArgs      []string
+	workerEnvVars    map[string]interface{}
+	logStore         *LogStore
+
+	jobConfig    *types.JobConfig
+	dockerConfig *types.DockerConfig
+
+	// Used to allow mocking of the docker host for testing
+	runPod    func(pod *dockerPod, podCommand string) error
+	removePod func(pod *dockerPod) error
+	getLogs   func(pod *dockerPod) string
+}
+
+// dockerPod tracks a pod2docker script running on the local host
+type dockerPod struct {
+	name     string
+	workDir  string
+	started  time.Time
+	done     chan struct{}
+	exitCode int
+}
+
+// NewDockerProvider creates a provider which runs jobs on the local docker host
+func NewDockerProvider(config *types.Configuration, sharedHandlerArgs []string) (*Docker, error) {
+	if config == nil || config.Docker == nil || config.Job == nil {
+		return nil, fmt.Errorf("Cannot create a provider - invalid configuration, require config, Docker and Job")
+	}
+
+	if _, err := exec.LookPath("docker"); err != nil {
+		return nil, fmt.Errorf("docker not found on path: %+v", err)
+	}
+
+	d := Docker{}
+	d.handlerArgs = sharedHandlerArgs
+	d.inflightJobStore = NewInflightStore()
+	d.pods = map[string]*dockerPod{}
+	d.moduleName = config.ModuleName
+	d.jobConfig = config.Job
+	d.dockerConfig = config.Docker
+	d.workerEnvVars = map[string]interface{}{
+		"HANDLER_PORT": config.Handler.ServerPort,
+	}
+
+	// Add module specific config
+	envs, err := getModuleEnvironmentVars(config.ModuleConfigPath)
+	if err != nil {
+		log.WithField("filepath", config.ModuleConfigPath).Error("failed to load addition module config from file")
+	} else {
+		for key, value := range envs {
+			d.workerEnvVars[key] = value
+		}
+	}
+
+	d.workingDir = config.Docker.WorkingDir
+	if d.workingDir == "" {
+		d.workingDir = filepath.Join(os.TempDir(), "ion", config.Hostname+"-"+config.ModuleName)
+	}
+	err = os.MkdirAll(d.workingDir, 0777)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker working directory %s: %+v", d.workingDir, err)
+	}
+
+	d.runPod = func(pod *dockerPod, podCommand string) error {
+		return runPodScript(pod, podCommand, time.Duration(d.jobConfig.MaxRunningTimeMins)*time.Minute)
+	}
+	d.removePod = func(pod *dockerPod) error {
+		return os.RemoveAll(pod.workDir)
+	}
+	d.getLogs = getLogsForPod
+
+	if config.Handler != nil &&
+		config.Handler.MongoDBDocumentStorageProvider != nil &&
+		config.Handler.AzureBlobStorageProvider != nil {
+		d.logStore, err = NewLogStore(config.Handler.MongoDBDocumentStorageProvider, config.Handler.AzureBlobStorageProvider, config.ModuleName)
+		if err != nil {
+			log.WithError(err).Error("failed to create log store")
+			return nil, err
+		}
+	} else {
+		log.Info("Skipping logstore config as not provided")
+		d.logStore = &LogStore{}
+	}
+
+	return &d, nil
+}
+
+//GetActiveMessages gets the currently active messages
+func (d *Docker) GetActiveMessages() []messaging.Message {
+	return d.inflightJobStore.Messages()
+}
+
+// InProgressCount provides a count of the currently running pods
+func (d *Docker) InProgressCount() int {
+	return d.inflightJobStore.Count()
+}
+
+// Dispatch runs the prepare, worker and commit containers for the message on the local docker host
+func (d *Docker) Dispatch(message messaging.Message) error {
+	if message == nil {
+		return fmt.Errorf("invalid input. Message cannot be nil")
+	}
+	if d == nil {
+		return fmt.Errorf("invalid properties. Provider cannot be nil")
+	}
+
+	perJobArgs, err := getMessageHandlerArgs(message)
+	if err != nil {
+		return fmt.Errorf("failed generating handler args from message: %v", err)
+	}
+	fullHandlerArgs := append(d.handlerArgs, perJobArgs...)
+	//Prevent later append calls overwriting original backing array: https://stackoverflow.com/a/40036950/3437018
+	fullHandlerArgs = fullHandlerArgs[:len(fullHandlerArgs):len(fullHandlerArgs)]
+
+	eventData, err := message.EventData()
+	if err != nil {
+		return fmt.Errorf("failed getting event data from message: %v", err)
+	}
+	workerEnvVars := []apiv1.EnvVar{
+		{
+			Name:  "SHARED_SECRET",
+			Value: message.ID(), //Todo: source from common place with args
+		},
+	}
+	for key, value := range d.workerEnvVars {
+		envVar := apiv1.EnvVar{
+			Name:  key,
+			Value: fmt.Sprintf("%v", value),
+		}
+		workerEnvVars = append(workerEnvVars, envVar)
+	}
+	workerEnvVars = append(workerEnvVars, apiv1.EnvVar{
+		Name:  eventTypeEnvVar,
+		Value: eventData.Type,
+	})
+
+	pullPolicy := apiv1.PullIfNotPresent
+	if d.jobConfig.PullAlways {
+		pullPolicy = apiv1.PullAlways
+	}
+
+	volumeMounts := []apiv1.VolumeMount{
+		{
+			Name:      "ionvolume",
+			MountPath: "/ion",
+		},
+	}
+	podComponent := pod2docker.PodComponents{
+		InitContainers: []apiv1.Container{
+			{
+				Name:            "prepare",
+				Image:           d.jobConfig.HandlerImage,
+				Args:            append(fullHandlerArgs, "--action=prepare"),
+				ImagePullPolicy: pullPolicy,
+				VolumeMounts:    volumeMounts,
+			},
+			{
+				Name:            "worker",
+				Image:           d.jobConfig.WorkerImage,
+				Env:             workerEnvVars,
+				ImagePullPolicy: pullPolicy,
+				VolumeMounts:    volumeMounts,
+			},
+		},
+		Containers: []apiv1.Container{
+			{
+				Name:            "commit",
+				Image:           d.jobConfig.HandlerImage,
+				Args:            append(fullHandlerArgs, "--action=commit"),
+				ImagePullPolicy: pullPolicy,
+				VolumeMounts:    volumeMounts,
+			},
+		},
+		PodName: getJobName(message, d.moduleName),
+		Volumes: []apiv1.Volume{
+			{
+				Name: "ionvolume",
+				VolumeSource: apiv1.VolumeSource{
+					EmptyDir: &apiv1.EmptyDirVolumeSource{},
+				},
+			},
+		},
+	}
+
+	if d.dockerConfig != nil && d.dockerConfig.ImageRepositoryServer != "" {
+		podComponent.PullCredentials = []pod2docker.ImageRegistryCredential{
+			{
+				Server:   d.dockerConfig.ImageRepositoryServer,
+				Username: d.dockerConfig.ImageRepositoryUsername,
+				Password: d.dockerConfig.ImageRepositoryPassword,
+			},
+		}
+	}
+
+	podCommand, err := pod2docker.GetBashCommand(podComponent)
+	if err != nil {
+		return err
+	}
+
+	pod := &dockerPod{
+		name:    podComponent.PodName,
+		workDir: filepath.Join(d.workingDir, podComponent.PodName),
+		started: time.Now(),
+		done:    make(chan struct{}),
+	}
+	// Track the message before the pod so Reconcile always finds the source message for a pod
+	d.inflightJobStore.Add(message)
+	err = d.runPod(pod, podCommand)
+	if err != nil {
+		d.inflightJobStore.Remove(message.ID())
+		log.WithError(err).Error("failed starting docker pod")
+		mErr := message.Reject()
+		if mErr != nil {
+			log.WithError(mErr).Error("failed rejecting message after failing to start docker pod")
+		}
+		return err
+	}
+
+	log.WithField("messageid", message.ID()).Infof("docker pod %s started for message", pod.name)
+	d.podsMu.Lock()
+	d.pods[message.ID()] = pod
+	d.podsMu.Unlock()
+
+	return nil
+}
+
+// Reconcile checks for pods which have exited and accepts or rejects their messages accordingly
+func (d *Docker) Reconcile() error {
+	if d == nil {
+		return fmt.Errorf("invalid properties. Provider cannot be nil")
+	}
+
+	for messageID, pod := range d.exitedPods() {
+		sourceMessage, ok := d.inflightJobStore.Get(messageID)
+		contextualLogger := log.WithField("pod", pod.name).WithField("messageID", messageID).WithField("exitCode", pod.exitCode)
+		if !ok {
+			contextualLogger.Error("pod seen without source message... skipping")
+			d.removePodFromStore(messageID)
+			continue
+		}
+		contextualLogger = GetLoggerForMessage(sourceMessage, contextualLogger)
+
+		succeeded := pod.exitCode == 0
+		if succeeded {
+			contextualLogger.Info("docker pod completed with success exit code")
+		} else {
+			contextualLogger.Warning("docker pod completed with failed exit code")
+		}
+
+		logs := d.getLogs(pod)
+		err := d.logStore.StoreLogs(contextualLogger, sourceMessage, logs, succeeded)
+		if err != nil {
+			contextualLogger.WithError(err).Error("failed to log to logstore")
+		}
+
+		err = d.removePod(pod)
+		if err != nil {
+			contextualLogger.WithError(err).Error("failed to remove docker pod working directory")
+		}
+
+		if succeeded {
+			err = sourceMessage.Accept()
+			if err != nil {
+				contextualLogger.Error("failed to accept message")
+				return err
+			}
+		} else {
+			err = sourceMessage.Reject()
+			if err != nil {
+				contextualLogger.Error("failed to reject message")
+				return err
+			}
+		}
+
+		//Remove the message from the inflight message store
+		d.inflightJobStore.Remove(messageID)
+		d.removePodFromStore(messageID)
+	}
+
+	return nil
+}
+
+// exitedPods returns the pods whose scripts have exited, keyed by message ID
+func (d *Docker) exitedPods() map[string]*dockerPod {
+	d.podsMu.Lock()
+	defer d.podsMu.Unlock()
+
+	exited := map[string]*dockerPod{}
+	for messageID, pod := range d.pods {
+		select {
+		case <-pod.done:
+			exited[messageID] = pod
+		default:
+			// Still running
+		}
+	}
+	return exited
+}
+
+func (d *Docker) removePodFromStore(messageID string) {
+	d.podsMu.Lock()
+	defer d.podsMu.Unlock()
+	delete(d.pods, messageID)
+}
+
+// runPodScript writes the pod2docker script into the pods working directory and runs it
+// with bash in the background. The pods done channel is closed once the script exits.
+func runPodScript(pod *dockerPod, podCommand string, maxRunningTime time.Duration) error {
+	err := os.MkdirAll(pod.workDir, 0777)
+	if err != nil {
+		return fmt.Errorf("failed to create pod working directory %s: %+v", pod.workDir, err)
+	}
+	err = ioutil.WriteFile(filepath.Join(pod.workDir, podScriptName), []byte(podCommand), 0777)
+	if err != nil {
+		return fmt.Errorf("failed to write pod script: %+v", err)
+	}
+	output, err := os.Create(filepath.Join(pod.workDir, "pod.log"))
+	if err != nil {
+		return fmt.Errorf("failed to create pod log file: %+v", err)
+	}
+
+	cmd := exec.Command("/bin/bash", podScriptName)
+	cmd.Dir = pod.workDir
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err = cmd.Start()
+	if err != nil {
+		output.Close() //nolint: errcheck
+		return fmt.Errorf("failed to start pod script: %+v", err)
+	}
+
+	// Use SIGTERM rather than SIGKILL so the scripts cleanup trap removes the containers,
+	// only killing the script if it hasn't exited a minute later
+	terminate := time.AfterFunc(maxRunningTime, func() {
+		log.WithField("pod", pod.name).Info("docker pod exceeded max running time, terminating")
+		cmd.Process.Signal(syscall.SIGTERM) //nolint: errcheck
+		time.AfterFunc(time.Minute, func() {
+			select {
+			case <-pod.done:
+			default:
+				cmd.Process.Kill() //nolint: errcheck
+			}
+		})
+	})
+
+	go func() {
+		defer output.Close() //nolint: errcheck
+		err := cmd.Wait()
+		terminate.Stop()
+		if err != nil {
+			pod.exitCode = -1
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Exited() && status.ExitStatus() > 0 {
+					pod.exitCode = status.ExitStatus()
+				}
+			}
+			log.WithError(err).WithField("pod", pod.name).Info("docker pod exited with error")
+		}
+		close(pod.done)
+	}()
+
+	return nil
+}
+
+func getLogsForPod(pod *dockerPod) string {
+	sb := strings.Builder{}
+	for _, logFile := range []struct {
+		title string
+		file  string
+	}{
+		{"Pod logs: (for debugging)", "pod.log"},
+		{"Preparer logs", "prepare.log"},
+		{"Module logs", "worker.log"},
+		{"Commit logs", "commit.log"},
+	} {
+		sb.WriteString("\n\n ------ " + logFile.title + " ------ \n\n") //nolint: errcheck
+		logs, err := ioutil.ReadFile(filepath.Join(pod.workDir, logFile.file))
+		if err != nil {
+			log.WithError(err).WithField("pod", pod.name).Warningf("failed to get %v from pod", logFile.file)
+			sb.WriteString("failed to get: " + logFile.file) //nolint: errcheck
+			continue
+		}
+		sb.Write(logs) //nolint: errcheck
+	}
+	return sb.String()
+}
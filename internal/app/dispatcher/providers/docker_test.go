@@ -0,0 +1,177 @@
+package providers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lawrencegripper/ion/internal/pkg/types"
+)
+
+func NewMockDockerProvider(run func(pod *dockerPod, podCommand string) error) (*Docker, error) {
+	d := Docker{}
+	d.handlerArgs = []string{"--things=stuff"}
+	d.jobConfig = &types.JobConfig{
+		HandlerImage: "handler-image",
+		WorkerImage:  "worker-image",
+	}
+	d.moduleName = "examplemodule"
+	d.workingDir = "/tmp/ion-test"
+
+	d.inflightJobStore = NewInflightStore()
+	d.pods = map[string]*dockerPod{}
+	d.runPod = run
+	d.removePod = func(pod *dockerPod) error {
+		return nil
+	}
+	d.getLogs = func(pod *dockerPod) string { return "logs" }
+	d.logStore = &LogStore{}
+	return &d, nil
+}
+
+func TestDockerDispatchRunsPod(t *testing.T) {
+	podCommands := map[string]string{}
+
+	run := func(pod *dockerPod, podCommand string) error {
+		podCommands[pod.name] = podCommand
+		return nil
+	}
+
+	d, _ := NewMockDockerProvider(run)
+
+	messageToSend := MockMessage{
+		MessageID: mockMessageID,
+	}
+
+	err := d.Dispatch(messageToSend)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(podCommands) != 1 {
+		t.Errorf("Pod count incorrect Expected: 1 Got: %v", len(podCommands))
+		return
+	}
+
+	for _, command := range podCommands {
+		if strings.Count(command, "--action=prepare") != 1 {
+			t.Error("Missing prepare action")
+		}
+		if strings.Count(command, "--action=commit") != 1 {
+			t.Error("Missing commit action")
+		}
+		if !strings.Contains(command, "worker-image") {
+			t.Error("Missing worker image")
+		}
+	}
+
+	if d.InProgressCount() != 1 {
+		t.Errorf("In progress count incorrect Expected: 1 Got: %v", d.InProgressCount())
+	}
+}
+
+func TestDockerFailedDispatchRejectsMessage(t *testing.T) {
+	run := func(pod *dockerPod, podCommand string) error {
+		return fmt.Errorf("Simulate error")
+	}
+
+	d, _ := NewMockDockerProvider(run)
+
+	wasRejected := false
+	messageToSend := MockMessage{
+		MessageID: mockMessageID,
+	}
+	messageToSend.Rejected = func() {
+		wasRejected = true
+	}
+
+	err := d.Dispatch(messageToSend)
+	if err == nil {
+		t.Error("Expected error ... didn't see one!")
+	}
+
+	if !wasRejected {
+		t.Error("Expected to be rejected... wasn't")
+	}
+
+	if d.InProgressCount() != 0 {
+		t.Error("Expected message to not be stored")
+	}
+}
+
+func TestDockerReconcile(t *testing.T) {
+	testCases := []struct {
+		name           string
+		exited         bool
+		exitCode       int
+		expectAccepted bool
+		expectRejected bool
+		expectInflight int
+	}{
+		{
+			name:           "completed",
+			exited:         true,
+			exitCode:       0,
+			expectAccepted: true,
+			expectInflight: 0,
+		},
+		{
+			name:           "failed",
+			exited:         true,
+			exitCode:       1,
+			expectRejected: true,
+			expectInflight: 0,
+		},
+		{
+			name:           "running",
+			exited:         false,
+			expectInflight: 1,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			run := func(pod *dockerPod, podCommand string) error {
+				if test.exited {
+					pod.exitCode = test.exitCode
+					close(pod.done)
+				}
+				return nil
+			}
+
+			d, _ := NewMockDockerProvider(run)
+
+			var accepted, rejected bool
+			messageToSend := MockMessage{
+				MessageID: mockMessageID,
+				Accepted: func() {
+					accepted = true
+				},
+				Rejected: func() {
+					rejected = true
+				},
+			}
+
+			err := d.Dispatch(messageToSend)
+			if err != nil {
+				t.Error(err)
+			}
+
+			err = d.Reconcile()
+			if err != nil {
+				t.Error(err)
+			}
+
+			if accepted != test.expectAccepted {
+				t.Errorf("Accepted incorrect Expected: %v Got: %v", test.expectAccepted, accepted)
+			}
+			if rejected != test.expectRejected {
+				t.Errorf("Rejected incorrect Expected: %v Got: %v", test.expectRejected, rejected)
+			}
+			if d.InProgressCount() != test.expectInflight {
+				t.Errorf("In progress count incorrect Expected: %v Got: %v", test.expectInflight, d.InProgressCount())
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package providers
+
+import (
+	"sync"
+
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+)
+
+// InflightStore tracks the source messages of jobs which are in progress, keyed by message ID.
+// It is safe for concurrent use by the dispatch, reconcile and lock renewal goroutines.
+type InflightStore struct {
+	mu       sync.RWMutex
+	messages map[string]messaging.Message
+}
+
+// NewInflightStore creates an empty store
+func NewInflightStore() *InflightStore {
+	return &InflightStore{
+		messages: map[string]messaging.Message{},
+	}
+}
+
+// Add stores the message for an in progress job
+func (s *InflightStore) Add(message messaging.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages[message.ID()] = message
+}
+
+// Get returns the message with the given ID if its job is in progress
+func (s *InflightStore) Get(messageID string) (messaging.Message, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	message, ok := s.messages[messageID]
+	return message, ok
+}
+
+// Remove deletes the message with the given ID from the store
+func (s *InflightStore) Remove(messageID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.messages, messageID)
+}
+
+// Count returns the number of in progress jobs
+func (s *InflightStore) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.messages)
+}
+
+// Messages returns a snapshot of the messages for all in progress jobs
+func (s *InflightStore) Messages() []messaging.Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	messages := make([]messaging.Message, 0, len(s.messages))
+	for _, m := range s.messages {
+		messages = append(messages, m)
+	}
+	return messages
+}
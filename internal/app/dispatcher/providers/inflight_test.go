@@ -0,0 +1,155 @@
+package providers
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// These tests are intended to be run with `go test -race`
+
+func TestInflightStoreConcurrentAccess(t *testing.T) {
+	store := NewInflightStore()
+	const workers = 20
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("message%d", i)
+			store.Add(MockMessage{MessageID: id})
+			if _, ok := store.Get(id); !ok {
+				t.Errorf("expected to find message %s in store", id)
+			}
+			_ = store.Messages()
+			_ = store.Count()
+			if i%2 == 0 {
+				store.Remove(id)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if store.Count() != workers/2 {
+		t.Errorf("Count incorrect Expected: %v Got: %v", workers/2, store.Count())
+	}
+	if len(store.Messages()) != workers/2 {
+		t.Errorf("Messages incorrect Expected: %v Got: %v", workers/2, len(store.Messages()))
+	}
+}
+
+func TestInflightStoreMessagesIsSnapshot(t *testing.T) {
+	store := NewInflightStore()
+	store.Add(MockMessage{MessageID: "1"})
+
+	messages := store.Messages()
+	store.Remove("1")
+
+	if len(messages) != 1 {
+		t.Errorf("Snapshot changed after remove Expected: 1 Got: %v", len(messages))
+	}
+	if _, ok := store.Get("1"); ok {
+		t.Error("Expected message to be removed")
+	}
+}
+
+func TestKubernetesConcurrentDispatchReconcileRenew(t *testing.T) {
+	var jobsMu sync.Mutex
+	inMemMockJobStore := []batchv1.Job{}
+
+	// Jobs complete as soon as they're created so reconcile races with dispatch
+	create := func(b *batchv1.Job) (*batchv1.Job, error) {
+		jobsMu.Lock()
+		defer jobsMu.Unlock()
+		b.Status.Conditions = append(b.Status.Conditions, batchv1.JobCondition{
+			Type: batchv1.JobComplete,
+		})
+		inMemMockJobStore = append(inMemMockJobStore, *b)
+		return b, nil
+	}
+
+	list := func() (*batchv1.JobList, error) {
+		jobsMu.Lock()
+		defer jobsMu.Unlock()
+		items := make([]batchv1.Job, len(inMemMockJobStore))
+		copy(items, inMemMockJobStore)
+		return &batchv1.JobList{
+			Items: items,
+		}, nil
+	}
+
+	k, _ := NewMockKubernetesProvider(create, list)
+
+	const messageCount = 50
+	var accepted int32
+	done := make(chan struct{})
+
+	var background sync.WaitGroup
+	background.Add(2)
+	// Reconcile loop
+	go func() {
+		defer background.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				if err := k.Reconcile(); err != nil {
+					t.Error(err)
+				}
+			}
+		}
+	}()
+	// Lock renewal loop
+	go func() {
+		defer background.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				for _, m := range k.GetActiveMessages() {
+					_ = m.ID()
+				}
+				_ = k.InProgressCount()
+			}
+		}
+	}()
+
+	var dispatchers sync.WaitGroup
+	for i := 0; i < messageCount; i++ {
+		dispatchers.Add(1)
+		go func(i int) {
+			defer dispatchers.Done()
+			message := MockMessage{
+				MessageID: fmt.Sprintf("message%d", i),
+				Accepted: func() {
+					atomic.AddInt32(&accepted, 1)
+				},
+				Rejected: func() {},
+			}
+			if err := k.Dispatch(message); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	dispatchers.Wait()
+	close(done)
+	background.Wait()
+
+	// Pick up any jobs which completed after the last reconcile
+	if err := k.Reconcile(); err != nil {
+		t.Error(err)
+	}
+
+	if k.InProgressCount() != 0 {
+		t.Errorf("In progress count incorrect Expected: 0 Got: %v", k.InProgressCount())
+	}
+	if got := atomic.LoadInt32(&accepted); got != messageCount {
+		t.Errorf("Accepted count incorrect Expected: %v Got: %v", messageCount, got)
+	}
+}
@@ -1,13 +1,16 @@
 package providers
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"k8s.io/apimachinery/pkg/labels"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/lawrencegripper/ion/internal/pkg/messaging"
@@ -15,9 +18,12 @@ import (
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/lawrencegripper/ion/internal/pkg/types"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
 	batchv1 "k8s.io/api/batch/v1"
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -33,22 +39,70 @@ const (
 	eventID             = "ion/eventid"
 )
 
+// watchRetryInterval is how long Watch waits before retrying after failing to list or watch jobs
+var watchRetryInterval = time.Duration(5) * time.Second
+
 //Check providers match interface at compile time
 var _ Provider = &Kubernetes{}
+var _ Recoverer = &Kubernetes{}
+var _ Watcher = &Kubernetes{}
+
+func init() {
+	Register(Registration{
+		Name: KubernetesProviderName,
+		AddFlags: func(flags *pflag.FlagSet) {
+			flags.String("kubernetes.namespace", "default", "The Kubernetes namespace in which jobs will be created")
+			flags.String("kubernetes.imagepullsecretname", "", "")
+			flags.String("kubernetes.serviceaccountname", "", "Service account the job pods run as")
+			flags.StringSlice("kubernetes.nodeselector", []string{}, "Node labels, as key=value, a node must have to run the job pods")
+			flags.StringSlice("kubernetes.tolerations", []string{}, "Taints, as key[=value][:effect], the job pods tolerate")
+		},
+		Configure: func(config *types.Configuration, settings Settings) error {
+			nodeSelector, err := parseKeyValuePairs(settings.GetStringSlice("kubernetes.nodeselector"))
+			if err != nil {
+				return fmt.Errorf("invalid kubernetes.nodeselector: %v", err)
+			}
+			config.Kubernetes = &types.KubernetesConfig{
+				Namespace:           settings.GetString("kubernetes.namespace"),
+				ImagePullSecretName: settings.GetString("kubernetes.imagepullsecretname"),
+				ServiceAccountName:  settings.GetString("kubernetes.serviceaccountname"),
+				NodeSelector:        nodeSelector,
+				Tolerations:         settings.GetStringSlice("kubernetes.tolerations"),
+			}
+			return nil
+		},
+		New: func(config *types.Configuration, sharedHandlerArgs []string) (Provider, error) {
+			p, err := NewKubernetesProvider(config, sharedHandlerArgs)
+			if err != nil {
+				return nil, err
+			}
+			return p, nil
+		},
+	})
+}
 
 // Kubernetes schedules jobs onto k8s from the queue and monitors their progress
 type Kubernetes struct {
 	createJob        func(*batchv1.Job) (*batchv1.Job, error)
 	listAllJobs      func() (*batchv1.JobList, error)
+	watchJobs        func(resourceVersion string) (watch.Interface, error)
 	removeJob        func(*batchv1.Job) error
 	getLogs          func(b *batchv1.Job) (string, error)
 	client           *kubernetes.Clientset
 	jobConfig        *types.JobConfig
-	inflightJobStore map[string]messaging.Message
+	inflightJobStore *InflightStore
+	recoveredJobs    *recoveredJobStore
+	reconcileMu      sync.Mutex
 	dispatcherName   string
 	moduleName       string
 	Namespace        string
 	pullSecret       string
+	serviceAccount   string
+	nodeSelector     map[string]string
+	tolerations      []apiv1.Toleration
+	prepareResources apiv1.ResourceRequirements
+	workerResources  apiv1.ResourceRequirements
+	commitResources  apiv1.ResourceRequirements
 	handlerArgs      []string
 	workerEnvVars    map[string]interface{}
 	logStore         *LogStore
@@ -88,9 +142,28 @@ func NewKubernetesProvider(config *types.Configuration, sharedHandlerArgs []stri
 
 	k.Namespace = config.Kubernetes.Namespace
 	k.pullSecret = config.Kubernetes.ImagePullSecretName
+	k.serviceAccount = config.Kubernetes.ServiceAccountName
+	k.nodeSelector = config.Kubernetes.NodeSelector
+	k.tolerations, err = parseTolerations(config.Kubernetes.Tolerations)
+	if err != nil {
+		return nil, err
+	}
+	k.prepareResources, err = getResourceRequirements(config.Job.Prepare)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prepare resources: %v", err)
+	}
+	k.workerResources, err = getResourceRequirements(config.Job.Worker)
+	if err != nil {
+		return nil, fmt.Errorf("invalid worker resources: %v", err)
+	}
+	k.commitResources, err = getResourceRequirements(config.Job.Commit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit resources: %v", err)
+	}
 	k.jobConfig = config.Job
-	k.dispatcherName = config.Hostname
-	k.inflightJobStore = map[string]messaging.Message{}
+	k.dispatcherName = config.DispatcherName()
+	k.inflightJobStore = NewInflightStore()
+	k.recoveredJobs = newRecoveredJobStore()
 	k.createJob = func(b *batchv1.Job) (*batchv1.Job, error) {
 		return k.client.BatchV1().Jobs(k.Namespace).Create(b)
 	}
@@ -99,6 +172,12 @@ func NewKubernetesProvider(config *types.Configuration, sharedHandlerArgs []stri
 			LabelSelector: fmt.Sprintf("%s=%s", dispatcherNameLabel, k.dispatcherName),
 		})
 	}
+	k.watchJobs = func(resourceVersion string) (watch.Interface, error) {
+		return k.client.BatchV1().Jobs(k.Namespace).Watch(metav1.ListOptions{
+			LabelSelector:   fmt.Sprintf("%s=%s", dispatcherNameLabel, k.dispatcherName),
+			ResourceVersion: resourceVersion,
+		})
+	}
 	k.removeJob = func(j *batchv1.Job) error {
 		return k.client.BatchV1().Jobs(k.Namespace).Delete(j.Name, &metav1.DeleteOptions{})
 	}
@@ -124,16 +203,12 @@ func NewKubernetesProvider(config *types.Configuration, sharedHandlerArgs []stri
 
 //GetActiveMessages gets the currently active messages
 func (k *Kubernetes) GetActiveMessages() []messaging.Message {
-	activeMessages := make([]messaging.Message, 0, len(k.inflightJobStore))
-	for _, m := range k.inflightJobStore {
-		activeMessages = append(activeMessages, m)
-	}
-	return activeMessages
+	return k.inflightJobStore.Messages()
 }
 
 // InProgressCount provides a count of the currently running jobs
 func (k *Kubernetes) InProgressCount() int {
-	return len(k.inflightJobStore)
+	return k.inflightJobStore.Count()
 }
 
 // Reconcile will review the state of running jobs and accept or reject messages accordingly
@@ -141,107 +216,287 @@ func (k *Kubernetes) Reconcile() error {
 	if k == nil {
 		return fmt.Errorf("invalid properties. Provider cannot be nil")
 	}
+	_, err := k.reconcileAllJobs()
+	return err
+}
+
+// reconcileAllJobs reconciles every job created by the dispatcher and returns the
+// resource version of the list so a watch can pick up from where it left off
+func (k *Kubernetes) reconcileAllJobs() (string, error) {
 	// Todo: investigate using the field selector to limit the returned data to only
 	// completed or failed jobs
 	jobs, err := k.listAllJobs()
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	for _, j := range jobs.Items {
-		messageID, ok := j.ObjectMeta.Labels[messageIDLabel]
-		contextualLogger := getLoggerForJob(&j)
-		if !ok {
-			contextualLogger.Error("job seen without messageid present in labels... skipping")
-			continue
+	for i := range jobs.Items {
+		err := k.reconcileJob(&jobs.Items[i])
+		if err != nil {
+			return "", err
 		}
+	}
 
-		sourceMessage, ok := k.inflightJobStore[messageID]
-		// If we don't have a message in flight for this job check some error cases
-		if !ok {
-			dipatcherName, ok := j.Labels[dispatcherNameLabel]
-			// Is it malformed?
-			if !ok {
-				contextualLogger.Error("job seen without dispatcher present in labels... skipping")
-				continue
-			}
-			// Is it someone elses?
-			if dipatcherName != k.dispatcherName {
-				contextualLogger.Debug("job seen with different dispatcher name present in labels... skipping")
-				continue
-			}
-			// Is it ours and we've forgotten
-			if dipatcherName == k.dispatcherName {
-				for _, condition := range j.Status.Conditions {
-					if jobIsFinishedAndOlderThanAnHour(condition) {
-						//Cleanup stuff that's been around a while
-						err = k.removeJob(&j)
-						if err != nil {
-							contextualLogger.Error("cleanup: failed to remove old job job from k8s")
-						}
-					}
-				}
+	return jobs.ResourceVersion, nil
+}
 
+// Watch reconciles jobs as soon as their status changes. When the API server closes the watch
+// it's restarted from the last resource version seen, all jobs are only relisted and reconciled
+// when that version has expired. Errors are retried until the context is done.
+func (k *Kubernetes) Watch(ctx context.Context) error {
+	if k == nil {
+		return fmt.Errorf("invalid properties. Provider cannot be nil")
+	}
+	relist := true
+	resourceVersion := ""
+	for {
+		if relist {
+			listResourceVersion, err := k.reconcileAllJobs()
+			if err != nil {
+				log.WithError(err).Error("failed listing jobs to watch, retrying")
+				if !sleepUntilDone(ctx, watchRetryInterval) {
+					return nil
+				}
 				continue
 			}
+			resourceVersion = listResourceVersion
+			relist = false
+		}
 
-			//Unknown case?!
-			contextualLogger.Info("unknown case when reconciling job")
+		watcher, err := k.watchJobs(resourceVersion)
+		if err == nil {
+			resourceVersion, err = k.handleJobEvents(ctx, watcher, resourceVersion)
+			watcher.Stop()
+		}
+		if isWatchExpired(err) {
+			log.WithError(err).Info("job watch resource version expired, relisting jobs")
+			relist = true
+			continue
+		}
+		if err != nil {
+			log.WithError(err).Error("failed watching jobs, retrying")
+			if !sleepUntilDone(ctx, watchRetryInterval) {
+				return nil
+			}
 			continue
 		}
 
-		contextualLogger = GetLoggerForMessage(sourceMessage, contextualLogger)
-		for _, condition := range j.Status.Conditions {
-			// Job failed - reject the message so it goes back on the queue to be retried
-			if condition.Type == batchv1.JobFailed {
-				contextualLogger.Warning("job failed to execute in k8s")
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+			log.WithField("resourceVersion", resourceVersion).Debug("job watch closed, restarting it")
+		}
+	}
+}
 
-				logs, err := k.getLogs(&j)
-				if err != nil {
-					contextualLogger.WithError(err).Error("failed to get logs for job: getLogsFailed")
+// handleJobEvents reconciles the jobs from the watch until it's closed or the context is done.
+// It returns the resource version of the last event seen so the watch can be restarted from it.
+func (k *Kubernetes) handleJobEvents(ctx context.Context, watcher watch.Interface, resourceVersion string) (string, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return resourceVersion, nil
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return resourceVersion, nil
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified, watch.Deleted:
+				j, ok := event.Object.(*batchv1.Job)
+				if !ok {
+					log.WithField("object", event.Object).Error("unexpected object type seen watching jobs... skipping")
+					continue
 				}
-				err = k.logStore.StoreLogs(contextualLogger, sourceMessage, logs, false)
+				resourceVersion = j.ResourceVersion
+				if event.Type == watch.Deleted {
+					continue
+				}
+				err := k.reconcileJob(j)
 				if err != nil {
-					contextualLogger.WithError(err).Error("failed to log to logstore")
+					// The job is reconciled again by the next resync
+					getLoggerForJob(j).WithError(err).Error("failed reconciling job seen watching jobs")
 				}
+			case watch.Error:
+				return resourceVersion, errors.FromObject(event.Object)
+			}
+		}
+	}
+}
 
-				err = sourceMessage.Reject()
+// isWatchExpired returns true if the watch failed because its resource version is too old
+func isWatchExpired(err error) bool {
+	if errors.IsGone(err) || errors.IsResourceExpired(err) {
+		return true
+	}
+	statusErr, ok := err.(*errors.StatusError)
+	return ok && statusErr.ErrStatus.Code == http.StatusGone
+}
 
-				if err != nil {
-					contextualLogger.Error("failed to reject message")
-					return err
-				}
+// sleepUntilDone waits for the duration, returning false if the context is done first
+func sleepUntilDone(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
 
-				//Remove the message from the inflight message store
-				delete(k.inflightJobStore, messageID)
-			}
+// reconcileJob accepts or rejects the message for the job if it has finished
+func (k *Kubernetes) reconcileJob(j *batchv1.Job) error {
+	// Reconcile and watch events can see the same job at the same time
+	k.reconcileMu.Lock()
+	defer k.reconcileMu.Unlock()
 
-			// Job succeeded - accept the message so it is removed from the queue
-			if condition.Type == batchv1.JobComplete {
-				contextualLogger.Info("job successfully to execute in k8s")
+	messageID, ok := j.ObjectMeta.Labels[messageIDLabel]
+	contextualLogger := getLoggerForJob(j)
+	if !ok {
+		contextualLogger.Error("job seen without messageid present in labels... skipping")
+		return nil
+	}
 
-				logs, err := k.getLogs(&j)
+	sourceMessage, ok := k.inflightJobStore.Get(messageID)
+	// If we don't have a message in flight for this job check some error cases
+	if !ok {
+		dipatcherName, ok := j.Labels[dispatcherNameLabel]
+		// Is it malformed?
+		if !ok {
+			contextualLogger.Error("job seen without dispatcher present in labels... skipping")
+			return nil
+		}
+		// Is it someone elses?
+		if dipatcherName != k.dispatcherName {
+			contextualLogger.Debug("job seen with different dispatcher name present in labels... skipping")
+			return nil
+		}
+		// Is it ours and we've forgotten
+		if dipatcherName == k.dispatcherName {
+			// Was it recovered after a restart and its message never redelivered?
+			if _, expired := k.recoveredJobs.expire(messageID, j.Name, time.Now()); expired {
+				contextualLogger.Warning("cancelling job recovered after dispatcher restart as its message wasn't redelivered")
+				err := k.removeJob(j)
 				if err != nil {
-					contextualLogger.WithError(err).Error("failed to get logs for job: getLogsFailed")
+					contextualLogger.WithError(err).Error("failed to cancel recovered job in k8s")
 				}
-				err = k.logStore.StoreLogs(contextualLogger, sourceMessage, logs, true)
-				if err != nil {
-					contextualLogger.WithError(err).Error("failed to log to logstore")
+				return nil
+			}
+
+			for _, condition := range j.Status.Conditions {
+				if jobIsFinishedAndOlderThanAnHour(condition) {
+					//Cleanup stuff that's been around a while
+					err := k.removeJob(j)
+					if err != nil {
+						contextualLogger.Error("cleanup: failed to remove old job job from k8s")
+					}
 				}
+			}
 
-				err = sourceMessage.Accept()
+			return nil
+		}
 
-				if err != nil {
-					contextualLogger.Error("failed to accept message")
-					return err
-				}
+		//Unknown case?!
+		contextualLogger.Info("unknown case when reconciling job")
+		return nil
+	}
+
+	contextualLogger = GetLoggerForMessage(sourceMessage, contextualLogger)
+	for _, condition := range j.Status.Conditions {
+		// Job failed - reject the message so it goes back on the queue to be retried
+		if condition.Type == batchv1.JobFailed {
+			contextualLogger.Warning("job failed to execute in k8s")
+
+			logs, err := k.getLogs(j)
+			if err != nil {
+				contextualLogger.WithError(err).Error("failed to get logs for job: getLogsFailed")
+			}
+			err = k.logStore.StoreLogs(contextualLogger, sourceMessage, logs, false)
+			if err != nil {
+				contextualLogger.WithError(err).Error("failed to log to logstore")
+			}
+
+			err = sourceMessage.Reject()
+
+			if err != nil {
+				contextualLogger.Error("failed to reject message")
+				return err
+			}
+
+			//Remove the message from the inflight message store
+			k.inflightJobStore.Remove(messageID)
+		}
+
+		// Job succeeded - accept the message so it is removed from the queue
+		if condition.Type == batchv1.JobComplete {
+			contextualLogger.Info("job successfully to execute in k8s")
+
+			logs, err := k.getLogs(j)
+			if err != nil {
+				contextualLogger.WithError(err).Error("failed to get logs for job: getLogsFailed")
+			}
+			err = k.logStore.StoreLogs(contextualLogger, sourceMessage, logs, true)
+			if err != nil {
+				contextualLogger.WithError(err).Error("failed to log to logstore")
+			}
+
+			err = sourceMessage.Accept()
+
+			if err != nil {
+				contextualLogger.Error("failed to accept message")
+				return err
+			}
+
+			//Remove the message from the inflight message store
+			k.inflightJobStore.Remove(messageID)
+		}
+	}
+
+	return nil
+}
+
+// Recover rebuilds the in-flight state from the jobs this dispatcher created before it restarted
+func (k *Kubernetes) Recover() error {
+	if k == nil {
+		return fmt.Errorf("invalid properties. Provider cannot be nil")
+	}
+	jobs, err := k.listAllJobs()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, j := range jobs.Items {
+		contextualLogger := getLoggerForJob(&j)
+		messageID, ok := j.Labels[messageIDLabel]
+		if !ok {
+			contextualLogger.Error("job seen without messageid present in labels... skipping recovery")
+			continue
+		}
+		if j.Labels[dispatcherNameLabel] != k.dispatcherName {
+			continue
+		}
 
-				//Remove the message from the inflight message store
-				delete(k.inflightJobStore, messageID)
+		deliveryCount, err := strconv.Atoi(j.Labels[deliverycountlabel])
+		if err != nil {
+			contextualLogger.WithError(err).Warning("job seen with invalid deliverycount label")
+		}
+		failed := false
+		for _, condition := range j.Status.Conditions {
+			if condition.Type == batchv1.JobFailed {
+				failed = true
 			}
 		}
+
+		k.recoveredJobs.add(messageID, recoveredJob{
+			name:          j.Name,
+			deliveryCount: deliveryCount,
+			failed:        failed,
+			recoveredAt:   now,
+		})
+		contextualLogger.WithField("failed", failed).Info("recovered job created before dispatcher restart")
 	}
 
+	log.WithField("recoveredJobs", k.recoveredJobs.count()).Info("recovered in-flight state from k8s")
 	return nil
 }
 
@@ -254,6 +509,32 @@ func (k *Kubernetes) Dispatch(message messaging.Message) error {
 		return fmt.Errorf("invalid properties. Provider cannot be nil")
 	}
 
+	// Adopt the job from before a restart, if there was one, rather than running the message twice
+	if recovered, ok := k.recoveredJobs.claim(message.ID()); ok {
+		contextualLogger := log.WithField("job", recovered.name).WithField("messageID", message.ID())
+		// Failed jobs have the message's ID so they must be removed before the message is in flight,
+		// otherwise reconciling them would reject the message
+		failedJobs := recovered.superseded
+		if recovered.failed {
+			failedJobs = append(failedJobs, recovered.name)
+		}
+		err := k.removeJobsByName(failedJobs)
+		if err != nil {
+			contextualLogger.WithError(err).Error("failed removing failed jobs created before dispatcher restart")
+			mErr := message.Reject()
+			if mErr != nil {
+				contextualLogger.WithError(mErr).Error("failed rejecting message after failing to remove failed jobs")
+			}
+			return err
+		}
+		if !recovered.failed {
+			contextualLogger.Info("adopting job created before dispatcher restart")
+			k.inflightJobStore.Add(message)
+			return nil
+		}
+		contextualLogger.Info("removed failed job created before dispatcher restart, dispatching a new job")
+	}
+
 	perJobArgs, err := getMessageHandlerArgs(message)
 	if err != nil {
 		return fmt.Errorf("failed generating handler args from message: %v", err)
@@ -263,6 +544,9 @@ func (k *Kubernetes) Dispatch(message messaging.Message) error {
 	fullHandlerArgs = fullHandlerArgs[:len(fullHandlerArgs):len(fullHandlerArgs)]
 
 	eventData, err := message.EventData()
+	if err != nil {
+		return fmt.Errorf("failed getting event data from message: %v", err)
+	}
 	labels := map[string]string{
 		dispatcherNameLabel: k.dispatcherName,
 		messageIDLabel:      message.ID(),
@@ -285,6 +569,10 @@ func (k *Kubernetes) Dispatch(message messaging.Message) error {
 		}
 		workerEnvVars = append(workerEnvVars, envVar)
 	}
+	workerEnvVars = append(workerEnvVars, apiv1.EnvVar{
+		Name:  eventTypeEnvVar,
+		Value: eventData.Type,
+	})
 
 	pullPolicy := apiv1.PullIfNotPresent
 	if k.jobConfig.PullAlways {
@@ -314,6 +602,7 @@ func (k *Kubernetes) Dispatch(message messaging.Message) error {
 							Image:           k.jobConfig.HandlerImage,
 							Args:            handlerPrepareAgs,
 							ImagePullPolicy: pullPolicy,
+							Resources:       k.prepareResources,
 							VolumeMounts: []apiv1.VolumeMount{
 								{
 									Name:      "ionvolume",
@@ -326,6 +615,7 @@ func (k *Kubernetes) Dispatch(message messaging.Message) error {
 							Image:           k.jobConfig.WorkerImage,
 							Env:             workerEnvVars,
 							ImagePullPolicy: pullPolicy,
+							Resources:       k.workerResources,
 							VolumeMounts: []apiv1.VolumeMount{
 								{
 									Name:      "ionvolume",
@@ -340,6 +630,7 @@ func (k *Kubernetes) Dispatch(message messaging.Message) error {
 							Image:           k.jobConfig.HandlerImage,
 							Args:            handlerCommitAgs,
 							ImagePullPolicy: pullPolicy,
+							Resources:       k.commitResources,
 							VolumeMounts: []apiv1.VolumeMount{
 								{
 									Name:      "ionvolume",
@@ -356,7 +647,10 @@ func (k *Kubernetes) Dispatch(message messaging.Message) error {
 							},
 						},
 					},
-					RestartPolicy: apiv1.RestartPolicyNever,
+					RestartPolicy:      apiv1.RestartPolicyNever,
+					ServiceAccountName: k.serviceAccount,
+					NodeSelector:       k.nodeSelector,
+					Tolerations:        k.tolerations,
 				},
 			},
 		},
@@ -383,11 +677,27 @@ func (k *Kubernetes) Dispatch(message messaging.Message) error {
 	}
 
 	log.WithField("messageid", message.ID()).Infof("pod created for message %s", kjob.GetSelfLink())
-	k.inflightJobStore[message.ID()] = message
+	k.inflightJobStore.Add(message)
 
 	return nil
 }
 
+// removeJobsByName removes the named jobs from the provider's namespace
+func (k *Kubernetes) removeJobsByName(names []string) error {
+	for _, name := range names {
+		err := k.removeJob(&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: k.Namespace,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed removing job %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
 func jobIsFinishedAndOlderThanAnHour(condition batchv1.JobCondition) bool {
 	return condition.Type == batchv1.JobFailed ||
 		condition.Type == batchv1.JobComplete &&
@@ -0,0 +1,114 @@
+package providers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lawrencegripper/ion/internal/pkg/types"
+	apiv1 "k8s.io/api/core/v1"
+	v1resource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+// gpuResourceName is the resource advertised by the nvidia device plugin
+const gpuResourceName apiv1.ResourceName = "nvidia.com/gpu"
+
+// getResourceRequirements converts the resources configured for a container into the requests and limits k8s expects
+func getResourceRequirements(resources types.ContainerResources) (apiv1.ResourceRequirements, error) {
+	requirements := apiv1.ResourceRequirements{}
+
+	quantities := []struct {
+		value    string
+		resource apiv1.ResourceName
+		isLimit  bool
+	}{
+		{resources.CPURequest, apiv1.ResourceCPU, false},
+		{resources.CPULimit, apiv1.ResourceCPU, true},
+		{resources.MemoryRequest, apiv1.ResourceMemory, false},
+		{resources.MemoryLimit, apiv1.ResourceMemory, true},
+	}
+	for _, q := range quantities {
+		if q.value == "" {
+			continue
+		}
+		quantity, err := v1resource.ParseQuantity(q.value)
+		if err != nil {
+			return requirements, fmt.Errorf("invalid %s quantity '%s': %v", q.resource, q.value, err)
+		}
+		if q.isLimit {
+			if requirements.Limits == nil {
+				requirements.Limits = apiv1.ResourceList{}
+			}
+			requirements.Limits[q.resource] = quantity
+		} else {
+			if requirements.Requests == nil {
+				requirements.Requests = apiv1.ResourceList{}
+			}
+			requirements.Requests[q.resource] = quantity
+		}
+	}
+
+	if resources.GPU < 0 {
+		return requirements, fmt.Errorf("invalid gpu count %d, must not be negative", resources.GPU)
+	}
+	// GPUs can only be set as a limit, k8s uses it as the request too
+	if resources.GPU > 0 {
+		if requirements.Limits == nil {
+			requirements.Limits = apiv1.ResourceList{}
+		}
+		requirements.Limits[gpuResourceName] = *v1resource.NewQuantity(int64(resources.GPU), v1resource.DecimalSI)
+	}
+
+	return requirements, nil
+}
+
+// parseTolerations converts tolerations in the form 'key[=value][:effect]' into k8s tolerations.
+// Without a value the toleration matches any taint with the key, without an effect it matches all effects.
+func parseTolerations(tolerations []string) ([]apiv1.Toleration, error) {
+	parsed := make([]apiv1.Toleration, 0, len(tolerations))
+	for _, t := range tolerations {
+		toleration := apiv1.Toleration{
+			Operator: apiv1.TolerationOpExists,
+		}
+
+		keyValue := t
+		if i := strings.LastIndex(t, ":"); i >= 0 {
+			keyValue = t[:i]
+			toleration.Effect = apiv1.TaintEffect(t[i+1:])
+		}
+		switch toleration.Effect {
+		case "", apiv1.TaintEffectNoSchedule, apiv1.TaintEffectPreferNoSchedule, apiv1.TaintEffectNoExecute:
+		default:
+			return nil, fmt.Errorf("invalid toleration '%s', unknown effect '%s'", t, toleration.Effect)
+		}
+
+		if i := strings.Index(keyValue, "="); i >= 0 {
+			toleration.Key = keyValue[:i]
+			toleration.Value = keyValue[i+1:]
+			toleration.Operator = apiv1.TolerationOpEqual
+		} else {
+			toleration.Key = keyValue
+		}
+		if toleration.Key == "" {
+			return nil, fmt.Errorf("invalid toleration '%s', key cannot be empty", t)
+		}
+
+		parsed = append(parsed, toleration)
+	}
+	return parsed, nil
+}
+
+// parseKeyValuePairs converts a list of 'key=value' strings into a map
+func parseKeyValuePairs(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	parsed := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("'%s' is not in the form key=value", pair)
+		}
+		parsed[kv[0]] = kv[1]
+	}
+	return parsed, nil
+}
@@ -1,19 +1,21 @@
 package providers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/lawrencegripper/ion/internal/pkg/common"
-	"github.com/lawrencegripper/ion/internal/pkg/messaging"
 	"github.com/lawrencegripper/ion/internal/pkg/types"
-	"pack.ag/amqp"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
 )
 
 func NewMockKubernetesProvider(create func(b *batchv1.Job) (*batchv1.Job, error), list func() (*batchv1.JobList, error)) (*Kubernetes, error) {
@@ -26,7 +28,8 @@ func NewMockKubernetesProvider(create func(b *batchv1.Job) (*batchv1.Job, error)
 	}
 	k.dispatcherName = mockDispatcherName
 
-	k.inflightJobStore = map[string]messaging.Message{}
+	k.inflightJobStore = NewInflightStore()
+	k.recoveredJobs = newRecoveredJobStore()
 	k.createJob = create
 	k.listAllJobs = list
 	k.removeJob = func(j *batchv1.Job) error {
@@ -226,6 +229,164 @@ func TestK8s_DispatchedJobConfiguration(t *testing.T) {
 	}
 }
 
+func TestK8s_DispatchedJobEventType(t *testing.T) {
+	inMemMockJobStore := []batchv1.Job{}
+
+	create := func(b *batchv1.Job) (*batchv1.Job, error) {
+		inMemMockJobStore = append(inMemMockJobStore, *b)
+		return b, nil
+	}
+
+	k, _ := NewMockKubernetesProvider(create, nil)
+
+	err := k.Dispatch(MockMessage{
+		MessageID: mockMessageID,
+		JSONValue: `{ "type": "frame_extracted", "context": {"eventId": "barry", "name": "faceevnt", "correlationId": "12345" }}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := inMemMockJobStore[0].Spec.Template.Spec.InitContainers[1].Env
+	eventType := env[len(env)-1]
+	if eventType.Name != eventTypeEnvVar || eventType.Value != "frame_extracted" {
+		t.Errorf("expected the worker to be given the event type Got: %+v", eventType)
+	}
+}
+
+func TestK8s_DispatchedJobSchedulingConfiguration(t *testing.T) {
+	inMemMockJobStore := []batchv1.Job{}
+
+	create := func(b *batchv1.Job) (*batchv1.Job, error) {
+		inMemMockJobStore = append(inMemMockJobStore, *b)
+		return b, nil
+	}
+
+	k, _ := NewMockKubernetesProvider(create, nil)
+
+	var err error
+	k.workerResources, err = getResourceRequirements(types.ContainerResources{
+		CPURequest:  "500m",
+		MemoryLimit: "2Gi",
+		GPU:         1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.commitResources, err = getResourceRequirements(types.ContainerResources{
+		MemoryRequest: "256Mi",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.tolerations, err = parseTolerations([]string{"gpu=true:NoSchedule"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.nodeSelector = map[string]string{"accelerator": "nvidia"}
+	k.serviceAccount = "module-sa"
+
+	err = k.Dispatch(MockMessage{
+		MessageID: mockMessageID,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	podSpec := inMemMockJobStore[0].Spec.Template.Spec
+
+	prepare := podSpec.InitContainers[0]
+	if len(prepare.Resources.Requests) != 0 || len(prepare.Resources.Limits) != 0 {
+		t.Errorf("Expected no resources on prepare container Got: %v", prepare.Resources)
+	}
+
+	worker := podSpec.InitContainers[1]
+	if cpu := worker.Resources.Requests[apiv1.ResourceCPU]; cpu.String() != "500m" {
+		t.Errorf("worker cpu request wrong Expected: 500m Got: %s", cpu.String())
+	}
+	if memory := worker.Resources.Limits[apiv1.ResourceMemory]; memory.String() != "2Gi" {
+		t.Errorf("worker memory limit wrong Expected: 2Gi Got: %s", memory.String())
+	}
+	if gpu := worker.Resources.Limits[gpuResourceName]; gpu.Value() != 1 {
+		t.Errorf("worker gpu limit wrong Expected: 1 Got: %v", gpu.Value())
+	}
+
+	commit := podSpec.Containers[0]
+	if memory := commit.Resources.Requests[apiv1.ResourceMemory]; memory.String() != "256Mi" {
+		t.Errorf("commit memory request wrong Expected: 256Mi Got: %s", memory.String())
+	}
+	if _, ok := commit.Resources.Limits[gpuResourceName]; ok {
+		t.Error("Expected gpu only on the worker container")
+	}
+
+	if podSpec.ServiceAccountName != "module-sa" {
+		t.Errorf("service account wrong Expected: module-sa Got: %s", podSpec.ServiceAccountName)
+	}
+	if podSpec.NodeSelector["accelerator"] != "nvidia" {
+		t.Errorf("node selector wrong Got: %v", podSpec.NodeSelector)
+	}
+	if len(podSpec.Tolerations) != 1 || podSpec.Tolerations[0].Key != "gpu" {
+		t.Errorf("tolerations wrong Got: %v", podSpec.Tolerations)
+	}
+}
+
+func TestParseTolerations(t *testing.T) {
+	testCases := []struct {
+		toleration  string
+		expected    apiv1.Toleration
+		expectError bool
+	}{
+		{
+			toleration: "gpu=true:NoSchedule",
+			expected:   apiv1.Toleration{Key: "gpu", Value: "true", Operator: apiv1.TolerationOpEqual, Effect: apiv1.TaintEffectNoSchedule},
+		},
+		{
+			toleration: "dedicated:NoExecute",
+			expected:   apiv1.Toleration{Key: "dedicated", Operator: apiv1.TolerationOpExists, Effect: apiv1.TaintEffectNoExecute},
+		},
+		{
+			toleration: "dedicated=ion",
+			expected:   apiv1.Toleration{Key: "dedicated", Value: "ion", Operator: apiv1.TolerationOpEqual},
+		},
+		{
+			toleration:  "gpu=true:Sometimes",
+			expectError: true,
+		},
+		{
+			toleration:  "=true:NoSchedule",
+			expectError: true,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.toleration, func(t *testing.T) {
+			tolerations, err := parseTolerations([]string{test.toleration})
+			if test.expectError {
+				if err == nil {
+					t.Error("Expected error ... didn't see one!")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tolerations[0] != test.expected {
+				t.Errorf("toleration wrong Expected: %+v Got: %+v", test.expected, tolerations[0])
+			}
+		})
+	}
+}
+
+func TestGetResourceRequirementsInvalidQuantity(t *testing.T) {
+	_, err := getResourceRequirements(types.ContainerResources{
+		CPULimit: "lots",
+	})
+	if err == nil {
+		t.Error("Expected error for invalid quantity ... didn't see one!")
+	}
+}
+
 func CheckLabelsAssignedCorrectly(t *testing.T, job batchv1.Job, expectedMessageID string) {
 	testCases := []struct {
 		labelName     string
@@ -328,7 +489,7 @@ func TestReconcileJobCompleted(t *testing.T) {
 		t.Error("Failed to accept message during reconcilation. Expected message to be marked as accepted as job is complete")
 	}
 
-	if len(k.inflightJobStore) != 0 {
+	if k.inflightJobStore.Count() != 0 {
 		t.Error("Reconcile should remove jobs from the inmemory store once it has accepted or rejected them")
 	}
 }
@@ -378,7 +539,7 @@ func TestReconcileJobFailed(t *testing.T) {
 		t.Error("Failed to reject message during reconcilation. Expected message to be marked as accepted as job is complete")
 	}
 
-	if len(k.inflightJobStore) != 0 {
+	if k.inflightJobStore.Count() != 0 {
 		t.Error("Reconcile should remove jobs from the inmemory store once it has accepted or rejected them")
 	}
 }
@@ -389,6 +550,7 @@ type MockMessage struct {
 	DeliveryCountValue int
 	Accepted           func()
 	Rejected           func()
+	DeadLettered       func(reason string)
 	JSONValue          string
 }
 
@@ -409,11 +571,6 @@ func (m MockMessage) DeliveryCount() int {
 	return m.DeliveryCountValue
 }
 
-// GetAMQPMessage get the original amqp message
-func (m MockMessage) GetAMQPMessage() *amqp.Message {
-	return nil
-}
-
 // ID get the ID
 func (m MockMessage) ID() string {
 	return m.MessageID
@@ -436,6 +593,14 @@ func (m MockMessage) Reject() error {
 	return nil
 }
 
+// DeadLetter mark the message as unprocessable
+func (m MockMessage) DeadLetter(reason, description string) error {
+	if m.DeadLettered != nil {
+		m.DeadLettered(reason)
+	}
+	return nil
+}
+
 // EventData deserialize json value to type
 func (m MockMessage) EventData() (common.Event, error) {
 	a := common.Event{}
@@ -451,3 +616,423 @@ func (m MockMessage) EventData() (common.Event, error) {
 	}
 	return a, nil
 }
+
+func newMockRecoveredJob(name, messageID, deliveryCount string, conditions ...batchv1.JobConditionType) batchv1.Job {
+	job := batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				dispatcherNameLabel: mockDispatcherName,
+				messageIDLabel:      messageID,
+				deliverycountlabel:  deliveryCount,
+			},
+		},
+	}
+	for _, c := range conditions {
+		job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{Type: c})
+	}
+	return job
+}
+
+func TestRecoverAdoptsRunningJob(t *testing.T) {
+	inMemMockJobStore := []batchv1.Job{
+		newMockRecoveredJob("job-v1", mockMessageID, "1"),
+	}
+
+	create := func(b *batchv1.Job) (*batchv1.Job, error) {
+		inMemMockJobStore = append(inMemMockJobStore, *b)
+		return b, nil
+	}
+
+	list := func() (*batchv1.JobList, error) {
+		return &batchv1.JobList{
+			Items: inMemMockJobStore,
+		}, nil
+	}
+
+	k, _ := NewMockKubernetesProvider(create, list)
+
+	err := k.Recover()
+	if err != nil {
+		t.Error(err)
+	}
+
+	var acceptedMessage bool
+	redelivered := MockMessage{
+		MessageID:          mockMessageID,
+		DeliveryCountValue: 2,
+		Accepted: func() {
+			acceptedMessage = true
+		},
+	}
+
+	err = k.Dispatch(redelivered)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(inMemMockJobStore) != 1 {
+		t.Errorf("Expected running job to be adopted not recreated. Job count Expected: 1 Got: %v", len(inMemMockJobStore))
+	}
+	if k.InProgressCount() != 1 {
+		t.Errorf("In progress count incorrect Expected: 1 Got: %v", k.InProgressCount())
+	}
+
+	// Adopted job completes and should accept the redelivered message
+	inMemMockJobStore[0].Status.Conditions = append(inMemMockJobStore[0].Status.Conditions, batchv1.JobCondition{
+		Type: batchv1.JobComplete,
+	})
+	err = k.Reconcile()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !acceptedMessage {
+		t.Error("Expected redelivered message to be accepted when adopted job completed")
+	}
+	if k.InProgressCount() != 0 {
+		t.Errorf("In progress count incorrect Expected: 0 Got: %v", k.InProgressCount())
+	}
+}
+
+func TestRecoverReplacesFailedJob(t *testing.T) {
+	inMemMockJobStore := []batchv1.Job{
+		newMockRecoveredJob("job-v1", mockMessageID, "1", batchv1.JobFailed),
+		newMockRecoveredJob("job-v2", mockMessageID, "2", batchv1.JobFailed),
+	}
+
+	create := func(b *batchv1.Job) (*batchv1.Job, error) {
+		inMemMockJobStore = append(inMemMockJobStore, *b)
+		return b, nil
+	}
+
+	list := func() (*batchv1.JobList, error) {
+		return &batchv1.JobList{
+			Items: inMemMockJobStore,
+		}, nil
+	}
+
+	k, _ := NewMockKubernetesProvider(create, list)
+
+	k.removeJob = func(j *batchv1.Job) error {
+		for i, job := range inMemMockJobStore {
+			if job.Name == j.Name {
+				inMemMockJobStore = append(inMemMockJobStore[:i], inMemMockJobStore[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("job %s not found", j.Name)
+	}
+
+	err := k.Recover()
+	if err != nil {
+		t.Error(err)
+	}
+
+	var acceptedMessage, rejectedMessage bool
+	redelivered := MockMessage{
+		MessageID:          mockMessageID,
+		DeliveryCountValue: 3,
+		Accepted: func() {
+			acceptedMessage = true
+		},
+		Rejected: func() {
+			rejectedMessage = true
+		},
+	}
+
+	err = k.Dispatch(redelivered)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(inMemMockJobStore) != 1 || inMemMockJobStore[0].Labels[deliverycountlabel] != "3" {
+		t.Fatalf("Expected failed jobs to be replaced by a job for the redelivered message Got: %v", inMemMockJobStore)
+	}
+
+	// The failed jobs are gone so reconciling mustn't reject the redelivered message
+	err = k.Reconcile()
+	if err != nil {
+		t.Error(err)
+	}
+	if rejectedMessage {
+		t.Error("Expected redelivered message not to be rejected because of the failed jobs")
+	}
+
+	inMemMockJobStore[0].Status.Conditions = append(inMemMockJobStore[0].Status.Conditions, batchv1.JobCondition{
+		Type: batchv1.JobComplete,
+	})
+	err = k.Reconcile()
+	if err != nil {
+		t.Error(err)
+	}
+	if !acceptedMessage || rejectedMessage {
+		t.Error("Expected redelivered message to be accepted when its new job completed")
+	}
+}
+
+func TestRecoverCancelsUnclaimedJob(t *testing.T) {
+	inMemMockJobStore := []batchv1.Job{
+		newMockRecoveredJob("job-v1", mockMessageID, "1"),
+		newMockRecoveredJob("job-other", "othermessage", "1"),
+	}
+
+	list := func() (*batchv1.JobList, error) {
+		return &batchv1.JobList{
+			Items: inMemMockJobStore,
+		}, nil
+	}
+
+	k, _ := NewMockKubernetesProvider(nil, list)
+
+	removed := []string{}
+	k.removeJob = func(j *batchv1.Job) error {
+		removed = append(removed, j.Name)
+		return nil
+	}
+
+	err := k.Recover()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Nothing should be cancelled before the claim timeout
+	err = k.Reconcile()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("Expected no jobs to be cancelled before timeout Got: %v", removed)
+	}
+
+	// Simulate the timeout passing for one of the jobs
+	k.recoveredJobs.add(mockMessageID, recoveredJob{
+		name:          "job-v1",
+		deliveryCount: 1,
+		recoveredAt:   time.Now().Add(-recoveryClaimTimeout),
+	})
+
+	err = k.Reconcile()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(removed) != 1 || removed[0] != "job-v1" {
+		t.Errorf("Expected only expired job to be cancelled Got: %v", removed)
+	}
+}
+
+func TestWatchReconcilesJobOnChange(t *testing.T) {
+	inMemMockJobStore := []batchv1.Job{}
+
+	create := func(b *batchv1.Job) (*batchv1.Job, error) {
+		inMemMockJobStore = append(inMemMockJobStore, *b)
+		return b, nil
+	}
+
+	list := func() (*batchv1.JobList, error) {
+		return &batchv1.JobList{
+			Items: []batchv1.Job{},
+		}, nil
+	}
+
+	k, _ := NewMockKubernetesProvider(create, list)
+
+	fakeWatch := watch.NewFake()
+	k.watchJobs = func(resourceVersion string) (watch.Interface, error) {
+		return fakeWatch, nil
+	}
+
+	accepted := make(chan struct{})
+	messageToSend := MockMessage{
+		MessageID: mockMessageID,
+		Accepted: func() {
+			close(accepted)
+		},
+	}
+
+	err := k.Dispatch(messageToSend)
+	if err != nil {
+		t.Error(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watchErr := make(chan error)
+	go func() {
+		watchErr <- k.Watch(ctx)
+	}()
+
+	job := inMemMockJobStore[0]
+	job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{
+		Type: batchv1.JobComplete,
+	})
+	fakeWatch.Modify(&job)
+
+	select {
+	case <-accepted:
+	case <-time.After(5 * time.Second):
+		t.Error("Expected message to be accepted when watch saw the job complete")
+	}
+
+	cancel()
+	err = <-watchErr
+	if err != nil {
+		t.Error(err)
+	}
+
+	if k.InProgressCount() != 0 {
+		t.Errorf("In progress count incorrect Expected: 0 Got: %v", k.InProgressCount())
+	}
+}
+
+func TestWatchRelistsAfterError(t *testing.T) {
+	var listCalls int32
+	list := func() (*batchv1.JobList, error) {
+		atomic.AddInt32(&listCalls, 1)
+		return &batchv1.JobList{
+			ListMeta: metav1.ListMeta{
+				ResourceVersion: "10",
+			},
+		}, nil
+	}
+
+	k, _ := NewMockKubernetesProvider(nil, list)
+
+	watches := make(chan *watch.FakeWatcher, 2)
+	resourceVersions := make(chan string, 2)
+	k.watchJobs = func(resourceVersion string) (watch.Interface, error) {
+		resourceVersions <- resourceVersion
+		fakeWatch := watch.NewFake()
+		watches <- fakeWatch
+		return fakeWatch, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watchErr := make(chan error)
+	go func() {
+		watchErr <- k.Watch(ctx)
+	}()
+
+	// Expire the first watch, a second should be started after relisting
+	(<-watches).Error(&metav1.Status{Reason: metav1.StatusReasonExpired})
+	<-watches
+
+	cancel()
+	err := <-watchErr
+	if err != nil {
+		t.Error(err)
+	}
+
+	if calls := atomic.LoadInt32(&listCalls); calls != 2 {
+		t.Errorf("List calls incorrect Expected: 2 Got: %v", calls)
+	}
+	for i := 0; i < 2; i++ {
+		if rv := <-resourceVersions; rv != "10" {
+			t.Errorf("Expected watch to start from list resource version Expected: 10 Got: %v", rv)
+		}
+	}
+}
+
+func TestWatchResumesFromLastResourceVersionAfterClose(t *testing.T) {
+	var listCalls int32
+	list := func() (*batchv1.JobList, error) {
+		atomic.AddInt32(&listCalls, 1)
+		return &batchv1.JobList{
+			ListMeta: metav1.ListMeta{
+				ResourceVersion: "10",
+			},
+		}, nil
+	}
+
+	k, _ := NewMockKubernetesProvider(nil, list)
+
+	watches := make(chan *watch.FakeWatcher, 2)
+	resourceVersions := make(chan string, 2)
+	k.watchJobs = func(resourceVersion string) (watch.Interface, error) {
+		resourceVersions <- resourceVersion
+		fakeWatch := watch.NewFake()
+		watches <- fakeWatch
+		return fakeWatch, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watchErr := make(chan error)
+	go func() {
+		watchErr <- k.Watch(ctx)
+	}()
+
+	// A job changes then the API server closes the watch, it should be restarted without relisting
+	first := <-watches
+	job := newMockRecoveredJob("job-v1", "othermessage", "1")
+	job.ResourceVersion = "11"
+	first.Modify(&job)
+	first.Stop()
+	<-watches
+
+	cancel()
+	err := <-watchErr
+	if err != nil {
+		t.Error(err)
+	}
+
+	if calls := atomic.LoadInt32(&listCalls); calls != 1 {
+		t.Errorf("List calls incorrect Expected: 1 Got: %v", calls)
+	}
+	if rv := <-resourceVersions; rv != "10" {
+		t.Errorf("Expected first watch to start from list resource version Expected: 10 Got: %v", rv)
+	}
+	if rv := <-resourceVersions; rv != "11" {
+		t.Errorf("Expected watch to resume from last event's resource version Expected: 11 Got: %v", rv)
+	}
+}
+
+func TestWatchRetriesAfterFailure(t *testing.T) {
+	defer func(interval time.Duration) { watchRetryInterval = interval }(watchRetryInterval)
+	watchRetryInterval = time.Millisecond
+
+	var listCalls int32
+	list := func() (*batchv1.JobList, error) {
+		if atomic.AddInt32(&listCalls, 1) == 1 {
+			return nil, fmt.Errorf("api server unavailable")
+		}
+		return &batchv1.JobList{
+			ListMeta: metav1.ListMeta{
+				ResourceVersion: "10",
+			},
+		}, nil
+	}
+
+	k, _ := NewMockKubernetesProvider(nil, list)
+
+	var watchCalls int32
+	watches := make(chan *watch.FakeWatcher, 1)
+	k.watchJobs = func(resourceVersion string) (watch.Interface, error) {
+		if atomic.AddInt32(&watchCalls, 1) == 1 {
+			return nil, fmt.Errorf("api server unavailable")
+		}
+		fakeWatch := watch.NewFake()
+		watches <- fakeWatch
+		return fakeWatch, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watchErr := make(chan error)
+	go func() {
+		watchErr <- k.Watch(ctx)
+	}()
+
+	select {
+	case <-watches:
+	case <-time.After(5 * time.Second):
+		t.Error("Expected watch to be retried after failing to list and watch jobs")
+	}
+
+	cancel()
+	err := <-watchErr
+	if err != nil {
+		t.Error(err)
+	}
+
+	if calls := atomic.LoadInt32(&listCalls); calls != 2 {
+		t.Errorf("List calls incorrect Expected: 2 Got: %v", calls)
+	}
+}
@@ -5,14 +5,18 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/blobstorage"
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/blobstorage/azure"
 	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/documentstorage"
 	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/documentstorage/mongodb"
 	"github.com/lawrencegripper/ion/internal/pkg/messaging"
 	"github.com/lawrencegripper/ion/internal/pkg/types"
 	log "github.com/sirupsen/logrus"
-	"time"
 )
 
+// logContainerName is the container module logs are stored in
+const logContainerName = "logs"
+
 //LogStore captures modules logs
 type LogStore struct {
 	mongoStore   *mongodb.MongoDB
@@ -31,11 +35,12 @@ func NewLogStore(mongoConfig *types.MongoDBConfig, blobConfig *types.AzureBlobCo
 	}
 
 	mongoStore, err := mongodb.NewMongoDB(&mongodb.Config{
-		Enabled:    true,
-		Name:       mongoConfig.Name,
-		Collection: mongoConfig.Collection,
-		Password:   mongoConfig.Password,
-		Port:       mongoConfig.Port,
+		Enabled:          true,
+		ConnectionString: mongoConfig.ConnectionString,
+		Name:             mongoConfig.Name,
+		Collection:       mongoConfig.Collection,
+		Password:         mongoConfig.Password,
+		Port:             mongoConfig.Port,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed initialising mongo connection: %+v", err)
@@ -50,7 +55,7 @@ func NewLogStore(mongoConfig *types.MongoDBConfig, blobConfig *types.AzureBlobCo
 	blobStore := blobClient.GetBlobService()
 	logStore.blobStore = &blobStore
 
-	logStore.containerRef = logStore.blobStore.GetContainerReference("logs")
+	logStore.containerRef = logStore.blobStore.GetContainerReference(logContainerName)
 	_, err = logStore.containerRef.CreateIfNotExists(&storage.CreateContainerOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create log container in blob: %+v", err)
@@ -59,7 +64,9 @@ func NewLogStore(mongoConfig *types.MongoDBConfig, blobConfig *types.AzureBlobCo
 	return &logStore, nil
 }
 
-//StoreLogs persists logs to blob storage then creates a link to them in mongo
+//StoreLogs persists logs to blob storage then stores a reference to them in mongo, such as
+//'azureblob://logs/<correlationid>/<eventid>/<name>-attempt-1.log'. A url to read them is
+//minted when they're read, so the reference doesn't expire.
 func (l *LogStore) StoreLogs(logger *log.Entry, message messaging.Message, stdout string, jobSuceeded bool) error {
 	if l.mongoStore == nil || l.blobStore == nil {
 		return errors.New("logstore not configured, failed to log messages")
@@ -73,35 +80,21 @@ func (l *LogStore) StoreLogs(logger *log.Entry, message messaging.Message, stdou
 
 	stdOutBuffer := bytes.NewBufferString(stdout)
 
-	blobRef := l.containerRef.GetBlobReference(fmt.Sprintf("%s/%s/%s-attempt-%d.log", eventData.Context.CorrelationID, eventData.Context.EventID, eventData.Context.Name, message.DeliveryCount()))
+	blobPath := fmt.Sprintf("%s/%s/%s-attempt-%d.log", eventData.Context.CorrelationID, eventData.Context.EventID, eventData.Context.Name, message.DeliveryCount())
+	blobRef := l.containerRef.GetBlobReference(blobPath)
 	err = blobRef.CreateBlockBlobFromReader(stdOutBuffer, &storage.PutBlobOptions{})
 	if err != nil {
 		logger.WithError(err).Error("failed to get upload logs to blob")
 		return err
 	}
 
-	readStorageOptions := storage.BlobSASOptions{
-		BlobServiceSASPermissions: storage.BlobServiceSASPermissions{
-			Read: true,
-		},
-		SASOptions: storage.SASOptions{
-			Start:  time.Now().Add(time.Duration(-1) * time.Hour),
-			Expiry: time.Now().Add(time.Duration(24) * time.Hour),
-		},
-	}
-	sasURL, err := blobRef.GetSASURI(readStorageOptions)
-	if err != nil {
-		logger.WithError(err).Error("failed to store logs for job in blobstore")
-		return err
-	}
-
 	// This event data will have the parent modules name, we want the logs to be stored under this module
 	// so we update the context
 	eventData.Context.Name = l.moduleName
 
 	err = l.mongoStore.CreateModuleLogs(&documentstorage.ModuleLogs{
 		Context:     eventData.Context,
-		Logs:        sasURL,
+		Logs:        blobstorage.Reference(azure.ReferenceScheme, logContainerName, blobPath),
 		Succeeded:   jobSuceeded,
 		Description: fmt.Sprintf("module:%s-event:%s-attempt:%v", eventData.Context.Name, eventData.Context.EventID, message.DeliveryCount()),
 	})
@@ -1,6 +1,8 @@
 package providers
 
 import (
+	"context"
+
 	"github.com/lawrencegripper/ion/internal/pkg/messaging"
 	log "github.com/sirupsen/logrus"
 )
@@ -13,6 +15,13 @@ type Provider interface {
 	GetActiveMessages() []messaging.Message
 }
 
+// Watcher is implemented by providers which can react to job status changes as they happen.
+// Watch blocks until the context is done, retrying its own errors. The dispatcher still calls
+// Reconcile, but less often, when a provider is a Watcher.
+type Watcher interface {
+	Watch(ctx context.Context) error
+}
+
 //GetLoggerForMessage Adds context fields to the logger for the message
 func GetLoggerForMessage(message messaging.Message, l *log.Entry) *log.Entry {
 	if message == nil {
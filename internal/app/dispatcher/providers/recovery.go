@@ -0,0 +1,97 @@
+package providers
+
+import (
+	"sync"
+	"time"
+)
+
+// recoveryClaimTimeout is how long a job found when the dispatcher starts is kept waiting
+// for its message to be redelivered. ServiceBus redelivers a message once its lock expires,
+// which is at most 5 minutes, so a job which is still unclaimed after this has lost its
+// message (for example it was dead lettered) and is cancelled.
+const recoveryClaimTimeout = time.Duration(10) * time.Minute
+
+// Recoverer is implemented by providers which can rebuild their in-flight state from the
+// jobs they created before the dispatcher restarted. Recover is called once, before
+// any messages are dispatched.
+//
+// The messages for recovered jobs are lost with the old process so they can't be accepted or
+// rejected. Instead a recovered job is held until ServiceBus redelivers its message:
+// - if the job is running or succeeded the message adopts the job rather than starting a new one
+// - if the job failed it's removed and replaced by a new job for the message
+// Jobs for earlier attempts at the message are removed when it's redelivered, they're
+// matched to the message by its ID so would otherwise be reconciled as its job
+// - if the message isn't redelivered within `recoveryClaimTimeout` the job is cancelled
+type Recoverer interface {
+	Recover() error
+}
+
+// recoveredJob is a job found when the dispatcher started which hasn't been claimed by a message yet
+type recoveredJob struct {
+	name          string
+	deliveryCount int
+	failed        bool
+	recoveredAt   time.Time
+	// superseded are the names of earlier, failed, attempts at the same message
+	superseded []string
+}
+
+// recoveredJobStore holds recovered jobs keyed by message ID until they're claimed or expire
+type recoveredJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]recoveredJob
+}
+
+func newRecoveredJobStore() *recoveredJobStore {
+	return &recoveredJobStore{
+		jobs: map[string]recoveredJob{},
+	}
+}
+
+// add records a recovered job. When several jobs exist for the same message
+// the latest attempt, the one with the highest delivery count, is kept and
+// the earlier attempts are recorded as superseded by it.
+func (s *recoveredJobStore) add(messageID string, job recoveredJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.jobs[messageID]; ok {
+		if existing.deliveryCount > job.deliveryCount {
+			existing.superseded = append(existing.superseded, job.name)
+			s.jobs[messageID] = existing
+			return
+		}
+		job.superseded = append(existing.superseded, existing.name)
+	}
+	s.jobs[messageID] = job
+}
+
+// claim removes and returns the recovered job for the message, if there is one
+func (s *recoveredJobStore) claim(messageID string) (recoveredJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[messageID]
+	if ok {
+		delete(s.jobs, messageID)
+	}
+	return job, ok
+}
+
+// expire removes and returns the named recovered job for the message if it's
+// been waiting longer than `recoveryClaimTimeout` to be claimed
+func (s *recoveredJobStore) expire(messageID, name string, now time.Time) (recoveredJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[messageID]
+	if !ok || job.name != name || now.Sub(job.recoveredAt) < recoveryClaimTimeout {
+		return recoveredJob{}, false
+	}
+	delete(s.jobs, messageID)
+	return job, true
+}
+
+// count returns the number of recovered jobs waiting to be claimed
+func (s *recoveredJobStore) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.jobs)
+}
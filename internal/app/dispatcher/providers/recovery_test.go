@@ -0,0 +1,47 @@
+package providers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecoveredJobStoreKeepsLatestAttempt(t *testing.T) {
+	store := newRecoveredJobStore()
+	now := time.Now()
+
+	store.add("message", recoveredJob{name: "v2", deliveryCount: 2, recoveredAt: now})
+	store.add("message", recoveredJob{name: "v1", deliveryCount: 1, failed: true, recoveredAt: now})
+
+	job, ok := store.claim("message")
+	if !ok {
+		t.Fatal("Expected to claim recovered job")
+	}
+	if job.name != "v2" {
+		t.Errorf("Expected latest attempt to be kept Expected: v2 Got: %v", job.name)
+	}
+	if len(job.superseded) != 1 || job.superseded[0] != "v1" {
+		t.Errorf("Expected earlier attempt to be superseded Expected: [v1] Got: %v", job.superseded)
+	}
+	if _, ok := store.claim("message"); ok {
+		t.Error("Expected job to only be claimed once")
+	}
+}
+
+func TestRecoveredJobStoreExpire(t *testing.T) {
+	store := newRecoveredJobStore()
+	recoveredAt := time.Now()
+	store.add("message", recoveredJob{name: "job", recoveredAt: recoveredAt})
+
+	if _, expired := store.expire("message", "job", recoveredAt.Add(recoveryClaimTimeout-time.Second)); expired {
+		t.Error("Expected job not to expire before timeout")
+	}
+	if _, expired := store.expire("message", "otherjob", recoveredAt.Add(recoveryClaimTimeout)); expired {
+		t.Error("Expected only the recovered job to expire")
+	}
+	if _, expired := store.expire("message", "job", recoveredAt.Add(recoveryClaimTimeout)); !expired {
+		t.Error("Expected job to expire after timeout")
+	}
+	if store.count() != 0 {
+		t.Errorf("Expected expired job to be removed Got: %v", store.count())
+	}
+}
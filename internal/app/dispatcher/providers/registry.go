@@ -0,0 +1,134 @@
+package providers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lawrencegripper/ion/internal/pkg/types"
+	"github.com/spf13/pflag"
+)
+
+// Names of the providers built into the dispatcher
+const (
+	KubernetesProviderName = "kubernetes"
+	AzureBatchProviderName = "azurebatch"
+	DockerProviderName     = "docker"
+)
+
+// Constructor creates a provider from the dispatcher configuration and the args shared by all handlers
+type Constructor func(config *types.Configuration, sharedHandlerArgs []string) (Provider, error)
+
+// Settings reads the dispatcher's settings, from its flags, environment or config file
+type Settings interface {
+	GetString(key string) string
+	GetBool(key string) bool
+	GetInt(key string) int
+	GetStringSlice(key string) []string
+}
+
+// Registration describes a provider which the dispatcher can select with the `provider` setting
+type Registration struct {
+	// Name used to select the provider, matched case insensitively
+	Name string
+	// AddFlags adds the provider's settings to the dispatcher's flags, they're named
+	// `<section>.<setting>` after the provider's section in the dispatcher config
+	AddFlags func(flags *pflag.FlagSet)
+	// Configure reads the provider's settings into the config when the provider is selected
+	Configure func(config *types.Configuration, settings Settings) error
+	// New creates an instance of the provider
+	New Constructor
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Registration{}
+)
+
+// Register makes a provider available to the dispatcher. It panics if the
+// registration is invalid or a provider is already registered with the same name.
+func Register(r Registration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	name := strings.ToLower(r.Name)
+	if name == "" {
+		panic("providers: Register called with empty name")
+	}
+	if r.New == nil {
+		panic("providers: Register called with nil constructor for " + name)
+	}
+	if _, exists := registry[name]; exists {
+		panic("providers: Register called twice for provider " + name)
+	}
+	r.Name = name
+	registry[name] = r
+}
+
+// unregister removes a provider, allowing tests to clean up their registrations
+func unregister(name string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	delete(registry, strings.ToLower(name))
+}
+
+// Lookup returns the registration for the named provider
+func Lookup(name string) (Registration, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	r, ok := registry[strings.ToLower(name)]
+	return r, ok
+}
+
+// Registered returns the sorted names of all registered providers
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AddFlags adds the settings of every registered provider to the flags
+func AddFlags(flags *pflag.FlagSet) {
+	for _, name := range Registered() {
+		r, _ := Lookup(name)
+		if r.AddFlags != nil {
+			r.AddFlags(flags)
+		}
+	}
+}
+
+// Configure reads the settings of the provider selected by `config.Provider` into the config
+func Configure(config *types.Configuration, settings Settings) error {
+	r, ok := Lookup(config.Provider)
+	if !ok {
+		return fmt.Errorf("unknown provider '%s', registered providers: %s", config.Provider, strings.Join(Registered(), ", "))
+	}
+	if r.Configure == nil {
+		return nil
+	}
+	return r.Configure(config, settings)
+}
+
+// NewProvider creates the provider selected by `config.Provider`
+func NewProvider(config *types.Configuration, sharedHandlerArgs []string) (Provider, error) {
+	if config == nil {
+		return nil, fmt.Errorf("invalid config. Cannot be nil")
+	}
+	if config.Provider == "" {
+		return nil, fmt.Errorf("no provider selected, registered providers: %s", strings.Join(Registered(), ", "))
+	}
+	r, ok := Lookup(config.Provider)
+	if !ok {
+		return nil, fmt.Errorf("unknown provider '%s', registered providers: %s", config.Provider, strings.Join(Registered(), ", "))
+	}
+	return r.New(config, sharedHandlerArgs)
+}
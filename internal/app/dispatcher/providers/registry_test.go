@@ -0,0 +1,101 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lawrencegripper/ion/internal/pkg/types"
+	"github.com/spf13/pflag"
+)
+
+func TestRegistryContainsBuiltInProviders(t *testing.T) {
+	for _, name := range []string{KubernetesProviderName, AzureBatchProviderName, DockerProviderName} {
+		if _, ok := Lookup(name); !ok {
+			t.Errorf("Expected provider %s to be registered", name)
+		}
+	}
+}
+
+func TestRegistryLookupIgnoresCase(t *testing.T) {
+	if _, ok := Lookup("AzureBatch"); !ok {
+		t.Error("Expected lookup to ignore case")
+	}
+}
+
+func TestNewProviderUnknownName(t *testing.T) {
+	_, err := NewProvider(&types.Configuration{Provider: "doesntexist"}, []string{})
+	if err == nil {
+		t.Error("Expected error for unknown provider... didn't see one!")
+		return
+	}
+	if !strings.Contains(err.Error(), "doesntexist") || !strings.Contains(err.Error(), KubernetesProviderName) {
+		t.Errorf("Expected error to name the provider and list registered providers. Got: %v", err)
+	}
+}
+
+func TestNewProviderUsesRegisteredConstructor(t *testing.T) {
+	mock, _ := NewMockDockerProvider(nil)
+	Register(Registration{
+		Name: "MockProvider",
+		New: func(config *types.Configuration, sharedHandlerArgs []string) (Provider, error) {
+			return mock, nil
+		},
+	})
+	defer unregister("MockProvider")
+
+	p, err := NewProvider(&types.Configuration{Provider: "mockprovider"}, []string{})
+	if err != nil {
+		t.Error(err)
+	}
+	if p != mock {
+		t.Error("Expected provider from registered constructor")
+	}
+}
+
+type mockSettings map[string]string
+
+func (s mockSettings) GetString(key string) string        { return s[key] }
+func (s mockSettings) GetBool(key string) bool            { return s[key] == "true" }
+func (s mockSettings) GetInt(key string) int              { return 0 }
+func (s mockSettings) GetStringSlice(key string) []string { return nil }
+
+func TestConfigureUsesSelectedProvider(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	AddFlags(flags)
+	for _, name := range []string{"kubernetes.namespace", "azurebatch.poolid", "docker.workingdir"} {
+		if flags.Lookup(name) == nil {
+			t.Errorf("Expected flag %s to be added by its provider", name)
+		}
+	}
+
+	config := &types.Configuration{Provider: DockerProviderName}
+	err := Configure(config, mockSettings{"docker.workingdir": "/tmp/ion", "azurebatch.poolid": "pool"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Docker == nil || config.Docker.WorkingDir != "/tmp/ion" {
+		t.Errorf("Expected the docker config to be read Got: %+v", config.Docker)
+	}
+	if config.AzureBatch != nil || config.Kubernetes != nil {
+		t.Error("Expected only the selected provider to be configured")
+	}
+
+	if err := Configure(&types.Configuration{Provider: "doesntexist"}, mockSettings{}); err == nil {
+		t.Error("Expected an error configuring an unknown provider")
+	}
+}
+
+func TestRegisterDuplicatePanics(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expected registering a duplicate provider to panic")
+		}
+	}()
+
+	Register(Registration{
+		Name: KubernetesProviderName,
+		New: func(config *types.Configuration, sharedHandlerArgs []string) (Provider, error) {
+			return nil, nil
+		},
+	})
+}
@@ -2,61 +2,125 @@ package dispatcher
 
 import (
 	"context"
-	"pack.ag/amqp"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/lawrencegripper/ion/internal/app/dispatcher/join"
 	"github.com/lawrencegripper/ion/internal/app/dispatcher/providers" //TODO couldn't it be moved into internal/pkg ?
-	"github.com/lawrencegripper/ion/internal/pkg/messaging"            //TODO couldn't it be moved into internal/pkg ?
-	"github.com/lawrencegripper/ion/internal/pkg/servicebus"
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/documentstorage/mongodb"
+	_ "github.com/lawrencegripper/ion/internal/pkg/jetstream" // Register the NATS JetStream broker
+	_ "github.com/lawrencegripper/ion/internal/pkg/kafka"     // Register the Kafka broker
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"   //TODO couldn't it be moved into internal/pkg ?
+	"github.com/lawrencegripper/ion/internal/pkg/messaging/filter"
+	_ "github.com/lawrencegripper/ion/internal/pkg/messaging/inmemory" // Register the in-memory broker
+	_ "github.com/lawrencegripper/ion/internal/pkg/rabbitmq"           // Register the RabbitMQ broker
+	_ "github.com/lawrencegripper/ion/internal/pkg/servicebus"         // Register the ServiceBus broker
 	"github.com/lawrencegripper/ion/internal/pkg/types"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// lockRenewalInterval is how often message locks are renewed. It must be shorter
+// than the lock duration on the ServiceBus subscription.
+const lockRenewalInterval = time.Duration(45) * time.Second
+
+// reconcileInterval is how often the provider reconciles all of its jobs
+const reconcileInterval = time.Duration(15) * time.Second
+
+// watchResyncInterval replaces reconcileInterval for providers which watch for job changes,
+// the full reconcile is then only a safety net for missed events and cleaning up old jobs
+const watchResyncInterval = time.Duration(5) * time.Minute
+
+// capacityPollInterval is how often the provider is checked for free capacity when
+// the number of in progress jobs is at 'job.maxconcurrent'
+const capacityPollInterval = time.Second
+
+// minReceiveBackoff and maxReceiveBackoff bound how long the dispatcher waits before
+// receiving again after ServiceBus returns an error
+const (
+	minReceiveBackoff = time.Second
+	maxReceiveBackoff = time.Duration(30) * time.Second
+)
+
+// maxConsecutiveReceiveErrors is how many receives in a row can fail, a few minutes of retries,
+// before the dispatcher exits. Errors which last that long aren't transient, for example a
+// closed receiver link never recovers, so the dispatcher is restarted with a new connection.
+const maxConsecutiveReceiveErrors = 10
+
+// listenerStats counts messages the dispatcher couldn't dispatch, they're logged with the queue depth
+type listenerStats struct {
+	poisonMessages int64
+	receiveErrors  int64
+}
+
 // Run will start the dispatcher server and wait for new AMQP messages
 func Run(cfg *types.Configuration) {
 	ctx := context.Background()
 
-	amqpConnection := servicebus.NewAmqpConnection(ctx, cfg)
-	handlerArgs := providers.GetSharedHandlerArgs(cfg, amqpConnection.AccessKeys)
+	log.WithField("broker", cfg.Broker).Info("Creating broker...")
+	broker, err := messaging.NewBroker(ctx, cfg)
+	if err != nil {
+		log.WithError(err).WithField("broker", cfg.Broker).Panic("Couldn't create broker")
+	}
+	handlerArgs := providers.GetSharedHandlerArgs(cfg, broker.HandlerArgs())
+
+	subscriptionFilter, err := filter.Parse(cfg.SubscriptionFilter)
+	if err != nil {
+		log.WithError(err).Panic("Invalid subscription filter")
+	}
 
-	var provider providers.Provider
+	joiner, err := getJoiner(cfg)
+	if err != nil {
+		log.WithError(err).Panic("Couldn't create join")
+	}
 
-	if cfg.AzureBatch != nil {
-		log.Info("Using Azure batch provider...")
-		batchProvider, err := providers.NewAzureBatchProvider(cfg, handlerArgs)
-		if err != nil {
-			log.WithError(err).Panic("Couldn't create azure batch provider")
-		}
-		provider = batchProvider
-	} else {
-		log.Info("Defaulting to using Kubernetes provider...")
-		k8sProvider, err := providers.NewKubernetesProvider(cfg, handlerArgs)
+	log.WithField("provider", cfg.Provider).Info("Creating provider...")
+	provider, err := providers.NewProvider(cfg, handlerArgs)
+	if err != nil {
+		log.WithError(err).WithField("provider", cfg.Provider).Panic("Couldn't create provider")
+	}
+
+	// Pick up jobs started before a restart so their redelivered messages aren't run twice
+	if recoverer, ok := provider.(providers.Recoverer); ok {
+		err := recoverer.Recover()
 		if err != nil {
-			log.WithError(err).Panic("Couldn't create kubernetes provider")
+			log.WithError(err).WithField("provider", cfg.Provider).Panic("Couldn't recover in-flight jobs")
 		}
-		provider = k8sProvider
 	}
 
+	// Failed messages are held by the scheduler until their retry delay has elapsed
+	retries := messaging.NewRetryScheduler(getRetryPolicy(cfg.Job), cfg.Job.RetryCount+1)
+
+	stats := &listenerStats{}
+
 	var wg sync.WaitGroup
 
+	resyncInterval := reconcileInterval
+	if watcher, ok := provider.(providers.Watcher); ok {
+		resyncInterval = watchResyncInterval
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Watch retries its own failures so it only returns once the context is done,
+			// the periodic reconcile keeps jobs up to date if it stops early
+			err := watcher.Watch(ctx)
+			if err != nil {
+				log.WithError(err).Error("Stopped watching jobs ....")
+			}
+		}()
+	}
+
 	wg.Add(3)
 	go func() {
 		defer wg.Done()
 		for {
-			// Renew message locks with ServiceBus
-			//https://docs.microsoft.com/en-us/azure/service-bus-messaging/service-bus-amqp-request-response#message-renew-lock
-			time.Sleep(time.Duration(45) * time.Second)
-
-			activeMessages := provider.GetActiveMessages()
-			messagesAMQP := make([]*amqp.Message, 0, len(activeMessages))
-			for _, m := range activeMessages {
-				originalMessage := m.GetAMQPMessage()
-				messagesAMQP = append(messagesAMQP, originalMessage)
-			}
+			// Renew message locks with the broker
+			time.Sleep(lockRenewalInterval)
 
-			err := amqpConnection.RenewLocks(ctx, messagesAMQP)
+			activeMessages := append(provider.GetActiveMessages(), retries.Pending()...)
+			err := broker.RenewLocks(ctx, activeMessages)
 			if err != nil {
 				log.WithError(err).Error("failed to renew locks")
 			}
@@ -64,40 +128,78 @@ func Run(cfg *types.Configuration) {
 	}()
 	go func() {
 		defer wg.Done()
+		receiveBackoff := minReceiveBackoff
+		consecutiveReceiveErrors := 0
 		for {
-			message, err := amqpConnection.Receiver.Receive(ctx)
+			message, err := broker.Receive(ctx)
 			if err != nil {
-				// Todo: Investigate the type of error here. If this could be triggered by a poisened message
-				// app shouldn't panic.
-				log.WithError(err).Panic("Error received dequeuing message")
-			}
-
-			if message == nil {
-				log.WithError(err).Panic("Error received dequeuing message - nil message")
+				atomic.AddInt64(&stats.receiveErrors, 1)
+				consecutiveReceiveErrors++
+				if consecutiveReceiveErrors >= maxConsecutiveReceiveErrors {
+					log.WithError(err).WithField("consecutiveErrors", consecutiveReceiveErrors).Panic("Couldn't dequeue messages, exiting to reconnect to the broker")
+				}
+				log.WithError(err).WithField("retryIn", receiveBackoff.String()).Error("Error received dequeuing message")
+				time.Sleep(receiveBackoff)
+				receiveBackoff = nextReceiveBackoff(receiveBackoff)
+				continue
 			}
+			receiveBackoff = minReceiveBackoff
+			consecutiveReceiveErrors = 0
 
-			wrapper := messaging.NewAmqpMessageWrapper(message)
+			wrapper := retries.Wrap(message)
 			contextualLogger := providers.GetLoggerForMessage(wrapper, log.NewEntry(log.StandardLogger()))
 			contextualLogger.Debug("message received")
 
-			if wrapper.DeliveryCount() > cfg.Job.RetryCount+1 {
-				contextualLogger.Error("message re-received when above retryCount. AMQP provider wrongly redelivered message.")
-				err := wrapper.Reject()
+			if deadLetterPoisonMessage(wrapper, contextualLogger) {
+				atomic.AddInt64(&stats.poisonMessages, 1)
+				continue
+			}
+
+			if skipFilteredMessage(wrapper, subscriptionFilter, contextualLogger) {
+				continue
+			}
+
+			if joiner != nil {
+				joined, ready := joinMessage(wrapper, joiner, contextualLogger)
+				if !ready {
+					continue
+				}
+				wrapper = joined
+			}
+
+			if deadLetterOverRetriedMessage(wrapper, cfg.Job.RetryCount, contextualLogger) {
+				continue
+			}
+			// Hold the message while the provider is at capacity. It's locked from the moment it's
+			// received so its lock is renewed here until it's dispatched, the provider's active
+			// messages are renewed after that. The events joined with a message were accepted
+			// when they were recorded, so only the message which completed the join is locked.
+			waited := waitForCapacity(provider, cfg.Job.MaxConcurrent, capacityPollInterval, lockRenewalInterval, func() {
+				err := broker.RenewLocks(ctx, []messaging.Message{wrapper})
 				if err != nil {
-					contextualLogger.Error("error rejecting message")
+					contextualLogger.WithError(err).Error("failed to renew lock on message waiting for capacity")
 				}
+			})
+			if waited > 0 {
+				contextualLogger.WithField("waited", waited.String()).Info("dispatching message held while at capacity")
 			}
+
 			err = provider.Dispatch(wrapper)
 			if err != nil {
 				contextualLogger.WithError(err).Error("Couldn't dispatch message to kubernetes provider")
 			}
 
 			contextualLogger.Debug("message dispatched")
-			queueStats, err := amqpConnection.GetQueueDepth()
+			queueStats, err := broker.GetQueueDepth()
 			if err != nil {
 				contextualLogger.WithError(err).Error("failed getting queue depth from listener")
 			}
-			contextualLogger.WithField("activeMessageCount", queueStats.ActiveMessageCount).WithField("deadLetteredMessageCount", queueStats.DeadLetterMessageCount).Info("listenerStats")
+			contextualLogger.WithFields(log.Fields{
+				"activeMessageCount":       queueStats.ActiveMessageCount,
+				"deadLetteredMessageCount": queueStats.DeadLetterMessageCount,
+				"poisonMessageCount":       atomic.LoadInt64(&stats.poisonMessages),
+				"receiveErrorCount":        atomic.LoadInt64(&stats.receiveErrors),
+			}).Info("listenerStats")
 		}
 	}()
 
@@ -111,9 +213,9 @@ func Run(cfg *types.Configuration) {
 				// Todo: Should this panic here? Should we tolerate a few failures (k8s upgade causing masters not to be vailable for example?)
 				log.WithError(err).Panic("Failed to reconcile ....")
 			}
-			log.WithField("inProgress", provider.InProgressCount()).Info("providerStats")
+			log.WithField("inProgress", provider.InProgressCount()).WithField("maxConcurrent", cfg.Job.MaxConcurrent).Info("providerStats")
 
-			time.Sleep(time.Second * 15)
+			time.Sleep(resyncInterval)
 
 		}
 	}()
@@ -127,3 +229,161 @@ func Run(cfg *types.Configuration) {
 	//	fmt.Printf("Error %s \n", err.Error())
 	//}
 }
+
+// deadLetterPoisonMessage dead letters a message which would fail however many times it was
+// retried, for example because its body isn't a valid event. Returns true if the message was dead lettered.
+func deadLetterPoisonMessage(message messaging.Message, logger *log.Entry) bool {
+	_, err := message.EventData()
+	poisonErr, ok := err.(*messaging.PoisonMessageError)
+	if !ok {
+		return false
+	}
+
+	logger.WithError(err).WithField("reason", poisonErr.Reason).Error("dead lettering poison message")
+	err = message.DeadLetter(poisonErr.Reason, poisonErr.Err.Error())
+	if err != nil {
+		logger.WithError(err).Error("failed to dead letter poison message")
+	}
+	return true
+}
+
+// deadLetterOverRetriedMessage dead letters a message which has been delivered more times than
+// the module's retries allow, the broker should already have dead lettered it. Rejecting it would
+// only redeliver it again. Returns true if the message was dead lettered.
+func deadLetterOverRetriedMessage(message messaging.Message, retryCount int, logger *log.Entry) bool {
+	if message.DeliveryCount() <= retryCount+1 {
+		return false
+	}
+	logger.Error("message re-received when above retryCount. AMQP provider wrongly redelivered message, dead lettering it")
+	err := message.DeadLetter(messaging.DeadLetterReasonMaxDeliveryCountExceeded,
+		fmt.Sprintf("message was delivered %d times, more than the %d retries allowed", message.DeliveryCount(), retryCount))
+	if err != nil {
+		logger.WithError(err).Error("failed to dead letter message above retryCount")
+	}
+	return true
+}
+
+// skipFilteredMessage accepts a message whose event doesn't match the module's subscription
+// filter so no job is run for it. Brokers which can't filter messages on the server deliver
+// every event on the topic. Returns true if the message was skipped.
+func skipFilteredMessage(message messaging.Message, subscriptionFilter *filter.Filter, logger *log.Entry) bool {
+	if subscriptionFilter.IsEmpty() {
+		return false
+	}
+	event, err := message.EventData()
+	if err != nil || subscriptionFilter.Match(event.Data) {
+		return false
+	}
+
+	logger.WithField("filter", subscriptionFilter.String()).Debug("skipping message which doesn't match the subscription filter")
+	err = message.Accept()
+	if err != nil {
+		logger.WithError(err).Error("failed to accept message skipped by the subscription filter")
+	}
+	return true
+}
+
+// joinMessage records the message's event with the joiner and returns the message to dispatch once
+// the event completes its join. Otherwise the message is settled and false is returned, it's accepted
+// while the join waits for more events, dead lettered if it can't be joined and rejected, so it's
+// retried, if the join couldn't be recorded.
+func joinMessage(message messaging.Message, joiner *join.Joiner, logger *log.Entry) (messaging.Message, bool) {
+	joined, ready, err := joiner.Join(message)
+	if poisonErr, ok := err.(*messaging.PoisonMessageError); ok {
+		logger.WithError(err).WithField("reason", poisonErr.Reason).Error("dead lettering message which can't be joined")
+		err = message.DeadLetter(poisonErr.Reason, poisonErr.Err.Error())
+		if err != nil {
+			logger.WithError(err).Error("failed to dead letter message which can't be joined")
+		}
+		return nil, false
+	}
+	if err != nil {
+		logger.WithError(err).Error("failed to join message, rejecting it")
+		err = message.Reject()
+		if err != nil {
+			logger.WithError(err).Error("error rejecting message")
+		}
+		return nil, false
+	}
+	if !ready {
+		logger.Debug("accepting message, its join is waiting for more events")
+		err = message.Accept()
+		if err != nil {
+			logger.WithError(err).Error("failed to accept message waiting to be joined")
+		}
+		return nil, false
+	}
+	logger.Info("join completed, dispatching message")
+	return joined, true
+}
+
+// getJoiner creates the joiner for a module which joins the events it subscribes to, it's nil
+// when the join isn't enabled. Joins are stored in the handler's MongoDB database when it's configured.
+func getJoiner(cfg *types.Configuration) (*join.Joiner, error) {
+	if cfg.Join == nil || !cfg.Join.Enabled {
+		return nil, nil
+	}
+	eventTypes := messaging.SplitEventTypes(cfg.SubscribesToEvent)
+	mongoConfig := cfg.Handler.MongoDBDocumentStorageProvider
+	if mongoConfig == nil || (mongoConfig.Name == "" && mongoConfig.ConnectionString == "") {
+		log.Warn("no MongoDB configured, joins are kept in memory and lost when the dispatcher restarts")
+		// Keep a completed join until every retry of the message which completed it has run
+		retention := time.Duration(cfg.Job.RetryCount+1) *
+			(time.Duration(cfg.Job.MaxRunningTimeMins)*time.Minute + time.Duration(cfg.Job.RetryMaxDelaySecs)*time.Second)
+		return join.NewJoiner(eventTypes, join.NewMemoryStore(retention, time.Duration(cfg.Join.ExpiryMins)*time.Minute))
+	}
+	store, err := join.NewMongoDBStore(&mongodb.Config{
+		Enabled:          true,
+		ConnectionString: mongoConfig.ConnectionString,
+		Name:             mongoConfig.Name,
+		Password:         mongoConfig.Password,
+		Collection:       cfg.Join.Collection,
+		Port:             mongoConfig.Port,
+	}, cfg.ModuleName, time.Duration(cfg.Join.ExpiryMins)*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	return join.NewJoiner(eventTypes, store)
+}
+
+// nextReceiveBackoff doubles the wait before receiving again, up to maxReceiveBackoff
+func nextReceiveBackoff(current time.Duration) time.Duration {
+	next := current * 2
+	if next > maxReceiveBackoff {
+		return maxReceiveBackoff
+	}
+	return next
+}
+
+// getRetryPolicy creates the backoff used to delay the redelivery of failed messages
+func getRetryPolicy(job *types.JobConfig) messaging.RetryPolicy {
+	return messaging.RetryPolicy{
+		InitialDelay: time.Duration(job.RetryInitialDelaySecs) * time.Second,
+		Multiplier:   job.RetryMultiplier,
+		MaxDelay:     time.Duration(job.RetryMaxDelaySecs) * time.Second,
+		Jitter:       job.RetryJitter,
+	}
+}
+
+// waitForCapacity blocks until the provider has fewer than maxConcurrent jobs in progress
+// and returns how long it waited. A maxConcurrent of 0 or less means there is no limit.
+// renew is called when the wait starts, and then every renewInterval, to keep the lock on the
+// message being held. The message may have been prefetched so its lock is renewed straight away.
+func waitForCapacity(provider providers.Provider, maxConcurrent int, pollInterval, renewInterval time.Duration, renew func()) time.Duration {
+	if maxConcurrent <= 0 || provider.InProgressCount() < maxConcurrent {
+		return 0
+	}
+
+	start := time.Now()
+	log.WithField("inProgress", provider.InProgressCount()).WithField("maxConcurrent", maxConcurrent).Info("provider at capacity, holding message until a job completes")
+	renew()
+	renewed := start
+	for provider.InProgressCount() >= maxConcurrent {
+		if time.Since(renewed) >= renewInterval {
+			renew()
+			renewed = time.Now()
+		}
+		time.Sleep(pollInterval)
+	}
+	return time.Since(start)
+}
@@ -0,0 +1,191 @@
+package dispatcher
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/app/dispatcher/join"
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging/filter"
+	log "github.com/sirupsen/logrus"
+)
+
+type mockProvider struct {
+	inProgress int32
+}
+
+func (p *mockProvider) Reconcile() error                         { return nil }
+func (p *mockProvider) Dispatch(message messaging.Message) error { return nil }
+func (p *mockProvider) GetActiveMessages() []messaging.Message   { return nil }
+func (p *mockProvider) InProgressCount() int {
+	return int(atomic.LoadInt32(&p.inProgress))
+}
+
+func TestWaitForCapacityUnlimited(t *testing.T) {
+	p := &mockProvider{inProgress: 100}
+
+	waited := waitForCapacity(p, 0, time.Millisecond, time.Millisecond, func() { t.Error("Expected no renewal when maxConcurrent is 0") })
+	if waited != 0 {
+		t.Errorf("Expected no wait when maxConcurrent is 0 Got: %v", waited)
+	}
+}
+
+func TestWaitForCapacityBelowLimit(t *testing.T) {
+	p := &mockProvider{inProgress: 1}
+
+	waited := waitForCapacity(p, 2, time.Second, time.Second, func() { t.Error("Expected no renewal when below maxConcurrent") })
+	if waited >= time.Second {
+		t.Errorf("Expected no wait when below maxConcurrent Got: %v", waited)
+	}
+}
+
+func TestWaitForCapacityBlocksUntilJobCompletes(t *testing.T) {
+	p := &mockProvider{inProgress: 2}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		atomic.StoreInt32(&p.inProgress, 1)
+	}()
+
+	var renewals int32
+	waited := waitForCapacity(p, 2, time.Millisecond, 20*time.Millisecond, func() { atomic.AddInt32(&renewals, 1) })
+	if waited < 50*time.Millisecond {
+		t.Errorf("Expected to wait for a job to complete Got: %v", waited)
+	}
+	if renewals < 2 {
+		t.Errorf("Expected the held message's lock to be renewed while waiting Got: %v renewals", renewals)
+	}
+	if p.InProgressCount() >= 2 {
+		t.Error("Returned while provider still at capacity")
+	}
+}
+
+type mockMessage struct {
+	event            common.Event
+	eventErr         error
+	deadLetterReason string
+	accepted         bool
+	deliveryCount    int
+}
+
+func (m *mockMessage) ID() string         { return "1" }
+func (m *mockMessage) DeliveryCount() int { return m.deliveryCount }
+func (m *mockMessage) Body() []byte       { return nil }
+func (m *mockMessage) Accept() error {
+	m.accepted = true
+	return nil
+}
+func (m *mockMessage) Reject() error { return nil }
+func (m *mockMessage) DeadLetter(reason, description string) error {
+	m.deadLetterReason = reason
+	return nil
+}
+func (m *mockMessage) EventData() (common.Event, error) { return m.event, m.eventErr }
+
+func TestDeadLetterPoisonMessage(t *testing.T) {
+	m := &mockMessage{
+		eventErr: &messaging.PoisonMessageError{
+			Reason: messaging.DeadLetterReasonMalformedEvent,
+			Err:    errors.New("invalid character"),
+		},
+	}
+
+	deadLettered := deadLetterPoisonMessage(m, log.NewEntry(log.StandardLogger()))
+	if !deadLettered {
+		t.Error("Expected poison message to be dead lettered")
+	}
+	if m.deadLetterReason != messaging.DeadLetterReasonMalformedEvent {
+		t.Errorf("Dead letter reason incorrect Expected: %v Got: %v", messaging.DeadLetterReasonMalformedEvent, m.deadLetterReason)
+	}
+}
+
+func TestDeadLetterPoisonMessageIgnoresValidMessage(t *testing.T) {
+	m := &mockMessage{}
+
+	deadLettered := deadLetterPoisonMessage(m, log.NewEntry(log.StandardLogger()))
+	if deadLettered {
+		t.Error("Expected valid message not to be dead lettered")
+	}
+}
+
+func TestDeadLetterOverRetriedMessage(t *testing.T) {
+	logger := log.NewEntry(log.StandardLogger())
+	m := &mockMessage{deliveryCount: 3}
+	if deadLetterOverRetriedMessage(m, 2, logger) || m.deadLetterReason != "" {
+		t.Error("Expected a message on its last retry to be dispatched")
+	}
+	m = &mockMessage{deliveryCount: 4}
+	if !deadLetterOverRetriedMessage(m, 2, logger) || m.deadLetterReason != messaging.DeadLetterReasonMaxDeliveryCountExceeded {
+		t.Errorf("Expected a message delivered after its last retry to be dead lettered Got: %v", m.deadLetterReason)
+	}
+}
+
+func TestSkipFilteredMessage(t *testing.T) {
+	f, err := filter.Parse("mime=video/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name    string
+		filter  *filter.Filter
+		data    common.KeyValuePairs
+		skipped bool
+	}{
+		{name: "no filter", filter: &filter.Filter{}, skipped: false},
+		{name: "matching", filter: f, data: common.KeyValuePairs{{Key: "mime", Value: "video/mp4"}}, skipped: false},
+		{name: "not matching", filter: f, data: common.KeyValuePairs{{Key: "mime", Value: "image/png"}}, skipped: true},
+	}
+	for _, test := range testCases {
+		m := &mockMessage{event: common.Event{Data: test.data}}
+		skipped := skipFilteredMessage(m, test.filter, log.NewEntry(log.StandardLogger()))
+		if skipped != test.skipped || m.accepted != test.skipped {
+			t.Errorf("%s: Expected skipped and accepted: %v Got: %v %v", test.name, test.skipped, skipped, m.accepted)
+		}
+	}
+}
+
+func TestJoinMessage(t *testing.T) {
+	joiner, err := join.NewJoiner([]string{"audio_analysed", "video_analysed"}, join.NewMemoryStore(time.Hour, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log.NewEntry(log.StandardLogger())
+	event := func(eventType, eventID string) common.Event {
+		return common.Event{Type: eventType, Context: &common.Context{EventID: eventID, CorrelationID: "c1"}}
+	}
+
+	audio := &mockMessage{event: event("audio_analysed", "a1")}
+	if _, ready := joinMessage(audio, joiner, logger); ready || !audio.accepted {
+		t.Error("Expected the first event to be accepted while the join waits")
+	}
+
+	video := &mockMessage{event: event("video_analysed", "v1")}
+	joined, ready := joinMessage(video, joiner, logger)
+	if !ready || video.accepted {
+		t.Fatal("Expected the last event to complete the join without being accepted")
+	}
+	joinedEvent, err := joined.EventData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(joinedEvent.Context.JoinedEventIDs) != 1 || joinedEvent.Context.JoinedEventIDs[0] != "a1" {
+		t.Errorf("Expected the joined event IDs to be [a1] Got: %v", joinedEvent.Context.JoinedEventIDs)
+	}
+
+	invalid := &mockMessage{event: event("frame_extracted", "f1")}
+	if _, ready := joinMessage(invalid, joiner, logger); ready || invalid.deadLetterReason != messaging.DeadLetterReasonInvalidEvent {
+		t.Errorf("Expected an event which isn't joined to be dead lettered Got: %v", invalid.deadLetterReason)
+	}
+}
+
+func TestNextReceiveBackoff(t *testing.T) {
+	if backoff := nextReceiveBackoff(minReceiveBackoff); backoff != minReceiveBackoff*2 {
+		t.Errorf("Backoff incorrect Expected: %v Got: %v", minReceiveBackoff*2, backoff)
+	}
+	if backoff := nextReceiveBackoff(maxReceiveBackoff); backoff != maxReceiveBackoff {
+		t.Errorf("Backoff incorrect Expected: %v Got: %v", maxReceiveBackoff, backoff)
+	}
+}
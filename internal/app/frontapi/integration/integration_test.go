@@ -94,11 +94,12 @@ func TestHttpServer(t *testing.T) {
 func checkEventData(t *testing.T, e *common.Event, config *types.Configuration) {
 
 	mongoConfig := &mongodb.Config{
-		Enabled:    true,
-		Name:       config.Handler.MongoDBDocumentStorageProvider.Name,
-		Collection: config.Handler.MongoDBDocumentStorageProvider.Collection,
-		Password:   config.Handler.MongoDBDocumentStorageProvider.Password,
-		Port:       config.Handler.MongoDBDocumentStorageProvider.Port,
+		Enabled:          true,
+		ConnectionString: config.Handler.MongoDBDocumentStorageProvider.ConnectionString,
+		Name:             config.Handler.MongoDBDocumentStorageProvider.Name,
+		Collection:       config.Handler.MongoDBDocumentStorageProvider.Collection,
+		Password:         config.Handler.MongoDBDocumentStorageProvider.Password,
+		Port:             config.Handler.MongoDBDocumentStorageProvider.Port,
 	}
 
 	docStore, err := mongodb.NewMongoDB(mongoConfig)
@@ -14,6 +14,8 @@ import (
 
 	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/documentstorage"
 	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/eventschema"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging/filter"
 )
 
 //Process will read the URL inside the body of the incoming request and publish it to the topic
@@ -31,8 +33,12 @@ func Process(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
 	defer cancel()
 
+	data := common.KeyValuePairs{}
+	data = data.Append(common.KeyValuePair{Key: "url", Value: linkReq.URL})
+
 	event := common.Event{
 		Type: eventType,
+		Data: data,
 		Context: &common.Context{
 			CorrelationID: uuid.Must(uuid.NewV4(), nil).String(),
 			ParentEventID: "frontapi",
@@ -55,8 +61,19 @@ func Process(w http.ResponseWriter, r *http.Request) {
 	// This will be looked up by
 	// the processing modules using the
 	// event id.
-	data := common.KeyValuePairs{}
-	data = data.Append(common.KeyValuePair{Key: "url", Value: linkReq.URL})
+	if schemaValidator != nil {
+		err = schemaValidator.Validate(eventType, data)
+		if _, ok := err.(*eventschema.ValidationError); ok {
+			log.Infof("rejecting invalid event: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Errorf("failed validating event: %v", err)
+			http.Error(w, "Failed validating event", http.StatusInternalServerError)
+			return
+		}
+	}
 	eventMeta := documentstorage.EventMeta{
 		Context: event.Context,
 		Data:    data,
@@ -69,7 +86,9 @@ func Process(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Infoln("Publishing event", amqpSender.Address())
-	err = amqpSender.Send(ctx, amqp.NewMessage(eventJSON))
+	msg := amqp.NewMessage(eventJSON)
+	msg.ApplicationProperties = filter.Properties(data)
+	err = amqpSender.Send(ctx, msg)
 	if err != nil {
 		log.Errorln(err)
 		http.Error(w, "Failed publishing event", http.StatusInternalServerError)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/lawrencegripper/ion/internal/pkg/eventschema"
 	"github.com/lawrencegripper/ion/internal/pkg/servicebus"
 	log "github.com/sirupsen/logrus"
 	"pack.ag/amqp"
@@ -50,15 +51,17 @@ type request struct {
 }
 
 var documentStore *mongodb.MongoDB
+var schemaValidator eventschema.Validator
 
 // InitMongoDB initialize the mongodb connection for storing event data
 func InitMongoDB(cfg *types.Configuration) {
 	docStore, err := mongodb.NewMongoDB(&mongodb.Config{
-		Enabled:    true,
-		Name:       cfg.Handler.MongoDBDocumentStorageProvider.Name,
-		Collection: cfg.Handler.MongoDBDocumentStorageProvider.Collection,
-		Password:   cfg.Handler.MongoDBDocumentStorageProvider.Password,
-		Port:       cfg.Handler.MongoDBDocumentStorageProvider.Port,
+		Enabled:          true,
+		ConnectionString: cfg.Handler.MongoDBDocumentStorageProvider.ConnectionString,
+		Name:             cfg.Handler.MongoDBDocumentStorageProvider.Name,
+		Collection:       cfg.Handler.MongoDBDocumentStorageProvider.Collection,
+		Password:         cfg.Handler.MongoDBDocumentStorageProvider.Password,
+		Port:             cfg.Handler.MongoDBDocumentStorageProvider.Port,
 	})
 
 	if err != nil {
@@ -67,3 +70,12 @@ func InitMongoDB(cfg *types.Configuration) {
 
 	documentStore = docStore
 }
+
+// InitSchemaValidator initialize the connection to the schema registry events are validated against
+func InitSchemaValidator(cfg *types.Configuration) {
+	validator, err := eventschema.NewRegistryValidator(cfg.Handler.SchemaRegistryEndpoint, 10*time.Second)
+	if err != nil {
+		panic(err)
+	}
+	schemaValidator = validator
+}
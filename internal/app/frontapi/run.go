@@ -23,6 +23,10 @@ func Run(cfg *types.Configuration, port int) {
 	links.InitAmqp(cfg, "frontapi.new_link")
 	log.Info("Initialising Mongo connection")
 	links.InitMongoDB(cfg)
+	if cfg.Handler.SchemaRegistryEndpoint != "" {
+		log.Info("Initialising schema registry connection")
+		links.InitSchemaValidator(cfg)
+	}
 
 	log.Info("Starting api server")
 	// Routers declarations
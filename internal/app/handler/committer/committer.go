@@ -8,6 +8,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/lawrencegripper/ion/internal/app/handler/dataplane"
@@ -16,6 +17,7 @@ import (
 	"github.com/lawrencegripper/ion/internal/app/handler/logger"
 	"github.com/lawrencegripper/ion/internal/app/handler/module"
 	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/eventschema"
 )
 
 // cSpell:ignore logrus, GUID, nolint
@@ -23,6 +25,7 @@ import (
 const (
 	eventTypeKey      = "eventType"
 	filesToIncludeKey = "files"
+	forEachFileKey    = "forEachFile"
 )
 
 // Committer holds the data and methods needed to commit
@@ -34,13 +37,15 @@ type Committer struct {
 
 	executionID     string
 	validEventTypes []string
+	schemaValidator eventschema.Validator
 
 	baseDir   string
 	devConfig *development.Configuration
 }
 
-// NewCommitter creates a new committer instance
-func NewCommitter(baseDir string, devCfg *development.Configuration) *Committer {
+// NewCommitter creates a new committer instance, events are
+// validated against their schemas when schemaValidator isn't nil
+func NewCommitter(baseDir string, devCfg *development.Configuration, schemaValidator eventschema.Validator) *Committer {
 	if baseDir == "" {
 		baseDir = "/ion/"
 	}
@@ -50,8 +55,9 @@ func NewCommitter(baseDir string, devCfg *development.Configuration) *Committer
 	}
 
 	committer := &Committer{
-		baseDir:   baseDir,
-		devConfig: devCfg,
+		baseDir:         baseDir,
+		devConfig:       devCfg,
+		schemaValidator: schemaValidator,
 	}
 
 	return committer
@@ -95,8 +101,15 @@ func (c *Committer) Close() {
 func (c *Committer) doCommit() error {
 	logger.Info(c.context, "committing module's environment to the data plane")
 
+	// Read and validate the events before anything is
+	// committed so an invalid event fails the commit
+	events, err := c.readEvents(c.environment.OutputEventsDirPath)
+	if err != nil {
+		return fmt.Errorf("error reading events: %+v", err)
+	}
+
 	// Commit blob data to an external blob store
-	blobURIs, err := c.commitBlob(c.environment.OutputBlobDirPath)
+	blobURIs, checksums, err := c.commitBlob(c.environment.OutputBlobDirPath)
 	if err != nil {
 		return fmt.Errorf("error committing blob data: %+v", err)
 	}
@@ -108,7 +121,7 @@ func (c *Committer) doCommit() error {
 	}
 
 	// Commit events to an external messaging system
-	err = c.commitEvents(c.environment.OutputEventsDirPath, blobURIs)
+	err = c.commitEvents(events, blobURIs, checksums)
 	if err != nil {
 		return fmt.Errorf("error committing events: %+v", err)
 	}
@@ -124,32 +137,44 @@ func (c *Committer) doCommit() error {
 	return nil
 }
 
-//CommitBlob commits the blob directory to an external blob provider
-func (c *Committer) commitBlob(blobsPath string) (map[string]string, error) {
+//CommitBlob commits the blob directory to an external blob provider and returns
+//the uri and checksum of each file
+func (c *Committer) commitBlob(blobsPath string) (map[string]string, map[string]string, error) {
 	if _, err := os.Stat(blobsPath); os.IsNotExist(err) {
 		logger.Debug(c.context, fmt.Sprintf("blob output directory '%s' does not exists '%+v'", blobsPath, err))
-		return nil, nil
+		return nil, nil, nil
 	}
 
-	// TODO: Search recursively to support sub folders.
-	files, err := ioutil.ReadDir(blobsPath)
-	if err != nil {
-		return nil, err
-	}
+	// Files in sub directories are committed
+	// with their path relative to the blob
+	// directory, such as 'frames/0001.jpg',
+	// so the directories are recreated when
+	// the next module prepares them.
 	var fileNames []string
-	for _, file := range files {
-		fileNames = append(fileNames, filepath.FromSlash(path.Join(blobsPath, file.Name())))
+	err := filepath.Walk(blobsPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(blobsPath, filePath)
+		if err != nil {
+			return err
+		}
+		fileNames = append(fileNames, filepath.ToSlash(relPath))
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read blob output directory '%s': %+v", blobsPath, err)
 	}
-	blobURIs, err := c.dataPlane.PutBlobs(fileNames)
+	blobURIs, checksums, err := c.dataPlane.PutBlobs(blobsPath, fileNames)
 	if err != nil {
-		return nil, fmt.Errorf("failed to commit blob: %+v", err)
+		return nil, nil, fmt.Errorf("failed to commit blob: %+v", err)
 	}
 
 	logger.Info(c.context, "committed blob data")
 	logger.DebugWithFields(c.context, "blob file names", map[string]interface{}{
 		"files": fileNames,
 	})
-	return blobURIs, nil
+	return blobURIs, checksums, nil
 }
 
 //CommitMeta commits the metadata document to an external provider
@@ -192,157 +217,288 @@ func (c *Committer) commitInsights(insightsPath string) error {
 	return nil
 }
 
-//CommitEvents commits the events directory to an external provider
-func (c *Committer) commitEvents(eventsPath string, blobURIs map[string]string) error {
+// outputEvent is an event the module has written to its output events directory
+type outputEvent struct {
+	fileName  string
+	eventType string
+	files     []string
+	forEach   string
+	data      common.KeyValuePairs
+}
+
+//ReadEvents reads and validates the events in the events directory
+func (c *Committer) readEvents(eventsPath string) ([]outputEvent, error) {
 	if _, err := os.Stat(eventsPath); os.IsNotExist(err) {
 		logger.Info(c.context, fmt.Sprintf("events output directory '%s' does not exists '%+v'", eventsPath, err))
-		return nil
+		return nil, nil
 	}
 
 	// Read each of the event files stored in the
 	// output events directory. Events will be
-	// de-serialized into an expected structure,
-	// enriched, validated and then split into
-	// an event to send via the messaging system
-	// and a context document for the event to
-	// reference.
+	// de-serialized into an expected structure
+	// and validated against the schema registered
+	// for their type. Every event is validated
+	// before any are published so that the
+	// violations of all of them are reported.
 	files, err := ioutil.ReadDir(eventsPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	var events []outputEvent
+	var violations []string
 	for _, file := range files {
-		fileName := file.Name()
-		eventFilePath := path.Join(eventsPath, fileName)
-		f, err := os.Open(eventFilePath)
-		defer f.Close() // nolint: errcheck
+		event, err := c.readEvent(eventsPath, file.Name())
 		if err != nil {
-			return fmt.Errorf("failed to read file '%s' with error: '%+v'", fileName, err)
+			return nil, err
 		}
-
-		// Decode event into map
-		var keyValuePairs common.KeyValuePairs
-		decoder := json.NewDecoder(f)
-		err = decoder.Decode(&keyValuePairs)
-		if err != nil {
-			return fmt.Errorf("failed to unmarshal map '%s' with error: '%+v'", fileName, err)
-		}
-		logger.DebugWithFields(c.context, "event data", map[string]interface{}{
-			"event": keyValuePairs,
-		})
-
-		var eventType string
-		var includedFilesCSV string
-		var eventTypeIndex, filesIndex int
-
-		// For each key/value in event data array.
-		for i, kvp := range keyValuePairs {
-			// Check the key against required keys
-			switch kvp.Key {
-			case eventTypeKey:
-				// Check whether the event type is valid for this module
-				if helpers.ContainsString(c.validEventTypes, kvp.Value) == false {
-					logger.Info(c.context, fmt.Sprintf("this module is unable to publish event's of type '%s'", eventType))
-					continue
-				}
-				eventType = kvp.Value
-				eventTypeIndex = i
-				break
-			case filesToIncludeKey:
-				includedFilesCSV = kvp.Value
-				filesIndex = i
-				break
-			default:
-				// Ignore non required keys
-				break
+		if c.schemaValidator != nil {
+			err = c.schemaValidator.Validate(event.eventType, event.data)
+			if validationErr, ok := err.(*eventschema.ValidationError); ok {
+				violations = append(violations, fmt.Sprintf("event file '%s': %s", event.fileName, validationErr.Error()))
+				continue
 			}
-		}
-		itemsRemoved := 0
-
-		// [Required] Check that the key 'eventType' was found in the data
-		// if it wasn't return an error. If it was, remove it
-		// from the key value pairs as it is no longer needed
-		if eventType == "" {
-			return fmt.Errorf("all events must contain an 'eventType' field, error: '%+v'", err)
-		}
-		keyValuePairs, err = keyValuePairs.Remove(eventTypeIndex)
-		if err != nil {
-			return fmt.Errorf("error removing event type from metadata: '%+v'", err)
-		}
-		itemsRemoved++
-
-		// [Optional] Check whether the key 'files' was supplied in order
-		// to pass file references to event context. If it wasn't, log it
-		// and ignore it. If it was, remove it from the key value pairs
-		// as it is no longer needed and then add the file list and their
-		// blob uri for each of the files to the event context.
-		var fileSlice []string
-		if len(includedFilesCSV) == 0 {
-			logger.Info(c.context, "event contains no file references")
-		} else {
-			keyValuePairs, err = keyValuePairs.Remove(filesIndex - itemsRemoved)
 			if err != nil {
-				return fmt.Errorf("error removing event type from metadata: '%+v'", err)
-			}
-			itemsRemoved++
-			fileSlice = strings.Split(includedFilesCSV, ",")
-			for _, f := range fileSlice {
-				blobInfo := common.KeyValuePair{
-					Key:   f,
-					Value: blobURIs[f],
-				}
-				keyValuePairs = keyValuePairs.Append(blobInfo)
+				return nil, err
 			}
 		}
+		events = append(events, event)
+	}
+	if len(violations) > 0 {
+		return nil, fmt.Errorf("events do not match their schemas:\n%s", strings.Join(violations, "\n"))
+	}
+	return events, nil
+}
 
-		eventID := helpers.NewGUID()
-
-		// Create a new context for this event.
-		// We can only build a partial context
-		// as we don't know which modules will
-		// process the message.
-		// The context will be completed later.
-		context := &common.Context{
-			CorrelationID: c.context.CorrelationID,
-			ParentEventID: c.context.EventID,
-			EventID:       eventID,
-			Name:          c.context.Name,
-		}
+// readEvent de-serializes an event file and removes the
+// keys used to describe the event from its data
+func (c *Committer) readEvent(eventsPath, fileName string) (outputEvent, error) {
+	eventFilePath := path.Join(eventsPath, fileName)
+	f, err := os.Open(eventFilePath)
+	if err != nil {
+		return outputEvent{}, fmt.Errorf("failed to read file '%s' with error: '%+v'", fileName, err)
+	}
+	defer f.Close() // nolint: errcheck
+
+	// Decode event into map
+	var keyValuePairs common.KeyValuePairs
+	decoder := json.NewDecoder(f)
+	err = decoder.Decode(&keyValuePairs)
+	if err != nil {
+		return outputEvent{}, fmt.Errorf("failed to unmarshal map '%s' with error: '%+v'", fileName, err)
+	}
+	logger.DebugWithFields(c.context, "event data", map[string]interface{}{
+		"event": keyValuePairs,
+	})
 
-		// Create a new event to publish
-		// via the messaging system.
-		// This will embed the context
-		// created above.
-		event := common.Event{
-			Context: context,
-			Type:    eventType,
+	var eventType string
+	var includedFilesCSV string
+	var forEachGlob string
+
+	// For each key/value in event data array check
+	// the key against the keys describing the event,
+	// those are removed from the data by name so the
+	// keys can be in any order. Any other keys are
+	// the event's data.
+	data := common.KeyValuePairs{}
+	for _, kvp := range keyValuePairs {
+		switch kvp.Key {
+		case eventTypeKey:
+			// Check whether the event type is valid for this module
+			if helpers.ContainsString(c.validEventTypes, kvp.Value) == false {
+				logger.Info(c.context, fmt.Sprintf("this module is unable to publish event's of type '%s'", kvp.Value))
+				continue
+			}
+			eventType = kvp.Value
+		case filesToIncludeKey:
+			includedFilesCSV = kvp.Value
+		case forEachFileKey:
+			forEachGlob = kvp.Value
+		default:
+			data = data.Append(kvp)
 		}
+	}
 
-		// Create event metadata that
-		// can store additional metadata
-		// without bloating th event such
-		// as a list of files to process.
-		// This will be looked up by
-		// the processing modules using the
-		// event id.
-		eventMeta := documentstorage.EventMeta{
-			Context: context,
-			Files:   fileSlice,
-			Data:    keyValuePairs,
+	// [Required] Check that the key 'eventType' was found in the data
+	// if it wasn't return an error.
+	if eventType == "" {
+		return outputEvent{}, fmt.Errorf("all events must contain an 'eventType' field, error: '%+v'", err)
+	}
+
+	// [Optional] Check whether the key 'files' was supplied in order
+	// to pass file references to event context. If it wasn't, log it
+	// and ignore it. The file list and their blob uri are added to
+	// the event context once the blobs are committed.
+	var fileSlice []string
+	if len(includedFilesCSV) == 0 {
+		logger.Info(c.context, "event contains no file references")
+	} else {
+		fileSlice = strings.Split(includedFilesCSV, ",")
+	}
+
+	// [Optional] Check whether the key 'forEachFile' was supplied.
+	// If it was, the event is a declaration which is fanned out
+	// into an event per output file matching the glob, so it can't
+	// also reference files. The glob is validated now so that a bad
+	// pattern fails the commit before anything is committed.
+	if len(forEachGlob) > 0 {
+		if len(fileSlice) > 0 {
+			return outputEvent{}, fmt.Errorf("event file '%s' can't contain both '%s' and '%s'", fileName, filesToIncludeKey, forEachFileKey)
 		}
-		err = c.dataPlane.CreateEventMeta(&eventMeta)
-		if err != nil {
-			return fmt.Errorf("failed to add context '%+v' with error '%+v'", eventMeta, err)
+		if _, err := path.Match(forEachGlob, ""); err != nil {
+			return outputEvent{}, fmt.Errorf("event file '%s' has an invalid '%s' glob '%s': '%+v'", fileName, forEachFileKey, forEachGlob, err)
 		}
-		err = c.dataPlane.Publish(event)
-		if err != nil {
-			return fmt.Errorf("failed to publish event '%+v' with error '%+v'", event, err)
+	}
+
+	return outputEvent{
+		fileName:  fileName,
+		eventType: eventType,
+		files:     fileSlice,
+		forEach:   forEachGlob,
+		data:      data,
+	}, nil
+}
+
+//CommitEvents commits the events read from the events directory to an external provider
+func (c *Committer) commitEvents(events []outputEvent, blobURIs, checksums map[string]string) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	// Each event is enriched with the blob uri and
+	// checksum of the files it references, so the
+	// next module can verify them, and split into
+	// an event to send via the messaging system
+	// and a context document for the event to
+	// reference. An event declared with a
+	// 'forEachFile' glob is sent once for each
+	// matching file so that the modules which
+	// subscribe to it process the files in parallel.
+	// A glob which matches no files fails the
+	// commit before any event is committed, as
+	// the module didn't output what it declared.
+	var outEvents []outputEvent
+	for _, outEvent := range events {
+		fannedOut := fanOutEvent(outEvent, blobURIs)
+		if outEvent.forEach != "" {
+			if len(fannedOut) == 0 {
+				return fmt.Errorf("event file '%s' '%s' glob '%s' didn't match any output files", outEvent.fileName, forEachFileKey, outEvent.forEach)
+			}
+			logger.Info(c.context, fmt.Sprintf("event file '%s' matched %d files with '%s'", outEvent.fileName, len(fannedOut), outEvent.forEach))
 		}
-		if c.devConfig.Enabled {
-			_ = c.devConfig.WriteMetadata(fileName, eventMeta)
-			_ = c.devConfig.WriteEvent(fileName, event)
+		outEvents = append(outEvents, fannedOut...)
+	}
+	for _, e := range outEvents {
+		if err := c.commitEvent(e, blobURIs, checksums); err != nil {
+			return err
 		}
 	}
 
 	logger.Info(c.context, "committed events")
 	return nil
 }
+
+// commitEvent stores the event's metadata and publishes it
+func (c *Committer) commitEvent(outEvent outputEvent, blobURIs, checksums map[string]string) error {
+	// Copy the data as events fanned out from
+	// the same declaration share it
+	keyValuePairs := append(common.KeyValuePairs{}, outEvent.data...)
+	var fileChecksums []documentstorage.FileChecksum
+	for _, f := range outEvent.files {
+		blobInfo := common.KeyValuePair{
+			Key:   f,
+			Value: blobURIs[f],
+		}
+		keyValuePairs = keyValuePairs.Append(blobInfo)
+		if checksum, ok := checksums[f]; ok {
+			fileChecksums = append(fileChecksums, documentstorage.FileChecksum{
+				File:   f,
+				SHA256: checksum,
+			})
+		}
+	}
+
+	eventID := helpers.NewGUID()
+
+	// Create a new context for this event.
+	// We can only build a partial context
+	// as we don't know which modules will
+	// process the message.
+	// The context will be completed later.
+	context := &common.Context{
+		CorrelationID: c.context.CorrelationID,
+		ParentEventID: c.context.EventID,
+		EventID:       eventID,
+		Name:          c.context.Name,
+	}
+
+	// Create a new event to publish
+	// via the messaging system.
+	// This will embed the context
+	// created above and the event's
+	// data, without file references,
+	// so modules' subscription
+	// filters can be evaluated.
+	event := common.Event{
+		Context: context,
+		Type:    outEvent.eventType,
+		Data:    outEvent.data,
+	}
+
+	// Create event metadata that
+	// can store additional metadata
+	// without bloating th event such
+	// as a list of files to process.
+	// This will be looked up by
+	// the processing modules using the
+	// event id.
+	eventMeta := documentstorage.EventMeta{
+		Context:   context,
+		Files:     outEvent.files,
+		Checksums: fileChecksums,
+		Data:      keyValuePairs,
+	}
+	err := c.dataPlane.CreateEventMeta(&eventMeta)
+	if err != nil {
+		return fmt.Errorf("failed to add context '%+v' with error '%+v'", eventMeta, err)
+	}
+	err = c.dataPlane.Publish(event)
+	if err != nil {
+		return fmt.Errorf("failed to publish event '%+v' with error '%+v'", event, err)
+	}
+	if c.devConfig.Enabled {
+		_ = c.devConfig.WriteMetadata(outEvent.fileName, eventMeta)
+		_ = c.devConfig.WriteEvent(outEvent.fileName, event)
+	}
+	return nil
+}
+
+// fanOutEvent returns an event for each committed file matching the event's 'forEachFile'
+// glob, each referencing just that file. Events without a glob are returned as they are.
+func fanOutEvent(outEvent outputEvent, blobURIs map[string]string) []outputEvent {
+	if outEvent.forEach == "" {
+		return []outputEvent{outEvent}
+	}
+
+	// Files are matched by their path relative
+	// to the blob directory, so 'frames/*.jpg'
+	// matches the files in a sub directory
+	var matches []string
+	for filePath := range blobURIs {
+		if ok, _ := path.Match(outEvent.forEach, filePath); ok {
+			matches = append(matches, filePath)
+		}
+	}
+	sort.Strings(matches)
+
+	ext := filepath.Ext(outEvent.fileName)
+	events := make([]outputEvent, len(matches))
+	for i, filePath := range matches {
+		events[i] = outputEvent{
+			fileName:  fmt.Sprintf("%s_%s%s", strings.TrimSuffix(outEvent.fileName, ext), strings.Replace(filePath, "/", "_", -1), ext),
+			eventType: outEvent.eventType,
+			files:     []string{filePath},
+			data:      outEvent.data,
+		}
+	}
+	return events
+}
@@ -1,6 +1,8 @@
 package committer_test
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -8,6 +10,8 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/lawrencegripper/ion/internal/app/handler/committer"
@@ -17,6 +21,7 @@ import (
 	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/events/mock"
 	"github.com/lawrencegripper/ion/internal/app/handler/module"
 	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/eventschema"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -80,7 +85,7 @@ func TestMain(m *testing.M) {
 
 	// Create committer
 	log.SetOutput(os.Stdout)
-	c = committer.NewCommitter(testdata, nil)
+	c = committer.NewCommitter(testdata, nil, nil)
 
 	exitCode := m.Run()
 
@@ -147,6 +152,95 @@ func TestCommitBlob(t *testing.T) {
 	RefreshTempOutputs()
 }
 
+func TestCommitBlobSubDirectories(t *testing.T) {
+	_ = os.MkdirAll(persistentOutBlobDir, 0777)
+	files := []string{"frames/0001.jpg", "frames/0002.jpg", "audio/track.wav", "summary.txt"}
+	for _, file := range files {
+		filePath := filepath.Join(environment.OutputBlobDirPath, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filePath, []byte(file), 0777); err != nil {
+			t.Fatalf("error creating test file '%s'", file)
+		}
+	}
+	event := common.KeyValuePairs{
+		common.KeyValuePair{Key: "eventType", Value: "test_events"},
+		common.KeyValuePair{Key: "files", Value: "frames/0001.jpg,summary.txt"},
+	}
+	b, err := json.Marshal(&event)
+	if err != nil {
+		t.Fatalf("error encoding event: '%+v'", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(environment.OutputEventsDirPath, "event0.json"), b, 0777); err != nil {
+		t.Fatalf("error writing event file: '%+v'", err)
+	}
+
+	if err := c.Commit(context, dataPlane, eventTypes); err != nil {
+		t.Fatal(err)
+	}
+
+	// The event meta references the files by their relative paths
+	eventFiles, err := ioutil.ReadDir(persistentEventsDir)
+	if err != nil || len(eventFiles) != 1 {
+		t.Fatalf("expected 1 event to be published but got %d with error '%+v'", len(eventFiles), err)
+	}
+	b, err = ioutil.ReadFile(filepath.Join(persistentEventsDir, eventFiles[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inEvent common.Event
+	if err := json.Unmarshal(b, &inEvent); err != nil {
+		t.Fatal(err)
+	}
+	meta := dataPlane.DocumentStorageProvider.(*inmemory.InMemoryDB)
+	eventMeta, err := meta.GetEventMetaByID(inEvent.Context.EventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uris := eventMeta.Data.AsMap()
+	checksums := eventMeta.ChecksumsByFile()
+	for _, file := range []string{"frames/0001.jpg", "summary.txt"} {
+		if uris[file] == "" {
+			t.Errorf("expected the event meta to contain the blob uri of '%s' but got '%+v'", file, eventMeta.Data)
+		}
+		sum := sha256.Sum256([]byte(file))
+		if checksums[file] != hex.EncodeToString(sum[:]) {
+			t.Errorf("expected the event meta to contain the checksum of '%s' but got '%+v'", file, eventMeta.Checksums)
+		}
+	}
+
+	// The next module gets the files into the same directories
+	next, err := filesystem.NewBlobStorage(&filesystem.Config{
+		InputDir:  persistentOutBlobDir,
+		OutputDir: filepath.Join(testdata, "next"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inDir := filepath.Join(testdata, "in")
+	if err := next.GetBlobs(inDir, files, checksums); err != nil {
+		t.Fatalf("error getting blobs: '%+v'", err)
+	}
+	for _, file := range files {
+		content, err := ioutil.ReadFile(filepath.Join(inDir, filepath.FromSlash(file)))
+		if err != nil {
+			t.Errorf("expected '%s' to be prepared: '%+v'", file, err)
+			continue
+		}
+		if string(content) != file {
+			t.Errorf("expected '%s' to contain '%s' but got '%s'", file, file, content)
+		}
+	}
+
+	_ = os.RemoveAll(inDir)
+	_ = os.RemoveAll(filepath.Join(testdata, "next"))
+	_ = os.RemoveAll(persistentEventsDir)
+	_ = os.Mkdir(persistentEventsDir, 0777)
+	_ = os.RemoveAll(persistentOutBlobDir)
+	RefreshTempOutputs()
+}
+
 func TestCommitInsights(t *testing.T) {
 	testCases := []struct {
 		kvps common.KeyValuePairs
@@ -301,6 +395,218 @@ func TestCommitEvents(t *testing.T) {
 	RefreshTempOutputs()
 }
 
+type requiredKeyValidator struct {
+	key string
+}
+
+func (v requiredKeyValidator) Validate(eventType string, data common.KeyValuePairs) error {
+	for _, kvp := range data {
+		if kvp.Key == v.key {
+			return nil
+		}
+	}
+	return &eventschema.ValidationError{
+		EventType:  eventType,
+		Violations: []string{fmt.Sprintf("(root): %s is required", v.key)},
+	}
+}
+
+func TestCommitEventsValidatesSchemas(t *testing.T) {
+	validating := committer.NewCommitter(testdata, nil, requiredKeyValidator{key: "url"})
+	_ = os.Mkdir(persistentEventsDir, 0777)
+	testCases := []struct {
+		name  string
+		event common.KeyValuePairs
+		valid bool
+	}{
+		{
+			name: "valid",
+			event: common.KeyValuePairs{
+				common.KeyValuePair{Key: "eventType", Value: "test_events"},
+				common.KeyValuePair{Key: "url", Value: "https://example.com"},
+			},
+			valid: true,
+		},
+		{
+			name: "missing key",
+			event: common.KeyValuePairs{
+				common.KeyValuePair{Key: "eventType", Value: "test_events"},
+				common.KeyValuePair{Key: "uri", Value: "https://example.com"},
+			},
+		},
+	}
+	for _, test := range testCases {
+		b, err := json.Marshal(&test.event)
+		if err != nil {
+			t.Fatalf("error encoding event: '%+v'", err)
+		}
+		outputEventFilePath := filepath.FromSlash(path.Join(environment.OutputEventsDirPath, "event0.json"))
+		if err := ioutil.WriteFile(outputEventFilePath, b, 0777); err != nil {
+			t.Fatalf("error writing event file: '%+v'", err)
+		}
+
+		err = validating.Commit(context, dataPlane, eventTypes)
+		files, _ := ioutil.ReadDir(persistentEventsDir)
+		if test.valid {
+			if err != nil {
+				t.Errorf("%s: error commiting events: '%+v'", test.name, err)
+			}
+			if len(files) != 1 {
+				t.Errorf("%s: expected 1 event to be published but got %d", test.name, len(files))
+			}
+		} else {
+			if err == nil || !strings.Contains(err.Error(), "event0.json") || !strings.Contains(err.Error(), "url is required") {
+				t.Errorf("%s: expected the commit to fail listing the violation but got '%+v'", test.name, err)
+			}
+			if len(files) != 0 {
+				t.Errorf("%s: expected no events to be published but got %d", test.name, len(files))
+			}
+		}
+
+		_ = os.RemoveAll(persistentEventsDir)
+		_ = os.Mkdir(persistentEventsDir, 0777)
+		RefreshTempOutputs()
+	}
+	_ = os.RemoveAll(persistentEventsDir)
+}
+
+func TestCommitEventsForEachFile(t *testing.T) {
+	// The keys describing the event are removed whatever order they're in
+	orders := []common.KeyValuePairs{
+		{
+			common.KeyValuePair{Key: "eventType", Value: "test_events"},
+			common.KeyValuePair{Key: "forEachFile", Value: "frame*.png"},
+			common.KeyValuePair{Key: "source", Value: "video.mp4"},
+		},
+		{
+			common.KeyValuePair{Key: "forEachFile", Value: "frame*.png"},
+			common.KeyValuePair{Key: "eventType", Value: "test_events"},
+			common.KeyValuePair{Key: "source", Value: "video.mp4"},
+		},
+		{
+			common.KeyValuePair{Key: "source", Value: "video.mp4"},
+			common.KeyValuePair{Key: "forEachFile", Value: "frame*.png"},
+			common.KeyValuePair{Key: "eventType", Value: "test_events"},
+		},
+	}
+	for _, event := range orders {
+		testCommitEventsForEachFile(t, event)
+	}
+}
+
+func testCommitEventsForEachFile(t *testing.T, event common.KeyValuePairs) {
+	_ = os.Mkdir(persistentEventsDir, 0777)
+	_ = os.MkdirAll(persistentOutBlobDir, 0777)
+	defer func() {
+		_ = os.RemoveAll(persistentEventsDir)
+		_ = os.RemoveAll(persistentOutBlobDir)
+		RefreshTempOutputs()
+	}()
+	for _, file := range []string{"frame1.png", "frame2.png", "frame3.png", "audio.wav"} {
+		f, err := os.Create(filepath.FromSlash(path.Join(environment.OutputBlobDirPath, file)))
+		if err != nil {
+			t.Fatalf("error creating test file '%s'", file)
+		}
+		f.Close()
+	}
+	b, err := json.Marshal(&event)
+	if err != nil {
+		t.Fatalf("error encoding event: '%+v'", err)
+	}
+	outputEventFilePath := filepath.FromSlash(path.Join(environment.OutputEventsDirPath, "event0.json"))
+	if err := ioutil.WriteFile(outputEventFilePath, b, 0777); err != nil {
+		t.Fatalf("error writing event file: '%+v'", err)
+	}
+
+	if err := c.Commit(context, dataPlane, eventTypes); err != nil {
+		t.Fatalf("error commiting events '%+v': '%+v'", event, err)
+	}
+	files, err := ioutil.ReadDir(persistentEventsDir)
+	if err != nil {
+		t.Fatalf("error reading events directory '%s': '%+v'", persistentEventsDir, err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("expected an event to be published for each of the 3 frames but got %d", len(files))
+	}
+
+	meta := dataPlane.DocumentStorageProvider.(*inmemory.InMemoryDB)
+	var referenced []string
+	for _, f := range files {
+		b, err := ioutil.ReadFile(filepath.FromSlash(path.Join(persistentEventsDir, f.Name())))
+		if err != nil {
+			t.Fatalf("error reading event '%s' from disk '%+v'", f.Name(), err)
+		}
+		var inEvent common.Event
+		if err := json.Unmarshal(b, &inEvent); err != nil {
+			t.Fatalf("error unmarshalling event '%+v'", err)
+		}
+		expectedData := common.KeyValuePairs{common.KeyValuePair{Key: "source", Value: "video.mp4"}}
+		if !reflect.DeepEqual(inEvent.Data, expectedData) {
+			t.Errorf("expected the data of event '%+v' to be '%+v' but got '%+v'", event, expectedData, inEvent.Data)
+		}
+		eventMeta, err := meta.GetEventMetaByID(inEvent.Context.EventID)
+		if err != nil {
+			t.Fatalf("error getting event meta '%+v'", err)
+		}
+		if len(eventMeta.Files) != 1 {
+			t.Fatalf("expected the event meta to reference 1 file but got '%+v'", eventMeta.Files)
+		}
+		referenced = append(referenced, eventMeta.Files[0])
+		if _, ok := eventMeta.Data.AsMap()[eventMeta.Files[0]]; !ok {
+			t.Errorf("expected the event meta to contain the blob uri of '%s'", eventMeta.Files[0])
+		}
+	}
+	sort.Strings(referenced)
+	expected := []string{"frame1.png", "frame2.png", "frame3.png"}
+	if !reflect.DeepEqual(referenced, expected) {
+		t.Errorf("expected the events to reference '%+v' but got '%+v'", expected, referenced)
+	}
+}
+
+func TestCommitEventsForEachFileMatchingNothing(t *testing.T) {
+	_ = os.Mkdir(persistentEventsDir, 0777)
+	_ = os.MkdirAll(persistentOutBlobDir, 0777)
+	defer func() {
+		_ = os.RemoveAll(persistentEventsDir)
+		_ = os.RemoveAll(persistentOutBlobDir)
+		RefreshTempOutputs()
+	}()
+	f, err := os.Create(filepath.FromSlash(path.Join(environment.OutputBlobDirPath, "audio.wav")))
+	if err != nil {
+		t.Fatalf("error creating test file 'audio.wav'")
+	}
+	f.Close()
+	events := []common.KeyValuePairs{
+		{
+			common.KeyValuePair{Key: "eventType", Value: "test_events"},
+			common.KeyValuePair{Key: "files", Value: "audio.wav"},
+		},
+		{
+			common.KeyValuePair{Key: "eventType", Value: "test_events"},
+			common.KeyValuePair{Key: "forEachFile", Value: "frame*.png"},
+		},
+	}
+	for i, event := range events {
+		b, err := json.Marshal(&event)
+		if err != nil {
+			t.Fatalf("error encoding event: '%+v'", err)
+		}
+		outputEventFilePath := filepath.FromSlash(path.Join(environment.OutputEventsDirPath, fmt.Sprintf("event%d.json", i)))
+		if err := ioutil.WriteFile(outputEventFilePath, b, 0777); err != nil {
+			t.Fatalf("error writing event file: '%+v'", err)
+		}
+	}
+
+	err = c.Commit(context, dataPlane, eventTypes)
+	if err == nil || !strings.Contains(err.Error(), "event1.json") {
+		t.Errorf("expected the commit to fail as the glob matched no files but got '%+v'", err)
+	}
+	files, _ := ioutil.ReadDir(persistentEventsDir)
+	if len(files) != 0 {
+		t.Errorf("expected no events to be published but got %d", len(files))
+	}
+}
+
 func RefreshTempOutputs() {
 	_ = os.RemoveAll(environment.OutputBlobDirPath)
 	_ = os.RemoveAll(environment.OutputEventsDirPath)
@@ -1,14 +1,16 @@
 package azure
 
 import (
+	"crypto/md5"
+	"encoding/base64"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"io"
 	"os"
-	"path"
+	"sync"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/blobstorage"
 	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/documentstorage"
 	"github.com/lawrencegripper/ion/internal/app/handler/helpers"
 	log "github.com/sirupsen/logrus"
@@ -16,12 +18,19 @@ import (
 
 // cSpell:ignore nolint, golint, sasuris, sasuri
 
+// blockSize is the size of the chunks blobs are streamed in
+const blockSize = 8 * 1024 * 1024
+
+// ReferenceScheme is the scheme of the references to Azure blobs stored in the metastore
+const ReferenceScheme = "azureblob"
+
 //Config to setup a BlobStorage blob provider
 type Config struct {
 	Enabled         bool   `description:"Enable Azure Blob storage provider"`
 	BlobAccountName string `description:"Azure Blob Storage account name"`
 	BlobAccountKey  string `description:"Azure Blob Storage account key"`
 	ContainerName   string `description:"Azure Blob Storage container name"`
+	Parallelism     int    `description:"Number of blobs transferred at the same time"`
 }
 
 //BlobStorage is responsible for handling the connections to Azure Blob Storage
@@ -29,13 +38,13 @@ type Config struct {
 type BlobStorage struct {
 	blobClient       storage.BlobStorageClient
 	containerName    string
+	parallelism      int
 	outputBlobPrefix string
-	inputBlobPrefix  string
 	eventMeta        *documentstorage.EventMeta
 }
 
 //NewBlobStorage creates a new Azure Blob Storage object
-func NewBlobStorage(config *Config, inputBlobPrefix, outputBlobPrefix string, eventMeta *documentstorage.EventMeta) (*BlobStorage, error) {
+func NewBlobStorage(config *Config, outputBlobPrefix string, eventMeta *documentstorage.EventMeta) (*BlobStorage, error) {
 	blobClient, err := storage.NewBasicClient(config.BlobAccountName, config.BlobAccountKey)
 	if err != nil {
 		return nil, fmt.Errorf("error creating storage blobClient: %+v", err)
@@ -44,99 +53,113 @@ func NewBlobStorage(config *Config, inputBlobPrefix, outputBlobPrefix string, ev
 	asb := &BlobStorage{
 		blobClient:       blob,
 		containerName:    config.ContainerName,
+		parallelism:      config.Parallelism,
 		outputBlobPrefix: outputBlobPrefix,
-		inputBlobPrefix:  inputBlobPrefix,
 		eventMeta:        eventMeta,
 	}
 	return asb, nil
 }
 
-//PutBlobs puts a file into Azure Blob Storage
-func (a *BlobStorage) PutBlobs(filePaths []string) (map[string]string, error) {
+//PutBlobs puts files into Azure Blob Storage, keeping their paths relative to the base directory,
+//and returns a reference to each. Files are put in parallel and each is streamed as a block
+//blob in chunks.
+func (a *BlobStorage) PutBlobs(baseDir string, filePaths []string) (map[string]string, map[string]string, error) {
 	container, err := a.createContainerIfNotExist()
 	if err != nil {
-		return nil, err
-	}
-
-	readStorageOptions := storage.BlobSASOptions{
-		BlobServiceSASPermissions: storage.BlobServiceSASPermissions{
-			Read: true,
-		},
-		SASOptions: storage.SASOptions{
-			Start:  time.Now().Add(time.Duration(-1) * time.Hour),
-			Expiry: time.Now().Add(time.Duration(24) * time.Hour),
-		},
+		return nil, nil, err
 	}
 
-	blobSASURIs := make(map[string]string)
+	var mu sync.Mutex
+	blobRefs := make(map[string]string)
+	checksums := make(map[string]string)
 
-	for _, filePath := range filePaths {
-		_, nakedFilePath := path.Split(filePath)
-		blobPath := helpers.JoinBlobPath(a.outputBlobPrefix, nakedFilePath)
-		file, err := os.Open(filePath)
+	err = blobstorage.ForEach(filePaths, a.parallelism, func(filePath string) error {
+		localPath, err := helpers.BlobFilePath(baseDir, filePath)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read data from file '%s', error: '%+v'", filePath, err)
+			return err
 		}
-		defer file.Close() // nolint: errcheck
+		blobPath := helpers.JoinBlobPath(a.outputBlobPrefix, filePath)
 		blobRef := container.GetBlobReference(blobPath)
 		_, err = blobRef.DeleteIfExists(&storage.DeleteBlobOptions{})
 		if err != nil {
-			return nil, err
+			return err
 		}
-		err = blobRef.CreateBlockBlobFromReader(file, &storage.PutBlobOptions{})
+		checksum, err := putBlockBlob(blobRef, localPath)
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("failed to put blob '%s' from file '%s', error: '%+v'", blobPath, localPath, err)
 		}
 
-		uri, err := blobRef.GetSASURI(readStorageOptions)
-		if err != nil {
-			return nil, err
-		}
-
-		blobSASURIs[nakedFilePath] = uri
+		mu.Lock()
+		defer mu.Unlock()
+		blobRefs[filePath] = blobstorage.Reference(ReferenceScheme, container.Name, blobPath)
+		checksums[filePath] = checksum.SHA256()
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
-	return blobSASURIs, nil
+	return blobRefs, checksums, nil
 }
 
-//GetBlobs gets each of the provided blobs from Azure Blob Storage
-func (a *BlobStorage) GetBlobs(outputDir string, filePaths []string) error {
+//GetBlobs streams each of the provided blobs from Azure Blob Storage in parallel
+//and verifies them against their checksums. A short lived SAS url is minted to get
+//each blob referenced in the event meta.
+func (a *BlobStorage) GetBlobs(outputDir string, filePaths []string, checksums map[string]string) error {
 	if a.eventMeta == nil {
 		log.Info("skipping getblob as eventmeta is nil meaning this is an orphaned event or the first in a workflow")
 		return nil
 	}
 	dataAsMap := a.eventMeta.Data.AsMap()
-	for _, filePath := range filePaths {
-		fileSASURL, ok := dataAsMap[filePath]
+	return blobstorage.ForEach(filePaths, a.parallelism, func(filePath string) error {
+		ref, ok := dataAsMap[filePath]
 		if !ok {
-			log.WithField("filepath", filePath).WithField("eventMeta", a.eventMeta).Error("couldn't find SAS url for azure blob data")
-			return fmt.Errorf("failed to find sas url for azure blob data in event meta: %+v", a.eventMeta)
+			log.WithField("filepath", filePath).WithField("eventMeta", a.eventMeta).Error("couldn't find reference for azure blob data")
+			return fmt.Errorf("failed to find reference for azure blob data in event meta: %+v", a.eventMeta)
 		}
-
-		resp, err := http.Get(fileSASURL)
+		fileSASURL, err := SignReference(a.blobClient, ref, blobstorage.AccessExpiry)
 		if err != nil {
-			log.WithField("filepath", filePath).WithField("eventMeta", a.eventMeta).Error("couldn't download data from SAS url for azure blob data")
-			return fmt.Errorf("Couldn't download data from SAS url for azure blob url: %+v data: %+v", fileSASURL, a.eventMeta)
+			return err
 		}
-
-		bytes, err := ioutil.ReadAll(resp.Body)
-		defer resp.Body.Close() //nolint: errcheck
-
+		outputFilePath, err := helpers.BlobFilePath(outputDir, filePath)
 		if err != nil {
-			return fmt.Errorf("failed to read blob '%s' with error '%+v'", fileSASURL, err)
+			return err
 		}
-		outputFilePath := path.Join(outputDir, filePath)
-		err = ioutil.WriteFile(outputFilePath, bytes, 0777)
-		if err != nil {
-			return fmt.Errorf("failed to write file '%s' with error '%+v'", outputFilePath, err)
+		if err := blobstorage.Download(fileSASURL, outputFilePath, checksums[filePath]); err != nil {
+			log.WithField("filepath", filePath).WithError(err).Error("couldn't download data from SAS url for azure blob data")
+			return fmt.Errorf("failed to get blob '%s' with error '%+v'", filePath, err)
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
 //Close cleans up any external resources
 func (a *BlobStorage) Close() {
 }
 
+//SignReference mints a read SAS url for a referenced blob which is valid for the expiry,
+//signed urls stored before references were are returned as they are
+func SignReference(blobClient storage.BlobStorageClient, ref string, expiry time.Duration) (string, error) {
+	containerName, blobPath, signedURL, err := blobstorage.ParseReference(ReferenceScheme, ref)
+	if err != nil || signedURL != "" {
+		return signedURL, err
+	}
+	blobRef := blobClient.GetContainerReference(containerName).GetBlobReference(blobPath)
+	uri, err := blobRef.GetSASURI(storage.BlobSASOptions{
+		BlobServiceSASPermissions: storage.BlobServiceSASPermissions{
+			Read: true,
+		},
+		SASOptions: storage.SASOptions{
+			// Allow for clock skew with the service
+			Start:  time.Now().Add(time.Duration(-5) * time.Minute),
+			Expiry: time.Now().Add(expiry),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to mint sas url for blob '%s': %+v", ref, err)
+	}
+	return uri, nil
+}
+
 //createContainerIfNotExist creates the container if it doesn't exist
 func (a *BlobStorage) createContainerIfNotExist() (*storage.Container, error) {
 	containerName := a.containerName
@@ -149,3 +172,45 @@ func (a *BlobStorage) createContainerIfNotExist() (*storage.Container, error) {
 	}
 	return container, nil
 }
+
+//putBlockBlob streams a file into a block blob in chunks, each chunk is sent with its
+//MD5 so the service rejects corrupted blocks and the blob's Content-MD5 is set on commit
+func putBlockBlob(blobRef *storage.Blob, filePath string) (*blobstorage.Checksum, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() // nolint: errcheck
+
+	checksum := blobstorage.NewChecksum()
+	reader := io.TeeReader(file, checksum)
+	chunk := make([]byte, blockSize)
+	blocks := []storage.Block{}
+	for {
+		n, err := io.ReadFull(reader, chunk)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		blockMD5 := md5.Sum(chunk[:n])
+		block := storage.Block{
+			ID:     base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%08d", len(blocks)))),
+			Status: storage.BlockStatusUncommitted,
+		}
+		err = blobRef.PutBlock(block.ID, chunk[:n], &storage.PutBlockOptions{
+			ContentMD5: base64.StdEncoding.EncodeToString(blockMD5[:]),
+		})
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+
+	blobRef.Properties.ContentMD5 = checksum.MD5()
+	if err := blobRef.PutBlockList(blocks, nil); err != nil {
+		return nil, err
+	}
+	return checksum, nil
+}
@@ -0,0 +1,223 @@
+package blobstorage
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cSpell:ignore nolint
+
+// DefaultParallelism is the number of blobs transferred at the same time when it isn't configured
+const DefaultParallelism = 4
+
+// AccessExpiry is how long the urls minted to get blobs are valid for, a url only
+// needs to be valid when its download starts
+const AccessExpiry = time.Duration(15) * time.Minute
+
+//Reference returns a stable reference to a blob, such as 'azureblob://container/path/to/blob'.
+//Unlike a signed url it doesn't expire, so it's what event meta stores and access to the
+//blob is granted when it's got.
+func Reference(scheme, container, blobPath string) string {
+	ref := url.URL{
+		Scheme: scheme,
+		Host:   container,
+		Path:   "/" + blobPath,
+	}
+	return ref.String()
+}
+
+//ParseReference returns the container and path of the blob in a reference. Event meta
+//committed before references were stored holds signed urls, these are returned as the url
+//to get the blob with as they are.
+func ParseReference(scheme, ref string) (container, blobPath, signedURL string, err error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to parse blob reference '%s': %+v", ref, err)
+	}
+	switch u.Scheme {
+	case scheme:
+		blobPath = strings.TrimPrefix(u.Path, "/")
+		if u.Host == "" || blobPath == "" {
+			return "", "", "", fmt.Errorf("blob reference '%s' has no container or path", ref)
+		}
+		return u.Host, blobPath, "", nil
+	case "http", "https":
+		return "", "", ref, nil
+	default:
+		return "", "", "", fmt.Errorf("blob reference '%s' isn't a '%s' reference", ref, scheme)
+	}
+}
+
+//ChecksumError is returned when a blob's content doesn't match the checksum recorded when it was put
+type ChecksumError struct {
+	File     string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("blob '%s' has sha256 '%s' but '%s' was recorded when it was committed", e.File, e.Actual, e.Expected)
+}
+
+//Checksum hashes a blob's content as it's streamed
+type Checksum struct {
+	sha256 hash.Hash
+	md5    hash.Hash
+}
+
+//NewChecksum creates an empty checksum
+func NewChecksum() *Checksum {
+	return &Checksum{
+		sha256: sha256.New(),
+		md5:    md5.New(),
+	}
+}
+
+//Write adds the data to the checksum
+func (c *Checksum) Write(p []byte) (int, error) {
+	_, _ = c.md5.Write(p)
+	return c.sha256.Write(p)
+}
+
+//SHA256 returns the hex encoded SHA256 of the data, this is recorded in event meta
+func (c *Checksum) SHA256() string {
+	return hex.EncodeToString(c.sha256.Sum(nil))
+}
+
+//MD5 returns the base64 encoded MD5 of the data, as used by Content-MD5 headers
+func (c *Checksum) MD5() string {
+	return base64.StdEncoding.EncodeToString(c.md5.Sum(nil))
+}
+
+//Verify returns a *ChecksumError if the data doesn't match the expected SHA256. Blobs
+//committed without a checksum have nothing to verify against so aren't checked.
+func (c *Checksum) Verify(file, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	if actual := c.SHA256(); actual != expected {
+		return &ChecksumError{File: file, Expected: expected, Actual: actual}
+	}
+	return nil
+}
+
+//FileChecksum streams a file to compute its checksum
+func FileChecksum(filePath string) (*Checksum, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint: errcheck
+	checksum := NewChecksum()
+	if _, err := io.Copy(checksum, file); err != nil {
+		return nil, err
+	}
+	return checksum, nil
+}
+
+//ForEach calls fn for each of the file paths with at most parallelism calls running at a
+//time. Once a call fails no more are started and the first error is returned.
+func ForEach(filePaths []string, parallelism int, fn func(filePath string) error) error {
+	if parallelism < 1 {
+		parallelism = DefaultParallelism
+	}
+	paths := make(chan string)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+	for i := 0; i < parallelism && i < len(filePaths); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for filePath := range paths {
+				if failed() {
+					continue
+				}
+				if err := fn(filePath); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, filePath := range filePaths {
+		if failed() {
+			break
+		}
+		paths <- filePath
+	}
+	close(paths)
+	wg.Wait()
+	return firstErr
+}
+
+//CopyFile streams a file to the destination, creating its directory, and returns its checksum
+func CopyFile(src, dst string) (*Checksum, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close() //nolint: errcheck
+	return writeFile(in, dst)
+}
+
+//Download streams the blob at the url to a file, creating its directory, and verifies it
+//against the expected SHA256. A file which doesn't match is removed.
+func Download(url, filePath, expectedSHA256 string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint: errcheck
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status '%s'", resp.Status)
+	}
+
+	checksum, err := writeFile(resp.Body, filePath)
+	if err != nil {
+		return err
+	}
+	if err := checksum.Verify(filePath, expectedSHA256); err != nil {
+		_ = os.Remove(filePath)
+		return err
+	}
+	return nil
+}
+
+//writeFile streams the reader to a file, creating its directory, and returns its checksum
+func writeFile(r io.Reader, filePath string) (*Checksum, error) {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0777); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint: errcheck
+
+	checksum := NewChecksum()
+	if _, err := io.Copy(io.MultiWriter(file, checksum), r); err != nil {
+		return nil, err
+	}
+	return checksum, file.Close()
+}
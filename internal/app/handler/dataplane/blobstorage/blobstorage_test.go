@@ -0,0 +1,156 @@
+package blobstorage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestForEachBoundsParallelism(t *testing.T) {
+	var files []string
+	for i := 0; i < 20; i++ {
+		files = append(files, fmt.Sprintf("file%d", i))
+	}
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	done := map[string]bool{}
+	err := ForEach(files, 3, func(file string) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		running--
+		done[file] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxRunning > 3 {
+		t.Errorf("expected at most 3 files to be handled at a time but %d were", maxRunning)
+	}
+	if len(done) != len(files) {
+		t.Errorf("expected %d files to be handled but %d were", len(files), len(done))
+	}
+}
+
+func TestForEachReturnsError(t *testing.T) {
+	err := ForEach([]string{"a", "b", "c"}, 2, func(file string) error {
+		if file == "b" {
+			return fmt.Errorf("failed %s", file)
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "failed b" {
+		t.Errorf("expected the error for 'b' but got '%+v'", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	checksum := NewChecksum()
+	_, _ = checksum.Write([]byte("frame"))
+
+	testCases := []struct {
+		expected string
+		valid    bool
+	}{
+		{expected: sha256Hex("frame"), valid: true},
+		{expected: "", valid: true},
+		{expected: sha256Hex("other"), valid: false},
+	}
+	for _, test := range testCases {
+		err := checksum.Verify("frame.png", test.expected)
+		if test.valid && err != nil {
+			t.Errorf("expected '%s' to be valid but got '%+v'", test.expected, err)
+		}
+		if _, ok := err.(*ChecksumError); !test.valid && !ok {
+			t.Errorf("expected a checksum error for '%s' but got '%+v'", test.expected, err)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("frame"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "blobstorage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint: errcheck
+	filePath := filepath.Join(dir, "frames", "frame.png")
+
+	if err := Download(server.URL, filePath, sha256Hex("frame")); err != nil {
+		t.Fatalf("error downloading blob: %+v", err)
+	}
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil || string(content) != "frame" {
+		t.Errorf("expected the blob to contain 'frame' but got '%s' with error '%+v'", content, err)
+	}
+
+	err = Download(server.URL, filePath, sha256Hex("other"))
+	if _, ok := err.(*ChecksumError); !ok {
+		t.Errorf("expected a checksum error downloading a corrupted blob but got '%+v'", err)
+	}
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+		t.Error("expected the corrupted blob to be removed")
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	ref := Reference("azureblob", "correlation", "event/module/frames/0001.jpg")
+	if ref != "azureblob://correlation/event/module/frames/0001.jpg" {
+		t.Errorf("unexpected reference '%s'", ref)
+	}
+
+	testCases := []struct {
+		ref       string
+		container string
+		blobPath  string
+		signedURL string
+		valid     bool
+	}{
+		{ref: ref, container: "correlation", blobPath: "event/module/frames/0001.jpg", valid: true},
+		{ref: "https://account.blob.core.windows.net/correlation/frame.png?sig=abc", signedURL: "https://account.blob.core.windows.net/correlation/frame.png?sig=abc", valid: true},
+		{ref: "s3://bucket/frame.png", valid: false},
+		{ref: "azureblob://correlation", valid: false},
+	}
+	for _, test := range testCases {
+		container, blobPath, signedURL, err := ParseReference("azureblob", test.ref)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("expected an error parsing '%s'", test.ref)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("error parsing '%s': %+v", test.ref, err)
+			continue
+		}
+		if container != test.container || blobPath != test.blobPath || signedURL != test.signedURL {
+			t.Errorf("expected '%s' to parse as '%s', '%s', '%s' but got '%s', '%s', '%s'", test.ref, test.container, test.blobPath, test.signedURL, container, blobPath, signedURL)
+		}
+	}
+}
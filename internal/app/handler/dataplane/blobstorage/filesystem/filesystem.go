@@ -2,22 +2,25 @@ package filesystem
 
 import (
 	"fmt"
-	"io"
 	"os"
-	"path"
-	"path/filepath"
+	"sync"
+
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/blobstorage"
+	"github.com/lawrencegripper/ion/internal/app/handler/helpers"
 )
 
 //Config to setup a FileSystem storage provider
 type Config struct {
-	InputDir  string `description:"Input directory used to persist files"`
-	OutputDir string `description:"Output directory used to persist files"`
+	InputDir    string `description:"Input directory used to persist files"`
+	OutputDir   string `description:"Output directory used to persist files"`
+	Parallelism int    `description:"Number of files copied at the same time"`
 }
 
 //BlobStorage stores blobs on local disk
 type BlobStorage struct {
-	inDir  string
-	outDir string
+	inDir       string
+	outDir      string
+	parallelism int
 }
 
 //NewBlobStorage creates a new file system blob provider
@@ -27,63 +30,70 @@ func NewBlobStorage(config *Config) (*BlobStorage, error) {
 		return nil, fmt.Errorf("error creating directory for filesystem blob provider '%+v'", err)
 	}
 	fs := &BlobStorage{
-		inDir:  config.InputDir,
-		outDir: config.OutputDir,
+		inDir:       config.InputDir,
+		outDir:      config.OutputDir,
+		parallelism: config.Parallelism,
 	}
 	return fs, nil
 }
 
-//PutBlobs puts in the filesystem directory
-func (a *BlobStorage) PutBlobs(filePaths []string) (map[string]string, error) {
+//PutBlobs puts in the filesystem directory, keeping the files' paths relative to the base directory
+func (a *BlobStorage) PutBlobs(baseDir string, filePaths []string) (map[string]string, map[string]string, error) {
+	var mu sync.Mutex
 	uris := make(map[string]string)
-	for _, filePath := range filePaths {
-		_, nakedFilePath := filepath.Split(filePath)
-		destPath := filepath.FromSlash(path.Join(a.outDir, nakedFilePath))
-		if err := copy(filePath, destPath); err != nil {
-			return nil, fmt.Errorf("error copying file to blob storage '%+v'", err)
+	checksums := make(map[string]string)
+	err := blobstorage.ForEach(filePaths, a.parallelism, func(filePath string) error {
+		srcPath, err := helpers.BlobFilePath(baseDir, filePath)
+		if err != nil {
+			return err
+		}
+		destPath, err := helpers.BlobFilePath(a.outDir, filePath)
+		if err != nil {
+			return err
+		}
+		checksum, err := blobstorage.CopyFile(srcPath, destPath)
+		if err != nil {
+			return fmt.Errorf("error copying file to blob storage '%+v'", err)
 		}
+		mu.Lock()
+		defer mu.Unlock()
 		uris[filePath] = destPath
+		checksums[filePath] = checksum.SHA256()
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
-	return uris, nil
+	return uris, checksums, nil
 }
 
 //GetBlobs gets each of the referenced blobs from the file system
-func (a *BlobStorage) GetBlobs(outputDir string, filePaths []string) error {
-	for _, file := range filePaths {
-		srcPath := filepath.FromSlash(path.Join(a.inDir, file))
-		_, err := os.Stat(srcPath)
+func (a *BlobStorage) GetBlobs(outputDir string, filePaths []string, checksums map[string]string) error {
+	return blobstorage.ForEach(filePaths, a.parallelism, func(file string) error {
+		srcPath, err := helpers.BlobFilePath(a.inDir, file)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stat(srcPath)
 		if err != nil {
 			return fmt.Errorf("error getting blob '%s': '%+v'", file, err)
 		}
-		destPath := filepath.FromSlash(path.Join(outputDir, file))
-		if err := copy(srcPath, destPath); err != nil {
+		destPath, err := helpers.BlobFilePath(outputDir, file)
+		if err != nil {
+			return err
+		}
+		checksum, err := blobstorage.CopyFile(srcPath, destPath)
+		if err != nil {
 			return fmt.Errorf("error copying from blob '%s': '%+v'", file, err)
 		}
-	}
-	return nil
+		if err := checksum.Verify(destPath, checksums[file]); err != nil {
+			_ = os.Remove(destPath)
+			return err
+		}
+		return nil
+	})
 }
 
 //Close cleans up any external resources
 func (a *BlobStorage) Close() {
 }
-
-//copy a file from a source path to a destination path
-func copy(src, dst string) error {
-	in, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer in.Close() //nolint:errcheck
-
-	out, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer out.Close() //nolint:errcheck
-
-	_, err = io.Copy(out, in)
-	if err != nil {
-		return err
-	}
-	return out.Close() //nolint:errcheck
-}
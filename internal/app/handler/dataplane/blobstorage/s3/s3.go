@@ -0,0 +1,171 @@
+package s3
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/blobstorage"
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/documentstorage"
+	"github.com/lawrencegripper/ion/internal/app/handler/helpers"
+	minio "github.com/minio/minio-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// cSpell:ignore nolint, golint, minio, presigned
+
+// ReferenceScheme is the scheme of the references to S3 objects stored in the metastore
+const ReferenceScheme = "s3"
+
+//Config to setup an S3 compatible blob provider such as AWS S3, MinIO or Ceph
+type Config struct {
+	Enabled         bool   `description:"Enable S3 compatible blob storage provider"`
+	Endpoint        string `description:"S3 endpoint as host[:port], for example s3.amazonaws.com"`
+	AccessKeyID     string `description:"S3 access key ID"`
+	SecretAccessKey string `description:"S3 secret access key"`
+	Bucket          string `description:"S3 bucket blobs are stored in"`
+	Region          string `description:"S3 region, looked up from the bucket if not set"`
+	UseSSL          bool   `description:"Connect to the S3 endpoint using https"`
+	Parallelism     int    `description:"Number of blobs transferred at the same time"`
+}
+
+//BlobStorage is responsible for handling the connections to S3 compatible blob storage
+// nolint: golint
+type BlobStorage struct {
+	client           *minio.Client
+	bucket           string
+	region           string
+	parallelism      int
+	outputBlobPrefix string
+	eventMeta        *documentstorage.EventMeta
+}
+
+//NewBlobStorage creates a new S3 Blob Storage object
+func NewBlobStorage(config *Config, outputBlobPrefix string, eventMeta *documentstorage.EventMeta) (*BlobStorage, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("an S3 bucket is required")
+	}
+	client, err := minio.NewWithRegion(config.Endpoint, config.AccessKeyID, config.SecretAccessKey, config.UseSSL, config.Region)
+	if err != nil {
+		return nil, fmt.Errorf("error creating S3 client: %+v", err)
+	}
+	blob := &BlobStorage{
+		client:           client,
+		bucket:           config.Bucket,
+		region:           config.Region,
+		parallelism:      config.Parallelism,
+		outputBlobPrefix: outputBlobPrefix,
+		eventMeta:        eventMeta,
+	}
+	return blob, nil
+}
+
+//PutBlobs puts each file into the bucket in parallel, keeping its path relative to the base
+//directory, and returns a reference and checksum for each. Large files are streamed as
+//multipart uploads by the client.
+func (s *BlobStorage) PutBlobs(baseDir string, filePaths []string) (map[string]string, map[string]string, error) {
+	err := s.createBucketIfNotExist()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var mu sync.Mutex
+	blobRefs := make(map[string]string)
+	checksums := make(map[string]string)
+
+	err = blobstorage.ForEach(filePaths, s.parallelism, func(filePath string) error {
+		localPath, err := helpers.BlobFilePath(baseDir, filePath)
+		if err != nil {
+			return err
+		}
+		checksum, err := blobstorage.FileChecksum(localPath)
+		if err != nil {
+			return fmt.Errorf("failed to read data from file '%s', error: '%+v'", localPath, err)
+		}
+		objectName := helpers.JoinBlobPath(s.outputBlobPrefix, filePath)
+		_, err = s.client.FPutObject(s.bucket, objectName, localPath, minio.PutObjectOptions{
+			UserMetadata: map[string]string{"sha256": checksum.SHA256()},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to put object '%s' from file '%s', error: '%+v'", objectName, localPath, err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		blobRefs[filePath] = blobstorage.Reference(ReferenceScheme, s.bucket, objectName)
+		checksums[filePath] = checksum.SHA256()
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return blobRefs, checksums, nil
+}
+
+//GetBlobs streams each of the provided blobs in parallel and verifies them against their
+//checksums. A short lived presigned url is minted to get each blob referenced in the event meta.
+func (s *BlobStorage) GetBlobs(outputDir string, filePaths []string, checksums map[string]string) error {
+	if s.eventMeta == nil {
+		log.Info("skipping getblob as eventmeta is nil meaning this is an orphaned event or the first in a workflow")
+		return nil
+	}
+	dataAsMap := s.eventMeta.Data.AsMap()
+	return blobstorage.ForEach(filePaths, s.parallelism, func(filePath string) error {
+		ref, ok := dataAsMap[filePath]
+		if !ok {
+			log.WithField("filepath", filePath).WithField("eventMeta", s.eventMeta).Error("couldn't find reference for s3 blob data")
+			return fmt.Errorf("failed to find reference for s3 blob data in event meta: %+v", s.eventMeta)
+		}
+		fileURL, err := PresignReference(s.client, ref, blobstorage.AccessExpiry)
+		if err != nil {
+			return err
+		}
+		outputFilePath, err := helpers.BlobFilePath(outputDir, filePath)
+		if err != nil {
+			return err
+		}
+		if err := blobstorage.Download(fileURL, outputFilePath, checksums[filePath]); err != nil {
+			log.WithField("filepath", filePath).WithError(err).Error("couldn't download data from presigned url for s3 blob data")
+			return fmt.Errorf("failed to get blob '%s' with error '%+v'", filePath, err)
+		}
+		return nil
+	})
+}
+
+//Close cleans up any external resources
+func (s *BlobStorage) Close() {
+}
+
+//PresignReference mints a presigned GET url for a referenced object which is valid for the expiry,
+//presigned urls stored before references were are returned as they are
+func PresignReference(client *minio.Client, ref string, expiry time.Duration) (string, error) {
+	bucket, objectName, signedURL, err := blobstorage.ParseReference(ReferenceScheme, ref)
+	if err != nil || signedURL != "" {
+		return signedURL, err
+	}
+	url, err := client.PresignedGetObject(bucket, objectName, expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign url for object '%s', error: '%+v'", ref, err)
+	}
+	return url.String(), nil
+}
+
+//createBucketIfNotExist creates the bucket if it doesn't exist
+func (s *BlobStorage) createBucketIfNotExist() error {
+	exists, err := s.client.BucketExists(s.bucket)
+	if err != nil {
+		return fmt.Errorf("error checking bucket %s exists: %+v", s.bucket, err)
+	}
+	if exists {
+		return nil
+	}
+	err = s.client.MakeBucket(s.bucket, s.region)
+	if err != nil {
+		// Another handler may have created the bucket at the same time
+		if exists, existsErr := s.client.BucketExists(s.bucket); existsErr == nil && exists {
+			return nil
+		}
+		return fmt.Errorf("error thrown creating bucket %s: %+v", s.bucket, err)
+	}
+	return nil
+}
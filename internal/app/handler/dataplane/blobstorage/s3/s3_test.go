@@ -0,0 +1,99 @@
+package s3
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/documentstorage"
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+)
+
+// cSpell:ignore minio
+
+// TestS3Integration runs against a local MinIO, for example
+// docker run -p 9000:9000 -e MINIO_ACCESS_KEY=minio -e MINIO_SECRET_KEY=minio123 minio/minio server /data
+// with S3_ENDPOINT=localhost:9000 S3_ACCESS_KEY_ID=minio S3_SECRET_ACCESS_KEY=minio123
+func TestS3Integration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode...")
+	}
+	endpoint := os.Getenv("S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("Skipping integration test as env var 'S3_ENDPOINT' isn't set")
+	}
+	config := &Config{
+		Enabled:         true,
+		Endpoint:        endpoint,
+		AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		Bucket:          "ion-integration",
+		UseSSL:          os.Getenv("S3_USE_SSL") == "true",
+	}
+
+	dir, err := ioutil.TempDir("", "s3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint: errcheck
+	outDir := filepath.Join(dir, "out")
+	inDir := filepath.Join(dir, "in")
+	for _, d := range []string{outDir, inDir} {
+		if err := os.Mkdir(d, 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	content := []byte("frame")
+	filePath := filepath.Join(outDir, "frame1.png")
+	if err := ioutil.WriteFile(filePath, content, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	// Put the blob as the first module
+	blob, err := NewBlobStorage(config, "correlation/event1/module1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, checksums, err := blob.PutBlobs(outDir, []string{"frame1.png"})
+	if err != nil {
+		t.Fatalf("error putting blobs: %+v", err)
+	}
+	ref := refs["frame1.png"]
+	if ref != "s3://ion-integration/correlation/event1/module1/frame1.png" {
+		t.Fatalf("expected a reference to 'frame1.png' got %+v", refs)
+	}
+
+	// Get the blob as the next module using the reference in the event meta
+	eventMeta := &documentstorage.EventMeta{
+		Context: &common.Context{EventID: "event2"},
+		Files:   []string{"frame1.png"},
+		Data:    common.KeyValuePairs{{Key: "frame1.png", Value: ref}},
+	}
+	blob, err = NewBlobStorage(config, "correlation/event2/module2", eventMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blob.GetBlobs(inDir, []string{"frame1.png"}, checksums); err != nil {
+		t.Fatalf("error getting blobs: %+v", err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(inDir, "frame1.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(content) {
+		t.Errorf("expected the blob to contain '%s' but got '%s'", content, got)
+	}
+}
+
+func TestGetBlobsWithoutReference(t *testing.T) {
+	blob, err := NewBlobStorage(&Config{Endpoint: "localhost:9000", Bucket: "ion"}, "", &documentstorage.EventMeta{
+		Context: &common.Context{EventID: "event2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blob.GetBlobs(os.TempDir(), []string{"frame1.png"}, nil); err == nil {
+		t.Error("expected an error getting a blob without a reference in the event meta")
+	}
+}
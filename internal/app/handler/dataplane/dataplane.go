@@ -1,6 +1,8 @@
 package dataplane
 
 import (
+	"fmt"
+
 	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/documentstorage"
 	"github.com/lawrencegripper/ion/internal/pkg/common"
 )
@@ -13,10 +15,14 @@ type DocumentStorageProvider interface {
 	Close()
 }
 
-//BlobStorageProvider is responsible for getting information about blobs stored externally
+//BlobStorageProvider is responsible for getting information about blobs stored externally.
+//Blobs are referenced by their '/' separated path relative to the directory they're put from
+//or got into, so a module's nested output directories are preserved. Putting blobs returns
+//their uris and SHA256 checksums by path, getting blobs fails if a blob's content doesn't
+//match the checksum given for it.
 type BlobStorageProvider interface {
-	GetBlobs(outputDir string, filePaths []string) error
-	PutBlobs(filePaths []string) (map[string]string, error)
+	GetBlobs(outputDir string, filePaths []string, checksums map[string]string) error
+	PutBlobs(baseDir string, filePaths []string) (map[string]string, map[string]string, error)
 	Close()
 }
 
@@ -40,3 +46,21 @@ func (d *DataPlane) Close() {
 	defer d.DocumentStorageProvider.Close()
 	defer d.EventPublisher.Close()
 }
+
+// GetEventMeta returns the metadata of the event which triggered the module. When the module
+// was triggered by a join the metadata of the events joined with it is combined into it.
+func GetEventMeta(documents DocumentStorageProvider, context *common.Context) (*documentstorage.EventMeta, error) {
+	eventMeta, err := documents.GetEventMetaByID(context.EventID)
+	if err != nil || len(context.JoinedEventIDs) == 0 {
+		return eventMeta, err
+	}
+	metas := []*documentstorage.EventMeta{eventMeta}
+	for _, eventID := range context.JoinedEventIDs {
+		joined, err := documents.GetEventMetaByID(eventID)
+		if err != nil {
+			return nil, fmt.Errorf("failed getting meta for joined event %s: %+v", eventID, err)
+		}
+		metas = append(metas, joined)
+	}
+	return documentstorage.JoinEventMetas(metas)
+}
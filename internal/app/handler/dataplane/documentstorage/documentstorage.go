@@ -1,6 +1,8 @@
 package documentstorage
 
 import (
+	"fmt"
+
 	"github.com/lawrencegripper/ion/internal/pkg/common"
 )
 
@@ -16,9 +18,67 @@ type EventMeta struct {
 	*common.Context
 	ParentEventID string               `bson:"parentEventId" json:"parentEventId"`
 	Files         []string             `bson:"files" json:"files"`
+	Checksums     []FileChecksum       `bson:"checksums" json:"checksums"`
 	Data          common.KeyValuePairs `bson:"data" json:"data"`
 }
 
+//FileChecksum is the SHA256 of a file's content when it was committed, it's kept
+//in a list rather than keyed by file as file names can contain '.'
+type FileChecksum struct {
+	File   string `bson:"file" json:"file"`
+	SHA256 string `bson:"sha256" json:"sha256"`
+}
+
+//ChecksumsByFile returns the SHA256 of each of the files which has one
+func (e *EventMeta) ChecksumsByFile() map[string]string {
+	checksums := make(map[string]string, len(e.Checksums))
+	for _, checksum := range e.Checksums {
+		checksums[checksum.File] = checksum.SHA256
+	}
+	return checksums
+}
+
+//JoinEventMetas combines the metadata of the events joined to trigger a module into a single
+//event meta with the first event's context. Each event's files, checksums and data keys are
+//prefixed with its event ID, so events with files or data of the same name don't clash and
+//the module finds each event's files under '<eventID>/' in its input directory.
+func JoinEventMetas(metas []*EventMeta) (*EventMeta, error) {
+	if len(metas) == 0 || metas[0] == nil {
+		return nil, fmt.Errorf("no event meta to join")
+	}
+	joined := &EventMeta{
+		Context:       metas[0].Context,
+		ParentEventID: metas[0].ParentEventID,
+	}
+	for _, meta := range metas {
+		if meta == nil {
+			continue
+		}
+		if meta.Context == nil || meta.EventID == "" {
+			return nil, fmt.Errorf("joined event meta has no event ID")
+		}
+		for _, file := range meta.Files {
+			joined.Files = append(joined.Files, joinedKey(meta.EventID, file))
+		}
+		for _, checksum := range meta.Checksums {
+			joined.Checksums = append(joined.Checksums, FileChecksum{
+				File:   joinedKey(meta.EventID, checksum.File),
+				SHA256: checksum.SHA256,
+			})
+		}
+		for _, kvp := range meta.Data {
+			kvp.Key = joinedKey(meta.EventID, kvp.Key)
+			joined.Data = append(joined.Data, kvp)
+		}
+	}
+	return joined, nil
+}
+
+//joinedKey prefixes a file or data key with the ID of the joined event it came from
+func joinedKey(eventID, key string) string {
+	return eventID + "/" + key
+}
+
 //ModuleLogs is a single entry in a document
 type ModuleLogs struct {
 	*common.Context
@@ -0,0 +1,46 @@
+package documentstorage
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+)
+
+func TestJoinEventMetasNamespacesEachEvent(t *testing.T) {
+	metas := []*EventMeta{
+		{
+			Context:   &common.Context{EventID: "a1"},
+			Files:     []string{"output.json"},
+			Checksums: []FileChecksum{{File: "output.json", SHA256: "aa"}},
+			Data:      common.KeyValuePairs{{Key: "output.json", Value: "ref-a"}, {Key: "count", Value: "1"}},
+		},
+		{
+			Context:   &common.Context{EventID: "v1"},
+			Files:     []string{"output.json"},
+			Checksums: []FileChecksum{{File: "output.json", SHA256: "vv"}},
+			Data:      common.KeyValuePairs{{Key: "output.json", Value: "ref-v"}, {Key: "count", Value: "2"}},
+		},
+	}
+	joined, err := JoinEventMetas(metas)
+	if err != nil {
+		t.Fatalf("Expected events with files of the same name to join Got: %+v", err)
+	}
+	if expected := []string{"a1/output.json", "v1/output.json"}; !reflect.DeepEqual(joined.Files, expected) {
+		t.Errorf("Files incorrect Expected: %v Got: %v", expected, joined.Files)
+	}
+	checksums := joined.ChecksumsByFile()
+	if checksums["a1/output.json"] != "aa" || checksums["v1/output.json"] != "vv" {
+		t.Errorf("Checksums incorrect Got: %v", checksums)
+	}
+	data := joined.Data.AsMap()
+	expected := map[string]string{"a1/output.json": "ref-a", "a1/count": "1", "v1/output.json": "ref-v", "v1/count": "2"}
+	if len(joined.Data) != len(expected) {
+		t.Errorf("Expected no data to be dropped Got: %v", joined.Data)
+	}
+	for key, value := range expected {
+		if data[key] != value {
+			t.Errorf("Data '%s' incorrect Expected: %s Got: %s", key, value, data[key])
+		}
+	}
+}
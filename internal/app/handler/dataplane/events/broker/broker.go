@@ -0,0 +1,39 @@
+package broker
+
+import (
+	"context"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+	log "github.com/sirupsen/logrus"
+)
+
+// publishTimeout is how long publishing an event may take
+const publishTimeout = time.Duration(30) * time.Second
+
+//EventPublisher publishes events through a messaging broker
+type EventPublisher struct {
+	broker messaging.Publisher
+}
+
+//NewEventPublisher returns an EventPublisher which publishes to the broker
+func NewEventPublisher(broker messaging.Publisher) *EventPublisher {
+	return &EventPublisher{
+		broker: broker,
+	}
+}
+
+//Publish publishes an event to the topic for its type
+func (e *EventPublisher) Publish(event common.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	return e.broker.Publish(ctx, event)
+}
+
+//Close closes the connection to the broker
+func (e *EventPublisher) Close() {
+	if err := e.broker.Close(); err != nil {
+		log.WithError(err).Warn("failed to close connection to broker")
+	}
+}
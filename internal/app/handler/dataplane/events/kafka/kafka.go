@@ -0,0 +1,24 @@
+package kafka
+
+import (
+	"strings"
+
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/events/broker"
+	"github.com/lawrencegripper/ion/internal/pkg/kafka"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+)
+
+//Config to setup a Kafka event publisher
+type Config struct {
+	Enabled bool   `description:"Enable Kafka event provider"`
+	Brokers string `description:"Kafka broker addresses as a comma delimited list"`
+}
+
+//NewEventPublisher returns a publisher which writes events to the Kafka cluster
+func NewEventPublisher(config *Config, eventEncoding messaging.EventEncoding) (*broker.EventPublisher, error) {
+	publisher, err := kafka.NewPublisher(strings.Split(config.Brokers, ","), eventEncoding)
+	if err != nil {
+		return nil, err
+	}
+	return broker.NewEventPublisher(publisher), nil
+}
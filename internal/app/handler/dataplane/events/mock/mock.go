@@ -40,6 +40,7 @@ func (e *EventPublisher) Publish(event common.Event) error {
 	if err != nil {
 		return fmt.Errorf("error writing event to file '%s': '%+v'", eventPath, err)
 	}
+	e.count++
 	return nil
 }
 
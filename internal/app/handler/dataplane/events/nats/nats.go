@@ -0,0 +1,22 @@
+package nats
+
+import (
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/events/broker"
+	"github.com/lawrencegripper/ion/internal/pkg/jetstream"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+)
+
+//Config to setup a NATS JetStream event publisher
+type Config struct {
+	Enabled bool   `description:"Enable NATS JetStream event provider"`
+	URL     string `description:"NATS server url"`
+}
+
+//NewEventPublisher connects to the NATS server and returns a publisher for its events stream
+func NewEventPublisher(config *Config, eventEncoding messaging.EventEncoding) (*broker.EventPublisher, error) {
+	publisher, err := jetstream.NewPublisher(config.URL, eventEncoding)
+	if err != nil {
+		return nil, err
+	}
+	return broker.NewEventPublisher(publisher), nil
+}
@@ -0,0 +1,22 @@
+package rabbitmq
+
+import (
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/events/broker"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+	"github.com/lawrencegripper/ion/internal/pkg/rabbitmq"
+)
+
+//Config to setup a RabbitMQ event publisher
+type Config struct {
+	Enabled bool   `description:"Enable RabbitMQ event provider"`
+	URL     string `description:"RabbitMQ AMQP url"`
+}
+
+//NewEventPublisher connects to the RabbitMQ server and returns a publisher for its event exchanges
+func NewEventPublisher(config *Config, eventEncoding messaging.EventEncoding) (*broker.EventPublisher, error) {
+	publisher, err := rabbitmq.NewPublisher(config.URL, eventEncoding)
+	if err != nil {
+		return nil, err
+	}
+	return broker.NewEventPublisher(publisher), nil
+}
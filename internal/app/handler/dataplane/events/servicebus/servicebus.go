@@ -12,7 +12,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/lawrencegripper/ion/internal/pkg/cloudevents"
 	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
 	"k8s.io/kubernetes/third_party/forked/golang/template"
 )
 
@@ -32,6 +34,8 @@ type ServiceBus struct {
 	PartialURL string `description:"This is the SB url without the topic name set. Replace %%TOPIC_PLACEHOLDER%% with the required topic before using"`
 	Key        string
 	SKN        string
+
+	eventEncoding messaging.EventEncoding
 }
 
 /* not currently needed - leaving for future use
@@ -44,12 +48,27 @@ type brokerProperties struct {
 
 const topicPlaceholderText = "%%TOPIC_PLACEHOLDER%%"
 
+// reservedHeaders are HTTP headers which event data can't be set as, the data
+// isn't sent as a message property so can't be filtered on
+var reservedHeaders = map[string]bool{
+	"Authorization":    true,
+	"Brokerproperties": true,
+	"Connection":       true,
+	"Date":             true,
+	"Expect":           true,
+	"Host":             true,
+	"Te":               true,
+	"Trailer":          true,
+	"Upgrade":          true,
+}
+
 //NewServiceBus creates a new Service Bus object
-func NewServiceBus(config *Config) (*ServiceBus, error) {
+func NewServiceBus(config *Config, eventEncoding messaging.EventEncoding) (*ServiceBus, error) {
 	sb := &ServiceBus{
-		PartialURL: fmt.Sprintf("https://%s.servicebus.windows.net/%s/messages", config.Namespace, topicPlaceholderText),
-		Key:        config.Key,
-		SKN:        config.AuthorizationRuleName,
+		PartialURL:    fmt.Sprintf("https://%s.servicebus.windows.net/%s/messages", config.Namespace, topicPlaceholderText),
+		Key:           config.Key,
+		SKN:           config.AuthorizationRuleName,
+		eventEncoding: eventEncoding,
 	}
 	//TODO: validate connection for fast failure
 	return sb, nil
@@ -61,14 +80,35 @@ func (s *ServiceBus) Publish(e common.Event) error {
 	// generate a url for the correct topic for this event
 	sbURL := strings.Replace(s.PartialURL, topicPlaceholderText, e.Type, -1)
 
-	b, err := json.Marshal(e)
+	encoded, err := messaging.EncodeEvent(e, s.eventEncoding)
 	if err != nil {
 		return fmt.Errorf("error publishing event %+v", err)
 	}
-	req, err := http.NewRequest(http.MethodPost, sbURL, bytes.NewBuffer(b))
-	req.Header.Set("Content-Type", "application/json")
+	req, err := http.NewRequest(http.MethodPost, sbURL, bytes.NewBuffer(encoded.Body))
+	req.Header.Set("Content-Type", encoded.ContentType)
 	req.Header.Set("Authorization", generateSAS(sbURL, s.SKN, s.Key))
 
+	// Custom headers are set as the message's properties. Their values are JSON, so strings
+	// are quoted or ServiceBus would read a spec version of 1.0 as a number. The event's
+	// data is set as properties for subscription filters, its numbers are left unquoted.
+	for name, value := range encoded.Properties {
+		if req.Header.Get(name) != "" || reservedHeaders[http.CanonicalHeaderKey(name)] {
+			continue
+		}
+		encodedValue, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("error publishing event %+v", err)
+		}
+		req.Header.Set(name, string(encodedValue))
+	}
+	for name, value := range encoded.Attributes {
+		quoted, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("error publishing event %+v", err)
+		}
+		req.Header.Set(cloudevents.HTTPHeaderPrefix+name, string(quoted))
+	}
+
 	/* not currently needed - leaving for future use
 	var props brokerProperties
 	p, err := json.Marshal(&props)
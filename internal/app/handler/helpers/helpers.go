@@ -72,6 +72,16 @@ func JoinBlobPath(strs ...string) string {
 	return strings.Join(allStrs, `/`)
 }
 
+//BlobFilePath returns the OS specific path of a blob's file within a directory. Blob
+//paths are relative and '/' separated, paths outside of the directory return an error.
+func BlobFilePath(dir, blobPath string) (string, error) {
+	cleaned := path.Clean(blobPath)
+	if path.IsAbs(cleaned) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("blob path '%s' isn't a relative path within the directory", blobPath)
+	}
+	return filepath.Join(dir, filepath.FromSlash(cleaned)), nil
+}
+
 //ContainsString checks whether a string is in a slice of strings
 func ContainsString(slice []string, target string) bool {
 	for _, s := range slice {
@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"testing"
 
 	"github.com/lawrencegripper/ion/internal/app/handler/helpers"
@@ -109,6 +110,31 @@ func TestJoinBlobPath(t *testing.T) {
 	}
 }
 
+func TestBlobFilePath(t *testing.T) {
+	testCases := []struct {
+		blobPath string
+		expected string
+		valid    bool
+	}{
+		{blobPath: "frame.jpg", expected: filepath.Join("in", "frame.jpg"), valid: true},
+		{blobPath: "frames/0001.jpg", expected: filepath.Join("in", "frames", "0001.jpg"), valid: true},
+		{blobPath: "frames/../0001.jpg", expected: filepath.Join("in", "0001.jpg"), valid: true},
+		{blobPath: "../0001.jpg"},
+		{blobPath: "frames/../../0001.jpg"},
+		{blobPath: "/etc/passwd"},
+		{blobPath: "."},
+	}
+	for _, test := range testCases {
+		actual, err := helpers.BlobFilePath("in", test.blobPath)
+		if test.valid && (err != nil || actual != test.expected) {
+			t.Errorf("%s: expecting '%s' but got '%s' with error '%+v'", test.blobPath, test.expected, actual, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: expecting an error but got '%s'", test.blobPath, actual)
+		}
+	}
+}
+
 func TestRemoveFile(t *testing.T) {
 	testCases := []struct {
 		filename string
@@ -135,7 +135,7 @@ func (p *Preparer) prepareData() error {
 			"files": eventMeta.Files,
 			"data":  eventMeta.Data,
 		})
-		err = p.dataPlane.GetBlobs(p.environment.InputBlobDirPath, eventMeta.Files)
+		err = p.dataPlane.GetBlobs(p.environment.InputBlobDirPath, eventMeta.Files, eventMeta.ChecksumsByFile())
 		if err != nil {
 			return err
 		}
@@ -154,8 +154,12 @@ func (p *Preparer) prepareData() error {
 	return nil
 }
 
+// getEventMeta returns the metadata of the event, combined with the events joined with it
 func (p *Preparer) getEventMeta() (*documentstorage.EventMeta, error) {
-	context, _ := p.dataPlane.GetEventMetaByID(p.context.EventID)
+	eventMeta, err := dataplane.GetEventMeta(p.dataPlane, p.context)
+	if err != nil && len(p.context.JoinedEventIDs) > 0 {
+		return nil, err
+	}
 	//TODO: Fail on error conditions other than not found
-	return context, nil
+	return eventMeta, nil
 }
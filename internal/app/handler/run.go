@@ -9,18 +9,25 @@ import (
 	"path"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/lawrencegripper/ion/internal/app/handler/committer"
 	"github.com/lawrencegripper/ion/internal/app/handler/constants"
 	"github.com/lawrencegripper/ion/internal/app/handler/dataplane"
 	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/blobstorage/azure"
 	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/blobstorage/filesystem"
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/blobstorage/s3"
 	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/documentstorage/inmemory"
 	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/documentstorage/mongodb"
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/events/kafka"
 	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/events/mock"
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/events/nats"
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/events/rabbitmq"
 	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/events/servicebus"
 	"github.com/lawrencegripper/ion/internal/app/handler/helpers"
 	"github.com/lawrencegripper/ion/internal/app/handler/preparer"
+	"github.com/lawrencegripper/ion/internal/pkg/eventschema"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -35,7 +42,14 @@ const (
 	// Providers
 	metaProviderMongoDB      string = "mongodb"
 	blobProviderAzureStorage string = "azureblob"
+	blobProviderS3           string = "s3"
 	eventProviderServiceBus  string = "servicebus"
+	eventProviderNATS        string = "nats"
+	eventProviderKafka       string = "kafka"
+	eventProviderRabbitMQ    string = "rabbitmq"
+
+	// How long to wait for the schema registry to return an event type's schema
+	schemaRegistryTimeout = 30 * time.Second
 )
 
 // Run the handler using config
@@ -91,7 +105,7 @@ func Run(config Configuration) {
 			panic(fmt.Sprintf("error during prepration %+v", err))
 		}
 	} else if config.Action == constants.Commit {
-		committer := committer.NewCommitter(baseDir, config.DevelopmentConfiguration)
+		committer := committer.NewCommitter(baseDir, config.DevelopmentConfiguration, getSchemaValidator(&config))
 		defer committer.Close()
 		if err := committer.Commit(config.Context, dataPlane, validEventTypes); err != nil {
 			panic(fmt.Sprintf("error during commit %+v", err))
@@ -143,16 +157,37 @@ func getMetaProvider(config *Configuration) dataplane.DocumentStorageProvider {
 }
 
 func getBlobProvider(config *Configuration, meta dataplane.DocumentStorageProvider) dataplane.BlobStorageProvider {
+	if config.S3BlobStorageProvider.Enabled {
+		log.Info("using s3 blob storage provider")
+		c := config.S3BlobStorageProvider
+		c.Parallelism = config.BlobParallelism
+		log.Info("getting event meta as the blob provider requires the presigned urls")
+		eventMeta, err := dataplane.GetEventMeta(meta, config.Context)
+		if err != nil {
+			log.WithError(err).Panic("failed while getting eventmeta for blob provider to use presigned urls")
+		}
+		// The bucket is shared by every correlation
+		// so blobs are prefixed with its ID in the
+		// way an Azure container is per correlation
+		s3Blob, err := s3.NewBlobStorage(c,
+			helpers.JoinBlobPath(config.Context.CorrelationID, config.Context.EventID, config.Context.Name),
+			eventMeta,
+		)
+		if err != nil {
+			panic(fmt.Errorf("failed to establish blob storage with provider '%s', error: %+v", blobProviderS3, err))
+		}
+		return s3Blob
+	}
 	if config.AzureBlobStorageProvider.Enabled {
 		log.Info("using azure blob storage provider")
 		c := config.AzureBlobStorageProvider
+		c.Parallelism = config.BlobParallelism
 		log.Info("getting event meta as the blob provider requires the SAS urls")
-		eventMeta, err := meta.GetEventMetaByID(config.Context.EventID)
+		eventMeta, err := dataplane.GetEventMeta(meta, config.Context)
 		if err != nil {
 			log.WithError(err).Panic("failed while getting eventmeta for blob provider to use sas urls")
 		}
 		azureBlob, err := azure.NewBlobStorage(c,
-			helpers.JoinBlobPath(config.Context.ParentEventID, config.Context.Name),
 			helpers.JoinBlobPath(config.Context.EventID, config.Context.Name),
 			eventMeta,
 		)
@@ -163,8 +198,9 @@ func getBlobProvider(config *Configuration, meta dataplane.DocumentStorageProvid
 	} // else
 	log.Info("defaulting to filesystem blob storage provider")
 	fsBlob, err := filesystem.NewBlobStorage(&filesystem.Config{
-		InputDir:  filepath.FromSlash(path.Join(config.DevelopmentConfiguration.ParentModuleDir, development.BlobsDirExt)),
-		OutputDir: filepath.FromSlash(path.Join(config.DevelopmentConfiguration.ModuleDir, development.BlobsDirExt)),
+		InputDir:    filepath.FromSlash(path.Join(config.DevelopmentConfiguration.ParentModuleDir, development.BlobsDirExt)),
+		OutputDir:   filepath.FromSlash(path.Join(config.DevelopmentConfiguration.ModuleDir, development.BlobsDirExt)),
+		Parallelism: config.BlobParallelism,
 	})
 	if err != nil {
 		panic(fmt.Errorf("failed to establish metadata store with debug provider, error: %+v", err))
@@ -172,15 +208,56 @@ func getBlobProvider(config *Configuration, meta dataplane.DocumentStorageProvid
 	return fsBlob
 }
 
+func getSchemaValidator(config *Configuration) eventschema.Validator {
+	if config.SchemaRegistryEndpoint == "" {
+		log.Info("no schema registry configured, events will not be validated")
+		return nil
+	}
+	log.Infof("validating events against the schemas registered with %s", config.SchemaRegistryEndpoint)
+	validator, err := eventschema.NewRegistryValidator(config.SchemaRegistryEndpoint, schemaRegistryTimeout)
+	if err != nil {
+		panic(fmt.Errorf("failed to connect to schema registry, error: %+v", err))
+	}
+	return validator
+}
+
 func getEventProvider(config *Configuration) dataplane.EventPublisher {
+	eventEncoding, err := messaging.ParseEventEncoding(config.EventEncoding)
+	if err != nil {
+		panic(fmt.Errorf("failed to establish event publisher, error: %+v", err))
+	}
 	if config.ServiceBusEventProvider.Enabled {
 		log.Info("using azure service bus event publisher")
 		c := config.ServiceBusEventProvider
-		serviceBus, err := servicebus.NewServiceBus(c)
+		serviceBus, err := servicebus.NewServiceBus(c, eventEncoding)
 		if err != nil {
 			panic(fmt.Errorf("failed to establish event publisher with provider '%s', error: %+v", eventProviderServiceBus, err))
 		}
 		return serviceBus
+	}
+	if config.NATSEventProvider.Enabled {
+		log.Info("using nats jetstream event publisher")
+		publisher, err := nats.NewEventPublisher(config.NATSEventProvider, eventEncoding)
+		if err != nil {
+			panic(fmt.Errorf("failed to establish event publisher with provider '%s', error: %+v", eventProviderNATS, err))
+		}
+		return publisher
+	}
+	if config.KafkaEventProvider.Enabled {
+		log.Info("using kafka event publisher")
+		publisher, err := kafka.NewEventPublisher(config.KafkaEventProvider, eventEncoding)
+		if err != nil {
+			panic(fmt.Errorf("failed to establish event publisher with provider '%s', error: %+v", eventProviderKafka, err))
+		}
+		return publisher
+	}
+	if config.RabbitMQEventProvider.Enabled {
+		log.Info("using rabbitmq event publisher")
+		publisher, err := rabbitmq.NewEventPublisher(config.RabbitMQEventProvider, eventEncoding)
+		if err != nil {
+			panic(fmt.Errorf("failed to establish event publisher with provider '%s', error: %+v", eventProviderRabbitMQ, err))
+		}
+		return publisher
 	} // else
 	log.Info("defaulting to filesystem event publisher")
 	fsEvents := mock.NewEventPublisher(filepath.FromSlash(path.Join(config.DevelopmentConfiguration.ModuleDir, development.EventsDirExt)))
@@ -9,6 +9,7 @@ import (
 	"github.com/lawrencegripper/ion/internal/app/management/servers"
 	"github.com/lawrencegripper/ion/internal/app/management/types"
 	"github.com/lawrencegripper/ion/internal/pkg/management/module"
+	"github.com/lawrencegripper/ion/internal/pkg/management/schema"
 	"github.com/lawrencegripper/ion/internal/pkg/management/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
@@ -34,6 +35,11 @@ func Run(config *types.Configuration) {
 		panic(fmt.Errorf("failed to initialize the trace management server: %+v", err))
 	}
 
+	schemaServer, err := servers.NewSchemaServer(config)
+	if err != nil {
+		panic(fmt.Errorf("failed to initialize the schema management server: %+v", err))
+	}
+
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", config.Port))
 	if err != nil {
 		panic(fmt.Errorf("failed to listen: %v", err))
@@ -42,6 +48,7 @@ func Run(config *types.Configuration) {
 
 	module.RegisterModuleServiceServer(s, moduleServer)
 	trace.RegisterTraceServiceServer(s, traceServer)
+	schema.RegisterSchemaServiceServer(s, schemaServer)
 
 	reflection.Register(s)
 
@@ -6,10 +6,15 @@ import (
 	"fmt"
 	"github.com/lawrencegripper/ion/internal/app/management/types"
 	"github.com/lawrencegripper/ion/internal/pkg/management/module"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging/filter"
 	"github.com/rs/xid"
 	log "github.com/sirupsen/logrus"
 	context "golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -118,6 +123,11 @@ func (k *Kubernetes) createSharedServicesSecret(config *types.Configuration) err
 			"LOGGING_APPINSIGHTS":                       config.AppInsightsKey,
 		},
 	}
+	// Dispatchers connect to Cosmos DB with the
+	// name and password without a connection string
+	if config.MongoDBConnectionString != "" {
+		secret.StringData["HANDLER_MONGODBDOCPROVIDER_CONNECTIONSTRING"] = config.MongoDBConnectionString
+	}
 
 	if err := k.createSecretIfNotExist(secret); err != nil {
 		return err
@@ -187,6 +197,14 @@ func (k *Kubernetes) createSecretIfNotExist(secret *apiv1.Secret) error {
 // and a deployment that runs a disptcher pod. The dispatcher pod will
 // orchestrate the execution of the module itself.
 func (k *Kubernetes) Create(ctx context.Context, r *module.ModuleCreateRequest) (*module.ModuleCreateResponse, error) {
+	// Reject a filter the dispatcher would fail to start with
+	if _, err := filter.Parse(r.Subscriptionfilter); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if r.Join && len(messaging.SplitEventTypes(r.Eventsubscriptions)) < 2 {
+		return nil, status.Error(codes.InvalidArgument, "a module must subscribe to at least 2 events to join them")
+	}
+
 	// a unique ID for this creation
 	id := fmt.Sprintf("%s-%s", r.Modulename, genID())
 
@@ -224,11 +242,6 @@ func (k *Kubernetes) Create(ctx context.Context, r *module.ModuleCreateRequest)
 
 	configMapFilePath := "/etc/config"
 
-	useAzureBatchProvider := false
-	if r.Provider == "azurebatch" {
-		useAzureBatchProvider = true
-	}
-
 	// Create an argument list to provide the the dispatcher binary
 	dispatcherArgs := []string{
 		"start",
@@ -236,7 +249,7 @@ func (k *Kubernetes) Create(ctx context.Context, r *module.ModuleCreateRequest)
 		"--moduleconfigpath=" + fmt.Sprintf("%s/module", configMapFilePath),
 		"--subscribestoevent=" + r.Eventsubscriptions,
 		"--eventspublished=" + r.Eventpublications,
-		"--azurebatch.enabled=" + strconv.FormatBool(useAzureBatchProvider),
+		"--provider=" + strings.ToLower(r.Provider),
 		"--job.workerimage=" + r.Moduleimage,
 		"--job.handlerimage=" + r.Handlerimage,
 		"--job.retrycount=" + fmt.Sprintf("%d", r.Retrycount),
@@ -246,6 +259,37 @@ func (k *Kubernetes) Create(ctx context.Context, r *module.ModuleCreateRequest)
 		"--loglevel=" + logLevel,
 		"--printconfig=true",
 	}
+	dispatcherArgs = append(dispatcherArgs, getResourceArgs("prepare", r.Prepareresources)...)
+	dispatcherArgs = append(dispatcherArgs, getResourceArgs("worker", r.Workerresources)...)
+	dispatcherArgs = append(dispatcherArgs, getResourceArgs("commit", r.Commitresources)...)
+	if r.Retrypolicy != nil {
+		dispatcherArgs = append(dispatcherArgs,
+			fmt.Sprintf("--job.retryinitialdelaysecs=%d", r.Retrypolicy.Initialdelaysecs),
+			fmt.Sprintf("--job.retrymultiplier=%g", r.Retrypolicy.Multiplier),
+			fmt.Sprintf("--job.retrymaxdelaysecs=%d", r.Retrypolicy.Maxdelaysecs),
+			fmt.Sprintf("--job.retryjitter=%g", r.Retrypolicy.Jitter),
+		)
+	}
+	if r.Subscriptionfilter != "" {
+		dispatcherArgs = append(dispatcherArgs, "--subscriptionfilter="+r.Subscriptionfilter)
+	}
+	if r.Join {
+		dispatcherArgs = append(dispatcherArgs, "--join.enabled=true")
+	}
+	if r.Serviceaccountname != "" {
+		dispatcherArgs = append(dispatcherArgs, "--kubernetes.serviceaccountname="+r.Serviceaccountname)
+	}
+	nodeSelectorKeys := make([]string, 0, len(r.Nodeselector))
+	for key := range r.Nodeselector {
+		nodeSelectorKeys = append(nodeSelectorKeys, key)
+	}
+	sort.Strings(nodeSelectorKeys)
+	for _, key := range nodeSelectorKeys {
+		dispatcherArgs = append(dispatcherArgs, fmt.Sprintf("--kubernetes.nodeselector=%s=%s", key, r.Nodeselector[key]))
+	}
+	for _, toleration := range r.Tolerations {
+		dispatcherArgs = append(dispatcherArgs, "--kubernetes.tolerations="+toleration)
+	}
 
 	dispatcherDeploymentName := id
 
@@ -462,4 +506,29 @@ func getClientSet() (*kubernetes.Clientset, error) {
 	return clientset, nil
 }
 
+// getResourceArgs creates the dispatcher args to set the resources of one of the job's containers
+func getResourceArgs(container string, resources *module.ContainerResources) []string {
+	if resources == nil {
+		return nil
+	}
+	prefix := "--job." + container + "."
+	args := []string{}
+	if resources.Cpurequest != "" {
+		args = append(args, prefix+"cpurequest="+resources.Cpurequest)
+	}
+	if resources.Cpulimit != "" {
+		args = append(args, prefix+"cpulimit="+resources.Cpulimit)
+	}
+	if resources.Memoryrequest != "" {
+		args = append(args, prefix+"memoryrequest="+resources.Memoryrequest)
+	}
+	if resources.Memorylimit != "" {
+		args = append(args, prefix+"memorylimit="+resources.Memorylimit)
+	}
+	if resources.Gpu > 0 {
+		args = append(args, prefix+"gpu="+strconv.Itoa(int(resources.Gpu)))
+	}
+	return args
+}
+
 func int32Ptr(i int32) *int32 { return &i }
@@ -0,0 +1,140 @@
+package servers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/documentstorage/mongodb"
+	"github.com/lawrencegripper/ion/internal/app/management/types"
+	"github.com/lawrencegripper/ion/internal/pkg/eventschema"
+	"github.com/lawrencegripper/ion/internal/pkg/management/schema"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	mongo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// cSpell:ignore mongodb, bson, upsert
+
+//Check at compile time if we implement the interface
+var _ schema.SchemaServiceServer = (*SchemaServer)(nil)
+
+// schemaDocument is how a schema is stored. The schema is kept as a string as
+// JSON Schema keywords, such as '$schema', aren't valid field names in MongoDB.
+type schemaDocument struct {
+	EventType string `bson:"eventType"`
+	Schema    string `bson:"schema"`
+}
+
+//NewSchemaServer Create a new instance of a Schema management server
+func NewSchemaServer(config *types.Configuration) (*SchemaServer, error) {
+	mongoConnection, err := mongodb.NewMongoDB(&mongodb.Config{
+		Collection:       config.MongoDBSchemaCollection,
+		Enabled:          true,
+		ConnectionString: config.MongoDBConnectionString,
+		Name:             config.MongoDBName,
+		Password:         config.MongoDBPassword,
+		Port:             config.MongoDBPort,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed connecting to mongo: %+v", err)
+	}
+
+	collection := mongoConnection.Collection
+	return &SchemaServer{
+		saveSchema: func(document schemaDocument) error {
+			_, err := collection.Upsert(bson.M{"eventType": document.EventType}, document)
+			return err
+		},
+		getSchema: func(eventType string) (*schemaDocument, error) {
+			document := schemaDocument{}
+			err := collection.Find(bson.M{"eventType": eventType}).One(&document)
+			if err == mongo.ErrNotFound {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			return &document, nil
+		},
+		listEventTypes: func() ([]string, error) {
+			var eventTypes []string
+			err := collection.Find(nil).Distinct("eventType", &eventTypes)
+			return eventTypes, err
+		},
+		deleteSchema: func(eventType string) (bool, error) {
+			err := collection.Remove(bson.M{"eventType": eventType})
+			if err == mongo.ErrNotFound {
+				return false, nil
+			}
+			return err == nil, err
+		},
+	}, nil
+}
+
+//SchemaServer is an instance of a Schema management server, it's the registry of
+//the JSON Schemas events' data is validated against
+type SchemaServer struct {
+	saveSchema     func(document schemaDocument) error
+	getSchema      func(eventType string) (*schemaDocument, error)
+	listEventTypes func() ([]string, error)
+	deleteSchema   func(eventType string) (bool, error)
+}
+
+//Register validates and stores a schema for an event type, replacing any existing schema
+func (s *SchemaServer) Register(ctx context.Context, r *schema.SchemaRegisterRequest) (*schema.SchemaRegisterResponse, error) {
+	if r.Eventtype == "" {
+		return nil, status.Error(codes.InvalidArgument, "an event type is required")
+	}
+	if _, err := eventschema.Compile(r.Schema); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.saveSchema(schemaDocument{EventType: r.Eventtype, Schema: r.Schema}); err != nil {
+		return nil, fmt.Errorf("error saving schema for event type '%s': %+v", r.Eventtype, err)
+	}
+	return &schema.SchemaRegisterResponse{
+		Eventtype: r.Eventtype,
+	}, nil
+}
+
+//Delete removes the schema for an event type, its events are no longer validated
+func (s *SchemaServer) Delete(ctx context.Context, r *schema.SchemaDeleteRequest) (*schema.SchemaDeleteResponse, error) {
+	deleted, err := s.deleteSchema(r.Eventtype)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting schema for event type '%s': %+v", r.Eventtype, err)
+	}
+	if !deleted {
+		return nil, status.Errorf(codes.NotFound, "no schema is registered for event type '%s'", r.Eventtype)
+	}
+	return &schema.SchemaDeleteResponse{
+		Eventtype: r.Eventtype,
+	}, nil
+}
+
+//Get returns the schema for an event type, or a NotFound error if none is registered
+func (s *SchemaServer) Get(ctx context.Context, r *schema.SchemaGetRequest) (*schema.SchemaGetResponse, error) {
+	document, err := s.getSchema(r.Eventtype)
+	if err != nil {
+		return nil, fmt.Errorf("error getting schema for event type '%s': %+v", r.Eventtype, err)
+	}
+	if document == nil {
+		return nil, status.Errorf(codes.NotFound, "no schema is registered for event type '%s'", r.Eventtype)
+	}
+	return &schema.SchemaGetResponse{
+		Eventtype: document.EventType,
+		Schema:    document.Schema,
+	}, nil
+}
+
+//List returns the event types which have a schema registered
+func (s *SchemaServer) List(ctx context.Context, r *schema.SchemaListRequest) (*schema.SchemaListResponse, error) {
+	eventTypes, err := s.listEventTypes()
+	if err != nil {
+		return nil, fmt.Errorf("error listing schemas: %+v", err)
+	}
+	sort.Strings(eventTypes)
+	return &schema.SchemaListResponse{
+		Eventtypes: eventTypes,
+	}, nil
+}
@@ -1,11 +1,20 @@
 package servers
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/blobstorage/azure"
+	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/blobstorage/s3"
 	"github.com/lawrencegripper/ion/internal/app/handler/dataplane/documentstorage/mongodb"
 	"github.com/lawrencegripper/ion/internal/app/management/types"
 	"github.com/lawrencegripper/ion/internal/pkg/management/trace"
+	minio "github.com/minio/minio-go"
 )
 
 //Check at compile time if we implement the interface
@@ -13,14 +22,17 @@ var _ trace.TraceServiceServer = (*TraceServer)(nil)
 
 //NewTraceServer Create a new instance of a Trace management server
 func NewTraceServer(config *types.Configuration) (*TraceServer, error) {
-	traceServer := TraceServer{}
+	traceServer := TraceServer{
+		urlExpiry: time.Duration(config.SignedURLExpiryMins) * time.Minute,
+	}
 
 	mongoConnection, err := mongodb.NewMongoDB(&mongodb.Config{
-		Collection: config.MongoDBCollection,
-		Enabled:    true,
-		Name:       config.MongoDBName,
-		Password:   config.MongoDBPassword,
-		Port:       config.MongoDBPort,
+		Collection:       config.MongoDBCollection,
+		Enabled:          true,
+		ConnectionString: config.MongoDBConnectionString,
+		Name:             config.MongoDBName,
+		Password:         config.MongoDBPassword,
+		Port:             config.MongoDBPort,
 	})
 
 	if err != nil {
@@ -29,23 +41,109 @@ func NewTraceServer(config *types.Configuration) (*TraceServer, error) {
 
 	traceServer.mongoConnection = mongoConnection
 
+	blobClient, err := storage.NewBasicClient(config.AzureStorageAccountName, config.AzureStorageAccountKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed creating blob client: %+v", err)
+	}
+	traceServer.blobClient = blobClient.GetBlobService()
+
+	if config.S3Endpoint != "" {
+		traceServer.s3Client, err = minio.NewWithRegion(config.S3Endpoint, config.S3AccessKeyID, config.S3SecretAccessKey, config.S3UseSSL, config.S3Region)
+		if err != nil {
+			return nil, fmt.Errorf("Failed creating S3 client: %+v", err)
+		}
+	}
+
 	return &traceServer, nil
 }
 
 //TraceServer is an instance of a Trace management server
 type TraceServer struct {
 	mongoConnection *mongodb.MongoDB
+	blobClient      storage.BlobStorageClient
+	s3Client        *minio.Client
+	urlExpiry       time.Duration
 }
 
-//GetFlow returns json data from the meta store by correlationid
+//GetFlow returns json data from the meta store by correlationid, the blobs and logs
+//referenced in the data are replaced with urls to them which are valid for the configured expiry
 func (t *TraceServer) GetFlow(ctx context.Context, request *trace.GetFlowRequest) (*trace.GetFlowResponse, error) {
-	json, err := t.mongoConnection.GetJSONDataByCorrelationID(request.CorrelationID)
+	flowJSON, err := t.mongoConnection.GetJSONDataByCorrelationID(request.CorrelationID)
 
 	if err != nil {
 		return nil, err
 	}
 
+	signedJSON, err := t.signFlow(*flowJSON)
+	if err != nil {
+		return nil, err
+	}
+
 	return &trace.GetFlowResponse{
-		FlowJSON: *json,
+		FlowJSON: signedJSON,
 	}, nil
 }
+
+//signFlow replaces the references to blobs in the flow's documents with signed urls
+func (t *TraceServer) signFlow(flowJSON string) (string, error) {
+	var documents interface{}
+	decoder := json.NewDecoder(bytes.NewBufferString(flowJSON))
+	decoder.UseNumber()
+	if err := decoder.Decode(&documents); err != nil {
+		return "", fmt.Errorf("failed to decode flow: %+v", err)
+	}
+	documents, err := t.signReferences(documents)
+	if err != nil {
+		return "", err
+	}
+	b, err := mongodb.JSONMarshal(documents)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode flow: %+v", err)
+	}
+	return string(b), nil
+}
+
+//signReferences walks a decoded json value signing each string which is a blob reference
+func (t *TraceServer) signReferences(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return t.signReference(v)
+	case []interface{}:
+		for i, item := range v {
+			signed, err := t.signReferences(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = signed
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			signed, err := t.signReferences(item)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = signed
+		}
+	}
+	return value, nil
+}
+
+//signReference returns a signed url for an Azure blob or S3 object reference, any other
+//value is returned as it is. S3 references are only signed when an endpoint is configured.
+func (t *TraceServer) signReference(value string) (string, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return value, nil
+	}
+	switch u.Scheme {
+	case azure.ReferenceScheme:
+		return azure.SignReference(t.blobClient, value, t.urlExpiry)
+	case s3.ReferenceScheme:
+		if t.s3Client == nil {
+			return value, nil
+		}
+		return s3.PresignReference(t.s3Client, value, t.urlExpiry)
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,52 @@
+package servers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+	minio "github.com/minio/minio-go"
+)
+
+func TestSignFlowSignsReferences(t *testing.T) {
+	blobClient, err := storage.NewBasicClient("account", "a2V5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s3Client, err := minio.NewWithRegion("localhost:9000", "id", "secret", false, "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	traceServer := &TraceServer{
+		blobClient: blobClient.GetBlobService(),
+		s3Client:   s3Client,
+		urlExpiry:  time.Duration(30) * time.Minute,
+	}
+	flow := `[{"logs": "azureblob://logs/c1/e1/module-attempt-1.log", "data": [{"key": "frame.png", "value": "s3://bucket/c1/e1/module/frame.png"}, {"key": "count", "value": "2"}], "port": 27017}]`
+
+	signed, err := traceServer.signFlow(flow)
+	if err != nil {
+		t.Fatalf("error signing flow: %+v", err)
+	}
+	var documents []struct {
+		Logs string `json:"logs"`
+		Data []struct {
+			Value string `json:"value"`
+		} `json:"data"`
+		Port int `json:"port"`
+	}
+	if err := json.Unmarshal([]byte(signed), &documents); err != nil {
+		t.Fatalf("error decoding signed flow '%s': %+v", signed, err)
+	}
+	if !strings.HasPrefix(documents[0].Logs, "https://account.blob.core.windows.net/logs/c1/e1/module-attempt-1.log?") {
+		t.Errorf("expected a SAS url to the logs got '%s'", documents[0].Logs)
+	}
+	if !strings.HasPrefix(documents[0].Data[0].Value, "http://localhost:9000/bucket/c1/e1/module/frame.png?") || !strings.Contains(documents[0].Data[0].Value, "X-Amz-Expires=1800") {
+		t.Errorf("expected a presigned url valid for 30 minutes to the object got '%s'", documents[0].Data[0].Value)
+	}
+	if documents[0].Data[1].Value != "2" || documents[0].Port != 27017 {
+		t.Errorf("expected other values to be unchanged got '%s'", signed)
+	}
+}
@@ -26,12 +26,20 @@ type Configuration struct {
 	AzureBatchImageRepositoryServer   string
 	AzureBatchImageRepositoryUsername string
 	AzureBatchImageRepositoryPassword string
+	MongoDBConnectionString           string
 	MongoDBPort                       int
 	MongoDBName                       string
 	MongoDBPassword                   string
 	MongoDBCollection                 string
+	MongoDBSchemaCollection           string
 	AzureStorageAccountName           string
 	AzureStorageAccountKey            string
+	S3Endpoint                        string
+	S3AccessKeyID                     string
+	S3SecretAccessKey                 string
+	S3Region                          string
+	S3UseSSL                          bool
+	SignedURLExpiryMins               int
 	LogLevel                          string
 	PrintConfig                       bool
 	AppInsightsKey                    string
@@ -0,0 +1,251 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+)
+
+// SpecVersion is the version of the CloudEvents specification events are encoded with
+const SpecVersion = "1.0"
+
+// Content types of an encoded event's body
+const (
+	// StructuredContentType is the content type of an event encoded in structured mode
+	StructuredContentType = "application/cloudevents+json"
+	// JSONContentType is the content type of an event's data
+	JSONContentType = "application/json"
+)
+
+// Prefixes the protocol bindings add to attribute names when they're set as message
+// headers or properties in binary mode
+const (
+	HTTPHeaderPrefix   = "ce-"
+	KafkaHeaderPrefix  = "ce_"
+	AMQPPropertyPrefix = "cloudEvents:"
+	// amqpPropertyAltPrefix is allowed by the AMQP binding for properties which can't contain ':'
+	amqpPropertyAltPrefix = "cloudEvents_"
+)
+
+// Attributes an Ion event is mapped to. The context's event, correlation and parent event IDs
+// are the id and the correlationid and parenteventid extensions. The module which published
+// the event is recorded in the source.
+const (
+	attributeSpecVersion     = "specversion"
+	attributeID              = "id"
+	attributeSource          = "source"
+	attributeType            = "type"
+	attributeDataContentType = "datacontenttype"
+	attributeCorrelationID   = "correlationid"
+	attributeParentEventID   = "parenteventid"
+	attributeDocumentType    = "documenttype"
+	attributeData            = "data"
+	attributeDataBase64      = "data_base64"
+
+	// sourcePrefix is prepended to the name of the module which published an event
+	sourcePrefix = "/ion/"
+)
+
+// IsStructured returns true if the body is an event encoded in structured mode
+func IsStructured(data []byte) bool {
+	var probe struct {
+		SpecVersion string `json:"specversion"`
+	}
+	return json.Unmarshal(data, &probe) == nil && probe.SpecVersion != ""
+}
+
+// MarshalStructured encodes the event, with its data, as a CloudEvents JSON document
+func MarshalStructured(event common.Event) ([]byte, error) {
+	attributes, err := toAttributes(event)
+	if err != nil {
+		return nil, err
+	}
+	document := make(map[string]interface{}, len(attributes)+1)
+	for name, value := range attributes {
+		document[name] = value
+	}
+	if len(event.Data) > 0 {
+		document[attributeData] = event.Data
+	}
+	return json.Marshal(document)
+}
+
+// UnmarshalStructured decodes an event encoded as a CloudEvents JSON document
+func UnmarshalStructured(data []byte) (common.Event, error) {
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(data, &document); err != nil {
+		return common.Event{}, err
+	}
+	attributes := make(map[string]string, len(document))
+	for name, raw := range document {
+		if name == attributeData || name == attributeDataBase64 {
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			// Extensions may be numbers or booleans, keep their JSON form
+			value = string(raw)
+		}
+		attributes[name] = value
+	}
+
+	event, err := fromAttributes(attributes)
+	if err != nil {
+		return event, err
+	}
+	if raw, ok := document[attributeDataBase64]; ok {
+		var encoded []byte
+		if err := json.Unmarshal(raw, &encoded); err != nil {
+			return event, fmt.Errorf("invalid data_base64: %+v", err)
+		}
+		event.Data, err = decodeData(encoded)
+	} else if raw, ok := document[attributeData]; ok {
+		event.Data, err = decodeData(raw)
+	}
+	return event, err
+}
+
+// ToBinary returns the event's attributes, to be set as message headers with the binding's
+// prefix, and its data, to be the message body. The data's content type isn't an attribute,
+// it's JSONContentType and is set as the message's content type.
+func ToBinary(event common.Event) (map[string]string, []byte, error) {
+	attributes, err := toAttributes(event)
+	if err != nil {
+		return nil, nil, err
+	}
+	delete(attributes, attributeDataContentType)
+	data := []byte{}
+	if len(event.Data) > 0 {
+		data, err = json.Marshal(event.Data)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return attributes, data, nil
+}
+
+// FromBinary decodes an event from the attributes set as message headers and its body. The
+// message's content type may be passed as the datacontenttype attribute.
+func FromBinary(attributes map[string]string, data []byte) (common.Event, error) {
+	event, err := fromAttributes(attributes)
+	if err != nil {
+		return event, err
+	}
+	if len(data) > 0 {
+		event.Data, err = decodeData(data)
+	}
+	return event, err
+}
+
+// Attributes returns the attributes of an event encoded in binary mode from a message's headers.
+// Headers with any of the bindings' prefixes are attributes, it returns nil when the headers
+// don't include a spec version so the message isn't a binary mode event.
+func Attributes(headers map[string]string) map[string]string {
+	attributes := map[string]string{}
+	for name, value := range headers {
+		for _, prefix := range []string{HTTPHeaderPrefix, KafkaHeaderPrefix, AMQPPropertyPrefix, amqpPropertyAltPrefix} {
+			if len(name) > len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+				attributes[strings.ToLower(name[len(prefix):])] = value
+				break
+			}
+		}
+	}
+	if attributes[attributeSpecVersion] == "" {
+		return nil
+	}
+	return attributes
+}
+
+// toAttributes maps the event to CloudEvents attributes, the context's fields are only set when they have a value
+func toAttributes(event common.Event) (map[string]string, error) {
+	if event.Context == nil || event.Context.EventID == "" {
+		return nil, errors.New("an event requires a context with an eventId to be encoded as a cloudevent")
+	}
+	if event.Type == "" {
+		return nil, errors.New("an event requires a type to be encoded as a cloudevent")
+	}
+	attributes := map[string]string{
+		attributeSpecVersion:     SpecVersion,
+		attributeID:              event.Context.EventID,
+		attributeSource:          sourcePrefix + event.Context.Name,
+		attributeType:            event.Type,
+		attributeDataContentType: JSONContentType,
+	}
+	extensions := map[string]string{
+		attributeCorrelationID: event.Context.CorrelationID,
+		attributeParentEventID: event.Context.ParentEventID,
+		attributeDocumentType:  event.Context.DocumentType,
+	}
+	for name, value := range extensions {
+		if value != "" {
+			attributes[name] = value
+		}
+	}
+	return attributes, nil
+}
+
+// fromAttributes maps CloudEvents attributes back to an event, an event from outside Ion keeps its source
+// as the context's name
+func fromAttributes(attributes map[string]string) (common.Event, error) {
+	if version := attributes[attributeSpecVersion]; version != SpecVersion {
+		return common.Event{}, fmt.Errorf("unsupported cloudevents specversion '%s'", version)
+	}
+	if contentType := attributes[attributeDataContentType]; contentType != "" && !isJSON(contentType) {
+		return common.Event{}, fmt.Errorf("unsupported cloudevents datacontenttype '%s'", contentType)
+	}
+	return common.Event{
+		Type: attributes[attributeType],
+		Context: &common.Context{
+			Name:          strings.TrimPrefix(attributes[attributeSource], sourcePrefix),
+			EventID:       attributes[attributeID],
+			CorrelationID: attributes[attributeCorrelationID],
+			ParentEventID: attributes[attributeParentEventID],
+			DocumentType:  attributes[attributeDocumentType],
+		},
+	}, nil
+}
+
+// decodeData decodes an event's data. Ion writes its key value pairs, other producers may
+// write an object whose fields become the key value pairs, in key order.
+func decodeData(data []byte) (common.KeyValuePairs, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "" || trimmed == "null" {
+		return nil, nil
+	}
+	if strings.HasPrefix(trimmed, "[") {
+		var kvps common.KeyValuePairs
+		if err := json.Unmarshal(data, &kvps); err != nil {
+			return nil, fmt.Errorf("invalid event data: %+v", err)
+		}
+		return kvps, nil
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, fmt.Errorf("event data must be a JSON array of key value pairs or a JSON object: %+v", err)
+	}
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	kvps := make(common.KeyValuePairs, 0, len(keys))
+	for _, key := range keys {
+		var value string
+		if err := json.Unmarshal(object[key], &value); err != nil {
+			value = string(object[key])
+		}
+		kvps = kvps.Append(common.KeyValuePair{Key: key, Value: value})
+	}
+	return kvps, nil
+}
+
+// isJSON returns true for JSON content types, such as application/json and application/vnd.x+json
+func isJSON(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return mediaType == JSONContentType || strings.HasSuffix(mediaType, "+json") || mediaType == "text/json"
+}
@@ -0,0 +1,150 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+)
+
+func newTestEvent() common.Event {
+	return common.Event{
+		Type: "face_detected",
+		Context: &common.Context{
+			Name:          "facedetector",
+			EventID:       "event1",
+			CorrelationID: "correlation1",
+			ParentEventID: "parent1",
+		},
+		Data: common.KeyValuePairs{
+			{Key: "faces", Value: "2"},
+			{Key: "camera", Value: "front"},
+		},
+	}
+}
+
+func TestStructuredRoundTrip(t *testing.T) {
+	event := newTestEvent()
+	data, err := MarshalStructured(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var document map[string]interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"specversion":   "1.0",
+		"id":            "event1",
+		"source":        "/ion/facedetector",
+		"type":          "face_detected",
+		"correlationid": "correlation1",
+		"parenteventid": "parent1",
+	}
+	for name, value := range expected {
+		if document[name] != value {
+			t.Errorf("Attribute %s incorrect Expected: %s Got: %v", name, value, document[name])
+		}
+	}
+
+	if !IsStructured(data) {
+		t.Error("Expected the document to be detected as a structured cloudevent")
+	}
+	decoded, err := UnmarshalStructured(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, event) {
+		t.Errorf("Event incorrect Expected: %+v Got: %+v", event, decoded)
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	event := newTestEvent()
+	attributes, data, err := ToBinary(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := attributes["datacontenttype"]; ok {
+		t.Error("Expected the data content type to be left to the message's content type")
+	}
+
+	headers := map[string]string{"Content-Type": JSONContentType}
+	for name, value := range attributes {
+		headers[KafkaHeaderPrefix+name] = value
+	}
+	decoded, err := FromBinary(Attributes(headers), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, event) {
+		t.Errorf("Event incorrect Expected: %+v Got: %+v", event, decoded)
+	}
+}
+
+func TestUnmarshalStructuredFromOtherProducers(t *testing.T) {
+	data := []byte(`{
+		"specversion": "1.0",
+		"id": "event1",
+		"source": "https://example.com/cameras",
+		"type": "face_detected",
+		"correlationid": "correlation1",
+		"data": {"faces": 2, "camera": "front"}
+	}`)
+	event, err := UnmarshalStructured(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Context.Name != "https://example.com/cameras" {
+		t.Errorf("Expected the source to be kept as the name Got: %s", event.Context.Name)
+	}
+	expected := common.KeyValuePairs{
+		{Key: "camera", Value: "front"},
+		{Key: "faces", Value: "2"},
+	}
+	if !reflect.DeepEqual(event.Data, expected) {
+		t.Errorf("Data incorrect Expected: %+v Got: %+v", expected, event.Data)
+	}
+}
+
+func TestUnsupportedEvents(t *testing.T) {
+	testCases := []struct {
+		name string
+		data string
+	}{
+		{"unsupported version", `{"specversion": "0.3", "id": "1", "type": "t"}`},
+		{"unsupported content type", `{"specversion": "1.0", "id": "1", "type": "t", "datacontenttype": "application/xml", "data": "<a/>"}`},
+		{"data isn't an object", `{"specversion": "1.0", "id": "1", "type": "t", "data": 42}`},
+	}
+	for _, test := range testCases {
+		if _, err := UnmarshalStructured([]byte(test.data)); err == nil {
+			t.Errorf("%s: Expected an error", test.name)
+		}
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	testCases := []struct {
+		name     string
+		headers  map[string]string
+		expected map[string]string
+	}{
+		{"http", map[string]string{"Ce-Specversion": "1.0", "Ce-Id": "1"}, map[string]string{"specversion": "1.0", "id": "1"}},
+		{"kafka", map[string]string{"ce_specversion": "1.0", "ce_id": "1"}, map[string]string{"specversion": "1.0", "id": "1"}},
+		{"amqp", map[string]string{"cloudEvents:specversion": "1.0", "cloudEvents_id": "1", "other": "x"}, map[string]string{"specversion": "1.0", "id": "1"}},
+		{"not a cloudevent", map[string]string{"ce-id": "1"}, nil},
+	}
+	for _, test := range testCases {
+		if actual := Attributes(test.headers); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: Expected: %v Got: %v", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestEncodingRequiresAnEventID(t *testing.T) {
+	if _, err := MarshalStructured(common.Event{Type: "face_detected"}); err == nil {
+		t.Error("Expected an event without a context to fail")
+	}
+}
@@ -54,9 +54,10 @@ const ModuleLogsDocType = "modulelogs"
 
 //Context carries the data for configuring the module
 type Context struct {
-	Name          string `description:"module name" bson:"name" json:"name"`
-	EventID       string `description:"event identifier" bson:"eventId" json:"eventId"`
-	CorrelationID string `description:"correlation identifier" bson:"correlationId" json:"correlationId"`
-	ParentEventID string `description:"parent event identifier" bson:"parentEventId" json:"parentEventId"`
-	DocumentType  string `description:"the type of document this item represents" bson:"documentType" json:"documentType"`
+	Name           string   `description:"module name" bson:"name" json:"name"`
+	EventID        string   `description:"event identifier" bson:"eventId" json:"eventId"`
+	CorrelationID  string   `description:"correlation identifier" bson:"correlationId" json:"correlationId"`
+	ParentEventID  string   `description:"parent event identifier" bson:"parentEventId" json:"parentEventId"`
+	DocumentType   string   `description:"the type of document this item represents" bson:"documentType" json:"documentType"`
+	JoinedEventIDs []string `description:"events joined with the event which triggered the module" bson:"joinedEventIds,omitempty" json:"joinedEventIds,omitempty"`
 }
@@ -0,0 +1,71 @@
+package eventschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+//Schema is a compiled JSON Schema for the data of an event type
+type Schema struct {
+	schema *gojsonschema.Schema
+}
+
+//Compile parses a JSON Schema, it errors if the document isn't valid JSON or isn't a valid schema
+func Compile(document string) (*Schema, error) {
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(document))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %+v", err)
+	}
+	return &Schema{schema: schema}, nil
+}
+
+//Validate checks an event's data against the schema. The key value pairs are validated as
+//a JSON object whose values are all strings, so a schema constrains values with keywords
+//such as 'pattern', 'enum' and 'format' rather than 'type'. It returns a *ValidationError
+//listing every violation when the data doesn't match.
+func (s *Schema) Validate(eventType string, data common.KeyValuePairs) error {
+	document, err := json.Marshal(toObject(data))
+	if err != nil {
+		return fmt.Errorf("error serializing event data: %+v", err)
+	}
+	result, err := s.schema.Validate(gojsonschema.NewBytesLoader(document))
+	if err != nil {
+		return fmt.Errorf("error validating event data against the schema for '%s': %+v", eventType, err)
+	}
+	if result.Valid() {
+		return nil
+	}
+	violations := make([]string, 0, len(result.Errors()))
+	for _, violation := range result.Errors() {
+		violations = append(violations, violation.String())
+	}
+	sort.Strings(violations)
+	return &ValidationError{
+		EventType:  eventType,
+		Violations: violations,
+	}
+}
+
+//ValidationError is returned when an event's data doesn't match the schema registered for its type
+type ValidationError struct {
+	EventType  string
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("event of type '%s' does not match its schema: %s", e.EventType, strings.Join(e.Violations, "; "))
+}
+
+// toObject converts key value pairs to the JSON object they're validated as
+func toObject(data common.KeyValuePairs) map[string]string {
+	object := make(map[string]string, len(data))
+	for _, kvp := range data {
+		object[kvp.Key] = kvp.Value
+	}
+	return object
+}
@@ -0,0 +1,115 @@
+package eventschema
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+)
+
+const faceSchema = `{
+	"type": "object",
+	"required": ["url", "confidence"],
+	"properties": {
+		"url": {"format": "uri"},
+		"confidence": {"pattern": "^(0(\\.[0-9]+)?|1(\\.0+)?)$"}
+	},
+	"additionalProperties": false
+}`
+
+func kvps(pairs ...string) common.KeyValuePairs {
+	data := common.KeyValuePairs{}
+	for i := 0; i < len(pairs); i += 2 {
+		data = data.Append(common.KeyValuePair{Key: pairs[i], Value: pairs[i+1]})
+	}
+	return data
+}
+
+func TestValidate(t *testing.T) {
+	schema, err := Compile(faceSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name       string
+		data       common.KeyValuePairs
+		violations int
+	}{
+		{name: "valid", data: kvps("url", "https://example.com/face.png", "confidence", "0.93")},
+		{name: "missing key", data: kvps("url", "https://example.com/face.png"), violations: 1},
+		{name: "invalid values", data: kvps("url", "not a url", "confidence", "high"), violations: 2},
+		{name: "unexpected key", data: kvps("url", "https://example.com/face.png", "confidence", "1", "extra", "x"), violations: 1},
+	}
+	for _, test := range testCases {
+		err := schema.Validate("face_detected", test.data)
+		if test.violations == 0 {
+			if err != nil {
+				t.Errorf("%s: expected no error Got: %v", test.name, err)
+			}
+			continue
+		}
+		validationErr, ok := err.(*ValidationError)
+		if !ok {
+			t.Errorf("%s: expected a validation error Got: %v", test.name, err)
+			continue
+		}
+		if validationErr.EventType != "face_detected" || len(validationErr.Violations) != test.violations {
+			t.Errorf("%s: expected %d violations Got: %+v", test.name, test.violations, validationErr)
+		}
+	}
+}
+
+func TestCompileRejectsInvalidSchema(t *testing.T) {
+	for _, document := range []string{`{"type": `, `{"type": "not-a-type"}`} {
+		if _, err := Compile(document); err == nil {
+			t.Errorf("expected an error compiling '%s'", document)
+		}
+	}
+}
+
+func TestRegistryValidatorCachesSchemas(t *testing.T) {
+	fetches := 0
+	v := newRegistryValidator(nil, time.Second, func(ctx context.Context, eventType string) (string, bool, error) {
+		fetches++
+		if eventType == "face_detected" {
+			return faceSchema, true, nil
+		}
+		return "", false, nil
+	})
+	now := time.Now()
+	v.now = func() time.Time { return now }
+
+	if err := v.Validate("face_detected", kvps("url", "https://example.com/face.png")); err == nil {
+		t.Error("expected missing confidence to be a violation")
+	}
+	if err := v.Validate("face_detected", kvps("url", "https://example.com/face.png", "confidence", "0.5")); err != nil {
+		t.Errorf("expected valid data to pass Got: %v", err)
+	}
+	if err := v.Validate("unregistered", kvps("anything", "goes")); err != nil {
+		t.Errorf("expected an event type without a schema not to be validated Got: %v", err)
+	}
+	if fetches != 2 {
+		t.Errorf("expected a schema to be fetched once per event type Got: %d fetches", fetches)
+	}
+
+	now = now.Add(defaultCacheDuration)
+	_ = v.Validate("face_detected", kvps())
+	if fetches != 3 {
+		t.Errorf("expected an expired schema to be fetched again Got: %d fetches", fetches)
+	}
+}
+
+func TestRegistryValidatorFailsWhenRegistryUnavailable(t *testing.T) {
+	v := newRegistryValidator(nil, time.Second, func(ctx context.Context, eventType string) (string, bool, error) {
+		return "", false, errors.New("connection refused")
+	})
+	err := v.Validate("face_detected", kvps())
+	if err == nil {
+		t.Fatal("expected an error when the registry is unavailable")
+	}
+	if _, ok := err.(*ValidationError); ok {
+		t.Errorf("expected a registry error rather than a validation error Got: %v", err)
+	}
+}
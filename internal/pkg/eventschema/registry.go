@@ -0,0 +1,125 @@
+package eventschema
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/management/schema"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// How long a schema fetched from the registry is used before it's fetched again
+const defaultCacheDuration = time.Minute
+
+//Validator checks an event's data against the schema registered for its type
+type Validator interface {
+	Validate(eventType string, data common.KeyValuePairs) error
+}
+
+//Check at compile time if we implement the interface
+var _ Validator = (*RegistryValidator)(nil)
+
+//RegistryValidator validates events against the schemas registered with the management server.
+//Event types without a registered schema aren't validated.
+type RegistryValidator struct {
+	conn          *grpc.ClientConn
+	timeout       time.Duration
+	cacheDuration time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedSchema
+
+	getSchema func(ctx context.Context, eventType string) (string, bool, error)
+	now       func() time.Time
+}
+
+type cachedSchema struct {
+	schema  *Schema
+	expires time.Time
+}
+
+//NewRegistryValidator creates a validator which fetches schemas from the management server's
+//schema registry at the endpoint. The connection is made when the first schema is fetched.
+func NewRegistryValidator(endpoint string, timeout time.Duration) (*RegistryValidator, error) {
+	conn, err := grpc.Dial(endpoint, grpc.WithInsecure())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to schema registry %s: %+v", endpoint, err)
+	}
+	client := schema.NewSchemaServiceClient(conn)
+	return newRegistryValidator(conn, timeout, func(ctx context.Context, eventType string) (string, bool, error) {
+		response, err := client.Get(ctx, &schema.SchemaGetRequest{Eventtype: eventType})
+		if status.Code(err) == codes.NotFound {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+		return response.Schema, true, nil
+	}), nil
+}
+
+func newRegistryValidator(conn *grpc.ClientConn, timeout time.Duration, getSchema func(ctx context.Context, eventType string) (string, bool, error)) *RegistryValidator {
+	return &RegistryValidator{
+		conn:          conn,
+		timeout:       timeout,
+		cacheDuration: defaultCacheDuration,
+		cache:         map[string]cachedSchema{},
+		getSchema:     getSchema,
+		now:           time.Now,
+	}
+}
+
+//Validate checks the event's data against the schema registered for its type, it returns
+//a *ValidationError listing the violations when the data doesn't match
+func (v *RegistryValidator) Validate(eventType string, data common.KeyValuePairs) error {
+	schema, err := v.schemaFor(eventType)
+	if err != nil {
+		return err
+	}
+	if schema == nil {
+		return nil
+	}
+	return schema.Validate(eventType, data)
+}
+
+//Close closes the connection to the registry
+func (v *RegistryValidator) Close() error {
+	if v.conn == nil {
+		return nil
+	}
+	return v.conn.Close()
+}
+
+// schemaFor returns the schema registered for the event type, or nil if there isn't one
+func (v *RegistryValidator) schemaFor(eventType string) (*Schema, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if cached, ok := v.cache[eventType]; ok && v.now().Before(cached.expires) {
+		return cached.schema, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), v.timeout)
+	defer cancel()
+	document, found, err := v.getSchema(ctx, eventType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema for event type '%s' from the registry: %+v", eventType, err)
+	}
+	var schema *Schema
+	if found {
+		schema, err = Compile(document)
+		if err != nil {
+			return nil, fmt.Errorf("schema registered for event type '%s' is invalid: %+v", eventType, err)
+		}
+	}
+	v.cache[eventType] = cachedSchema{
+		schema:  schema,
+		expires: v.now().Add(v.cacheDuration),
+	}
+	return schema, nil
+}
@@ -0,0 +1,426 @@
+package jetstream
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/pkg/cloudevents"
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+	"github.com/lawrencegripper/ion/internal/pkg/types"
+	"github.com/nats-io/nats.go"
+)
+
+// cSpell:ignore nats, nak
+
+// BrokerName is the name used to select NATS JetStream as the dispatcher's broker
+const BrokerName = "jetstream"
+
+const (
+	// eventsStreamName is the stream every event is published to, each module has a durable
+	// consumer on the stream filtered to the subject for the event type it subscribes to
+	eventsStreamName    = "ION_EVENTS"
+	eventsSubjectPrefix = "ion.events."
+
+	// Messages are dead lettered to a stream per consumer, so its size is the consumer's dead letter count
+	deadLetterStreamPrefix  = "ION_DEADLETTER_"
+	deadLetterSubjectPrefix = "ion.deadletter."
+
+	// contentTypeHeader is the content type of the event's encoding
+	contentTypeHeader = "Content-Type"
+
+	// defaultAckWait is how long a received message is locked for before it's redelivered,
+	// it matches the default lock duration of a ServiceBus subscription
+	defaultAckWait = time.Duration(60) * time.Second
+	// fetchWait is how long a single pull request waits for a message
+	fetchWait = time.Duration(30) * time.Second
+)
+
+func init() {
+	messaging.RegisterBroker(BrokerName, func(ctx context.Context, config *types.Configuration) (messaging.Broker, error) {
+		return NewBroker(config)
+	})
+}
+
+// Publisher publishes events to the JetStream events stream
+type Publisher struct {
+	conn          *nats.Conn
+	js            nats.JetStreamContext
+	eventEncoding messaging.EventEncoding
+}
+
+//Check at compile time if we implement the interface
+var _ messaging.Publisher = (*Publisher)(nil)
+
+// NewPublisher connects to the NATS server, creating the events stream if it doesn't exist
+func NewPublisher(url string, eventEncoding messaging.EventEncoding) (*Publisher, error) {
+	conn, err := nats.Connect(url, nats.Name("ion"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to nats server %s: %+v", url, err)
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error creating jetstream context: %+v", err)
+	}
+	// Interest retention removes an event once every module subscribed to it has acknowledged
+	// it, like a ServiceBus topic an event published without any subscribers is dropped
+	err = ensureStream(js, &nats.StreamConfig{
+		Name:      eventsStreamName,
+		Subjects:  []string{eventsSubjectPrefix + ">"},
+		Retention: nats.InterestPolicy,
+		Storage:   nats.FileStorage,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Publisher{
+		conn:          conn,
+		js:            js,
+		eventEncoding: eventEncoding,
+	}, nil
+}
+
+// Publish sends the event to the subject for its type. The event ID is used as the
+// message ID so JetStream drops duplicates when publishing is retried.
+func (p *Publisher) Publish(ctx context.Context, event common.Event) error {
+	encoded, err := messaging.EncodeEvent(event, p.eventEncoding)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(getEventSubject(event.Type))
+	msg.Data = encoded.Body
+	msg.Header.Set(contentTypeHeader, encoded.ContentType)
+	for name, value := range encoded.Attributes {
+		msg.Header.Set(cloudevents.HTTPHeaderPrefix+name, value)
+	}
+
+	opts := []nats.PubOpt{nats.Context(ctx)}
+	if event.Context != nil && event.Context.EventID != "" {
+		opts = append(opts, nats.MsgId(event.Context.EventID))
+	}
+	_, err = p.js.PublishMsg(msg, opts...)
+	if err != nil {
+		return fmt.Errorf("error publishing event to %s: %+v", msg.Subject, err)
+	}
+	return nil
+}
+
+// Close flushes pending messages and closes the connection
+func (p *Publisher) Close() error {
+	return p.conn.Drain()
+}
+
+// Broker receives the module's events from a durable JetStream consumer
+type Broker struct {
+	*Publisher
+	subscription      *nats.Subscription
+	consumerName      string
+	deadLetterStream  string
+	deadLetterSubject string
+	maxDeliveryCount  int
+	handlerArgs       []string
+}
+
+//Check at compile time if we implement the interface
+var _ messaging.Broker = (*Broker)(nil)
+
+// NewBroker connects to the NATS server and binds to the module's durable consumer,
+// creating the consumer and its dead letter stream if they don't exist
+func NewBroker(config *types.Configuration) (*Broker, error) {
+	if config.SubscribesToEvent == "" || config.ModuleName == "" {
+		return nil, fmt.Errorf("subscribestoevent and modulename are required")
+	}
+	if config.NATS == nil || config.NATS.URL == "" {
+		return nil, fmt.Errorf("nats.url is required")
+	}
+	ackWait := defaultAckWait
+	if config.NATS.AckWaitSecs > 0 {
+		ackWait = time.Duration(config.NATS.AckWaitSecs) * time.Second
+	}
+	maxDeliveryCount := 1
+	if config.Job != nil {
+		maxDeliveryCount = config.Job.RetryCount + 1
+	}
+
+	eventEncoding, err := messaging.ParseEventEncoding(config.EventEncoding)
+	if err != nil {
+		return nil, err
+	}
+	publisher, err := NewPublisher(config.NATS.URL, eventEncoding)
+	if err != nil {
+		return nil, err
+	}
+
+	consumerName := getConsumerName(config.SubscribesToEvent, config.ModuleName)
+	b := &Broker{
+		Publisher:         publisher,
+		consumerName:      consumerName,
+		deadLetterStream:  getDeadLetterStreamName(consumerName),
+		deadLetterSubject: getDeadLetterSubject(consumerName),
+		maxDeliveryCount:  maxDeliveryCount,
+		handlerArgs: []string{
+			"--natseventprovider.enabled=true",
+			"--natseventprovider.url=" + config.NATS.URL,
+		},
+	}
+
+	err = ensureStream(publisher.js, &nats.StreamConfig{
+		Name:     b.deadLetterStream,
+		Subjects: []string{b.deadLetterSubject},
+		Storage:  nats.FileStorage,
+	})
+	if err != nil {
+		publisher.conn.Close()
+		return nil, err
+	}
+
+	// The broker creates the consumer itself, a consumer created by subscribing is
+	// deleted when the subscription is closed and the module would lose its events
+	err = ensureConsumer(publisher.js, getConsumerConfig(consumerName, config.SubscribesToEvent, ackWait, maxDeliveryCount))
+	if err != nil {
+		publisher.conn.Close()
+		return nil, err
+	}
+
+	b.subscription, err = publisher.js.PullSubscribe(
+		getEventSubject(config.SubscribesToEvent),
+		consumerName,
+		nats.Bind(eventsStreamName, consumerName),
+	)
+	if err != nil {
+		publisher.conn.Close()
+		return nil, fmt.Errorf("error subscribing to consumer %s: %+v", consumerName, err)
+	}
+	return b, nil
+}
+
+// Receive blocks until a message is available on the module's consumer
+func (b *Broker) Receive(ctx context.Context) (messaging.Message, error) {
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, fetchWait)
+		msgs, err := b.subscription.Fetch(1, nats.Context(fetchCtx))
+		cancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == context.DeadlineExceeded || err == nats.ErrTimeout {
+			// No message within the wait, send another pull request
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(msgs) == 0 {
+			continue
+		}
+		return newMessage(msgs[0], b)
+	}
+}
+
+// RenewLocks resets the ack wait of messages still being processed
+func (b *Broker) RenewLocks(ctx context.Context, messages []messaging.Message) error {
+	err := messaging.CheckReceived(messages, func(message messaging.Message) bool {
+		m, ok := message.(*Message)
+		return ok && m.broker == b
+	})
+	if err != nil {
+		return err
+	}
+	for _, message := range messages {
+		m := messaging.Unwrap(message).(*Message)
+		if err := m.msg.InProgress(); err != nil {
+			return fmt.Errorf("error renewing lock on message %s: %+v", m.ID(), err)
+		}
+	}
+	return nil
+}
+
+// GetQueueDepth returns the number of messages waiting on, and dead lettered from, the module's consumer
+func (b *Broker) GetQueueDepth() (messaging.MessageCountDetails, error) {
+	consumer, err := b.js.ConsumerInfo(eventsStreamName, b.consumerName)
+	if err != nil {
+		return messaging.MessageCountDetails{}, err
+	}
+	deadLetters, err := b.js.StreamInfo(b.deadLetterStream)
+	if err != nil {
+		return messaging.MessageCountDetails{}, err
+	}
+	return messaging.MessageCountDetails{
+		ActiveMessageCount:     int64(consumer.NumPending) + int64(consumer.NumAckPending),
+		DeadLetterMessageCount: int64(deadLetters.State.Msgs),
+	}, nil
+}
+
+// HandlerArgs returns the args which configure the handler to publish events to the NATS server
+func (b *Broker) HandlerArgs() []string {
+	return b.handlerArgs
+}
+
+// Close closes the subscription, the durable consumer is kept so the module's events
+// keep being stored until the dispatcher reconnects
+func (b *Broker) Close() error {
+	return b.Publisher.Close()
+}
+
+// deadLetter copies the message to the consumer's dead letter stream then terminates it
+// so JetStream won't redeliver it
+func (b *Broker) deadLetter(m *Message, reason, description string) error {
+	msg := nats.NewMsg(b.deadLetterSubject)
+	msg.Data = m.msg.Data
+	// Keep the message's headers, an event encoded in CloudEvents binary mode is in them
+	for key, values := range m.msg.Header {
+		if key != nats.MsgIdHdr {
+			msg.Header[key] = values
+		}
+	}
+	msg.Header.Set(messaging.DeadLetterReasonProperty, reason)
+	msg.Header.Set(messaging.DeadLetterDescriptionProperty, description)
+
+	// The message ID is unique to the delivery so a retried dead letter isn't stored twice
+	_, err := b.js.PublishMsg(msg, nats.MsgId(b.consumerName+"-"+m.ID()))
+	if err != nil {
+		return fmt.Errorf("error dead lettering message %s: %+v", m.ID(), err)
+	}
+	return m.msg.Term()
+}
+
+// Message is a delivery of an event from a JetStream consumer
+type Message struct {
+	msg      *nats.Msg
+	metadata *nats.MsgMetadata
+	broker   *Broker
+}
+
+//Check at compile time if we implement the interface
+var _ messaging.Message = (*Message)(nil)
+
+func newMessage(msg *nats.Msg, broker *Broker) (*Message, error) {
+	metadata, err := msg.Metadata()
+	if err != nil {
+		return nil, fmt.Errorf("error reading jetstream metadata: %+v", err)
+	}
+	return &Message{
+		msg:      msg,
+		metadata: metadata,
+		broker:   broker,
+	}, nil
+}
+
+// ID get the ID, this is the ID the message was published with or, when it has none, its sequence
+// in the stream. Neither change when the message is redelivered.
+func (m *Message) ID() string {
+	if id := m.msg.Header.Get(nats.MsgIdHdr); id != "" {
+		return id
+	}
+	return strconv.FormatUint(m.metadata.Sequence.Stream, 10)
+}
+
+// DeliveryCount get number of times the message has been delivered
+func (m *Message) DeliveryCount() int {
+	return int(m.metadata.NumDelivered)
+}
+
+// Body get the body
+func (m *Message) Body() []byte {
+	return m.msg.Data
+}
+
+// Accept mark the message as processed successfully (don't re-queue)
+func (m *Message) Accept() error {
+	return m.msg.Ack()
+}
+
+// Reject mark message to be requeued, it's dead lettered once its max delivery count is reached
+func (m *Message) Reject() error {
+	if description, exceeded := messaging.MaxDeliveryCountExceeded(m, m.broker.maxDeliveryCount); exceeded {
+		return m.broker.deadLetter(m, messaging.DeadLetterReasonMaxDeliveryCountExceeded, description)
+	}
+	return m.msg.Nak()
+}
+
+// DeadLetter move the message to the dead letter stream, recording why it couldn't be processed
+func (m *Message) DeadLetter(reason, description string) error {
+	return m.broker.deadLetter(m, reason, description)
+}
+
+// EventData deserialize json value to type
+func (m *Message) EventData() (common.Event, error) {
+	headers := make(map[string]string, len(m.msg.Header))
+	for key := range m.msg.Header {
+		headers[key] = m.msg.Header.Get(key)
+	}
+	return messaging.DecodeEventWithHeaders(headers, m.msg.Data)
+}
+
+// ensureStream creates the stream if it doesn't exist
+func ensureStream(js nats.JetStreamContext, config *nats.StreamConfig) error {
+	_, err := js.StreamInfo(config.Name)
+	if err == nats.ErrStreamNotFound {
+		_, err = js.AddStream(config)
+	}
+	if err != nil {
+		return fmt.Errorf("error creating stream %s: %+v", config.Name, err)
+	}
+	return nil
+}
+
+// ensureConsumer creates the durable consumer, or updates it so it uses the current config
+func ensureConsumer(js nats.JetStreamContext, config *nats.ConsumerConfig) error {
+	_, err := js.ConsumerInfo(eventsStreamName, config.Durable)
+	if err == nats.ErrConsumerNotFound {
+		_, err = js.AddConsumer(eventsStreamName, config)
+	} else if err == nil {
+		_, err = js.UpdateConsumer(eventsStreamName, config)
+	}
+	if err != nil {
+		return fmt.Errorf("error creating consumer %s: %+v", config.Durable, err)
+	}
+	return nil
+}
+
+// getConsumerConfig returns the config for a module's durable consumer. Messages are acknowledged
+// explicitly and redelivered when they're not acknowledged within `ackWait`.
+func getConsumerConfig(consumerName, eventName string, ackWait time.Duration, maxDeliveryCount int) *nats.ConsumerConfig {
+	return &nats.ConsumerConfig{
+		Durable:       consumerName,
+		DeliverPolicy: nats.DeliverAllPolicy,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       ackWait,
+		MaxDeliver:    maxDeliveryCount,
+		FilterSubject: getEventSubject(eventName),
+	}
+}
+
+// getConsumerName returns the durable consumer name for a module, it matches the ServiceBus subscription name
+func getConsumerName(eventName, moduleName string) string {
+	return sanitizeToken(eventName) + "_" + sanitizeToken(moduleName)
+}
+
+func getEventSubject(eventName string) string {
+	return eventsSubjectPrefix + sanitizeToken(eventName)
+}
+
+func getDeadLetterSubject(consumerName string) string {
+	return deadLetterSubjectPrefix + consumerName
+}
+
+func getDeadLetterStreamName(consumerName string) string {
+	return deadLetterStreamPrefix + strings.ToUpper(consumerName)
+}
+
+// sanitizeToken lower cases the name and replaces the characters which can't be used
+// in a subject token, or a stream or consumer name, with underscores
+func sanitizeToken(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', '/', '\\', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, strings.ToLower(name))
+}
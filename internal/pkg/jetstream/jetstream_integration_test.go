@@ -0,0 +1,101 @@
+package jetstream
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/app/dispatcher/helpers"
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+	"github.com/lawrencegripper/ion/internal/pkg/types"
+)
+
+func newIntegrationBroker(t *testing.T) *Broker {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode...")
+	}
+	url := os.Getenv("NATS_URL")
+	if url == "" {
+		t.Skip("Skipping integration test, NATS_URL isn't set")
+	}
+
+	broker, err := NewBroker(&types.Configuration{
+		ModuleName:        helpers.RandomName(8),
+		SubscribesToEvent: "ExampleEvent",
+		NATS: &types.NATSConfig{
+			URL: url,
+		},
+		Job: &types.JobConfig{
+			RetryCount: 1,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return broker
+}
+
+// deleteConsumer removes the consumer and dead letter stream created for the test's random module
+func deleteConsumer(broker *Broker) {
+	_ = broker.js.DeleteConsumer(eventsStreamName, broker.consumerName)
+	_ = broker.js.DeleteStream(broker.deadLetterStream)
+	_ = broker.Close()
+}
+
+func receiveIntegration(t *testing.T, broker *Broker) messaging.Message {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	message, err := broker.Receive(ctx)
+	if err != nil {
+		t.Fatalf("failed to receive message: %v", err)
+	}
+	return message
+}
+
+func TestIntegrationRedeliverThenDeadLetter(t *testing.T) {
+	broker := newIntegrationBroker(t)
+	defer deleteConsumer(broker)
+
+	eventID := helpers.RandomName(12)
+	err := broker.Publish(context.Background(), common.Event{
+		Type: "ExampleEvent",
+		Context: &common.Context{
+			EventID:       eventID,
+			CorrelationID: "correlation1",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := receiveIntegration(t, broker)
+	if first.ID() != eventID || first.DeliveryCount() != 1 {
+		t.Errorf("Expected first delivery of %s Got: %s delivery %d", eventID, first.ID(), first.DeliveryCount())
+	}
+	if err := broker.RenewLocks(context.Background(), []messaging.Message{first}); err != nil {
+		t.Error(err)
+	}
+	if err := first.Reject(); err != nil {
+		t.Fatal(err)
+	}
+
+	second := receiveIntegration(t, broker)
+	if second.ID() != eventID || second.DeliveryCount() != 2 {
+		t.Errorf("Expected second delivery of %s Got: %s delivery %d", eventID, second.ID(), second.DeliveryCount())
+	}
+	if err := second.Reject(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stats are updated asynchronously by the server
+	time.Sleep(time.Second)
+	depth, err := broker.GetQueueDepth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth.ActiveMessageCount != 0 || depth.DeadLetterMessageCount != 1 {
+		t.Errorf("Expected message to be dead lettered Got: %+v", depth)
+	}
+}
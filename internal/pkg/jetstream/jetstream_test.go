@@ -0,0 +1,70 @@
+package jetstream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestGetConsumerName(t *testing.T) {
+	const expected = `eventname_modulename`
+	actual := getConsumerName("eventName", "moduleName")
+	if actual != expected {
+		t.Logf("Got: %s Expected: %s", actual, expected)
+		t.Fail()
+	}
+}
+
+func TestGetEventSubject(t *testing.T) {
+	const expected = `ion.events.exampleevent`
+	actual := getEventSubject("exampleEvent")
+	if actual != expected {
+		t.Logf("Got: %s Expected: %s", actual, expected)
+		t.Fail()
+	}
+}
+
+func TestGetDeadLetterNames(t *testing.T) {
+	consumerName := getConsumerName("exampleEvent", "moduleName")
+	if actual := getDeadLetterSubject(consumerName); actual != "ion.deadletter.exampleevent_modulename" {
+		t.Errorf("Dead letter subject incorrect Got: %s", actual)
+	}
+	if actual := getDeadLetterStreamName(consumerName); actual != "ION_DEADLETTER_EXAMPLEEVENT_MODULENAME" {
+		t.Errorf("Dead letter stream incorrect Got: %s", actual)
+	}
+}
+
+func TestSanitizeToken(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{name: "face_detected", expected: "face_detected"},
+		{name: "Face.Detected", expected: "face_detected"},
+		{name: "face detected", expected: "face_detected"},
+		{name: "face>*", expected: "face__"},
+		{name: "face/detected", expected: "face_detected"},
+	}
+	for _, test := range testCases {
+		if actual := sanitizeToken(test.name); actual != test.expected {
+			t.Errorf("sanitizeToken(%q) incorrect Expected: %s Got: %s", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestGetConsumerConfig(t *testing.T) {
+	config := getConsumerConfig("exampleevent_modulename", "exampleEvent", time.Minute, 3)
+	if config.Durable != "exampleevent_modulename" {
+		t.Errorf("Durable incorrect Got: %s", config.Durable)
+	}
+	if config.FilterSubject != "ion.events.exampleevent" {
+		t.Errorf("FilterSubject incorrect Got: %s", config.FilterSubject)
+	}
+	if config.AckPolicy != nats.AckExplicitPolicy {
+		t.Errorf("Expected messages to be acknowledged explicitly Got: %v", config.AckPolicy)
+	}
+	if config.AckWait != time.Minute || config.MaxDeliver != 3 {
+		t.Errorf("AckWait or MaxDeliver incorrect Got: %v %v", config.AckWait, config.MaxDeliver)
+	}
+}
@@ -0,0 +1,540 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/pkg/cloudevents"
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+	"github.com/lawrencegripper/ion/internal/pkg/types"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// BrokerName is the name used to select Kafka as the dispatcher's broker
+const BrokerName = "kafka"
+
+// deadLetterTopicSuffix is appended to a module's consumer group to name the topic its
+// dead lettered messages are written to
+const deadLetterTopicSuffix = ".deadletter"
+
+// contentTypeHeader is the content type of the event's encoding, as named by the CloudEvents Kafka binding
+const contentTypeHeader = "content-type"
+
+// commitTimeout is how long committing an offset may take
+const commitTimeout = time.Duration(30) * time.Second
+
+func init() {
+	messaging.RegisterBroker(BrokerName, func(ctx context.Context, config *types.Configuration) (messaging.Broker, error) {
+		return NewBroker(config)
+	})
+}
+
+// Publisher writes events to the topic for their type
+type Publisher struct {
+	writer        *kafkago.Writer
+	eventEncoding messaging.EventEncoding
+}
+
+//Check at compile time if we implement the interface
+var _ messaging.Publisher = (*Publisher)(nil)
+
+// NewPublisher creates a publisher which writes to the cluster the brokers belong to
+func NewPublisher(brokers []string, eventEncoding messaging.EventEncoding) (*Publisher, error) {
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("at least one kafka broker is required")
+	}
+	return &Publisher{
+		writer: &kafkago.Writer{
+			Addr:     kafkago.TCP(brokers...),
+			Balancer: &kafkago.Hash{},
+			// Events are published one at a time, so don't wait for a batch to fill up
+			BatchSize:              1,
+			RequiredAcks:           kafkago.RequireAll,
+			AllowAutoTopicCreation: true,
+		},
+		eventEncoding: eventEncoding,
+	}, nil
+}
+
+// Publish writes the event to the topic for its type, it's keyed by the event ID
+// so events are spread across the topic's partitions
+func (p *Publisher) Publish(ctx context.Context, event common.Event) error {
+	encoded, err := messaging.EncodeEvent(event, p.eventEncoding)
+	if err != nil {
+		return err
+	}
+	var key []byte
+	if event.Context != nil {
+		key = []byte(event.Context.EventID)
+	}
+	headers := []kafkago.Header{{Key: contentTypeHeader, Value: []byte(encoded.ContentType)}}
+	for name, value := range encoded.Attributes {
+		headers = append(headers, kafkago.Header{Key: cloudevents.KafkaHeaderPrefix + name, Value: []byte(value)})
+	}
+	return p.write(ctx, kafkago.Message{
+		Topic:   getEventTopic(event.Type),
+		Key:     key,
+		Value:   encoded.Body,
+		Headers: headers,
+	})
+}
+
+func (p *Publisher) write(ctx context.Context, message kafkago.Message) error {
+	if err := p.writer.WriteMessages(ctx, message); err != nil {
+		return fmt.Errorf("error writing message to topic %s: %+v", message.Topic, err)
+	}
+	return nil
+}
+
+// Close flushes and closes the writer
+func (p *Publisher) Close() error {
+	return p.writer.Close()
+}
+
+// reader is the part of kafkago.Reader the broker uses
+type reader interface {
+	FetchMessage(ctx context.Context) (kafkago.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafkago.Message) error
+	Config() kafkago.ReaderConfig
+	Close() error
+}
+
+// fetchResult is a message, or the error, from fetching the next message
+type fetchResult struct {
+	message *Message
+	err     error
+}
+
+// Broker receives the module's events as a member of the module's consumer group.
+// Kafka only records how far through each partition the group has read, so a message's offset
+// is committed once it, and every message before it on the partition, has been accepted or
+// dead lettered. Rejected messages are redelivered by the broker itself, so their delivery
+// count starts again at 1 if the dispatcher restarts before they're settled.
+type Broker struct {
+	*Publisher
+	reader           reader
+	consumerGroup    string
+	deadLetterTopic  string
+	maxDeliveryCount int
+	offsets          *offsetTracker
+	fetched          chan fetchResult
+	redeliverMu      sync.Mutex
+	redeliver        []*Message
+	redelivered      chan struct{}
+	cancel           context.CancelFunc
+	handlerArgs      []string
+	writeMessage     func(ctx context.Context, message kafkago.Message) error
+	countMessages    func(ctx context.Context, topic, consumerGroup string) (int64, error)
+}
+
+//Check at compile time if we implement the interface
+var _ messaging.Broker = (*Broker)(nil)
+
+// NewBroker joins the module's consumer group for the topic of the event it subscribes to
+func NewBroker(config *types.Configuration) (*Broker, error) {
+	if config.SubscribesToEvent == "" || config.ModuleName == "" {
+		return nil, fmt.Errorf("subscribestoevent and modulename are required")
+	}
+	if config.Kafka == nil {
+		return nil, fmt.Errorf("kafka config is required")
+	}
+	maxDeliveryCount := 1
+	if config.Job != nil {
+		maxDeliveryCount = config.Job.RetryCount + 1
+	}
+
+	eventEncoding, err := messaging.ParseEventEncoding(config.EventEncoding)
+	if err != nil {
+		return nil, err
+	}
+	publisher, err := NewPublisher(config.Kafka.Brokers, eventEncoding)
+	if err != nil {
+		return nil, err
+	}
+
+	consumerGroup := getConsumerGroup(config.SubscribesToEvent, config.ModuleName)
+	r := kafkago.NewReader(kafkago.ReaderConfig{
+		Brokers: config.Kafka.Brokers,
+		GroupID: consumerGroup,
+		Topic:   getEventTopic(config.SubscribesToEvent),
+		// Offsets are committed as soon as CommitMessages is called
+		CommitInterval: 0,
+	})
+
+	b := newBroker(r, publisher, consumerGroup, maxDeliveryCount)
+	b.handlerArgs = []string{
+		"--kafkaeventprovider.enabled=true",
+		"--kafkaeventprovider.brokers=" + strings.Join(config.Kafka.Brokers, ","),
+	}
+	client := &kafkago.Client{
+		Addr:    kafkago.TCP(config.Kafka.Brokers...),
+		Timeout: commitTimeout,
+	}
+	b.countMessages = func(ctx context.Context, topic, consumerGroup string) (int64, error) {
+		return countMessages(ctx, client, topic, consumerGroup)
+	}
+	return b, nil
+}
+
+// newBroker creates a broker receiving from the reader and starts fetching messages
+func newBroker(r reader, publisher *Publisher, consumerGroup string, maxDeliveryCount int) *Broker {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Broker{
+		Publisher:        publisher,
+		reader:           r,
+		consumerGroup:    consumerGroup,
+		deadLetterTopic:  consumerGroup + deadLetterTopicSuffix,
+		maxDeliveryCount: maxDeliveryCount,
+		offsets:          newOffsetTracker(),
+		fetched:          make(chan fetchResult),
+		redelivered:      make(chan struct{}, 1),
+		cancel:           cancel,
+		writeMessage:     publisher.write,
+	}
+	go b.fetch(ctx)
+	return b
+}
+
+// fetch reads messages from the consumer group until the broker is closed. Each message is
+// tracked as soon as it's fetched so its offset isn't committed before it's settled.
+func (b *Broker) fetch(ctx context.Context) {
+	for {
+		msg, err := b.reader.FetchMessage(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		result := fetchResult{err: err}
+		if err == nil {
+			b.offsets.add(msg)
+			result.message = &Message{
+				msg:           msg,
+				deliveryCount: 1,
+				broker:        b,
+			}
+		}
+		select {
+		case b.fetched <- result:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Receive blocks until a message has been fetched or a rejected message is ready to be redelivered
+func (b *Broker) Receive(ctx context.Context) (messaging.Message, error) {
+	for {
+		if m := b.nextRedelivery(); m != nil {
+			return m, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-b.redelivered:
+		case result := <-b.fetched:
+			if result.err != nil {
+				return nil, result.err
+			}
+			return result.message, nil
+		}
+	}
+}
+
+func (b *Broker) nextRedelivery() *Message {
+	b.redeliverMu.Lock()
+	defer b.redeliverMu.Unlock()
+	if len(b.redeliver) == 0 {
+		return nil
+	}
+	m := b.redeliver[0]
+	b.redeliver = b.redeliver[1:]
+	return m
+}
+
+// requeue adds the message to the messages waiting to be redelivered and wakes up Receive
+func (b *Broker) requeue(m *Message) {
+	b.redeliverMu.Lock()
+	b.redeliver = append(b.redeliver, m)
+	b.redeliverMu.Unlock()
+	select {
+	case b.redelivered <- struct{}{}:
+	default:
+	}
+}
+
+// RenewLocks checks the messages were received from the broker. Kafka doesn't lock messages,
+// a message stays uncommitted, and is redelivered after a restart, until it's settled.
+func (b *Broker) RenewLocks(ctx context.Context, messages []messaging.Message) error {
+	return messaging.CheckReceived(messages, func(message messaging.Message) bool {
+		m, ok := message.(*Message)
+		return ok && m.broker == b
+	})
+}
+
+// GetQueueDepth returns the consumer group's lag, the messages it hasn't committed, on the
+// event's topic and the number of messages on the module's dead letter topic
+func (b *Broker) GetQueueDepth() (messaging.MessageCountDetails, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commitTimeout)
+	defer cancel()
+	active, err := b.countMessages(ctx, b.reader.Config().Topic, b.consumerGroup)
+	if err != nil {
+		return messaging.MessageCountDetails{}, err
+	}
+	deadLetters, err := b.countMessages(ctx, b.deadLetterTopic, "")
+	if err != nil {
+		return messaging.MessageCountDetails{}, err
+	}
+	return messaging.MessageCountDetails{
+		ActiveMessageCount:     active,
+		DeadLetterMessageCount: deadLetters,
+	}, nil
+}
+
+// HandlerArgs returns the args which configure the handler to publish events to the cluster
+func (b *Broker) HandlerArgs() []string {
+	return b.handlerArgs
+}
+
+// Close leaves the consumer group, uncommitted messages are redelivered to the group's next member
+func (b *Broker) Close() error {
+	b.cancel()
+	readerErr := b.reader.Close()
+	if err := b.Publisher.Close(); err != nil {
+		return err
+	}
+	return readerErr
+}
+
+// complete marks the message as settled and commits the offsets which are now safe to commit
+func (b *Broker) complete(m *Message) error {
+	commit, ok := b.offsets.done(m.msg)
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commitTimeout)
+	defer cancel()
+	if err := b.reader.CommitMessages(ctx, commit); err != nil {
+		return fmt.Errorf("error committing offset %d on partition %d: %+v", commit.Offset, commit.Partition, err)
+	}
+	return nil
+}
+
+// deadLetter writes the message to the module's dead letter topic, with headers recording
+// why it was dead lettered, then commits it
+func (b *Broker) deadLetter(m *Message, reason, description string) error {
+	headers := append([]kafkago.Header{}, m.msg.Headers...)
+	headers = append(headers,
+		kafkago.Header{Key: messaging.DeadLetterReasonProperty, Value: []byte(reason)},
+		kafkago.Header{Key: messaging.DeadLetterDescriptionProperty, Value: []byte(description)},
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), commitTimeout)
+	defer cancel()
+	err := b.writeMessage(ctx, kafkago.Message{
+		Topic:   b.deadLetterTopic,
+		Key:     m.msg.Key,
+		Value:   m.msg.Value,
+		Headers: headers,
+	})
+	if err != nil {
+		return fmt.Errorf("error dead lettering message %s: %+v", m.ID(), err)
+	}
+	return b.complete(m)
+}
+
+// Message is a delivery of an event from the module's consumer group
+type Message struct {
+	msg           kafkago.Message
+	deliveryCount int
+	settlement    messaging.Settlement
+	broker        *Broker
+}
+
+//Check at compile time if we implement the interface
+var _ messaging.Message = (*Message)(nil)
+
+// ID get the ID, the message's partition and offset don't change when it's redelivered
+func (m *Message) ID() string {
+	return fmt.Sprintf("%d-%d", m.msg.Partition, m.msg.Offset)
+}
+
+// DeliveryCount get number of times the message has been delivered
+func (m *Message) DeliveryCount() int {
+	return m.deliveryCount
+}
+
+// Body get the body
+func (m *Message) Body() []byte {
+	return m.msg.Value
+}
+
+// Accept mark the message as processed successfully (don't re-queue)
+func (m *Message) Accept() error {
+	if err := m.settlement.Settle(); err != nil {
+		return err
+	}
+	return m.broker.complete(m)
+}
+
+// Reject mark message to be requeued, it's dead lettered once its max delivery count is reached
+func (m *Message) Reject() error {
+	if err := m.settlement.Settle(); err != nil {
+		return err
+	}
+	if description, exceeded := messaging.MaxDeliveryCountExceeded(m, m.broker.maxDeliveryCount); exceeded {
+		return m.broker.deadLetter(m, messaging.DeadLetterReasonMaxDeliveryCountExceeded, description)
+	}
+	m.broker.requeue(&Message{
+		msg:           m.msg,
+		deliveryCount: m.deliveryCount + 1,
+		broker:        m.broker,
+	})
+	return nil
+}
+
+// DeadLetter move the message to the dead letter topic, recording why it couldn't be processed
+func (m *Message) DeadLetter(reason, description string) error {
+	if err := m.settlement.Settle(); err != nil {
+		return err
+	}
+	return m.broker.deadLetter(m, reason, description)
+}
+
+// EventData deserialize json value to type
+func (m *Message) EventData() (common.Event, error) {
+	headers := make(map[string]string, len(m.msg.Headers))
+	for _, header := range m.msg.Headers {
+		headers[header.Key] = string(header.Value)
+	}
+	return messaging.DecodeEventWithHeaders(headers, m.msg.Value)
+}
+
+// offsetTracker tracks the messages fetched from each partition so an offset is only
+// committed once it, and every message fetched before it from the partition, is settled
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int][]*trackedMessage
+}
+
+type trackedMessage struct {
+	msg  kafkago.Message
+	done bool
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		partitions: map[int][]*trackedMessage{},
+	}
+}
+
+// add tracks a fetched message, messages are fetched from a partition in offset order
+func (t *offsetTracker) add(msg kafkago.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.partitions[msg.Partition] = append(t.partitions[msg.Partition], &trackedMessage{msg: msg})
+}
+
+// done marks the message as settled. It returns the message with the highest offset which
+// can now be committed, or false when an earlier message on the partition is still unsettled.
+func (t *offsetTracker) done(msg kafkago.Message) (kafkago.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tracked := t.partitions[msg.Partition]
+	for _, m := range tracked {
+		if m.msg.Offset == msg.Offset {
+			m.done = true
+			break
+		}
+	}
+
+	var commit kafkago.Message
+	committable := 0
+	for committable < len(tracked) && tracked[committable].done {
+		commit = tracked[committable].msg
+		committable++
+	}
+	t.partitions[msg.Partition] = tracked[committable:]
+	return commit, committable > 0
+}
+
+// countMessages returns the number of messages on the topic's partitions which the consumer
+// group hasn't committed or, without a consumer group, the number of messages on the topic
+func countMessages(ctx context.Context, client *kafkago.Client, topic, consumerGroup string) (int64, error) {
+	metadata, err := client.Metadata(ctx, &kafkago.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return 0, fmt.Errorf("error reading metadata for topic %s: %+v", topic, err)
+	}
+	if len(metadata.Topics) == 0 || errors.Is(metadata.Topics[0].Error, kafkago.UnknownTopicOrPartition) {
+		// Nothing has been written to the topic yet
+		return 0, nil
+	}
+	if metadata.Topics[0].Error != nil {
+		return 0, fmt.Errorf("error reading metadata for topic %s: %+v", topic, metadata.Topics[0].Error)
+	}
+
+	partitions := []int{}
+	requests := []kafkago.OffsetRequest{}
+	for _, partition := range metadata.Topics[0].Partitions {
+		partitions = append(partitions, partition.ID)
+		requests = append(requests, kafkago.FirstOffsetOf(partition.ID), kafkago.LastOffsetOf(partition.ID))
+	}
+	offsets, err := client.ListOffsets(ctx, &kafkago.ListOffsetsRequest{
+		Topics: map[string][]kafkago.OffsetRequest{topic: requests},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error listing offsets for topic %s: %+v", topic, err)
+	}
+
+	committed := map[int]int64{}
+	if consumerGroup != "" {
+		fetched, err := client.OffsetFetch(ctx, &kafkago.OffsetFetchRequest{
+			GroupID: consumerGroup,
+			Topics:  map[string][]int{topic: partitions},
+		})
+		if err != nil {
+			return 0, fmt.Errorf("error fetching offsets for consumer group %s: %+v", consumerGroup, err)
+		}
+		for _, partition := range fetched.Topics[topic] {
+			committed[partition.Partition] = partition.CommittedOffset
+		}
+	}
+
+	var count int64
+	for _, partition := range offsets.Topics[topic] {
+		if partition.Error != nil {
+			return 0, fmt.Errorf("error listing offsets for topic %s partition %d: %+v", topic, partition.Partition, partition.Error)
+		}
+		start := partition.FirstOffset
+		if offset, ok := committed[partition.Partition]; ok && offset > start {
+			start = offset
+		}
+		count += partition.LastOffset - start
+	}
+	return count, nil
+}
+
+// getConsumerGroup returns the consumer group for a module, it matches the ServiceBus subscription name
+func getConsumerGroup(eventName, moduleName string) string {
+	return sanitizeName(eventName) + "_" + sanitizeName(moduleName)
+}
+
+// getEventTopic returns the topic events of the type are published to
+func getEventTopic(eventName string) string {
+	return sanitizeName(eventName)
+}
+
+// sanitizeName lower cases the name and replaces the characters which can't be used
+// in a topic name with underscores
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, strings.ToLower(name))
+}
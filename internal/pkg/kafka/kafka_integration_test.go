@@ -0,0 +1,91 @@
+package kafka
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/app/dispatcher/helpers"
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/types"
+)
+
+func TestIntegrationReceiveAndCommit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode...")
+	}
+	brokers := os.Getenv("KAFKA_BROKERS")
+	if brokers == "" {
+		t.Skip("Skipping integration test, KAFKA_BROKERS isn't set")
+	}
+
+	b, err := NewBroker(&types.Configuration{
+		ModuleName:        helpers.RandomName(8),
+		SubscribesToEvent: "ExampleEvent",
+		Kafka: &types.KafkaConfig{
+			Brokers: strings.Split(brokers, ","),
+		},
+		Job: &types.JobConfig{
+			RetryCount: 1,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close() //nolint: errcheck
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
+	defer cancel()
+
+	eventID := helpers.RandomName(12)
+	err = b.Publish(ctx, common.Event{
+		Type: "ExampleEvent",
+		Context: &common.Context{
+			EventID:       eventID,
+			CorrelationID: "correlation1",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A new consumer group starts from the beginning of the topic so skip events from other runs
+	for {
+		m, err := b.Receive(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		event, err := m.EventData()
+		if err != nil || event.Context.EventID != eventID {
+			if err := m.Accept(); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		if err := m.Reject(); err != nil {
+			t.Fatal(err)
+		}
+		redelivered, err := b.Receive(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if redelivered.ID() != m.ID() || redelivered.DeliveryCount() != 2 {
+			t.Errorf("Expected message %s to be redelivered Got: %s delivery %d", m.ID(), redelivered.ID(), redelivered.DeliveryCount())
+		}
+		if err := redelivered.Accept(); err != nil {
+			t.Fatal(err)
+		}
+		break
+	}
+
+	depth, err := b.GetQueueDepth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth.ActiveMessageCount != 0 {
+		t.Errorf("Expected all messages to be committed Got: %+v", depth)
+	}
+}
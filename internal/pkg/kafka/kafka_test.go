@@ -0,0 +1,188 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+type fakeReader struct {
+	messages chan kafkago.Message
+	mu       sync.Mutex
+	commits  []kafkago.Message
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafkago.Message, error) {
+	select {
+	case msg := <-r.messages:
+		return msg, nil
+	case <-ctx.Done():
+		return kafkago.Message{}, ctx.Err()
+	}
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commits = append(r.commits, msgs...)
+	return nil
+}
+
+func (r *fakeReader) Config() kafkago.ReaderConfig {
+	return kafkago.ReaderConfig{Topic: "face_detected"}
+}
+
+func (r *fakeReader) Close() error {
+	return nil
+}
+
+func (r *fakeReader) committedOffsets() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	offsets := []int64{}
+	for _, msg := range r.commits {
+		offsets = append(offsets, msg.Offset)
+	}
+	return offsets
+}
+
+func newTestBroker(t *testing.T, maxDeliveryCount int, msgs ...kafkago.Message) (*Broker, *fakeReader) {
+	r := &fakeReader{
+		messages: make(chan kafkago.Message, len(msgs)),
+	}
+	for _, msg := range msgs {
+		r.messages <- msg
+	}
+	publisher, err := NewPublisher([]string{"localhost:9092"}, messaging.EventEncodingIon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newBroker(r, publisher, "face_detected_module", maxDeliveryCount)
+	return b, r
+}
+
+func receive(t *testing.T, b *Broker) messaging.Message {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	m, err := b.Receive(ctx)
+	if err != nil {
+		t.Fatalf("failed to receive message: %v", err)
+	}
+	return m
+}
+
+func equalOffsets(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestOffsetTrackerOnlyCommitsSettledPrefix(t *testing.T) {
+	tracker := newOffsetTracker()
+	for offset := int64(0); offset < 3; offset++ {
+		tracker.add(kafkago.Message{Partition: 0, Offset: offset})
+	}
+	tracker.add(kafkago.Message{Partition: 1, Offset: 7})
+
+	if _, ok := tracker.done(kafkago.Message{Partition: 0, Offset: 1}); ok {
+		t.Error("Expected no commit while offset 0 is unsettled")
+	}
+	if commit, ok := tracker.done(kafkago.Message{Partition: 0, Offset: 0}); !ok || commit.Offset != 1 {
+		t.Errorf("Expected offset 1 to be committed Got: %v %v", commit.Offset, ok)
+	}
+	if commit, ok := tracker.done(kafkago.Message{Partition: 1, Offset: 7}); !ok || commit.Offset != 7 {
+		t.Errorf("Expected partitions to be committed independently Got: %v %v", commit.Offset, ok)
+	}
+}
+
+func TestAcceptCommitsOnceEarlierMessagesAreSettled(t *testing.T) {
+	b, r := newTestBroker(t, 1,
+		kafkago.Message{Partition: 0, Offset: 10},
+		kafkago.Message{Partition: 0, Offset: 11},
+	)
+	defer b.Close() //nolint: errcheck
+
+	first := receive(t, b)
+	second := receive(t, b)
+
+	if err := second.Accept(); err != nil {
+		t.Fatal(err)
+	}
+	if offsets := r.committedOffsets(); len(offsets) != 0 {
+		t.Errorf("Expected nothing committed while the first message is processed Got: %v", offsets)
+	}
+	if err := first.Accept(); err != nil {
+		t.Fatal(err)
+	}
+	if offsets := r.committedOffsets(); !equalOffsets(offsets, []int64{11}) {
+		t.Errorf("Expected offset 11 to be committed Got: %v", offsets)
+	}
+	if err := first.Accept(); err != messaging.ErrAlreadySettled {
+		t.Errorf("Expected settling twice to fail Got: %v", err)
+	}
+}
+
+func TestRejectRedeliversThenDeadLetters(t *testing.T) {
+	b, r := newTestBroker(t, 2, kafkago.Message{Partition: 0, Offset: 3, Value: []byte("body")})
+	defer b.Close() //nolint: errcheck
+
+	var deadLetter kafkago.Message
+	b.writeMessage = func(ctx context.Context, message kafkago.Message) error {
+		deadLetter = message
+		return nil
+	}
+
+	first := receive(t, b)
+	if err := first.Reject(); err != nil {
+		t.Fatal(err)
+	}
+	second := receive(t, b)
+	if second.ID() != first.ID() || second.DeliveryCount() != 2 {
+		t.Errorf("Expected message %s to be redelivered Got: %s delivery %d", first.ID(), second.ID(), second.DeliveryCount())
+	}
+	if offsets := r.committedOffsets(); len(offsets) != 0 {
+		t.Errorf("Expected a rejected message not to be committed Got: %v", offsets)
+	}
+
+	if err := second.Reject(); err != nil {
+		t.Fatal(err)
+	}
+	if deadLetter.Topic != "face_detected_module.deadletter" {
+		t.Errorf("Dead letter topic incorrect Got: %s", deadLetter.Topic)
+	}
+	if string(deadLetter.Value) != "body" || len(deadLetter.Headers) != 2 ||
+		string(deadLetter.Headers[0].Value) != messaging.DeadLetterReasonMaxDeliveryCountExceeded {
+		t.Errorf("Dead letter incorrect Got: %+v", deadLetter)
+	}
+	if offsets := r.committedOffsets(); !equalOffsets(offsets, []int64{3}) {
+		t.Errorf("Expected the dead lettered message to be committed Got: %v", offsets)
+	}
+}
+
+func TestGetConsumerGroup(t *testing.T) {
+	const expected = `eventname_modulename`
+	actual := getConsumerGroup("eventName", "moduleName")
+	if actual != expected {
+		t.Logf("Got: %s Expected: %s", actual, expected)
+		t.Fail()
+	}
+}
+
+func TestGetEventTopic(t *testing.T) {
+	const expected = `face_detected.v2`
+	actual := getEventTopic("Face Detected.v2")
+	if actual != expected {
+		t.Logf("Got: %s Expected: %s", actual, expected)
+		t.Fail()
+	}
+}
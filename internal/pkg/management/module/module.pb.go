@@ -24,25 +24,38 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 type ModuleCreateRequest struct {
-	Modulename           string            `protobuf:"bytes,1,opt,name=modulename,proto3" json:"modulename,omitempty"`
-	Eventsubscriptions   string            `protobuf:"bytes,2,opt,name=eventsubscriptions,proto3" json:"eventsubscriptions,omitempty"`
-	Eventpublications    string            `protobuf:"bytes,3,opt,name=eventpublications,proto3" json:"eventpublications,omitempty"`
-	Moduleimage          string            `protobuf:"bytes,4,opt,name=moduleimage,proto3" json:"moduleimage,omitempty"`
-	Handlerimage         string            `protobuf:"bytes,5,opt,name=handlerimage,proto3" json:"handlerimage,omitempty"`
-	Instancecount        int32             `protobuf:"varint,6,opt,name=instancecount,proto3" json:"instancecount,omitempty"`
-	Retrycount           int32             `protobuf:"varint,7,opt,name=retrycount,proto3" json:"retrycount,omitempty"`
-	Provider             string            `protobuf:"bytes,8,opt,name=provider,proto3" json:"provider,omitempty"`
-	Configmap            map[string]string `protobuf:"bytes,9,rep,name=configmap,proto3" json:"configmap,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
-	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
-	XXX_unrecognized     []byte            `json:"-"`
-	XXX_sizecache        int32             `json:"-"`
+	Modulename         string              `protobuf:"bytes,1,opt,name=modulename,proto3" json:"modulename,omitempty"`
+	Eventsubscriptions string              `protobuf:"bytes,2,opt,name=eventsubscriptions,proto3" json:"eventsubscriptions,omitempty"`
+	Eventpublications  string              `protobuf:"bytes,3,opt,name=eventpublications,proto3" json:"eventpublications,omitempty"`
+	Moduleimage        string              `protobuf:"bytes,4,opt,name=moduleimage,proto3" json:"moduleimage,omitempty"`
+	Handlerimage       string              `protobuf:"bytes,5,opt,name=handlerimage,proto3" json:"handlerimage,omitempty"`
+	Instancecount      int32               `protobuf:"varint,6,opt,name=instancecount,proto3" json:"instancecount,omitempty"`
+	Retrycount         int32               `protobuf:"varint,7,opt,name=retrycount,proto3" json:"retrycount,omitempty"`
+	Provider           string              `protobuf:"bytes,8,opt,name=provider,proto3" json:"provider,omitempty"`
+	Configmap          map[string]string   `protobuf:"bytes,9,rep,name=configmap,proto3" json:"configmap,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Prepareresources   *ContainerResources `protobuf:"bytes,10,opt,name=prepareresources,proto3" json:"prepareresources,omitempty"`
+	Workerresources    *ContainerResources `protobuf:"bytes,11,opt,name=workerresources,proto3" json:"workerresources,omitempty"`
+	Commitresources    *ContainerResources `protobuf:"bytes,12,opt,name=commitresources,proto3" json:"commitresources,omitempty"`
+	Nodeselector       map[string]string   `protobuf:"bytes,13,rep,name=nodeselector,proto3" json:"nodeselector,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Tolerations        []string            `protobuf:"bytes,14,rep,name=tolerations,proto3" json:"tolerations,omitempty"`
+	Serviceaccountname string              `protobuf:"bytes,15,opt,name=serviceaccountname,proto3" json:"serviceaccountname,omitempty"`
+	Retrypolicy        *RetryPolicy        `protobuf:"bytes,16,opt,name=retrypolicy,proto3" json:"retrypolicy,omitempty"`
+	// Conditions on event data, such as "mime=video/*,confidence>0.8", an event
+	// must match all of them to be dispatched to the module.
+	Subscriptionfilter string `protobuf:"bytes,17,opt,name=subscriptionfilter,proto3" json:"subscriptionfilter,omitempty"`
+	// Dispatch the module once an event of every type it subscribes to has arrived
+	// with the same correlation ID, rather than once for each event.
+	Join                 bool     `protobuf:"varint,18,opt,name=join,proto3" json:"join,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *ModuleCreateRequest) Reset()         { *m = ModuleCreateRequest{} }
 func (m *ModuleCreateRequest) String() string { return proto.CompactTextString(m) }
 func (*ModuleCreateRequest) ProtoMessage()    {}
 func (*ModuleCreateRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_module_4bd1f3906b55de90, []int{0}
+	return fileDescriptor_module_14ff1c1958690ce9, []int{0}
 }
 func (m *ModuleCreateRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ModuleCreateRequest.Unmarshal(m, b)
@@ -125,6 +138,204 @@ func (m *ModuleCreateRequest) GetConfigmap() map[string]string {
 	return nil
 }
 
+func (m *ModuleCreateRequest) GetPrepareresources() *ContainerResources {
+	if m != nil {
+		return m.Prepareresources
+	}
+	return nil
+}
+
+func (m *ModuleCreateRequest) GetWorkerresources() *ContainerResources {
+	if m != nil {
+		return m.Workerresources
+	}
+	return nil
+}
+
+func (m *ModuleCreateRequest) GetCommitresources() *ContainerResources {
+	if m != nil {
+		return m.Commitresources
+	}
+	return nil
+}
+
+func (m *ModuleCreateRequest) GetNodeselector() map[string]string {
+	if m != nil {
+		return m.Nodeselector
+	}
+	return nil
+}
+
+func (m *ModuleCreateRequest) GetTolerations() []string {
+	if m != nil {
+		return m.Tolerations
+	}
+	return nil
+}
+
+func (m *ModuleCreateRequest) GetServiceaccountname() string {
+	if m != nil {
+		return m.Serviceaccountname
+	}
+	return ""
+}
+
+func (m *ModuleCreateRequest) GetRetrypolicy() *RetryPolicy {
+	if m != nil {
+		return m.Retrypolicy
+	}
+	return nil
+}
+
+func (m *ModuleCreateRequest) GetSubscriptionfilter() string {
+	if m != nil {
+		return m.Subscriptionfilter
+	}
+	return ""
+}
+
+func (m *ModuleCreateRequest) GetJoin() bool {
+	if m != nil {
+		return m.Join
+	}
+	return false
+}
+
+// Resources requested by, and the limits of, one of a module's containers.
+// CPU and memory are Kubernetes quantities, for example "500m" or "2Gi".
+type ContainerResources struct {
+	Cpurequest           string   `protobuf:"bytes,1,opt,name=cpurequest,proto3" json:"cpurequest,omitempty"`
+	Cpulimit             string   `protobuf:"bytes,2,opt,name=cpulimit,proto3" json:"cpulimit,omitempty"`
+	Memoryrequest        string   `protobuf:"bytes,3,opt,name=memoryrequest,proto3" json:"memoryrequest,omitempty"`
+	Memorylimit          string   `protobuf:"bytes,4,opt,name=memorylimit,proto3" json:"memorylimit,omitempty"`
+	Gpu                  int32    `protobuf:"varint,5,opt,name=gpu,proto3" json:"gpu,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ContainerResources) Reset()         { *m = ContainerResources{} }
+func (m *ContainerResources) String() string { return proto.CompactTextString(m) }
+func (*ContainerResources) ProtoMessage()    {}
+func (*ContainerResources) Descriptor() ([]byte, []int) {
+	return fileDescriptor_module_14ff1c1958690ce9, []int{1}
+}
+func (m *ContainerResources) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ContainerResources.Unmarshal(m, b)
+}
+func (m *ContainerResources) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ContainerResources.Marshal(b, m, deterministic)
+}
+func (dst *ContainerResources) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ContainerResources.Merge(dst, src)
+}
+func (m *ContainerResources) XXX_Size() int {
+	return xxx_messageInfo_ContainerResources.Size(m)
+}
+func (m *ContainerResources) XXX_DiscardUnknown() {
+	xxx_messageInfo_ContainerResources.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ContainerResources proto.InternalMessageInfo
+
+func (m *ContainerResources) GetCpurequest() string {
+	if m != nil {
+		return m.Cpurequest
+	}
+	return ""
+}
+
+func (m *ContainerResources) GetCpulimit() string {
+	if m != nil {
+		return m.Cpulimit
+	}
+	return ""
+}
+
+func (m *ContainerResources) GetMemoryrequest() string {
+	if m != nil {
+		return m.Memoryrequest
+	}
+	return ""
+}
+
+func (m *ContainerResources) GetMemorylimit() string {
+	if m != nil {
+		return m.Memorylimit
+	}
+	return ""
+}
+
+func (m *ContainerResources) GetGpu() int32 {
+	if m != nil {
+		return m.Gpu
+	}
+	return 0
+}
+
+// Backoff before a module's failed job is retried, an initial delay of 0 retries immediately.
+type RetryPolicy struct {
+	Initialdelaysecs     int32    `protobuf:"varint,1,opt,name=initialdelaysecs,proto3" json:"initialdelaysecs,omitempty"`
+	Multiplier           float64  `protobuf:"fixed64,2,opt,name=multiplier,proto3" json:"multiplier,omitempty"`
+	Maxdelaysecs         int32    `protobuf:"varint,3,opt,name=maxdelaysecs,proto3" json:"maxdelaysecs,omitempty"`
+	Jitter               float64  `protobuf:"fixed64,4,opt,name=jitter,proto3" json:"jitter,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RetryPolicy) Reset()         { *m = RetryPolicy{} }
+func (m *RetryPolicy) String() string { return proto.CompactTextString(m) }
+func (*RetryPolicy) ProtoMessage()    {}
+func (*RetryPolicy) Descriptor() ([]byte, []int) {
+	return fileDescriptor_module_14ff1c1958690ce9, []int{2}
+}
+func (m *RetryPolicy) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RetryPolicy.Unmarshal(m, b)
+}
+func (m *RetryPolicy) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RetryPolicy.Marshal(b, m, deterministic)
+}
+func (dst *RetryPolicy) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RetryPolicy.Merge(dst, src)
+}
+func (m *RetryPolicy) XXX_Size() int {
+	return xxx_messageInfo_RetryPolicy.Size(m)
+}
+func (m *RetryPolicy) XXX_DiscardUnknown() {
+	xxx_messageInfo_RetryPolicy.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RetryPolicy proto.InternalMessageInfo
+
+func (m *RetryPolicy) GetInitialdelaysecs() int32 {
+	if m != nil {
+		return m.Initialdelaysecs
+	}
+	return 0
+}
+
+func (m *RetryPolicy) GetMultiplier() float64 {
+	if m != nil {
+		return m.Multiplier
+	}
+	return 0
+}
+
+func (m *RetryPolicy) GetMaxdelaysecs() int32 {
+	if m != nil {
+		return m.Maxdelaysecs
+	}
+	return 0
+}
+
+func (m *RetryPolicy) GetJitter() float64 {
+	if m != nil {
+		return m.Jitter
+	}
+	return 0
+}
+
 type ModuleCreateResponse struct {
 	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -136,7 +347,7 @@ func (m *ModuleCreateResponse) Reset()         { *m = ModuleCreateResponse{} }
 func (m *ModuleCreateResponse) String() string { return proto.CompactTextString(m) }
 func (*ModuleCreateResponse) ProtoMessage()    {}
 func (*ModuleCreateResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_module_4bd1f3906b55de90, []int{1}
+	return fileDescriptor_module_14ff1c1958690ce9, []int{3}
 }
 func (m *ModuleCreateResponse) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ModuleCreateResponse.Unmarshal(m, b)
@@ -174,7 +385,7 @@ func (m *ModuleDeleteRequest) Reset()         { *m = ModuleDeleteRequest{} }
 func (m *ModuleDeleteRequest) String() string { return proto.CompactTextString(m) }
 func (*ModuleDeleteRequest) ProtoMessage()    {}
 func (*ModuleDeleteRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_module_4bd1f3906b55de90, []int{2}
+	return fileDescriptor_module_14ff1c1958690ce9, []int{4}
 }
 func (m *ModuleDeleteRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ModuleDeleteRequest.Unmarshal(m, b)
@@ -212,7 +423,7 @@ func (m *ModuleDeleteResponse) Reset()         { *m = ModuleDeleteResponse{} }
 func (m *ModuleDeleteResponse) String() string { return proto.CompactTextString(m) }
 func (*ModuleDeleteResponse) ProtoMessage()    {}
 func (*ModuleDeleteResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_module_4bd1f3906b55de90, []int{3}
+	return fileDescriptor_module_14ff1c1958690ce9, []int{5}
 }
 func (m *ModuleDeleteResponse) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ModuleDeleteResponse.Unmarshal(m, b)
@@ -250,7 +461,7 @@ func (m *ModuleGetRequest) Reset()         { *m = ModuleGetRequest{} }
 func (m *ModuleGetRequest) String() string { return proto.CompactTextString(m) }
 func (*ModuleGetRequest) ProtoMessage()    {}
 func (*ModuleGetRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_module_4bd1f3906b55de90, []int{4}
+	return fileDescriptor_module_14ff1c1958690ce9, []int{6}
 }
 func (m *ModuleGetRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ModuleGetRequest.Unmarshal(m, b)
@@ -291,7 +502,7 @@ func (m *ModuleGetResponse) Reset()         { *m = ModuleGetResponse{} }
 func (m *ModuleGetResponse) String() string { return proto.CompactTextString(m) }
 func (*ModuleGetResponse) ProtoMessage()    {}
 func (*ModuleGetResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_module_4bd1f3906b55de90, []int{5}
+	return fileDescriptor_module_14ff1c1958690ce9, []int{7}
 }
 func (m *ModuleGetResponse) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ModuleGetResponse.Unmarshal(m, b)
@@ -342,7 +553,7 @@ func (m *ModuleListRequest) Reset()         { *m = ModuleListRequest{} }
 func (m *ModuleListRequest) String() string { return proto.CompactTextString(m) }
 func (*ModuleListRequest) ProtoMessage()    {}
 func (*ModuleListRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_module_4bd1f3906b55de90, []int{6}
+	return fileDescriptor_module_14ff1c1958690ce9, []int{8}
 }
 func (m *ModuleListRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ModuleListRequest.Unmarshal(m, b)
@@ -373,7 +584,7 @@ func (m *ModuleListResponse) Reset()         { *m = ModuleListResponse{} }
 func (m *ModuleListResponse) String() string { return proto.CompactTextString(m) }
 func (*ModuleListResponse) ProtoMessage()    {}
 func (*ModuleListResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_module_4bd1f3906b55de90, []int{7}
+	return fileDescriptor_module_14ff1c1958690ce9, []int{9}
 }
 func (m *ModuleListResponse) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ModuleListResponse.Unmarshal(m, b)
@@ -410,7 +621,7 @@ func (m *Empty) Reset()         { *m = Empty{} }
 func (m *Empty) String() string { return proto.CompactTextString(m) }
 func (*Empty) ProtoMessage()    {}
 func (*Empty) Descriptor() ([]byte, []int) {
-	return fileDescriptor_module_4bd1f3906b55de90, []int{8}
+	return fileDescriptor_module_14ff1c1958690ce9, []int{10}
 }
 func (m *Empty) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_Empty.Unmarshal(m, b)
@@ -433,6 +644,9 @@ var xxx_messageInfo_Empty proto.InternalMessageInfo
 func init() {
 	proto.RegisterType((*ModuleCreateRequest)(nil), "ModuleCreateRequest")
 	proto.RegisterMapType((map[string]string)(nil), "ModuleCreateRequest.ConfigmapEntry")
+	proto.RegisterMapType((map[string]string)(nil), "ModuleCreateRequest.NodeselectorEntry")
+	proto.RegisterType((*ContainerResources)(nil), "ContainerResources")
+	proto.RegisterType((*RetryPolicy)(nil), "RetryPolicy")
 	proto.RegisterType((*ModuleCreateResponse)(nil), "ModuleCreateResponse")
 	proto.RegisterType((*ModuleDeleteRequest)(nil), "ModuleDeleteRequest")
 	proto.RegisterType((*ModuleDeleteResponse)(nil), "ModuleDeleteResponse")
@@ -614,38 +828,57 @@ var _ModuleService_serviceDesc = grpc.ServiceDesc{
 	Metadata: "module.proto",
 }
 
-func init() { proto.RegisterFile("module.proto", fileDescriptor_module_4bd1f3906b55de90) }
-
-var fileDescriptor_module_4bd1f3906b55de90 = []byte{
-	// 473 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x94, 0xc1, 0x6e, 0xd3, 0x40,
-	0x10, 0x86, 0xe3, 0x3a, 0x71, 0x93, 0x69, 0x8b, 0x9a, 0x49, 0x40, 0x96, 0x0f, 0xc8, 0x5a, 0x10,
-	0x0a, 0x15, 0xb2, 0x44, 0x39, 0x80, 0x10, 0x17, 0x28, 0x55, 0x2f, 0xf4, 0x12, 0x6e, 0xdc, 0x36,
-	0xce, 0x50, 0x56, 0xd8, 0x6b, 0xb3, 0xbb, 0x8e, 0x94, 0x77, 0xe3, 0x71, 0x78, 0x10, 0xe4, 0xdd,
-	0x38, 0xb5, 0x89, 0xe9, 0x6d, 0xf7, 0x9f, 0x6f, 0x66, 0xe2, 0xff, 0x77, 0x0c, 0xa7, 0x79, 0xb1,
-	0xae, 0x32, 0x4a, 0x4a, 0x55, 0x98, 0x82, 0xfd, 0xf6, 0x61, 0x76, 0x6b, 0x85, 0x2b, 0x45, 0xdc,
-	0xd0, 0x92, 0x7e, 0x55, 0xa4, 0x0d, 0x3e, 0x05, 0x70, 0x9c, 0xe4, 0x39, 0x85, 0x5e, 0xec, 0x2d,
-	0x26, 0xcb, 0x96, 0x82, 0x09, 0x20, 0x6d, 0x48, 0x1a, 0x5d, 0xad, 0x74, 0xaa, 0x44, 0x69, 0x44,
-	0x21, 0x75, 0x78, 0x64, 0xb9, 0x9e, 0x0a, 0xbe, 0x82, 0xa9, 0x55, 0xcb, 0x6a, 0x95, 0x89, 0x94,
-	0x3b, 0xdc, 0xb7, 0xf8, 0x61, 0x01, 0x63, 0x38, 0x71, 0xbb, 0x44, 0xce, 0xef, 0x28, 0x1c, 0x5a,
-	0xae, 0x2d, 0x21, 0x83, 0xd3, 0x1f, 0x5c, 0xae, 0x33, 0x52, 0x0e, 0x19, 0x59, 0xa4, 0xa3, 0xe1,
-	0x73, 0x38, 0x13, 0x52, 0x1b, 0x2e, 0x53, 0x4a, 0x8b, 0x4a, 0x9a, 0x30, 0x88, 0xbd, 0xc5, 0x68,
-	0xd9, 0x15, 0xeb, 0x27, 0x55, 0x64, 0xd4, 0xd6, 0x21, 0xc7, 0x16, 0x69, 0x29, 0x18, 0xc1, 0xb8,
-	0x54, 0xc5, 0x46, 0xac, 0x49, 0x85, 0x63, 0xbb, 0x65, 0x7f, 0xc7, 0x8f, 0x30, 0x49, 0x0b, 0xf9,
-	0x5d, 0xdc, 0xe5, 0xbc, 0x0c, 0x27, 0xb1, 0xbf, 0x38, 0xb9, 0x7c, 0x96, 0xf4, 0xd8, 0x99, 0x5c,
-	0x35, 0xd4, 0xb5, 0x34, 0x6a, 0xbb, 0xbc, 0xef, 0x8a, 0x3e, 0xc0, 0xa3, 0x6e, 0x11, 0xcf, 0xc1,
-	0xff, 0x49, 0xdb, 0x9d, 0xe7, 0xf5, 0x11, 0xe7, 0x30, 0xda, 0xf0, 0xac, 0xa2, 0x9d, 0xbf, 0xee,
-	0xf2, 0xfe, 0xe8, 0x9d, 0xc7, 0x2e, 0x60, 0xde, 0x5d, 0xa7, 0xcb, 0x42, 0x6a, 0x42, 0x84, 0x61,
-	0x2b, 0x38, 0x7b, 0x66, 0x2f, 0x9b, 0xa4, 0x3f, 0x53, 0x46, 0xf7, 0x49, 0xf7, 0xa1, 0xfb, 0xb1,
-	0x0d, 0xfa, 0xc0, 0xd8, 0x17, 0x70, 0xee, 0xd8, 0x1b, 0x32, 0x0f, 0xcd, 0x24, 0x98, 0xb6, 0xb8,
-	0xff, 0x0f, 0xc4, 0x27, 0x10, 0x68, 0xc3, 0x4d, 0xd5, 0xbc, 0x4e, 0xbb, 0x5b, 0x1d, 0xa7, 0x3b,
-	0xdd, 0x92, 0xd6, 0x75, 0xe6, 0xee, 0xf5, 0xe9, 0x8a, 0x6c, 0xd6, 0xac, 0xf9, 0x22, 0x74, 0xf3,
-	0x7b, 0xd8, 0x05, 0x60, 0x5b, 0xdc, 0x2d, 0x9f, 0xc3, 0xa8, 0x5e, 0xa8, 0x43, 0x2f, 0xf6, 0x6b,
-	0x5b, 0xed, 0x85, 0x1d, 0xc3, 0xe8, 0x3a, 0x2f, 0xcd, 0xf6, 0xf2, 0x8f, 0x07, 0x67, 0xae, 0xeb,
-	0x2b, 0xa9, 0x8d, 0x48, 0x09, 0xdf, 0x42, 0xe0, 0x7c, 0xc6, 0x79, 0x5f, 0xca, 0xd1, 0xe3, 0xa4,
-	0x2f, 0x0c, 0x36, 0xa8, 0x1b, 0x9d, 0x93, 0xfb, 0xc6, 0x4e, 0x06, 0xfb, 0xc6, 0xae, 0xdd, 0x6c,
-	0x80, 0x09, 0xf8, 0x37, 0x64, 0x70, 0x9a, 0xfc, 0x6b, 0x71, 0x84, 0xc9, 0x81, 0x9b, 0x6c, 0x80,
-	0xaf, 0x61, 0x58, 0x3f, 0x22, 0x36, 0xd5, 0x96, 0x09, 0xd1, 0x2c, 0x39, 0xf4, 0x80, 0x0d, 0x3e,
-	0x8d, 0xbf, 0x05, 0xee, 0x8f, 0xb5, 0x0a, 0xec, 0x27, 0xe1, 0xcd, 0xdf, 0x00, 0x00, 0x00, 0xff,
-	0xff, 0x7f, 0xa5, 0x15, 0x8a, 0x22, 0x04, 0x00, 0x00,
+func init() { proto.RegisterFile("module.proto", fileDescriptor_module_14ff1c1958690ce9) }
+
+var fileDescriptor_module_14ff1c1958690ce9 = []byte{
+	// 769 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x55, 0xdd, 0x6e, 0xd3, 0x4a,
+	0x10, 0xae, 0x9b, 0x9f, 0xa6, 0x93, 0xb4, 0x4d, 0x36, 0xe9, 0x91, 0x95, 0x8b, 0xa3, 0xc8, 0xe7,
+	0xa8, 0x0a, 0x15, 0xb2, 0x44, 0xb9, 0x00, 0x21, 0x50, 0x05, 0xa5, 0xaa, 0x84, 0x28, 0x42, 0xe6,
+	0x8e, 0xbb, 0xad, 0x33, 0x2d, 0xdb, 0xda, 0x5e, 0xb3, 0xbb, 0x0e, 0xe4, 0x41, 0x78, 0x09, 0x1e,
+	0x86, 0xa7, 0xe0, 0x41, 0xd0, 0xee, 0xda, 0x89, 0x1d, 0xa7, 0x95, 0xb8, 0xdb, 0xfd, 0xf6, 0xfb,
+	0x66, 0xbd, 0xf3, 0xcd, 0x8c, 0xa1, 0x17, 0xf3, 0x59, 0x16, 0xa1, 0x9f, 0x0a, 0xae, 0xb8, 0xf7,
+	0x6b, 0x07, 0x86, 0x97, 0x06, 0x38, 0x13, 0x48, 0x15, 0x06, 0xf8, 0x35, 0x43, 0xa9, 0xc8, 0xbf,
+	0x00, 0x96, 0x97, 0xd0, 0x18, 0x5d, 0x67, 0xe2, 0x4c, 0x77, 0x83, 0x12, 0x42, 0x7c, 0x20, 0x38,
+	0xc7, 0x44, 0xc9, 0xec, 0x4a, 0x86, 0x82, 0xa5, 0x8a, 0xf1, 0x44, 0xba, 0xdb, 0x86, 0xb7, 0xe1,
+	0x84, 0x3c, 0x86, 0x81, 0x41, 0xd3, 0xec, 0x2a, 0x62, 0x21, 0xb5, 0xf4, 0x86, 0xa1, 0xd7, 0x0f,
+	0xc8, 0x04, 0xba, 0xf6, 0x2e, 0x16, 0xd3, 0x1b, 0x74, 0x9b, 0x86, 0x57, 0x86, 0x88, 0x07, 0xbd,
+	0x2f, 0x34, 0x99, 0x45, 0x28, 0x2c, 0xa5, 0x65, 0x28, 0x15, 0x8c, 0xfc, 0x0f, 0x7b, 0x2c, 0x91,
+	0x8a, 0x26, 0x21, 0x86, 0x3c, 0x4b, 0x94, 0xdb, 0x9e, 0x38, 0xd3, 0x56, 0x50, 0x05, 0xf5, 0x4b,
+	0x05, 0x2a, 0xb1, 0xb0, 0x94, 0x1d, 0x43, 0x29, 0x21, 0x64, 0x0c, 0x9d, 0x54, 0xf0, 0x39, 0x9b,
+	0xa1, 0x70, 0x3b, 0xe6, 0x96, 0xe5, 0x9e, 0xbc, 0x86, 0xdd, 0x90, 0x27, 0xd7, 0xec, 0x26, 0xa6,
+	0xa9, 0xbb, 0x3b, 0x69, 0x4c, 0xbb, 0x27, 0xff, 0xf9, 0x1b, 0xd2, 0xe9, 0x9f, 0x15, 0xac, 0xf3,
+	0x44, 0x89, 0x45, 0xb0, 0x52, 0x91, 0x53, 0xe8, 0xa7, 0x02, 0x53, 0x2a, 0x50, 0xa0, 0xe4, 0x99,
+	0x08, 0x51, 0xba, 0x30, 0x71, 0xa6, 0xdd, 0x93, 0xa1, 0x56, 0x29, 0xca, 0x12, 0x14, 0x41, 0x71,
+	0x14, 0xd4, 0xc8, 0xe4, 0x15, 0x1c, 0x7c, 0xe3, 0xe2, 0x0e, 0xc5, 0x4a, 0xdf, 0xbd, 0x5f, 0xbf,
+	0xce, 0xd5, 0xf2, 0x90, 0xc7, 0x31, 0x53, 0x2b, 0x79, 0xef, 0x01, 0xf9, 0x1a, 0x97, 0xbc, 0x83,
+	0x5e, 0xc2, 0x67, 0x28, 0x31, 0xc2, 0x50, 0x71, 0xe1, 0xee, 0x99, 0x24, 0x1c, 0x6d, 0x4c, 0xc2,
+	0x87, 0x12, 0xd1, 0xe6, 0xa1, 0xa2, 0xd5, 0xae, 0x2b, 0x1e, 0xa1, 0xc8, 0xab, 0x63, 0x7f, 0xd2,
+	0xd0, 0xae, 0x97, 0x20, 0x5d, 0x75, 0x12, 0xc5, 0x9c, 0x85, 0x48, 0x43, 0xe3, 0x8e, 0xa9, 0xce,
+	0x03, 0x5b, 0x75, 0xf5, 0x13, 0xe2, 0x43, 0xd7, 0x38, 0x99, 0xf2, 0x88, 0x85, 0x0b, 0xb7, 0x6f,
+	0x1e, 0xd6, 0xf3, 0x03, 0x8d, 0x7d, 0x34, 0x58, 0x50, 0x26, 0x98, 0xf8, 0xa5, 0xb2, 0xbd, 0x66,
+	0x91, 0x42, 0xe1, 0x0e, 0xf2, 0xf8, 0xb5, 0x13, 0x42, 0xa0, 0x79, 0xcb, 0x59, 0xe2, 0x92, 0x89,
+	0x33, 0xed, 0x04, 0x66, 0x3d, 0x7e, 0x09, 0xfb, 0x55, 0xb7, 0x49, 0x1f, 0x1a, 0x77, 0xb8, 0xc8,
+	0x9b, 0x48, 0x2f, 0xc9, 0x08, 0x5a, 0x73, 0x1a, 0x65, 0x98, 0x37, 0x8c, 0xdd, 0xbc, 0xd8, 0x7e,
+	0xee, 0x8c, 0x4f, 0x61, 0x50, 0x4b, 0xd3, 0xdf, 0x04, 0xf0, 0x7e, 0x3a, 0x40, 0xea, 0xc6, 0xe9,
+	0x2a, 0x0f, 0xd3, 0x4c, 0x58, 0x27, 0x8a, 0x7e, 0x5e, 0x21, 0xba, 0xca, 0xc3, 0x34, 0x8b, 0x58,
+	0xcc, 0x54, 0x1e, 0x73, 0xb9, 0xd7, 0x7d, 0x14, 0x63, 0xcc, 0xc5, 0xa2, 0x90, 0xdb, 0xbe, 0xad,
+	0x82, 0xa6, 0x67, 0x0d, 0x60, 0x83, 0x14, 0x3d, 0xbb, 0x82, 0xf4, 0x33, 0x6e, 0xd2, 0xcc, 0xb4,
+	0x6a, 0x2b, 0xd0, 0x4b, 0xef, 0x87, 0x03, 0xdd, 0x92, 0x19, 0xe4, 0x18, 0xfa, 0x2c, 0x61, 0x8a,
+	0xd1, 0x68, 0x86, 0x11, 0x5d, 0x48, 0x0c, 0xa5, 0xf9, 0xd6, 0x56, 0x50, 0xc3, 0xcd, 0x84, 0xca,
+	0x22, 0xc5, 0xd2, 0x88, 0xa1, 0x30, 0xdf, 0xec, 0x04, 0x25, 0x44, 0x4f, 0x88, 0x98, 0x7e, 0x5f,
+	0xc5, 0x69, 0x98, 0x38, 0x15, 0x8c, 0xfc, 0x03, 0xed, 0x5b, 0xa6, 0xb4, 0xc7, 0x4d, 0xa3, 0xcf,
+	0x77, 0xde, 0x31, 0x8c, 0xaa, 0x05, 0x2c, 0x53, 0x9e, 0x48, 0xd4, 0x7e, 0x97, 0xe6, 0xa1, 0x59,
+	0x7b, 0x8f, 0x8a, 0x01, 0xfa, 0x16, 0x23, 0x5c, 0x0d, 0xd0, 0x4d, 0xd4, 0x65, 0xd8, 0x82, 0xfa,
+	0x40, 0xd8, 0x23, 0xe8, 0x5b, 0xee, 0x05, 0xaa, 0x87, 0x62, 0x22, 0x0c, 0x4a, 0xbc, 0xfb, 0x03,
+	0xea, 0xb7, 0x4a, 0x45, 0x55, 0x56, 0x4c, 0xe9, 0x7c, 0xa7, 0xdd, 0xb5, 0xab, 0x4b, 0x94, 0x52,
+	0x8f, 0xd2, 0xdc, 0xdd, 0x0a, 0xe8, 0x0d, 0x8b, 0x6b, 0xde, 0x33, 0x59, 0x7c, 0x8f, 0x77, 0x0c,
+	0xa4, 0x0c, 0xe6, 0x97, 0x8f, 0xa0, 0xa5, 0x2f, 0xd4, 0xce, 0xe9, 0x06, 0xb6, 0x1b, 0x6f, 0x07,
+	0x5a, 0xe7, 0x71, 0xaa, 0x16, 0x27, 0xbf, 0x1d, 0xd8, 0xb3, 0xaa, 0x4f, 0xb6, 0x61, 0xc9, 0x33,
+	0x68, 0xdb, 0x3c, 0x93, 0xd1, 0xa6, 0xb9, 0x31, 0x3e, 0xf4, 0x37, 0x99, 0xe1, 0x6d, 0x69, 0xa1,
+	0xcd, 0xe4, 0x52, 0x58, 0xf1, 0x60, 0x7c, 0xb8, 0x86, 0x2e, 0x85, 0x3e, 0x34, 0x2e, 0x50, 0x91,
+	0x81, 0xbf, 0x9e, 0xe2, 0x31, 0xf1, 0x6b, 0xd9, 0xf4, 0xb6, 0xc8, 0x13, 0x68, 0xea, 0x27, 0x92,
+	0xe2, 0xb4, 0x94, 0x84, 0xf1, 0xd0, 0xaf, 0xe7, 0xc0, 0xdb, 0x7a, 0xd3, 0xf9, 0xdc, 0xb6, 0xff,
+	0xab, 0xab, 0xb6, 0xf9, 0xd3, 0x3e, 0xfd, 0x33, 0x00, 0x68, 0x37, 0x0f, 0xe2, 0x79, 0x07, 0x00,
+	0x00,
 }
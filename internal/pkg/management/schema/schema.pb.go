@@ -0,0 +1,542 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: schema.proto
+
+package schema
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type SchemaRegisterRequest struct {
+	Eventtype            string   `protobuf:"bytes,1,opt,name=eventtype,proto3" json:"eventtype,omitempty"`
+	Schema               string   `protobuf:"bytes,2,opt,name=schema,proto3" json:"schema,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SchemaRegisterRequest) Reset()         { *m = SchemaRegisterRequest{} }
+func (m *SchemaRegisterRequest) String() string { return proto.CompactTextString(m) }
+func (*SchemaRegisterRequest) ProtoMessage()    {}
+func (*SchemaRegisterRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_schema_eb816de67edbf70d, []int{0}
+}
+func (m *SchemaRegisterRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SchemaRegisterRequest.Unmarshal(m, b)
+}
+func (m *SchemaRegisterRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SchemaRegisterRequest.Marshal(b, m, deterministic)
+}
+func (dst *SchemaRegisterRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SchemaRegisterRequest.Merge(dst, src)
+}
+func (m *SchemaRegisterRequest) XXX_Size() int {
+	return xxx_messageInfo_SchemaRegisterRequest.Size(m)
+}
+func (m *SchemaRegisterRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SchemaRegisterRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SchemaRegisterRequest proto.InternalMessageInfo
+
+func (m *SchemaRegisterRequest) GetEventtype() string {
+	if m != nil {
+		return m.Eventtype
+	}
+	return ""
+}
+
+func (m *SchemaRegisterRequest) GetSchema() string {
+	if m != nil {
+		return m.Schema
+	}
+	return ""
+}
+
+type SchemaRegisterResponse struct {
+	Eventtype            string   `protobuf:"bytes,1,opt,name=eventtype,proto3" json:"eventtype,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SchemaRegisterResponse) Reset()         { *m = SchemaRegisterResponse{} }
+func (m *SchemaRegisterResponse) String() string { return proto.CompactTextString(m) }
+func (*SchemaRegisterResponse) ProtoMessage()    {}
+func (*SchemaRegisterResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_schema_eb816de67edbf70d, []int{1}
+}
+func (m *SchemaRegisterResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SchemaRegisterResponse.Unmarshal(m, b)
+}
+func (m *SchemaRegisterResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SchemaRegisterResponse.Marshal(b, m, deterministic)
+}
+func (dst *SchemaRegisterResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SchemaRegisterResponse.Merge(dst, src)
+}
+func (m *SchemaRegisterResponse) XXX_Size() int {
+	return xxx_messageInfo_SchemaRegisterResponse.Size(m)
+}
+func (m *SchemaRegisterResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_SchemaRegisterResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SchemaRegisterResponse proto.InternalMessageInfo
+
+func (m *SchemaRegisterResponse) GetEventtype() string {
+	if m != nil {
+		return m.Eventtype
+	}
+	return ""
+}
+
+type SchemaDeleteRequest struct {
+	Eventtype            string   `protobuf:"bytes,1,opt,name=eventtype,proto3" json:"eventtype,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SchemaDeleteRequest) Reset()         { *m = SchemaDeleteRequest{} }
+func (m *SchemaDeleteRequest) String() string { return proto.CompactTextString(m) }
+func (*SchemaDeleteRequest) ProtoMessage()    {}
+func (*SchemaDeleteRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_schema_eb816de67edbf70d, []int{2}
+}
+func (m *SchemaDeleteRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SchemaDeleteRequest.Unmarshal(m, b)
+}
+func (m *SchemaDeleteRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SchemaDeleteRequest.Marshal(b, m, deterministic)
+}
+func (dst *SchemaDeleteRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SchemaDeleteRequest.Merge(dst, src)
+}
+func (m *SchemaDeleteRequest) XXX_Size() int {
+	return xxx_messageInfo_SchemaDeleteRequest.Size(m)
+}
+func (m *SchemaDeleteRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SchemaDeleteRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SchemaDeleteRequest proto.InternalMessageInfo
+
+func (m *SchemaDeleteRequest) GetEventtype() string {
+	if m != nil {
+		return m.Eventtype
+	}
+	return ""
+}
+
+type SchemaDeleteResponse struct {
+	Eventtype            string   `protobuf:"bytes,1,opt,name=eventtype,proto3" json:"eventtype,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SchemaDeleteResponse) Reset()         { *m = SchemaDeleteResponse{} }
+func (m *SchemaDeleteResponse) String() string { return proto.CompactTextString(m) }
+func (*SchemaDeleteResponse) ProtoMessage()    {}
+func (*SchemaDeleteResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_schema_eb816de67edbf70d, []int{3}
+}
+func (m *SchemaDeleteResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SchemaDeleteResponse.Unmarshal(m, b)
+}
+func (m *SchemaDeleteResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SchemaDeleteResponse.Marshal(b, m, deterministic)
+}
+func (dst *SchemaDeleteResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SchemaDeleteResponse.Merge(dst, src)
+}
+func (m *SchemaDeleteResponse) XXX_Size() int {
+	return xxx_messageInfo_SchemaDeleteResponse.Size(m)
+}
+func (m *SchemaDeleteResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_SchemaDeleteResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SchemaDeleteResponse proto.InternalMessageInfo
+
+func (m *SchemaDeleteResponse) GetEventtype() string {
+	if m != nil {
+		return m.Eventtype
+	}
+	return ""
+}
+
+type SchemaGetRequest struct {
+	Eventtype            string   `protobuf:"bytes,1,opt,name=eventtype,proto3" json:"eventtype,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SchemaGetRequest) Reset()         { *m = SchemaGetRequest{} }
+func (m *SchemaGetRequest) String() string { return proto.CompactTextString(m) }
+func (*SchemaGetRequest) ProtoMessage()    {}
+func (*SchemaGetRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_schema_eb816de67edbf70d, []int{4}
+}
+func (m *SchemaGetRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SchemaGetRequest.Unmarshal(m, b)
+}
+func (m *SchemaGetRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SchemaGetRequest.Marshal(b, m, deterministic)
+}
+func (dst *SchemaGetRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SchemaGetRequest.Merge(dst, src)
+}
+func (m *SchemaGetRequest) XXX_Size() int {
+	return xxx_messageInfo_SchemaGetRequest.Size(m)
+}
+func (m *SchemaGetRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SchemaGetRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SchemaGetRequest proto.InternalMessageInfo
+
+func (m *SchemaGetRequest) GetEventtype() string {
+	if m != nil {
+		return m.Eventtype
+	}
+	return ""
+}
+
+type SchemaGetResponse struct {
+	Eventtype            string   `protobuf:"bytes,1,opt,name=eventtype,proto3" json:"eventtype,omitempty"`
+	Schema               string   `protobuf:"bytes,2,opt,name=schema,proto3" json:"schema,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SchemaGetResponse) Reset()         { *m = SchemaGetResponse{} }
+func (m *SchemaGetResponse) String() string { return proto.CompactTextString(m) }
+func (*SchemaGetResponse) ProtoMessage()    {}
+func (*SchemaGetResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_schema_eb816de67edbf70d, []int{5}
+}
+func (m *SchemaGetResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SchemaGetResponse.Unmarshal(m, b)
+}
+func (m *SchemaGetResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SchemaGetResponse.Marshal(b, m, deterministic)
+}
+func (dst *SchemaGetResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SchemaGetResponse.Merge(dst, src)
+}
+func (m *SchemaGetResponse) XXX_Size() int {
+	return xxx_messageInfo_SchemaGetResponse.Size(m)
+}
+func (m *SchemaGetResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_SchemaGetResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SchemaGetResponse proto.InternalMessageInfo
+
+func (m *SchemaGetResponse) GetEventtype() string {
+	if m != nil {
+		return m.Eventtype
+	}
+	return ""
+}
+
+func (m *SchemaGetResponse) GetSchema() string {
+	if m != nil {
+		return m.Schema
+	}
+	return ""
+}
+
+type SchemaListRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SchemaListRequest) Reset()         { *m = SchemaListRequest{} }
+func (m *SchemaListRequest) String() string { return proto.CompactTextString(m) }
+func (*SchemaListRequest) ProtoMessage()    {}
+func (*SchemaListRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_schema_eb816de67edbf70d, []int{6}
+}
+func (m *SchemaListRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SchemaListRequest.Unmarshal(m, b)
+}
+func (m *SchemaListRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SchemaListRequest.Marshal(b, m, deterministic)
+}
+func (dst *SchemaListRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SchemaListRequest.Merge(dst, src)
+}
+func (m *SchemaListRequest) XXX_Size() int {
+	return xxx_messageInfo_SchemaListRequest.Size(m)
+}
+func (m *SchemaListRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SchemaListRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SchemaListRequest proto.InternalMessageInfo
+
+type SchemaListResponse struct {
+	Eventtypes           []string `protobuf:"bytes,1,rep,name=eventtypes,proto3" json:"eventtypes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SchemaListResponse) Reset()         { *m = SchemaListResponse{} }
+func (m *SchemaListResponse) String() string { return proto.CompactTextString(m) }
+func (*SchemaListResponse) ProtoMessage()    {}
+func (*SchemaListResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_schema_eb816de67edbf70d, []int{7}
+}
+func (m *SchemaListResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SchemaListResponse.Unmarshal(m, b)
+}
+func (m *SchemaListResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SchemaListResponse.Marshal(b, m, deterministic)
+}
+func (dst *SchemaListResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SchemaListResponse.Merge(dst, src)
+}
+func (m *SchemaListResponse) XXX_Size() int {
+	return xxx_messageInfo_SchemaListResponse.Size(m)
+}
+func (m *SchemaListResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_SchemaListResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SchemaListResponse proto.InternalMessageInfo
+
+func (m *SchemaListResponse) GetEventtypes() []string {
+	if m != nil {
+		return m.Eventtypes
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*SchemaRegisterRequest)(nil), "SchemaRegisterRequest")
+	proto.RegisterType((*SchemaRegisterResponse)(nil), "SchemaRegisterResponse")
+	proto.RegisterType((*SchemaDeleteRequest)(nil), "SchemaDeleteRequest")
+	proto.RegisterType((*SchemaDeleteResponse)(nil), "SchemaDeleteResponse")
+	proto.RegisterType((*SchemaGetRequest)(nil), "SchemaGetRequest")
+	proto.RegisterType((*SchemaGetResponse)(nil), "SchemaGetResponse")
+	proto.RegisterType((*SchemaListRequest)(nil), "SchemaListRequest")
+	proto.RegisterType((*SchemaListResponse)(nil), "SchemaListResponse")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// SchemaServiceClient is the client API for SchemaService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type SchemaServiceClient interface {
+	Register(ctx context.Context, in *SchemaRegisterRequest, opts ...grpc.CallOption) (*SchemaRegisterResponse, error)
+	Delete(ctx context.Context, in *SchemaDeleteRequest, opts ...grpc.CallOption) (*SchemaDeleteResponse, error)
+	Get(ctx context.Context, in *SchemaGetRequest, opts ...grpc.CallOption) (*SchemaGetResponse, error)
+	List(ctx context.Context, in *SchemaListRequest, opts ...grpc.CallOption) (*SchemaListResponse, error)
+}
+
+type schemaServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewSchemaServiceClient(cc *grpc.ClientConn) SchemaServiceClient {
+	return &schemaServiceClient{cc}
+}
+
+func (c *schemaServiceClient) Register(ctx context.Context, in *SchemaRegisterRequest, opts ...grpc.CallOption) (*SchemaRegisterResponse, error) {
+	out := new(SchemaRegisterResponse)
+	err := c.cc.Invoke(ctx, "/SchemaService/Register", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schemaServiceClient) Delete(ctx context.Context, in *SchemaDeleteRequest, opts ...grpc.CallOption) (*SchemaDeleteResponse, error) {
+	out := new(SchemaDeleteResponse)
+	err := c.cc.Invoke(ctx, "/SchemaService/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schemaServiceClient) Get(ctx context.Context, in *SchemaGetRequest, opts ...grpc.CallOption) (*SchemaGetResponse, error) {
+	out := new(SchemaGetResponse)
+	err := c.cc.Invoke(ctx, "/SchemaService/Get", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schemaServiceClient) List(ctx context.Context, in *SchemaListRequest, opts ...grpc.CallOption) (*SchemaListResponse, error) {
+	out := new(SchemaListResponse)
+	err := c.cc.Invoke(ctx, "/SchemaService/List", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SchemaServiceServer is the server API for SchemaService service.
+type SchemaServiceServer interface {
+	Register(context.Context, *SchemaRegisterRequest) (*SchemaRegisterResponse, error)
+	Delete(context.Context, *SchemaDeleteRequest) (*SchemaDeleteResponse, error)
+	Get(context.Context, *SchemaGetRequest) (*SchemaGetResponse, error)
+	List(context.Context, *SchemaListRequest) (*SchemaListResponse, error)
+}
+
+func RegisterSchemaServiceServer(s *grpc.Server, srv SchemaServiceServer) {
+	s.RegisterService(&_SchemaService_serviceDesc, srv)
+}
+
+func _SchemaService_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SchemaRegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchemaServiceServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/SchemaService/Register",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchemaServiceServer).Register(ctx, req.(*SchemaRegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SchemaService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SchemaDeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchemaServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/SchemaService/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchemaServiceServer).Delete(ctx, req.(*SchemaDeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SchemaService_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SchemaGetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchemaServiceServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/SchemaService/Get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchemaServiceServer).Get(ctx, req.(*SchemaGetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SchemaService_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SchemaListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchemaServiceServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/SchemaService/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchemaServiceServer).List(ctx, req.(*SchemaListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _SchemaService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "SchemaService",
+	HandlerType: (*SchemaServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Register",
+			Handler:    _SchemaService_Register_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _SchemaService_Delete_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _SchemaService_Get_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _SchemaService_List_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "schema.proto",
+}
+
+func init() { proto.RegisterFile("schema.proto", fileDescriptor_schema_eb816de67edbf70d) }
+
+var fileDescriptor_schema_eb816de67edbf70d = []byte{
+	// 277 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x92, 0x41, 0x4b, 0xc3, 0x40,
+	0x10, 0x85, 0x13, 0x2b, 0xa1, 0x19, 0x14, 0xec, 0xa4, 0x8d, 0x21, 0x88, 0x94, 0x39, 0xf5, 0x34,
+	0xa8, 0x2d, 0x7a, 0xf2, 0x22, 0x42, 0x11, 0xf4, 0x92, 0xde, 0xbc, 0x69, 0x19, 0x34, 0xa0, 0x4d,
+	0xcc, 0xae, 0x05, 0xff, 0xb2, 0xbf, 0x42, 0xcc, 0x26, 0x1a, 0x9b, 0x58, 0xf6, 0x38, 0x33, 0xbc,
+	0xf7, 0x92, 0xef, 0x2d, 0xec, 0xa9, 0xe5, 0xb3, 0xbc, 0x3e, 0x70, 0x5e, 0x64, 0x3a, 0xa3, 0x3b,
+	0x18, 0x2d, 0xca, 0x39, 0x91, 0xa7, 0x54, 0x69, 0x29, 0x12, 0x79, 0x7b, 0x17, 0xa5, 0xf1, 0x08,
+	0x7c, 0x59, 0xcb, 0x4a, 0xeb, 0x8f, 0x5c, 0x22, 0x77, 0xec, 0x4e, 0xfc, 0xe4, 0x77, 0x81, 0x21,
+	0x78, 0xc6, 0x26, 0xda, 0x29, 0x4f, 0xd5, 0x44, 0xe7, 0x10, 0x6e, 0xda, 0xa9, 0x3c, 0x5b, 0x29,
+	0xd9, 0xee, 0x47, 0x53, 0x08, 0x8c, 0xee, 0x5a, 0x5e, 0x44, 0x8b, 0xd5, 0x47, 0xd0, 0x0c, 0x86,
+	0x7f, 0x45, 0x56, 0x51, 0x27, 0x70, 0x60, 0x54, 0x73, 0xd1, 0x76, 0x39, 0x37, 0x30, 0x68, 0x28,
+	0x6c, 0x42, 0xfe, 0xe5, 0x13, 0xd4, 0x56, 0xb7, 0xa9, 0xaa, 0xd3, 0x69, 0x06, 0xd8, 0x5c, 0x56,
+	0x01, 0xc7, 0x00, 0x3f, 0x7e, 0x2a, 0x72, 0xc7, 0xbd, 0x89, 0x9f, 0x34, 0x36, 0x67, 0x9f, 0x2e,
+	0xec, 0x1b, 0xd9, 0x42, 0x8a, 0x75, 0xba, 0x14, 0xbc, 0x84, 0x7e, 0x8d, 0x1d, 0x43, 0xee, 0xac,
+	0x35, 0x3e, 0xe4, 0xee, 0x7e, 0xc8, 0xc1, 0x0b, 0xf0, 0x0c, 0x48, 0x1c, 0x72, 0x47, 0x19, 0xf1,
+	0x88, 0xbb, 0x68, 0x93, 0x83, 0x0c, 0xbd, 0xb9, 0x68, 0x1c, 0xf0, 0x26, 0xd7, 0x18, 0xb9, 0x05,
+	0x8e, 0x1c, 0x3c, 0x85, 0xdd, 0xef, 0x3f, 0xc5, 0xfa, 0xda, 0x60, 0x11, 0x07, 0xdc, 0x46, 0x41,
+	0xce, 0x55, 0xff, 0xbe, 0x22, 0xf8, 0xe8, 0x95, 0xef, 0x76, 0xfa, 0x35, 0x00, 0xe5, 0x4a, 0x81,
+	0x60, 0xc7, 0x02, 0x00, 0x00,
+}
@@ -0,0 +1,138 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/types"
+)
+
+// Broker is the message broker a dispatcher receives its module's events from.
+// Messages are locked while they're processed and settled with `Accept`, `Reject` or `DeadLetter`.
+type Broker interface {
+	// Receive blocks until a message is available on the module's subscription
+	Receive(ctx context.Context) (Message, error)
+	// RenewLocks extends the locks on messages which are still being processed
+	RenewLocks(ctx context.Context, messages []Message) error
+	Publisher
+	// GetQueueDepth returns the number of messages waiting on, and dead lettered from, the module's subscription
+	GetQueueDepth() (MessageCountDetails, error)
+	// HandlerArgs returns the args which configure the handler to publish events to the broker
+	HandlerArgs() []string
+}
+
+// Publisher sends events to a message broker, handlers only need to publish so
+// brokers can offer a publisher without a subscription
+type Publisher interface {
+	// Publish sends an event to the topic for the event's type
+	Publish(ctx context.Context, event common.Event) error
+	Close() error
+}
+
+// MessageCountDetails is the number of messages on a subscription
+type MessageCountDetails struct {
+	// ActiveMessageCount - Number of active messages in the queue, topic, or subscription.
+	ActiveMessageCount int64
+	// DeadLetterMessageCount - Number of messages that are dead lettered.
+	DeadLetterMessageCount int64
+}
+
+// BrokerConstructor creates a broker from the dispatcher configuration
+type BrokerConstructor func(ctx context.Context, config *types.Configuration) (Broker, error)
+
+var (
+	brokerRegistryMu sync.RWMutex
+	brokerRegistry   = map[string]BrokerConstructor{}
+)
+
+// RegisterBroker makes a broker available to the dispatcher. It panics if the
+// registration is invalid or a broker is already registered with the same name.
+func RegisterBroker(name string, constructor BrokerConstructor) {
+	brokerRegistryMu.Lock()
+	defer brokerRegistryMu.Unlock()
+
+	name = strings.ToLower(name)
+	if name == "" {
+		panic("messaging: RegisterBroker called with empty name")
+	}
+	if constructor == nil {
+		panic("messaging: RegisterBroker called with nil constructor for " + name)
+	}
+	if _, exists := brokerRegistry[name]; exists {
+		panic("messaging: RegisterBroker called twice for broker " + name)
+	}
+	brokerRegistry[name] = constructor
+}
+
+// LookupBroker returns the constructor for the named broker
+func LookupBroker(name string) (BrokerConstructor, bool) {
+	brokerRegistryMu.RLock()
+	defer brokerRegistryMu.RUnlock()
+
+	constructor, ok := brokerRegistry[strings.ToLower(name)]
+	return constructor, ok
+}
+
+// RegisteredBrokers returns the sorted names of all registered brokers
+func RegisteredBrokers() []string {
+	brokerRegistryMu.RLock()
+	defer brokerRegistryMu.RUnlock()
+
+	names := make([]string, 0, len(brokerRegistry))
+	for name := range brokerRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewBroker creates the broker selected by `config.Broker`. When the module subscribes
+// to more than one event type a broker is created for each subscription and they're
+// combined by a SubscriptionsBroker.
+func NewBroker(ctx context.Context, config *types.Configuration) (Broker, error) {
+	if config == nil {
+		return nil, fmt.Errorf("invalid config. Cannot be nil")
+	}
+
+	constructor, ok := LookupBroker(config.Broker)
+	if !ok {
+		return nil, fmt.Errorf("unknown broker '%s', registered brokers: %s", config.Broker, strings.Join(RegisteredBrokers(), ", "))
+	}
+	eventTypes := SplitEventTypes(config.SubscribesToEvent)
+	if len(eventTypes) <= 1 {
+		return constructor(ctx, config)
+	}
+
+	brokers := make([]Broker, 0, len(eventTypes))
+	for _, eventType := range eventTypes {
+		subscriptionConfig := *config
+		subscriptionConfig.SubscribesToEvent = eventType
+		broker, err := constructor(ctx, &subscriptionConfig)
+		if err != nil {
+			for _, created := range brokers {
+				created.Close() //nolint: errcheck
+			}
+			return nil, fmt.Errorf("failed creating subscription to '%s': %v", eventType, err)
+		}
+		brokers = append(brokers, broker)
+	}
+	return NewSubscriptionsBroker(eventTypes, brokers), nil
+}
+
+// Unwrap returns the message received from the broker when the message has been
+// wrapped, for example by the RetryScheduler, so brokers can get at their own message type
+func Unwrap(m Message) Message {
+	for {
+		wrapper, ok := m.(interface {
+			Unwrap() Message
+		})
+		if !ok {
+			return m
+		}
+		m = wrapper.Unwrap()
+	}
+}
@@ -0,0 +1,84 @@
+package messaging
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lawrencegripper/ion/internal/pkg/cloudevents"
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging/filter"
+)
+
+// EventEncoding is how an event is written to a message. Received messages are decoded
+// whichever encoding they were published with.
+type EventEncoding string
+
+const (
+	// EventEncodingIon writes the event's JSON as the message body
+	EventEncodingIon EventEncoding = "ion"
+	// EventEncodingCloudEventsStructured writes the event as a CloudEvents JSON document
+	EventEncodingCloudEventsStructured EventEncoding = "structured"
+	// EventEncodingCloudEventsBinary writes the event's data as the message body and its
+	// CloudEvents attributes as message headers
+	EventEncodingCloudEventsBinary EventEncoding = "binary"
+)
+
+// ParseEventEncoding returns the encoding with the name, an empty name is the Ion encoding
+func ParseEventEncoding(name string) (EventEncoding, error) {
+	switch encoding := EventEncoding(strings.ToLower(name)); encoding {
+	case "":
+		return EventEncodingIon, nil
+	case EventEncodingIon, EventEncodingCloudEventsStructured, EventEncodingCloudEventsBinary:
+		return encoding, nil
+	}
+	return "", fmt.Errorf("unknown event encoding '%s', valid encodings are: %s, %s, %s", name,
+		EventEncodingIon, EventEncodingCloudEventsStructured, EventEncodingCloudEventsBinary)
+}
+
+// EncodedEvent is an event written as a message body. In binary mode the CloudEvents
+// attributes are set as message headers, with the prefix of the broker's protocol binding.
+// Brokers which filter on message properties, such as ServiceBus, set the event's data
+// as Properties so subscription filters can be evaluated against it.
+type EncodedEvent struct {
+	Body        []byte
+	ContentType string
+	Attributes  map[string]string
+	Properties  map[string]interface{}
+}
+
+// EncodeEvent writes the event with the encoding
+func EncodeEvent(event common.Event, encoding EventEncoding) (EncodedEvent, error) {
+	var encoded EncodedEvent
+	var err error
+	switch encoding {
+	case EventEncodingCloudEventsStructured:
+		encoded.ContentType = cloudevents.StructuredContentType
+		encoded.Body, err = cloudevents.MarshalStructured(event)
+	case EventEncodingCloudEventsBinary:
+		encoded.ContentType = cloudevents.JSONContentType
+		encoded.Attributes, encoded.Body, err = cloudevents.ToBinary(event)
+	default:
+		encoded.ContentType = cloudevents.JSONContentType
+		encoded.Body, err = json.Marshal(event)
+	}
+	if err != nil {
+		return EncodedEvent{}, fmt.Errorf("error encoding event: %+v", err)
+	}
+	encoded.Properties = filter.Properties(event.Data)
+	return encoded, nil
+}
+
+// DecodeEventWithHeaders deserializes a message into an event, like DecodeEvent, but an event
+// encoded in CloudEvents binary mode is read from the message's headers
+func DecodeEventWithHeaders(headers map[string]string, data []byte) (common.Event, error) {
+	attributes := cloudevents.Attributes(headers)
+	if attributes == nil {
+		return DecodeEvent(data)
+	}
+	event, err := cloudevents.FromBinary(attributes, data)
+	if err != nil {
+		return event, &PoisonMessageError{Reason: DeadLetterReasonMalformedEvent, Err: err}
+	}
+	return validatedEvent(event)
+}
@@ -0,0 +1,216 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+)
+
+// Operators a condition can compare a key's value with, longer operators
+// are listed first so '>=' isn't parsed as '>' followed by '=value'
+var operators = []string{"!=", ">=", "<=", "=", ">", "<"}
+
+// Keys are restricted to names which can be used as message properties in every broker
+var keyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Values which look like decimal numbers are compared, and sent as properties, as numbers
+var numberPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// wildcard matches any characters in the value of an '=' or '!=' condition
+const wildcard = "*"
+
+//Filter selects the events a module receives by the key value pairs of their data.
+//An event matches when every condition matches, an empty filter matches every event.
+type Filter struct {
+	conditions []condition
+}
+
+type condition struct {
+	key      string
+	operator string
+	value    string
+	number   float64
+	numeric  bool
+	pattern  *regexp.Regexp
+}
+
+//Parse reads a filter from a comma delimited list of conditions, such as
+//'mime=video/*,confidence>0.8'. '=' and '!=' compare strings, or numbers when the value
+//is a number, and '*' in their value matches any characters. '>', '>=', '<' and '<='
+//compare numbers.
+func Parse(expression string) (*Filter, error) {
+	filter := &Filter{}
+	for _, part := range strings.Split(expression, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		c, err := parseCondition(part)
+		if err != nil {
+			return nil, err
+		}
+		filter.conditions = append(filter.conditions, c)
+	}
+	return filter, nil
+}
+
+func parseCondition(expression string) (condition, error) {
+	index, operator := -1, ""
+	for _, op := range operators {
+		if i := strings.Index(expression, op); i >= 0 && (index < 0 || i < index) {
+			index, operator = i, op
+		}
+	}
+	if index < 0 {
+		return condition{}, fmt.Errorf("filter condition '%s' has no operator, expected one of %s", expression, strings.Join(operators, " "))
+	}
+
+	c := condition{
+		key:      strings.TrimSpace(expression[:index]),
+		operator: operator,
+		value:    strings.TrimSpace(expression[index+len(operator):]),
+	}
+	if !keyPattern.MatchString(c.key) {
+		return condition{}, fmt.Errorf("filter condition '%s' has an invalid key '%s', keys may only contain letters, digits and underscores", expression, c.key)
+	}
+	if numberPattern.MatchString(c.value) {
+		c.number, _ = strconv.ParseFloat(c.value, 64)
+		c.numeric = true
+	}
+	switch {
+	case c.operator != "=" && c.operator != "!=":
+		if !c.numeric {
+			return condition{}, fmt.Errorf("filter condition '%s' compares '%s' with '%s' which isn't a number", expression, c.key, c.value)
+		}
+	case strings.Contains(c.value, wildcard):
+		c.numeric = false
+		parts := strings.Split(c.value, wildcard)
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		c.pattern = regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+	}
+	return c, nil
+}
+
+//IsEmpty returns true if the filter has no conditions so matches every event
+func (f *Filter) IsEmpty() bool {
+	return f == nil || len(f.conditions) == 0
+}
+
+//Match returns true if the event data matches every condition. A condition on a key
+//which isn't in the data, or a numeric condition on a value which isn't a number, doesn't match.
+func (f *Filter) Match(data common.KeyValuePairs) bool {
+	if f.IsEmpty() {
+		return true
+	}
+	values := make(map[string]string, len(data))
+	for _, kvp := range data {
+		values[kvp.Key] = kvp.Value
+	}
+	for _, c := range f.conditions {
+		value, ok := values[c.key]
+		if !ok || !c.match(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c condition) match(value string) bool {
+	if c.pattern != nil {
+		return c.pattern.MatchString(value) == (c.operator == "=")
+	}
+	if !c.numeric {
+		return (value == c.value) == (c.operator == "=")
+	}
+	if !numberPattern.MatchString(value) {
+		return false
+	}
+	number, _ := strconv.ParseFloat(value, 64)
+	switch c.operator {
+	case "=":
+		return number == c.number
+	case "!=":
+		return number != c.number
+	case ">":
+		return number > c.number
+	case ">=":
+		return number >= c.number
+	case "<":
+		return number < c.number
+	default:
+		return number <= c.number
+	}
+}
+
+//SQL returns the filter as a ServiceBus SQL filter expression over the message
+//properties set by Properties, an empty filter is the expression '1=1'
+func (f *Filter) SQL() string {
+	if f.IsEmpty() {
+		return "1=1"
+	}
+	clauses := make([]string, 0, len(f.conditions))
+	for _, c := range f.conditions {
+		clauses = append(clauses, c.sql())
+	}
+	return strings.Join(clauses, " AND ")
+}
+
+func (c condition) sql() string {
+	if c.pattern != nil {
+		operator := "LIKE"
+		if c.operator == "!=" {
+			operator = "NOT LIKE"
+		}
+		// '!' escapes the characters LIKE treats as wildcards
+		escaper := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_", wildcard, "%")
+		return fmt.Sprintf("%s %s %s ESCAPE '!'", c.key, operator, quote(escaper.Replace(c.value)))
+	}
+	operator := c.operator
+	if operator == "!=" {
+		operator = "<>"
+	}
+	if c.numeric {
+		return fmt.Sprintf("%s %s %s", c.key, operator, strconv.FormatFloat(c.number, 'f', -1, 64))
+	}
+	return fmt.Sprintf("%s %s %s", c.key, operator, quote(c.value))
+}
+
+func quote(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
+
+//String returns the filter's conditions as they're parsed
+func (f *Filter) String() string {
+	if f.IsEmpty() {
+		return ""
+	}
+	conditions := make([]string, 0, len(f.conditions))
+	for _, c := range f.conditions {
+		conditions = append(conditions, c.key+c.operator+c.value)
+	}
+	return strings.Join(conditions, ",")
+}
+
+//Properties returns the event data a broker's filter is evaluated against as message
+//properties. Keys which can't be filtered on are left out and values which are numbers
+//are converted to float64 so they're compared as numbers.
+func Properties(data common.KeyValuePairs) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for _, kvp := range data {
+		if !keyPattern.MatchString(kvp.Key) {
+			continue
+		}
+		if numberPattern.MatchString(kvp.Value) {
+			number, _ := strconv.ParseFloat(kvp.Value, 64)
+			properties[kvp.Key] = number
+			continue
+		}
+		properties[kvp.Key] = kvp.Value
+	}
+	return properties
+}
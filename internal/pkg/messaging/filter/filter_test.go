@@ -0,0 +1,92 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+)
+
+func kvps(pairs ...string) common.KeyValuePairs {
+	data := common.KeyValuePairs{}
+	for i := 0; i < len(pairs); i += 2 {
+		data = data.Append(common.KeyValuePair{Key: pairs[i], Value: pairs[i+1]})
+	}
+	return data
+}
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		filter   string
+		data     common.KeyValuePairs
+		expected bool
+	}{
+		{filter: "", data: kvps(), expected: true},
+		{filter: "mime=video/*", data: kvps("mime", "video/mp4"), expected: true},
+		{filter: "mime=video/*", data: kvps("mime", "image/png"), expected: false},
+		{filter: "mime=video/*", data: kvps("other", "video/mp4"), expected: false},
+		{filter: "mime!=video/*", data: kvps("mime", "image/png"), expected: true},
+		{filter: "mime=video/mp4", data: kvps("mime", "video/mp4"), expected: true},
+		{filter: "mime!=video/mp4", data: kvps("mime", "video/mp4"), expected: false},
+		{filter: "confidence>0.8", data: kvps("confidence", "0.93"), expected: true},
+		{filter: "confidence>0.8", data: kvps("confidence", "0.8"), expected: false},
+		{filter: "confidence>=0.8", data: kvps("confidence", "0.8"), expected: true},
+		{filter: "confidence<0.8", data: kvps("confidence", "high"), expected: false},
+		{filter: "count=3", data: kvps("count", "3.0"), expected: true},
+		{filter: "mime=video/*, confidence>0.8", data: kvps("mime", "video/mp4", "confidence", "0.93"), expected: true},
+		{filter: "mime=video/*, confidence>0.8", data: kvps("mime", "video/mp4", "confidence", "0.5"), expected: false},
+	}
+	for _, test := range testCases {
+		f, err := Parse(test.filter)
+		if err != nil {
+			t.Errorf("%s: failed to parse: %v", test.filter, err)
+			continue
+		}
+		if actual := f.Match(test.data); actual != test.expected {
+			t.Errorf("%s: Expected: %v Got: %v for %v", test.filter, test.expected, actual, test.data)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expression := range []string{"mime", "mime-type=video", "confidence>high", "=video"} {
+		if _, err := Parse(expression); err == nil {
+			t.Errorf("expected an error parsing '%s'", expression)
+		}
+	}
+}
+
+func TestSQL(t *testing.T) {
+	testCases := []struct {
+		filter   string
+		expected string
+	}{
+		{filter: "", expected: "1=1"},
+		{filter: "mime=video/*", expected: "mime LIKE 'video/%' ESCAPE '!'"},
+		{filter: "name!=*_100%*", expected: "name NOT LIKE '%!_100!%%' ESCAPE '!'"},
+		{filter: "label=o'brien", expected: "label = 'o''brien'"},
+		{filter: "confidence>0.8,count!=2", expected: "confidence > 0.8 AND count <> 2"},
+	}
+	for _, test := range testCases {
+		f, err := Parse(test.filter)
+		if err != nil {
+			t.Errorf("%s: failed to parse: %v", test.filter, err)
+			continue
+		}
+		if actual := f.SQL(); actual != test.expected {
+			t.Errorf("%s: Expected: %s Got: %s", test.filter, test.expected, actual)
+		}
+	}
+}
+
+func TestProperties(t *testing.T) {
+	actual := Properties(kvps("mime", "video/mp4", "confidence", "0.93", "file1.png", "https://blob", "version", "1.2.3"))
+	expected := map[string]interface{}{
+		"mime":       "video/mp4",
+		"confidence": 0.93,
+		"version":    "1.2.3",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected: %v Got: %v", expected, actual)
+	}
+}
@@ -0,0 +1,386 @@
+package inmemory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+	"github.com/lawrencegripper/ion/internal/pkg/types"
+	"github.com/twinj/uuid"
+)
+
+// BrokerName is the name used to select the in-memory broker as the dispatcher's broker
+const BrokerName = "inmemory"
+
+// defaultLockDuration is how long a received message is locked for before it's redelivered,
+// it matches the default lock duration of a ServiceBus subscription
+const defaultLockDuration = time.Duration(60) * time.Second
+
+// errLockLost is returned when a message is settled after its lock has expired
+var errLockLost = errors.New("message lock lost, the message has been redelivered")
+
+// defaultBus is shared by the brokers created by the dispatcher so they can exchange events in process
+var defaultBus = NewBus()
+
+func init() {
+	messaging.RegisterBroker(BrokerName, func(ctx context.Context, config *types.Configuration) (messaging.Broker, error) {
+		if config.SubscribesToEvent == "" || config.ModuleName == "" {
+			return nil, fmt.Errorf("subscribestoevent and modulename are required")
+		}
+		maxDeliveryCount := 1
+		if config.Job != nil {
+			maxDeliveryCount = config.Job.RetryCount + 1
+		}
+		return defaultBus.NewBroker(config.SubscribesToEvent, config.ModuleName, maxDeliveryCount), nil
+	})
+}
+
+// Bus is a set of in process topics and their subscriptions, shared by the brokers created from it.
+// Like ServiceBus, an event published to a topic is copied to every subscription on the topic.
+type Bus struct {
+	mu     sync.Mutex
+	topics map[string]map[string]*subscription
+}
+
+// NewBus creates an empty bus
+func NewBus() *Bus {
+	return &Bus{
+		topics: map[string]map[string]*subscription{},
+	}
+}
+
+// NewBroker creates a broker which receives from the module's subscription to the event,
+// creating the subscription if it doesn't exist. A message is dead lettered once it's been
+// rejected `maxDeliveryCount` times.
+func (b *Bus) NewBroker(eventType, moduleName string, maxDeliveryCount int) *Broker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	topicName := strings.ToLower(eventType)
+	subName := topicName + "_" + strings.ToLower(moduleName)
+	topic, ok := b.topics[topicName]
+	if !ok {
+		topic = map[string]*subscription{}
+		b.topics[topicName] = topic
+	}
+	sub, ok := topic[subName]
+	if !ok {
+		sub = newSubscription(maxDeliveryCount)
+		topic[subName] = sub
+	}
+
+	return &Broker{
+		bus:          b,
+		subscription: sub,
+		lockDuration: defaultLockDuration,
+		now:          time.Now,
+	}
+}
+
+// publish copies the body to every subscription on the topic
+func (b *Bus) publish(topicName string, body []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, sub := range b.topics[strings.ToLower(topicName)] {
+		sub.enqueue(&storedMessage{
+			id:   uuid.NewV4().String(),
+			body: body,
+		})
+	}
+}
+
+// Broker receives messages from one subscription on the bus and publishes to any of its topics
+type Broker struct {
+	bus          *Bus
+	subscription *subscription
+	lockDuration time.Duration
+	now          func() time.Time
+}
+
+//Check at compile time if we implement the interface
+var _ messaging.Broker = (*Broker)(nil)
+
+// Receive blocks until a message is available on the subscription
+func (b *Broker) Receive(ctx context.Context) (messaging.Message, error) {
+	for {
+		m, notify := b.subscription.lock(b.now(), b.lockDuration)
+		if m != nil {
+			return m, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-notify:
+		case <-time.After(b.lockDuration):
+			// Wake up to redeliver messages whose locks have expired
+		}
+	}
+}
+
+// RenewLocks extends the locks on messages still being processed
+func (b *Broker) RenewLocks(ctx context.Context, messages []messaging.Message) error {
+	err := messaging.CheckReceived(messages, func(message messaging.Message) bool {
+		m, ok := message.(*Message)
+		return ok && m.subscription == b.subscription
+	})
+	if err != nil {
+		return err
+	}
+	for _, message := range messages {
+		m := messaging.Unwrap(message).(*Message)
+		if err := b.subscription.renew(m, b.now().Add(b.lockDuration)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Publish sends the event to the topic for its type
+func (b *Broker) Publish(ctx context.Context, event common.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error marshalling event: %+v", err)
+	}
+	b.bus.publish(event.Type, body)
+	return nil
+}
+
+// GetQueueDepth returns the number of messages waiting on, and dead lettered from, the subscription
+func (b *Broker) GetQueueDepth() (messaging.MessageCountDetails, error) {
+	return b.subscription.depth(), nil
+}
+
+// HandlerArgs returns no args, the bus only exists in the dispatcher's process so
+// handlers fall back to their development event publisher
+func (b *Broker) HandlerArgs() []string {
+	return nil
+}
+
+// Close does nothing, the subscription is kept so another broker can receive the remaining messages
+func (b *Broker) Close() error {
+	return nil
+}
+
+// DeadLetters returns the messages dead lettered from the subscription
+func (b *Broker) DeadLetters() []DeadLetter {
+	return b.subscription.deadLetters()
+}
+
+// DeadLetter is a message which was dead lettered, with the reason why
+type DeadLetter struct {
+	ID          string
+	Body        []byte
+	Reason      string
+	Description string
+}
+
+// storedMessage is a message on a subscription
+type storedMessage struct {
+	id            string
+	body          []byte
+	deliveryCount int
+	lockToken     int
+	lockedUntil   time.Time
+}
+
+// subscription holds the messages waiting to be received, locked by a receiver or dead lettered
+type subscription struct {
+	mu               sync.Mutex
+	maxDeliveryCount int
+	pending          []*storedMessage
+	locked           map[string]*storedMessage
+	deadLettered     []DeadLetter
+	nextLockToken    int
+	notify           chan struct{}
+}
+
+func newSubscription(maxDeliveryCount int) *subscription {
+	return &subscription{
+		maxDeliveryCount: maxDeliveryCount,
+		locked:           map[string]*storedMessage{},
+		notify:           make(chan struct{}),
+	}
+}
+
+// enqueue adds the message to the subscription and wakes up waiting receivers
+func (s *subscription) enqueue(m *storedMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, m)
+	s.wake()
+}
+
+// wake closes the notify channel to wake all waiting receivers, callers must hold the lock
+func (s *subscription) wake() {
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+// lock takes the next message and locks it until `now + lockDuration`. When there's no
+// message it returns a channel which is closed when one is enqueued.
+func (s *subscription) lock(now time.Time, lockDuration time.Duration) (*Message, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Messages whose locks have expired are available to be redelivered
+	for id, m := range s.locked {
+		if now.After(m.lockedUntil) {
+			delete(s.locked, id)
+			s.pending = append(s.pending, m)
+		}
+	}
+
+	if len(s.pending) == 0 {
+		return nil, s.notify
+	}
+	m := s.pending[0]
+	s.pending = s.pending[1:]
+
+	s.nextLockToken++
+	m.deliveryCount++
+	m.lockToken = s.nextLockToken
+	m.lockedUntil = now.Add(lockDuration)
+	s.locked[m.id] = m
+
+	return &Message{
+		id:            m.id,
+		body:          m.body,
+		deliveryCount: m.deliveryCount,
+		lockToken:     m.lockToken,
+		subscription:  s,
+	}, nil
+}
+
+// settle removes the message's lock, failing if the lock has been lost
+func (s *subscription) settle(m *Message) (*storedMessage, error) {
+	stored, ok := s.locked[m.id]
+	if !ok || stored.lockToken != m.lockToken {
+		return nil, errLockLost
+	}
+	delete(s.locked, m.id)
+	return stored, nil
+}
+
+func (s *subscription) accept(m *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.settle(m)
+	return err
+}
+
+func (s *subscription) reject(m *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, err := s.settle(m)
+	if err != nil {
+		return err
+	}
+	if stored.deliveryCount >= s.maxDeliveryCount {
+		s.deadLettered = append(s.deadLettered, DeadLetter{
+			ID:          stored.id,
+			Body:        stored.body,
+			Reason:      messaging.DeadLetterReasonMaxDeliveryCountExceeded,
+			Description: fmt.Sprintf("message was delivered %d times", stored.deliveryCount),
+		})
+		return nil
+	}
+	s.pending = append(s.pending, stored)
+	s.wake()
+	return nil
+}
+
+func (s *subscription) deadLetter(m *Message, reason, description string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, err := s.settle(m)
+	if err != nil {
+		return err
+	}
+	s.deadLettered = append(s.deadLettered, DeadLetter{
+		ID:          stored.id,
+		Body:        stored.body,
+		Reason:      reason,
+		Description: description,
+	})
+	return nil
+}
+
+func (s *subscription) renew(m *Message, lockedUntil time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.locked[m.id]
+	if !ok || stored.lockToken != m.lockToken {
+		return errLockLost
+	}
+	stored.lockedUntil = lockedUntil
+	return nil
+}
+
+func (s *subscription) depth() messaging.MessageCountDetails {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return messaging.MessageCountDetails{
+		ActiveMessageCount:     int64(len(s.pending) + len(s.locked)),
+		DeadLetterMessageCount: int64(len(s.deadLettered)),
+	}
+}
+
+func (s *subscription) deadLetters() []DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]DeadLetter{}, s.deadLettered...)
+}
+
+// Message is a delivery of a message from an in-memory subscription
+type Message struct {
+	id            string
+	body          []byte
+	deliveryCount int
+	lockToken     int
+	subscription  *subscription
+}
+
+//Check at compile time if we implement the interface
+var _ messaging.Message = (*Message)(nil)
+
+// ID get the ID
+func (m *Message) ID() string {
+	return m.id
+}
+
+// DeliveryCount get number of times the message has been delivered
+func (m *Message) DeliveryCount() int {
+	return m.deliveryCount
+}
+
+// Body get the body
+func (m *Message) Body() []byte {
+	return m.body
+}
+
+// Accept mark the message as processed successfully (don't re-queue)
+func (m *Message) Accept() error {
+	return m.subscription.accept(m)
+}
+
+// Reject mark message to be requeued, it's dead lettered once its max delivery count is reached
+func (m *Message) Reject() error {
+	return m.subscription.reject(m)
+}
+
+// DeadLetter move the message to the dead letter queue, recording why it couldn't be processed
+func (m *Message) DeadLetter(reason, description string) error {
+	return m.subscription.deadLetter(m, reason, description)
+}
+
+// EventData deserialize json value to type
+func (m *Message) EventData() (common.Event, error) {
+	return messaging.DecodeEvent(m.body)
+}
@@ -0,0 +1,186 @@
+package inmemory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+)
+
+func newTestEvent(eventType string) common.Event {
+	return common.Event{
+		Type: eventType,
+		Context: &common.Context{
+			EventID:       "event1",
+			CorrelationID: "correlation1",
+		},
+	}
+}
+
+func receive(t *testing.T, b *Broker) messaging.Message {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	m, err := b.Receive(ctx)
+	if err != nil {
+		t.Fatalf("failed to receive message: %v", err)
+	}
+	return m
+}
+
+func TestPublishCopiesEventToEachSubscription(t *testing.T) {
+	bus := NewBus()
+	moduleA := bus.NewBroker("face_detected", "moduleA", 1)
+	moduleB := bus.NewBroker("face_detected", "moduleB", 1)
+	other := bus.NewBroker("file_uploaded", "moduleC", 1)
+
+	err := moduleA.Publish(context.Background(), newTestEvent("face_detected"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, b := range []*Broker{moduleA, moduleB} {
+		m := receive(t, b)
+		event, err := m.EventData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Context.EventID != "event1" {
+			t.Errorf("EventID incorrect Expected: event1 Got: %v", event.Context.EventID)
+		}
+		if m.DeliveryCount() != 1 {
+			t.Errorf("DeliveryCount incorrect Expected: 1 Got: %v", m.DeliveryCount())
+		}
+	}
+
+	depth, _ := other.GetQueueDepth()
+	if depth.ActiveMessageCount != 0 {
+		t.Errorf("Expected no messages on other topic Got: %v", depth.ActiveMessageCount)
+	}
+}
+
+func TestReceiveBlocksUntilPublish(t *testing.T) {
+	b := NewBus().NewBroker("face_detected", "module", 1)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = b.Publish(context.Background(), newTestEvent("face_detected"))
+	}()
+
+	m := receive(t, b)
+	if m == nil {
+		t.Error("Expected to receive the published message")
+	}
+}
+
+func TestReceiveReturnsWhenContextDone(t *testing.T) {
+	b := NewBus().NewBroker("face_detected", "module", 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := b.Receive(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded Got: %v", err)
+	}
+}
+
+func TestRejectRedeliversUntilMaxDeliveryCount(t *testing.T) {
+	b := NewBus().NewBroker("face_detected", "module", 2)
+	_ = b.Publish(context.Background(), newTestEvent("face_detected"))
+
+	first := receive(t, b)
+	if err := first.Reject(); err != nil {
+		t.Fatal(err)
+	}
+
+	second := receive(t, b)
+	if second.ID() != first.ID() {
+		t.Errorf("Expected the same message to be redelivered Expected: %v Got: %v", first.ID(), second.ID())
+	}
+	if second.DeliveryCount() != 2 {
+		t.Errorf("DeliveryCount incorrect Expected: 2 Got: %v", second.DeliveryCount())
+	}
+	if err := second.Reject(); err != nil {
+		t.Fatal(err)
+	}
+
+	depth, _ := b.GetQueueDepth()
+	if depth.ActiveMessageCount != 0 || depth.DeadLetterMessageCount != 1 {
+		t.Errorf("Expected message to be dead lettered Got: %+v", depth)
+	}
+}
+
+func TestAcceptRemovesMessage(t *testing.T) {
+	b := NewBus().NewBroker("face_detected", "module", 1)
+	_ = b.Publish(context.Background(), newTestEvent("face_detected"))
+
+	m := receive(t, b)
+	if err := m.Accept(); err != nil {
+		t.Fatal(err)
+	}
+
+	depth, _ := b.GetQueueDepth()
+	if depth.ActiveMessageCount != 0 || depth.DeadLetterMessageCount != 0 {
+		t.Errorf("Expected no messages Got: %+v", depth)
+	}
+	if err := m.Accept(); err != errLockLost {
+		t.Errorf("Expected settling twice to fail Got: %v", err)
+	}
+}
+
+func TestDeadLetterRecordsReason(t *testing.T) {
+	b := NewBus().NewBroker("face_detected", "module", 5)
+	_ = b.Publish(context.Background(), newTestEvent("face_detected"))
+
+	m := receive(t, b)
+	if err := m.DeadLetter(messaging.DeadLetterReasonInvalidEvent, "event has no context"); err != nil {
+		t.Fatal(err)
+	}
+
+	deadLetters := b.DeadLetters()
+	if len(deadLetters) != 1 {
+		t.Fatalf("Expected 1 dead letter Got: %v", len(deadLetters))
+	}
+	if deadLetters[0].Reason != messaging.DeadLetterReasonInvalidEvent {
+		t.Errorf("Reason incorrect Expected: %v Got: %v", messaging.DeadLetterReasonInvalidEvent, deadLetters[0].Reason)
+	}
+}
+
+func TestExpiredLockIsRedeliveredUnlessRenewed(t *testing.T) {
+	b := NewBus().NewBroker("face_detected", "module", 5)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	_ = b.Publish(context.Background(), newTestEvent("face_detected"))
+	_ = b.Publish(context.Background(), newTestEvent("face_detected"))
+
+	renewed := receive(t, b)
+	expired := receive(t, b)
+
+	now = now.Add(b.lockDuration / 2)
+	if err := b.RenewLocks(context.Background(), []messaging.Message{renewed}); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(b.lockDuration/2 + time.Second)
+
+	redelivered := receive(t, b)
+	if redelivered.ID() != expired.ID() {
+		t.Errorf("Expected the message with the expired lock to be redelivered Expected: %v Got: %v", expired.ID(), redelivered.ID())
+	}
+	if err := expired.Accept(); err != errLockLost {
+		t.Errorf("Expected accepting with an expired lock to fail Got: %v", err)
+	}
+	if err := renewed.Accept(); err != nil {
+		t.Errorf("Expected accepting a renewed message to succeed Got: %v", err)
+	}
+}
+
+func TestRenewLocksUnwrapsMessages(t *testing.T) {
+	b := NewBus().NewBroker("face_detected", "module", 5)
+	_ = b.Publish(context.Background(), newTestEvent("face_detected"))
+
+	m := messaging.NewRetryScheduler(messaging.RetryPolicy{}, 5).Wrap(receive(t, b))
+	if err := b.RenewLocks(context.Background(), []messaging.Message{m}); err != nil {
+		t.Error(err)
+	}
+}
@@ -2,8 +2,11 @@ package messaging
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync/atomic"
 
+	"github.com/lawrencegripper/ion/internal/pkg/cloudevents"
 	"github.com/lawrencegripper/ion/internal/pkg/common"
 
 	log "github.com/sirupsen/logrus"
@@ -17,8 +20,80 @@ type Message interface {
 	Body() []byte
 	Accept() error
 	Reject() error
+	DeadLetter(reason, description string) error
 	EventData() (common.Event, error)
-	GetAMQPMessage() *amqp.Message
+}
+
+// Reasons a message is dead lettered without being processed
+const (
+	// DeadLetterReasonMalformedEvent the message body isn't a JSON event
+	DeadLetterReasonMalformedEvent = "MalformedEvent"
+	// DeadLetterReasonInvalidEvent the event is missing fields required to process it
+	DeadLetterReasonInvalidEvent = "InvalidEvent"
+)
+
+// DeadLetterReasonMaxDeliveryCountExceeded the message was rejected on every delivery,
+// it's the reason ServiceBus uses so brokers which dead letter it themselves match
+const DeadLetterReasonMaxDeliveryCountExceeded = "MaxDeliveryCountExceeded"
+
+// Properties ServiceBus sets on a dead lettered message, brokers which dead letter messages
+// themselves set headers with the same names
+const (
+	DeadLetterReasonProperty      = "DeadLetterReason"
+	DeadLetterDescriptionProperty = "DeadLetterErrorDescription"
+)
+
+// ErrAlreadySettled is returned when a message is accepted, rejected or dead lettered twice
+var ErrAlreadySettled = errors.New("message has already been settled")
+
+// Settlement records whether a message has been settled, for brokers which have to stop
+// a message being accepted, rejected or dead lettered twice themselves
+type Settlement struct {
+	settled int32
+}
+
+// Settle marks the message as settled, returning ErrAlreadySettled if it already was
+func (s *Settlement) Settle() error {
+	if !atomic.CompareAndSwapInt32(&s.settled, 0, 1) {
+		return ErrAlreadySettled
+	}
+	return nil
+}
+
+// MaxDeliveryCountExceeded returns true once a rejected message has been delivered maxDeliveryCount
+// times. Brokers which count deliveries themselves then dead letter it, rather than requeueing it,
+// with DeadLetterReasonMaxDeliveryCountExceeded and the description returned.
+func MaxDeliveryCountExceeded(m Message, maxDeliveryCount int) (string, bool) {
+	if m.DeliveryCount() < maxDeliveryCount {
+		return "", false
+	}
+	log.WithField("messageID", m.ID()).Warn("message reached its max delivery count, dead lettering")
+	return fmt.Sprintf("message was delivered %d times", m.DeliveryCount()), true
+}
+
+// CheckReceived returns an error for the first message which, once unwrapped, received
+// reports wasn't received from the broker. Brokers check the messages passed to RenewLocks.
+func CheckReceived(messages []Message, received func(m Message) bool) error {
+	for _, message := range messages {
+		if !received(Unwrap(message)) {
+			return fmt.Errorf("message %s wasn't received from this broker", message.ID())
+		}
+	}
+	return nil
+}
+
+// deadLetterCondition is the error condition ServiceBus uses to dead letter a rejected message
+const deadLetterCondition amqp.ErrorCondition = "com.microsoft:dead-letter"
+
+// PoisonMessageError is returned for a message which will fail however many times it's
+// retried, so should be dead lettered rather than requeued
+type PoisonMessageError struct {
+	Reason string
+	Err    error
+}
+
+func (e *PoisonMessageError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Reason, e.Err)
 }
 
 // AmqpMessage Wrapper for amqp
@@ -70,14 +145,84 @@ func (m *AmqpMessage) Reject() error {
 	return nil
 }
 
+// DeadLetter move the message to the dead letter queue, recording why it couldn't be processed
+func (m *AmqpMessage) DeadLetter(reason, description string) error {
+	m.OriginalMessage.Reject(&amqp.Error{
+		Condition:   deadLetterCondition,
+		Description: description,
+		Info: map[string]interface{}{
+			DeadLetterReasonProperty:      reason,
+			DeadLetterDescriptionProperty: description,
+		},
+	})
+	return nil
+}
+
 // EventData deserialize json value to type
 func (m *AmqpMessage) EventData() (common.Event, error) {
+	headers := map[string]string{}
+	for key, value := range m.OriginalMessage.ApplicationProperties {
+		if s, ok := value.(string); ok {
+			headers[key] = s
+		}
+	}
+	return DecodeEventWithHeaders(headers, m.OriginalMessage.GetData())
+}
+
+// NewAmqpEventMessage creates an AMQP message for the encoded event, CloudEvents attributes
+// are set as application properties
+func NewAmqpEventMessage(encoded EncodedEvent) *amqp.Message {
+	msg := amqp.NewMessage(encoded.Body)
+	msg.Properties = &amqp.MessageProperties{
+		ContentType: encoded.ContentType,
+	}
+	if len(encoded.Attributes)+len(encoded.Properties) > 0 {
+		msg.ApplicationProperties = make(map[string]interface{}, len(encoded.Attributes)+len(encoded.Properties))
+		for name, value := range encoded.Properties {
+			msg.ApplicationProperties[name] = value
+		}
+		for name, value := range encoded.Attributes {
+			msg.ApplicationProperties[cloudevents.AMQPPropertyPrefix+name] = value
+		}
+	}
+	return msg
+}
+
+// DecodeEvent deserializes a message body, an Ion event or a CloudEvents structured mode
+// document, into an event returning a PoisonMessageError if the body isn't an event the
+// dispatcher can process
+func DecodeEvent(data []byte) (common.Event, error) {
 	var event common.Event
-	data := m.OriginalMessage.GetData()
-	err := json.Unmarshal(data, &event)
+	var err error
+	if cloudevents.IsStructured(data) {
+		event, err = cloudevents.UnmarshalStructured(data)
+	} else {
+		err = json.Unmarshal(data, &event)
+	}
 	if err != nil {
-		log.WithError(err).WithField("value", m.OriginalMessage.Data).Fatal("Unmarshal failed")
-		return event, err
+		return event, &PoisonMessageError{Reason: DeadLetterReasonMalformedEvent, Err: err}
+	}
+	return validatedEvent(event)
+}
+
+// validatedEvent returns the event, or a PoisonMessageError if it's invalid
+func validatedEvent(event common.Event) (common.Event, error) {
+	if err := validateEvent(event); err != nil {
+		return event, &PoisonMessageError{Reason: DeadLetterReasonInvalidEvent, Err: err}
 	}
 	return event, nil
 }
+
+// validateEvent checks the event has the fields needed to dispatch a job for it
+func validateEvent(event common.Event) error {
+	if event.Context == nil {
+		return errors.New("event has no context")
+	}
+	if event.Context.EventID == "" {
+		return errors.New("event context has no eventId")
+	}
+	if event.Context.CorrelationID == "" {
+		return errors.New("event context has no correlationId")
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package messaging
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+
+	"pack.ag/amqp"
+)
+
+func TestEventDataPoisonMessages(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		expectedReason string
+	}{
+		{"valid event", `{"context": {"eventId": "1", "correlationId": "2"}, "type": "face_detected"}`, ""},
+		{"malformed json", `{"context": `, DeadLetterReasonMalformedEvent},
+		{"missing context", `{"type": "face_detected"}`, DeadLetterReasonInvalidEvent},
+		{"missing event id", `{"context": {"correlationId": "2"}}`, DeadLetterReasonInvalidEvent},
+		{"missing correlation id", `{"context": {"eventId": "1"}}`, DeadLetterReasonInvalidEvent},
+		{"structured cloudevent", `{"specversion": "1.0", "id": "1", "correlationid": "2", "type": "face_detected", "source": "/ion/module"}`, ""},
+		{"unsupported cloudevents version", `{"specversion": "0.3", "id": "1", "correlationid": "2", "type": "face_detected"}`, DeadLetterReasonMalformedEvent},
+		{"cloudevent missing correlation id", `{"specversion": "1.0", "id": "1", "type": "face_detected", "source": "/ion/module"}`, DeadLetterReasonInvalidEvent},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewAmqpMessageWrapper(amqp.NewMessage([]byte(test.body)))
+			_, err := m.EventData()
+			if test.expectedReason == "" {
+				if err != nil {
+					t.Errorf("Expected no error Got: %v", err)
+				}
+				return
+			}
+
+			poisonErr, ok := err.(*PoisonMessageError)
+			if !ok {
+				t.Fatalf("Expected PoisonMessageError Got: %v", err)
+			}
+			if poisonErr.Reason != test.expectedReason {
+				t.Errorf("Reason incorrect Expected: %v Got: %v", test.expectedReason, poisonErr.Reason)
+			}
+		})
+	}
+}
+
+func TestEventDataBinaryCloudEvent(t *testing.T) {
+	event := common.Event{
+		Type: "face_detected",
+		Context: &common.Context{
+			Name:          "module",
+			EventID:       "1",
+			CorrelationID: "2",
+			ParentEventID: "3",
+		},
+		Data: common.KeyValuePairs{{Key: "faces", Value: "4"}},
+	}
+	encoded, err := EncodeEvent(event, EventEncodingCloudEventsBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewAmqpMessageWrapper(NewAmqpEventMessage(encoded))
+	decoded, err := m.EventData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, event) {
+		t.Errorf("Event incorrect Expected: %+v Got: %+v", event, decoded)
+	}
+}
+
+func TestParseEventEncoding(t *testing.T) {
+	for name, expected := range map[string]EventEncoding{
+		"":           EventEncodingIon,
+		"ion":        EventEncodingIon,
+		"Structured": EventEncodingCloudEventsStructured,
+		"binary":     EventEncodingCloudEventsBinary,
+	} {
+		encoding, err := ParseEventEncoding(name)
+		if err != nil || encoding != expected {
+			t.Errorf("Encoding '%s' incorrect Expected: %v Got: %v %v", name, expected, encoding, err)
+		}
+	}
+	if _, err := ParseEventEncoding("xml"); err == nil {
+		t.Error("Expected an unknown encoding to fail")
+	}
+}
+
+func TestMaxDeliveryCountExceeded(t *testing.T) {
+	if _, exceeded := MaxDeliveryCountExceeded(&fakeMessage{id: "1", deliveryCount: 4}, 5); exceeded {
+		t.Error("expected a message delivered fewer than the max delivery count times to be requeued")
+	}
+	description, exceeded := MaxDeliveryCountExceeded(&fakeMessage{id: "1", deliveryCount: 5}, 5)
+	if !exceeded || description != "message was delivered 5 times" {
+		t.Errorf("expected the message to be dead lettered but got '%s', %t", description, exceeded)
+	}
+}
+
+func TestSettlement(t *testing.T) {
+	var s Settlement
+	if err := s.Settle(); err != nil {
+		t.Fatalf("error settling message: %+v", err)
+	}
+	if err := s.Settle(); err != ErrAlreadySettled {
+		t.Errorf("expected settling twice to return ErrAlreadySettled but got '%+v'", err)
+	}
+}
@@ -0,0 +1,140 @@
+package messaging
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RetryPolicy configures how long a failed message waits before it's redelivered.
+// The delay for an attempt is `InitialDelay * Multiplier^(attempt-1)` capped at `MaxDelay`,
+// with up to `Jitter` (a fraction between 0 and 1) of the delay removed at random so
+// messages which failed together aren't all redelivered at the same time.
+type RetryPolicy struct {
+	InitialDelay time.Duration
+	Multiplier   float64
+	MaxDelay     time.Duration
+	Jitter       float64
+}
+
+// Delay returns the backoff before redelivering a message which failed on the given attempt,
+// `random` is a number in [0,1) used to apply the jitter
+func (p RetryPolicy) Delay(attempt int, random float64) time.Duration {
+	if p.InitialDelay <= 0 {
+		return 0
+	}
+	if attempt < 1 {
+		attempt = 1
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		delay -= delay * jitter * random
+	}
+	return time.Duration(delay)
+}
+
+// RetryScheduler delays the redelivery of rejected messages. Rejecting a message
+// requeues it straight away so, rather than rejecting, the scheduler holds the message
+// until its backoff has elapsed and only then rejects it. The message keeps its lock
+// while it's held so `Pending` messages must have their locks renewed.
+// The broker increments the delivery count when the message is redelivered, so the
+// attempt number is still available to the job.
+// Held messages are only kept in memory. If the dispatcher restarts the broker redelivers
+// them once their locks expire, without the rest of the delay, and the in-memory broker
+// loses them. They also don't count towards the jobs the dispatcher runs concurrently.
+type RetryScheduler struct {
+	policy           RetryPolicy
+	maxDeliveryCount int
+	mu               sync.Mutex
+	pending          map[string]Message
+	random           func() float64
+	after            func(time.Duration, func())
+}
+
+// NewRetryScheduler creates a scheduler using the policy. A message which has been delivered
+// `maxDeliveryCount` times won't be redelivered so it's rejected without waiting.
+func NewRetryScheduler(policy RetryPolicy, maxDeliveryCount int) *RetryScheduler {
+	return &RetryScheduler{
+		policy:           policy,
+		maxDeliveryCount: maxDeliveryCount,
+		pending:          map[string]Message{},
+		random:           rand.Float64,
+		after: func(d time.Duration, f func()) {
+			time.AfterFunc(d, f)
+		},
+	}
+}
+
+// Wrap returns the message with `Reject` replaced by a delayed reject
+func (s *RetryScheduler) Wrap(m Message) Message {
+	return &retryMessage{
+		Message:   m,
+		scheduler: s,
+	}
+}
+
+// Pending returns the messages waiting to be redelivered
+func (s *RetryScheduler) Pending() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := make([]Message, 0, len(s.pending))
+	for _, m := range s.pending {
+		messages = append(messages, m)
+	}
+	return messages
+}
+
+func (s *RetryScheduler) schedule(m Message) error {
+	if m.DeliveryCount() >= s.maxDeliveryCount {
+		return m.Reject()
+	}
+	delay := s.policy.Delay(m.DeliveryCount(), s.random())
+	if delay <= 0 {
+		return m.Reject()
+	}
+
+	s.mu.Lock()
+	s.pending[m.ID()] = m
+	s.mu.Unlock()
+
+	log.WithField("messageID", m.ID()).WithField("delay", delay.String()).Info("delaying redelivery of failed message")
+	s.after(delay, func() {
+		s.mu.Lock()
+		delete(s.pending, m.ID())
+		s.mu.Unlock()
+
+		err := m.Reject()
+		if err != nil {
+			log.WithError(err).WithField("messageID", m.ID()).Error("failed to reject message after retry delay")
+		}
+	})
+	return nil
+}
+
+// retryMessage is a message whose redelivery is delayed by the scheduler when it's rejected
+type retryMessage struct {
+	Message
+	scheduler *RetryScheduler
+}
+
+// Unwrap returns the message received from the broker
+func (m *retryMessage) Unwrap() Message {
+	return m.Message
+}
+
+// Reject schedule the message to be requeued once its retry delay has elapsed
+func (m *retryMessage) Reject() error {
+	return m.scheduler.schedule(m.Message)
+}
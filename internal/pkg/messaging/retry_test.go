@@ -0,0 +1,107 @@
+package messaging
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+)
+
+type fakeMessage struct {
+	id            string
+	deliveryCount int
+	rejected      int
+}
+
+func (m *fakeMessage) ID() string                                  { return m.id }
+func (m *fakeMessage) DeliveryCount() int                          { return m.deliveryCount }
+func (m *fakeMessage) Body() []byte                                { return nil }
+func (m *fakeMessage) Accept() error                               { return nil }
+func (m *fakeMessage) Reject() error                               { m.rejected++; return nil }
+func (m *fakeMessage) DeadLetter(reason, description string) error { return nil }
+func (m *fakeMessage) EventData() (common.Event, error)            { return common.Event{}, nil }
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{
+		InitialDelay: time.Second * 10,
+		Multiplier:   2,
+		MaxDelay:     time.Second * 60,
+		Jitter:       0.5,
+	}
+
+	testCases := []struct {
+		name     string
+		policy   RetryPolicy
+		attempt  int
+		random   float64
+		expected time.Duration
+	}{
+		{"first attempt", policy, 1, 0, time.Second * 10},
+		{"backs off exponentially", policy, 3, 0, time.Second * 40},
+		{"capped at max delay", policy, 5, 0, time.Second * 60},
+		{"jitter removes part of the delay", policy, 2, 0.5, time.Second * 15},
+		{"no initial delay disables backoff", RetryPolicy{Multiplier: 2}, 3, 0, 0},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			delay := test.policy.Delay(test.attempt, test.random)
+			if delay != test.expected {
+				t.Errorf("Delay incorrect Expected: %v Got: %v", test.expected, delay)
+			}
+		})
+	}
+}
+
+func TestRetrySchedulerDelaysReject(t *testing.T) {
+	scheduler := NewRetryScheduler(RetryPolicy{InitialDelay: time.Second * 30, Multiplier: 2}, 5)
+	scheduler.random = func() float64 { return 0 }
+	var scheduled func()
+	var scheduledDelay time.Duration
+	scheduler.after = func(d time.Duration, f func()) {
+		scheduledDelay = d
+		scheduled = f
+	}
+
+	original := &fakeMessage{id: "1", deliveryCount: 2}
+	err := scheduler.Wrap(original).Reject()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if original.rejected != 0 {
+		t.Error("Expected reject to be delayed")
+	}
+	if scheduledDelay != time.Minute {
+		t.Errorf("Delay incorrect Expected: %v Got: %v", time.Minute, scheduledDelay)
+	}
+	if len(scheduler.Pending()) != 1 {
+		t.Errorf("Expected message to be pending, Got: %v", len(scheduler.Pending()))
+	}
+
+	scheduled()
+
+	if original.rejected != 1 {
+		t.Errorf("Expected message to be rejected once the delay elapsed, Got: %v rejects", original.rejected)
+	}
+	if len(scheduler.Pending()) != 0 {
+		t.Errorf("Expected no pending messages, Got: %v", len(scheduler.Pending()))
+	}
+}
+
+func TestRetrySchedulerRejectsFinalAttemptImmediately(t *testing.T) {
+	scheduler := NewRetryScheduler(RetryPolicy{InitialDelay: time.Second * 30}, 3)
+	scheduler.after = func(d time.Duration, f func()) {
+		t.Error("Expected final attempt not to be delayed")
+	}
+
+	original := &fakeMessage{id: "1", deliveryCount: 3}
+	err := scheduler.Wrap(original).Reject()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if original.rejected != 1 {
+		t.Errorf("Expected message to be rejected immediately, Got: %v rejects", original.rejected)
+	}
+}
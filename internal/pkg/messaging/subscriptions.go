@@ -0,0 +1,228 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+)
+
+// SplitEventTypes returns the event types in a comma delimited list, such as
+// a module's `subscribestoevent`, with empty entries and duplicates removed
+func SplitEventTypes(list string) []string {
+	var eventTypes []string
+	seen := map[string]bool{}
+	for _, eventType := range strings.Split(list, ",") {
+		eventType = strings.TrimSpace(eventType)
+		if eventType == "" || seen[strings.ToLower(eventType)] {
+			continue
+		}
+		seen[strings.ToLower(eventType)] = true
+		eventTypes = append(eventTypes, eventType)
+	}
+	return eventTypes
+}
+
+// SubscriptionsBroker receives from a broker per event type a module subscribes to.
+// Each subscription has a receiver which passes its messages to `Receive`, so a
+// receiver holds at most one message while the dispatcher is busy. The locks on held
+// messages are renewed along with the messages passed to `RenewLocks`.
+// Events are published through the first subscription's broker.
+type SubscriptionsBroker struct {
+	brokers    []Broker
+	eventTypes []string
+
+	startOnce sync.Once
+	received  chan receivedMessage
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	mu   sync.Mutex
+	held []Message
+}
+
+type receivedMessage struct {
+	message Message
+	err     error
+}
+
+//Check at compile time if we implement the interface
+var _ Broker = (*SubscriptionsBroker)(nil)
+
+// NewSubscriptionsBroker combines the brokers for each of the event types, `brokers[i]` receives `eventTypes[i]`
+func NewSubscriptionsBroker(eventTypes []string, brokers []Broker) *SubscriptionsBroker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SubscriptionsBroker{
+		brokers:    brokers,
+		eventTypes: eventTypes,
+		received:   make(chan receivedMessage),
+		held:       make([]Message, len(brokers)),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Receive blocks until a message is available on any of the module's subscriptions
+func (s *SubscriptionsBroker) Receive(ctx context.Context) (Message, error) {
+	s.startOnce.Do(func() {
+		for i := range s.brokers {
+			go s.receive(i)
+		}
+	})
+	select {
+	case r := <-s.received:
+		if m, ok := r.message.(*subscriptionMessage); ok {
+			s.release(m)
+		}
+		return r.message, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// receive passes the messages from one subscription to `Receive` until the broker is closed
+func (s *SubscriptionsBroker) receive(subscription int) {
+	for {
+		message, err := s.brokers[subscription].Receive(s.ctx)
+		if s.ctx.Err() != nil {
+			return
+		}
+		r := receivedMessage{err: err}
+		if err != nil {
+			r.err = fmt.Errorf("error receiving from subscription to '%s': %v", s.eventTypes[subscription], err)
+		} else {
+			r.message = &subscriptionMessage{Message: message, subscription: subscription, eventType: s.eventTypes[subscription]}
+		}
+		s.hold(subscription, r.message)
+		select {
+		case s.received <- r:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// hold records the message a subscription's receiver is waiting to pass to `Receive`
+func (s *SubscriptionsBroker) hold(subscription int, message Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.held[subscription] = message
+}
+
+// release stops renewing the lock on a message once `Receive` has returned it, the
+// receiver may already be holding the subscription's next message
+func (s *SubscriptionsBroker) release(m *subscriptionMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.held[m.subscription] == Message(m) {
+		s.held[m.subscription] = nil
+	}
+}
+
+// RenewLocks renews the locks on each message, and the messages held by the receivers,
+// with the broker it was received from
+func (s *SubscriptionsBroker) RenewLocks(ctx context.Context, messages []Message) error {
+	bySubscription := make([][]Message, len(s.brokers))
+	for _, message := range messages {
+		m, ok := findSubscriptionMessage(message)
+		if !ok {
+			return fmt.Errorf("message %s wasn't received from one of the module's subscriptions", message.ID())
+		}
+		bySubscription[m.subscription] = append(bySubscription[m.subscription], message)
+	}
+	s.mu.Lock()
+	for i, message := range s.held {
+		if message != nil {
+			bySubscription[i] = append(bySubscription[i], message)
+		}
+	}
+	s.mu.Unlock()
+	var errs []string
+	for i, subscriptionMessages := range bySubscription {
+		if len(subscriptionMessages) == 0 {
+			continue
+		}
+		if err := s.brokers[i].RenewLocks(ctx, subscriptionMessages); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", s.eventTypes[i], err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed renewing locks on subscriptions %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Publish sends an event to the topic for the event's type
+func (s *SubscriptionsBroker) Publish(ctx context.Context, event common.Event) error {
+	return s.brokers[0].Publish(ctx, event)
+}
+
+// GetQueueDepth returns the total number of messages waiting on, and dead lettered from, the module's subscriptions
+func (s *SubscriptionsBroker) GetQueueDepth() (MessageCountDetails, error) {
+	total := MessageCountDetails{}
+	for i, broker := range s.brokers {
+		details, err := broker.GetQueueDepth()
+		if err != nil {
+			return total, fmt.Errorf("failed getting queue depth of subscription to '%s': %v", s.eventTypes[i], err)
+		}
+		total.ActiveMessageCount += details.ActiveMessageCount
+		total.DeadLetterMessageCount += details.DeadLetterMessageCount
+	}
+	return total, nil
+}
+
+// HandlerArgs returns the args which configure the handler to publish events to the broker
+func (s *SubscriptionsBroker) HandlerArgs() []string {
+	return s.brokers[0].HandlerArgs()
+}
+
+// Close stops receiving and closes the broker for each subscription
+func (s *SubscriptionsBroker) Close() error {
+	s.cancel()
+	var firstErr error
+	for _, broker := range s.brokers {
+		if err := broker.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// subscriptionMessage records which of the module's subscriptions a message was received from
+type subscriptionMessage struct {
+	Message
+	subscription int
+	eventType    string
+}
+
+// Unwrap returns the message received from the subscription's broker
+func (m *subscriptionMessage) Unwrap() Message {
+	return m.Message
+}
+
+// EventData returns the message's event, an event without a type takes the type of its subscription
+func (m *subscriptionMessage) EventData() (common.Event, error) {
+	event, err := m.Message.EventData()
+	if err == nil && event.Type == "" {
+		event.Type = m.eventType
+	}
+	return event, err
+}
+
+// findSubscriptionMessage returns the subscriptionMessage a message has been wrapped around
+func findSubscriptionMessage(m Message) (*subscriptionMessage, bool) {
+	for {
+		if sm, ok := m.(*subscriptionMessage); ok {
+			return sm, true
+		}
+		wrapper, ok := m.(interface {
+			Unwrap() Message
+		})
+		if !ok {
+			return nil, false
+		}
+		m = wrapper.Unwrap()
+	}
+}
@@ -0,0 +1,132 @@
+package messaging
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+)
+
+type fakeBroker struct {
+	messages chan Message
+	renewed  []string
+	depth    MessageCountDetails
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{messages: make(chan Message, 10)}
+}
+
+func (b *fakeBroker) Receive(ctx context.Context) (Message, error) {
+	select {
+	case m := <-b.messages:
+		return m, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (b *fakeBroker) RenewLocks(ctx context.Context, messages []Message) error {
+	for _, m := range messages {
+		b.renewed = append(b.renewed, m.ID())
+	}
+	return nil
+}
+
+func (b *fakeBroker) Publish(ctx context.Context, event common.Event) error { return nil }
+func (b *fakeBroker) GetQueueDepth() (MessageCountDetails, error)           { return b.depth, nil }
+func (b *fakeBroker) HandlerArgs() []string                                 { return nil }
+func (b *fakeBroker) Close() error                                          { return nil }
+
+func TestSplitEventTypes(t *testing.T) {
+	actual := SplitEventTypes(" face_detected,,frame_extracted , Face_Detected")
+	expected := []string{"face_detected", "frame_extracted"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected: %v Got: %v", expected, actual)
+	}
+}
+
+func TestSubscriptionsBrokerReceivesFromEverySubscription(t *testing.T) {
+	faces, frames := newFakeBroker(), newFakeBroker()
+	faces.depth = MessageCountDetails{ActiveMessageCount: 2, DeadLetterMessageCount: 1}
+	frames.depth = MessageCountDetails{ActiveMessageCount: 3}
+	broker := NewSubscriptionsBroker([]string{"face_detected", "frame_extracted"}, []Broker{faces, frames})
+	defer broker.Close() //nolint: errcheck
+
+	faces.messages <- &fakeMessage{id: "face"}
+	frames.messages <- &fakeMessage{id: "frame"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	eventTypes := map[string]string{}
+	var received []Message
+	for i := 0; i < 2; i++ {
+		m, err := broker.Receive(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		event, err := m.EventData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		eventTypes[m.ID()] = event.Type
+		received = append(received, m)
+	}
+	expected := map[string]string{"face": "face_detected", "frame": "frame_extracted"}
+	if !reflect.DeepEqual(eventTypes, expected) {
+		t.Errorf("Expected each message to have its subscription's event type Expected: %v Got: %v", expected, eventTypes)
+	}
+
+	// Locks are renewed with the broker each message came from, even once it's wrapped by the retry scheduler
+	retries := NewRetryScheduler(RetryPolicy{}, 5)
+	err := broker.RenewLocks(ctx, []Message{retries.Wrap(received[0]), received[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(faces.renewed, []string{"face"}) || !reflect.DeepEqual(frames.renewed, []string{"frame"}) {
+		t.Errorf("Expected locks to be renewed by their own broker Got: faces %v frames %v", faces.renewed, frames.renewed)
+	}
+
+	depth, err := broker.GetQueueDepth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth.ActiveMessageCount != 5 || depth.DeadLetterMessageCount != 1 {
+		t.Errorf("Expected the queue depth of every subscription to be summed Got: %+v", depth)
+	}
+}
+
+func TestSubscriptionsBrokerRenewsHeldMessages(t *testing.T) {
+	faces := newFakeBroker()
+	broker := NewSubscriptionsBroker([]string{"face_detected"}, []Broker{faces})
+	defer broker.Close() //nolint: errcheck
+
+	faces.messages <- &fakeMessage{id: "face1"}
+	faces.messages <- &fakeMessage{id: "face2"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if _, err := broker.Receive(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The receiver holds the second message until Receive is called again
+	for {
+		if err := broker.RenewLocks(ctx, nil); err != nil {
+			t.Fatal(err)
+		}
+		if len(faces.renewed) > 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("Expected the lock on the held message to be renewed")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	if !reflect.DeepEqual(faces.renewed, []string{"face2"}) {
+		t.Errorf("Expected only the held message's lock to be renewed Got: %v", faces.renewed)
+	}
+}
@@ -0,0 +1,627 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/pkg/cloudevents"
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+	"github.com/lawrencegripper/ion/internal/pkg/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+// cSpell:ignore amqp, nack, qos
+
+// BrokerName is the name used to select RabbitMQ as the dispatcher's broker
+const BrokerName = "rabbitmq"
+
+const (
+	// deadLetterExchange routes dead lettered messages, by the name of the queue they were
+	// dead lettered from, to that queue's dead letter queue
+	deadLetterExchange    = "ion.deadletter"
+	deadLetterQueueSuffix = ".deadletter"
+
+	// deliveryCountHeader counts the deliveries of a rejected message which has been republished,
+	// classic queues only record whether a message has been delivered before
+	deliveryCountHeader = "DeliveryCount"
+
+	// defaultPrefetchCount is the number of unacknowledged messages delivered to the
+	// dispatcher when it doesn't limit the number of concurrent jobs
+	defaultPrefetchCount = 100
+	// settleTimeout is how long republishing a rejected or dead lettered message may take
+	settleTimeout = time.Duration(30) * time.Second
+)
+
+func init() {
+	messaging.RegisterBroker(BrokerName, func(ctx context.Context, config *types.Configuration) (messaging.Broker, error) {
+		return NewBroker(config)
+	})
+}
+
+// Publisher publishes events to the exchange for their type and waits for RabbitMQ to confirm them.
+// The connection is re-established the next time a message is published after it's lost.
+type Publisher struct {
+	url           string
+	eventEncoding messaging.EventEncoding
+	mu            sync.Mutex
+	conn          *amqp.Connection
+	channel       *amqp.Channel
+	confirms      chan amqp.Confirmation
+	exchanges     map[string]bool
+}
+
+//Check at compile time if we implement the interface
+var _ messaging.Publisher = (*Publisher)(nil)
+
+// NewPublisher connects to the RabbitMQ server
+func NewPublisher(url string, eventEncoding messaging.EventEncoding) (*Publisher, error) {
+	p := &Publisher{
+		url:           url,
+		eventEncoding: eventEncoding,
+		exchanges:     map[string]bool{},
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.ensureChannel(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Publish sends the event to the exchange for its type, which copies it to the queue of
+// every module subscribed to the event. In CloudEvents binary mode the attributes are set as
+// headers prefixed like the properties of the CloudEvents AMQP binding.
+func (p *Publisher) Publish(ctx context.Context, event common.Event) error {
+	encoded, err := messaging.EncodeEvent(event, p.eventEncoding)
+	if err != nil {
+		return err
+	}
+	msg := amqp.Publishing{
+		ContentType:  encoded.ContentType,
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    time.Now(),
+		Body:         encoded.Body,
+	}
+	if len(encoded.Attributes) > 0 {
+		msg.Headers = make(amqp.Table, len(encoded.Attributes))
+		for name, value := range encoded.Attributes {
+			msg.Headers[cloudevents.AMQPPropertyPrefix+name] = value
+		}
+	}
+	if event.Context != nil {
+		msg.MessageId = event.Context.EventID
+		msg.CorrelationId = event.Context.CorrelationID
+	}
+
+	exchange := getExchangeName(event.Type)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.declareExchange(exchange); err != nil {
+		return err
+	}
+	return p.publish(ctx, exchange, "", msg)
+}
+
+// Close closes the connection and its channels
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil || p.conn.IsClosed() {
+		return nil
+	}
+	return p.conn.Close()
+}
+
+// send publishes the message and waits for it to be confirmed
+func (p *Publisher) send(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.publish(ctx, exchange, key, msg)
+}
+
+// openChannel opens a channel which isn't used to publish. RabbitMQ closes a channel when
+// an operation on it fails so the publishing channel isn't shared.
+func (p *Publisher) openChannel() (*amqp.Channel, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conn, err := p.connection()
+	if err != nil {
+		return nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("error opening rabbitmq channel: %+v", err)
+	}
+	return ch, nil
+}
+
+// withChannel runs the func on a new channel which is closed when it returns
+func (p *Publisher) withChannel(fn func(ch *amqp.Channel) error) error {
+	ch, err := p.openChannel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close() //nolint: errcheck
+	return fn(ch)
+}
+
+// connection returns the connection, dialing the server if it's closed. Callers must hold the lock.
+func (p *Publisher) connection() (*amqp.Connection, error) {
+	if p.conn != nil && !p.conn.IsClosed() {
+		return p.conn, nil
+	}
+	conn, err := amqp.Dial(p.url)
+	if err != nil {
+		// The url isn't logged as it usually contains credentials
+		return nil, fmt.Errorf("error connecting to rabbitmq server: %+v", err)
+	}
+	p.conn = conn
+	p.channel = nil
+	return conn, nil
+}
+
+// ensureChannel opens the channel used to publish, in confirm mode, if it isn't open. Callers must hold the lock.
+func (p *Publisher) ensureChannel() error {
+	conn, err := p.connection()
+	if err != nil {
+		return err
+	}
+	if p.channel != nil {
+		return nil
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("error opening rabbitmq channel: %+v", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close() //nolint: errcheck
+		return fmt.Errorf("error enabling publisher confirms: %+v", err)
+	}
+	p.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	p.channel = ch
+	return nil
+}
+
+// resetChannel closes the publishing channel so the next message is published on a new one.
+// Callers must hold the lock.
+func (p *Publisher) resetChannel() {
+	if p.channel != nil {
+		p.channel.Close() //nolint: errcheck
+		p.channel = nil
+	}
+}
+
+// declareExchange creates the fanout exchange for an event type if it doesn't exist. Callers must hold the lock.
+func (p *Publisher) declareExchange(name string) error {
+	if err := p.ensureChannel(); err != nil {
+		return err
+	}
+	if p.exchanges[name] {
+		return nil
+	}
+	if err := p.channel.ExchangeDeclare(name, amqp.ExchangeFanout, true, false, false, false, nil); err != nil {
+		p.resetChannel()
+		return fmt.Errorf("error declaring exchange %s: %+v", name, err)
+	}
+	p.exchanges[name] = true
+	return nil
+}
+
+// publish sends the message and waits for the server to confirm it. Callers must hold the lock.
+func (p *Publisher) publish(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+	if err := p.ensureChannel(); err != nil {
+		return err
+	}
+	if err := p.channel.Publish(exchange, key, false, false, msg); err != nil {
+		p.resetChannel()
+		return fmt.Errorf("error publishing message to exchange '%s': %+v", exchange, err)
+	}
+	select {
+	case confirm, ok := <-p.confirms:
+		if !ok {
+			p.resetChannel()
+			return fmt.Errorf("channel closed before message to exchange '%s' was confirmed", exchange)
+		}
+		if !confirm.Ack {
+			return fmt.Errorf("rabbitmq refused message to exchange '%s'", exchange)
+		}
+		return nil
+	case <-ctx.Done():
+		// A late confirmation would be taken for the next message's, so start again on a new channel
+		p.resetChannel()
+		return ctx.Err()
+	}
+}
+
+// Broker receives the module's events from its queue, which is bound to the exchange for the
+// event type. Messages are dead lettered to the queue's dead letter queue through the dead
+// letter exchange once they've been rejected `RetryCount` times.
+type Broker struct {
+	*Publisher
+	queueName        string
+	deadLetterQueue  string
+	prefetchCount    int
+	maxDeliveryCount int
+	consumeMu        sync.Mutex
+	deliveries       <-chan amqp.Delivery
+	inFlight         int64
+	handlerArgs      []string
+	publishMessage   func(ctx context.Context, exchange, key string, msg amqp.Publishing) error
+}
+
+//Check at compile time if we implement the interface
+var _ messaging.Broker = (*Broker)(nil)
+
+// NewBroker connects to the RabbitMQ server, declares the module's queue and dead letter queue
+// if they don't exist and starts consuming from the queue
+func NewBroker(config *types.Configuration) (*Broker, error) {
+	if config.SubscribesToEvent == "" || config.ModuleName == "" {
+		return nil, fmt.Errorf("subscribestoevent and modulename are required")
+	}
+	if config.RabbitMQ == nil || config.RabbitMQ.URL == "" {
+		return nil, fmt.Errorf("rabbitmq.url is required")
+	}
+	maxDeliveryCount := 1
+	maxConcurrent := 0
+	if config.Job != nil {
+		maxDeliveryCount = config.Job.RetryCount + 1
+		maxConcurrent = config.Job.MaxConcurrent
+	}
+
+	eventEncoding, err := messaging.ParseEventEncoding(config.EventEncoding)
+	if err != nil {
+		return nil, err
+	}
+	publisher, err := NewPublisher(config.RabbitMQ.URL, eventEncoding)
+	if err != nil {
+		return nil, err
+	}
+
+	queueName := getQueueName(config.SubscribesToEvent, config.ModuleName)
+	b := &Broker{
+		Publisher:        publisher,
+		queueName:        queueName,
+		deadLetterQueue:  queueName + deadLetterQueueSuffix,
+		prefetchCount:    getPrefetchCount(maxConcurrent),
+		maxDeliveryCount: maxDeliveryCount,
+		handlerArgs: []string{
+			"--rabbitmqeventprovider.enabled=true",
+			"--rabbitmqeventprovider.url=" + config.RabbitMQ.URL,
+		},
+		publishMessage: publisher.send,
+	}
+
+	err = publisher.withChannel(func(ch *amqp.Channel) error {
+		return declareTopology(ch, getExchangeName(config.SubscribesToEvent), b.queueName, b.deadLetterQueue)
+	})
+	if err != nil {
+		publisher.Close() //nolint: errcheck
+		return nil, err
+	}
+
+	b.consumeMu.Lock()
+	defer b.consumeMu.Unlock()
+	if err := b.consume(); err != nil {
+		publisher.Close() //nolint: errcheck
+		return nil, err
+	}
+	return b, nil
+}
+
+// consume opens a channel and starts consuming from the module's queue. Callers must hold consumeMu.
+func (b *Broker) consume() error {
+	ch, err := b.openChannel()
+	if err != nil {
+		return err
+	}
+	if err := ch.Qos(b.prefetchCount, 0, false); err != nil {
+		ch.Close() //nolint: errcheck
+		return fmt.Errorf("error setting prefetch count: %+v", err)
+	}
+	deliveries, err := ch.Consume(b.queueName, "", false, false, false, false, nil)
+	if err != nil {
+		ch.Close() //nolint: errcheck
+		return fmt.Errorf("error consuming from queue %s: %+v", b.queueName, err)
+	}
+	b.deliveries = deliveries
+	return nil
+}
+
+// getDeliveries returns the consumer's deliveries, consuming again if the consumer's channel was closed
+func (b *Broker) getDeliveries() (<-chan amqp.Delivery, error) {
+	b.consumeMu.Lock()
+	defer b.consumeMu.Unlock()
+	if b.deliveries == nil {
+		if err := b.consume(); err != nil {
+			return nil, err
+		}
+	}
+	return b.deliveries, nil
+}
+
+// Receive blocks until a message is delivered from the module's queue
+func (b *Broker) Receive(ctx context.Context) (messaging.Message, error) {
+	deliveries, err := b.getDeliveries()
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case delivery, ok := <-deliveries:
+		if !ok {
+			b.consumeMu.Lock()
+			if b.deliveries == deliveries {
+				b.deliveries = nil
+			}
+			b.consumeMu.Unlock()
+			return nil, fmt.Errorf("consumer for queue %s was closed, unacknowledged messages will be redelivered", b.queueName)
+		}
+		atomic.AddInt64(&b.inFlight, 1)
+		return &Message{
+			delivery: delivery,
+			broker:   b,
+		}, nil
+	}
+}
+
+// RenewLocks checks the messages were received from the broker. RabbitMQ doesn't lock messages,
+// an unacknowledged message is redelivered once the channel it was delivered on is closed.
+func (b *Broker) RenewLocks(ctx context.Context, messages []messaging.Message) error {
+	return messaging.CheckReceived(messages, func(message messaging.Message) bool {
+		m, ok := message.(*Message)
+		return ok && m.broker == b
+	})
+}
+
+// GetQueueDepth returns the number of messages waiting on, or being processed from, the module's
+// queue and the number of messages on its dead letter queue
+func (b *Broker) GetQueueDepth() (messaging.MessageCountDetails, error) {
+	var queue, deadLetters amqp.Queue
+	err := b.withChannel(func(ch *amqp.Channel) error {
+		var err error
+		queue, err = ch.QueueInspect(b.queueName)
+		if err != nil {
+			return fmt.Errorf("error inspecting queue %s: %+v", b.queueName, err)
+		}
+		deadLetters, err = ch.QueueInspect(b.deadLetterQueue)
+		if err != nil {
+			return fmt.Errorf("error inspecting queue %s: %+v", b.deadLetterQueue, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return messaging.MessageCountDetails{}, err
+	}
+	return messaging.MessageCountDetails{
+		// The queue only counts messages which haven't been delivered
+		ActiveMessageCount:     int64(queue.Messages) + atomic.LoadInt64(&b.inFlight),
+		DeadLetterMessageCount: int64(deadLetters.Messages),
+	}, nil
+}
+
+// HandlerArgs returns the args which configure the handler to publish events to the RabbitMQ server
+func (b *Broker) HandlerArgs() []string {
+	return b.handlerArgs
+}
+
+// Close closes the connection, unacknowledged messages are redelivered to the queue's next consumer
+func (b *Broker) Close() error {
+	return b.Publisher.Close()
+}
+
+// settled records that a message is no longer being processed
+func (b *Broker) settled() {
+	atomic.AddInt64(&b.inFlight, -1)
+}
+
+// redeliver publishes a copy of the message, with its delivery count incremented, to the back
+// of the queue then acknowledges the original
+func (b *Broker) redeliver(m *Message) error {
+	headers := copyHeaders(m.delivery.Headers)
+	headers[deliveryCountHeader] = int32(m.DeliveryCount() + 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), settleTimeout)
+	defer cancel()
+	// Publishing to the default exchange routes the message straight to the named queue
+	err := b.publishMessage(ctx, "", b.queueName, toPublishing(m.delivery, headers))
+	if err != nil {
+		log.WithError(err).WithField("messageID", m.ID()).Warn("failed to republish rejected message, requeueing it")
+		return m.delivery.Nack(false, true)
+	}
+	return m.delivery.Ack(false)
+}
+
+// deadLetter publishes a copy of the message, with headers recording why it was dead lettered, to
+// the dead letter exchange then acknowledges the original. If that fails the message is rejected
+// without requeueing, so RabbitMQ routes it to the dead letter exchange the queue was declared with.
+func (b *Broker) deadLetter(m *Message, reason, description string) error {
+	headers := copyHeaders(m.delivery.Headers)
+	headers[messaging.DeadLetterReasonProperty] = reason
+	headers[messaging.DeadLetterDescriptionProperty] = description
+
+	ctx, cancel := context.WithTimeout(context.Background(), settleTimeout)
+	defer cancel()
+	err := b.publishMessage(ctx, deadLetterExchange, b.queueName, toPublishing(m.delivery, headers))
+	if err != nil {
+		log.WithError(err).WithField("messageID", m.ID()).Warn("failed to publish dead letter, rejecting message to the dead letter exchange")
+		return m.delivery.Nack(false, false)
+	}
+	return m.delivery.Ack(false)
+}
+
+// Message is a delivery of an event from the module's queue
+type Message struct {
+	delivery   amqp.Delivery
+	settlement messaging.Settlement
+	broker     *Broker
+}
+
+//Check at compile time if we implement the interface
+var _ messaging.Message = (*Message)(nil)
+
+// ID get the ID, this is the ID of the event the message was published for which doesn't change
+// when it's redelivered
+func (m *Message) ID() string {
+	if m.delivery.MessageId != "" {
+		return m.delivery.MessageId
+	}
+	return strconv.FormatUint(m.delivery.DeliveryTag, 10)
+}
+
+// DeliveryCount get number of times the message has been delivered
+func (m *Message) DeliveryCount() int {
+	return getDeliveryCount(m.delivery)
+}
+
+// Body get the body
+func (m *Message) Body() []byte {
+	return m.delivery.Body
+}
+
+// Accept mark the message as processed successfully (don't re-queue)
+func (m *Message) Accept() error {
+	if err := m.settle(); err != nil {
+		return err
+	}
+	return m.delivery.Ack(false)
+}
+
+// Reject mark message to be requeued, it's dead lettered once its max delivery count is reached
+func (m *Message) Reject() error {
+	if err := m.settle(); err != nil {
+		return err
+	}
+	if description, exceeded := messaging.MaxDeliveryCountExceeded(m, m.broker.maxDeliveryCount); exceeded {
+		return m.broker.deadLetter(m, messaging.DeadLetterReasonMaxDeliveryCountExceeded, description)
+	}
+	return m.broker.redeliver(m)
+}
+
+// DeadLetter move the message to the dead letter queue, recording why it couldn't be processed
+func (m *Message) DeadLetter(reason, description string) error {
+	if err := m.settle(); err != nil {
+		return err
+	}
+	return m.broker.deadLetter(m, reason, description)
+}
+
+// EventData deserialize json value to type
+func (m *Message) EventData() (common.Event, error) {
+	headers := map[string]string{}
+	for key, value := range m.delivery.Headers {
+		if s, ok := value.(string); ok {
+			headers[key] = s
+		}
+	}
+	return messaging.DecodeEventWithHeaders(headers, m.delivery.Body)
+}
+
+// settle marks the message as settled so it no longer counts as in flight
+func (m *Message) settle() error {
+	if err := m.settlement.Settle(); err != nil {
+		return err
+	}
+	m.broker.settled()
+	return nil
+}
+
+// declareTopology declares the event's exchange, the module's queue bound to it and the module's
+// dead letter queue bound to the dead letter exchange
+func declareTopology(ch *amqp.Channel, exchange, queueName, deadLetterQueue string) error {
+	if err := ch.ExchangeDeclare(exchange, amqp.ExchangeFanout, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("error declaring exchange %s: %+v", exchange, err)
+	}
+	if err := ch.ExchangeDeclare(deadLetterExchange, amqp.ExchangeDirect, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("error declaring exchange %s: %+v", deadLetterExchange, err)
+	}
+	_, err := ch.QueueDeclare(queueName, true, false, false, false, getQueueArgs(queueName))
+	if err != nil {
+		return fmt.Errorf("error declaring queue %s: %+v", queueName, err)
+	}
+	if err := ch.QueueBind(queueName, "", exchange, false, nil); err != nil {
+		return fmt.Errorf("error binding queue %s to exchange %s: %+v", queueName, exchange, err)
+	}
+	if _, err := ch.QueueDeclare(deadLetterQueue, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("error declaring queue %s: %+v", deadLetterQueue, err)
+	}
+	if err := ch.QueueBind(deadLetterQueue, queueName, deadLetterExchange, false, nil); err != nil {
+		return fmt.Errorf("error binding queue %s to exchange %s: %+v", deadLetterQueue, deadLetterExchange, err)
+	}
+	return nil
+}
+
+// getQueueArgs returns the args for a module's queue, messages rejected without being requeued
+// are routed to the dead letter exchange with the queue's name as their routing key
+func getQueueArgs(queueName string) amqp.Table {
+	return amqp.Table{
+		"x-dead-letter-exchange":    deadLetterExchange,
+		"x-dead-letter-routing-key": queueName,
+	}
+}
+
+// getPrefetchCount returns the number of unacknowledged messages RabbitMQ delivers to the dispatcher.
+// Messages count until they're settled so, when the dispatcher limits concurrent jobs, one more
+// than the limit is prefetched to have a message ready when a job completes.
+func getPrefetchCount(maxConcurrent int) int {
+	if maxConcurrent > 0 {
+		return maxConcurrent + 1
+	}
+	return defaultPrefetchCount
+}
+
+// getDeliveryCount returns the deliveries recorded on a republished message, plus one if
+// RabbitMQ has redelivered it since
+func getDeliveryCount(delivery amqp.Delivery) int {
+	count := 1
+	switch v := delivery.Headers[deliveryCountHeader].(type) {
+	case int32:
+		count = int(v)
+	case int64:
+		count = int(v)
+	case int:
+		count = v
+	}
+	if delivery.Redelivered {
+		count++
+	}
+	return count
+}
+
+// toPublishing copies a delivered message so it can be published again
+func toPublishing(delivery amqp.Delivery, headers amqp.Table) amqp.Publishing {
+	return amqp.Publishing{
+		Headers:       headers,
+		ContentType:   delivery.ContentType,
+		DeliveryMode:  amqp.Persistent,
+		CorrelationId: delivery.CorrelationId,
+		MessageId:     delivery.MessageId,
+		Timestamp:     delivery.Timestamp,
+		Body:          delivery.Body,
+	}
+}
+
+func copyHeaders(headers amqp.Table) amqp.Table {
+	copied := amqp.Table{}
+	for key, value := range headers {
+		copied[key] = value
+	}
+	return copied
+}
+
+// getQueueName returns the queue for a module, it matches the ServiceBus subscription name
+func getQueueName(eventName, moduleName string) string {
+	return strings.ToLower(eventName) + "_" + strings.ToLower(moduleName)
+}
+
+// getExchangeName returns the exchange events of the type are published to, it matches the ServiceBus topic name
+func getExchangeName(eventName string) string {
+	return strings.ToLower(eventName)
+}
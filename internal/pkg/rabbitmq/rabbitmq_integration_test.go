@@ -0,0 +1,82 @@
+package rabbitmq
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/ion/internal/app/dispatcher/helpers"
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/types"
+)
+
+func TestIntegrationRejectThenDeadLetter(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode...")
+	}
+	url := os.Getenv("RABBITMQ_URL")
+	if url == "" {
+		t.Skip("Skipping integration test, RABBITMQ_URL isn't set")
+	}
+
+	b, err := NewBroker(&types.Configuration{
+		ModuleName:        helpers.RandomName(8),
+		SubscribesToEvent: "ExampleEvent",
+		RabbitMQ: &types.RabbitMQConfig{
+			URL: url,
+		},
+		Job: &types.JobConfig{
+			RetryCount: 1,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close() //nolint: errcheck
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
+	defer cancel()
+
+	eventID := helpers.RandomName(12)
+	err = b.Publish(ctx, common.Event{
+		Type: "ExampleEvent",
+		Context: &common.Context{
+			EventID:       eventID,
+			CorrelationID: "correlation1",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := b.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.ID() != eventID || m.DeliveryCount() != 1 {
+		t.Errorf("Expected event %s on its first delivery Got: %s delivery %d", eventID, m.ID(), m.DeliveryCount())
+	}
+	if err := m.Reject(); err != nil {
+		t.Fatal(err)
+	}
+
+	redelivered, err := b.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redelivered.ID() != eventID || redelivered.DeliveryCount() != 2 {
+		t.Errorf("Expected event %s to be redelivered Got: %s delivery %d", eventID, redelivered.ID(), redelivered.DeliveryCount())
+	}
+	if err := redelivered.Reject(); err != nil {
+		t.Fatal(err)
+	}
+
+	depth, err := b.GetQueueDepth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth.ActiveMessageCount != 0 || depth.DeadLetterMessageCount != 1 {
+		t.Errorf("Expected the message to be dead lettered Got: %+v", depth)
+	}
+}
@@ -0,0 +1,177 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+	"github.com/streadway/amqp"
+)
+
+type fakeAcknowledger struct {
+	acked   bool
+	nacked  bool
+	requeue bool
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.acked = true
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.nacked = true
+	a.requeue = requeue
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+type published struct {
+	exchange string
+	key      string
+	msg      amqp.Publishing
+}
+
+func newTestBroker(maxDeliveryCount int, publishErr error) (*Broker, *[]published) {
+	sent := &[]published{}
+	b := &Broker{
+		queueName:        "face_detected_module",
+		deadLetterQueue:  "face_detected_module" + deadLetterQueueSuffix,
+		maxDeliveryCount: maxDeliveryCount,
+		publishMessage: func(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+			if publishErr != nil {
+				return publishErr
+			}
+			*sent = append(*sent, published{exchange: exchange, key: key, msg: msg})
+			return nil
+		},
+	}
+	return b, sent
+}
+
+func newTestMessage(b *Broker, headers amqp.Table) (*Message, *fakeAcknowledger) {
+	ack := &fakeAcknowledger{}
+	return &Message{
+		delivery: amqp.Delivery{
+			Acknowledger: ack,
+			Headers:      headers,
+			MessageId:    "event1",
+			Body:         []byte("body"),
+		},
+		broker: b,
+	}, ack
+}
+
+func TestRejectRepublishesWithIncrementedDeliveryCount(t *testing.T) {
+	b, sent := newTestBroker(3, nil)
+	m, ack := newTestMessage(b, nil)
+
+	if err := m.Reject(); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 1 {
+		t.Fatalf("Expected 1 message to be published Got: %v", len(*sent))
+	}
+	republished := (*sent)[0]
+	if republished.exchange != "" || republished.key != "face_detected_module" {
+		t.Errorf("Expected message to be republished to its queue Got: exchange '%s' key '%s'", republished.exchange, republished.key)
+	}
+	if count := republished.msg.Headers[deliveryCountHeader]; count != int32(2) {
+		t.Errorf("DeliveryCount incorrect Expected: 2 Got: %v", count)
+	}
+	if republished.msg.MessageId != "event1" || string(republished.msg.Body) != "body" {
+		t.Errorf("Republished message incorrect Got: %+v", republished.msg)
+	}
+	if !ack.acked {
+		t.Error("Expected the original message to be acknowledged")
+	}
+	if err := m.Accept(); err != messaging.ErrAlreadySettled {
+		t.Errorf("Expected settling twice to fail Got: %v", err)
+	}
+}
+
+func TestRejectDeadLettersAtMaxDeliveryCount(t *testing.T) {
+	b, sent := newTestBroker(2, nil)
+	m, ack := newTestMessage(b, amqp.Table{deliveryCountHeader: int32(2)})
+
+	if err := m.Reject(); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 1 {
+		t.Fatalf("Expected 1 message to be published Got: %v", len(*sent))
+	}
+	deadLetter := (*sent)[0]
+	if deadLetter.exchange != deadLetterExchange || deadLetter.key != "face_detected_module" {
+		t.Errorf("Expected message to be dead lettered Got: exchange '%s' key '%s'", deadLetter.exchange, deadLetter.key)
+	}
+	if reason := deadLetter.msg.Headers[messaging.DeadLetterReasonProperty]; reason != messaging.DeadLetterReasonMaxDeliveryCountExceeded {
+		t.Errorf("Dead letter reason incorrect Got: %v", reason)
+	}
+	if !ack.acked {
+		t.Error("Expected the original message to be acknowledged")
+	}
+}
+
+func TestDeadLetterRejectsToDeadLetterExchangeWhenPublishFails(t *testing.T) {
+	b, _ := newTestBroker(5, errors.New("channel closed"))
+	m, ack := newTestMessage(b, nil)
+
+	if err := m.DeadLetter(messaging.DeadLetterReasonInvalidEvent, "event has no context"); err != nil {
+		t.Fatal(err)
+	}
+	if ack.acked || !ack.nacked || ack.requeue {
+		t.Errorf("Expected the message to be rejected without requeueing Got: %+v", ack)
+	}
+}
+
+func TestRejectRequeuesWhenRepublishFails(t *testing.T) {
+	b, _ := newTestBroker(5, errors.New("channel closed"))
+	m, ack := newTestMessage(b, nil)
+
+	if err := m.Reject(); err != nil {
+		t.Fatal(err)
+	}
+	if ack.acked || !ack.nacked || !ack.requeue {
+		t.Errorf("Expected the message to be requeued Got: %+v", ack)
+	}
+}
+
+func TestGetDeliveryCount(t *testing.T) {
+	testCases := []struct {
+		name     string
+		delivery amqp.Delivery
+		expected int
+	}{
+		{name: "first delivery", delivery: amqp.Delivery{}, expected: 1},
+		{name: "redelivered", delivery: amqp.Delivery{Redelivered: true}, expected: 2},
+		{name: "republished", delivery: amqp.Delivery{Headers: amqp.Table{deliveryCountHeader: int32(3)}}, expected: 3},
+		{name: "republished then redelivered", delivery: amqp.Delivery{Headers: amqp.Table{deliveryCountHeader: int64(3)}, Redelivered: true}, expected: 4},
+	}
+	for _, test := range testCases {
+		if actual := getDeliveryCount(test.delivery); actual != test.expected {
+			t.Errorf("%s: Expected: %d Got: %d", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestGetPrefetchCount(t *testing.T) {
+	if count := getPrefetchCount(0); count != defaultPrefetchCount {
+		t.Errorf("Expected: %d Got: %d", defaultPrefetchCount, count)
+	}
+	if count := getPrefetchCount(4); count != 5 {
+		t.Errorf("Expected: 5 Got: %d", count)
+	}
+}
+
+func TestGetQueueName(t *testing.T) {
+	const expected = `eventname_modulename`
+	actual := getQueueName("eventName", "moduleName")
+	if actual != expected {
+		t.Logf("Got: %s Expected: %s", actual, expected)
+		t.Fail()
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -16,12 +18,27 @@ import (
 	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/lawrencegripper/ion/internal/app/dispatcher/helpers"
+	"github.com/lawrencegripper/ion/internal/pkg/common"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging"
+	"github.com/lawrencegripper/ion/internal/pkg/messaging/filter"
 	"github.com/lawrencegripper/ion/internal/pkg/types"
 	"pack.ag/amqp"
 )
 
 const serviceBusRootKeyName = "RootManageSharedAccessKey"
 
+// filterRuleName is the name of the subscription rule created from the module's filter
+const filterRuleName = "ion-filter"
+
+// BrokerName is the name used to select ServiceBus as the dispatcher's broker
+const BrokerName = "servicebus"
+
+func init() {
+	messaging.RegisterBroker(BrokerName, func(ctx context.Context, config *types.Configuration) (messaging.Broker, error) {
+		return NewAmqpConnection(ctx, config), nil
+	})
+}
+
 // AmqpConnection provides a connection to service bus and methods for creating required subscriptions and topics
 type AmqpConnection struct {
 	subsClient           *servicebus.SubscriptionsClient
@@ -36,26 +53,25 @@ type AmqpConnection struct {
 	ManagementReceiver   *amqp.Receiver
 	ManagementSender     *amqp.Sender
 	getSubscription      func() (servicebus.SBSubscription, error)
+	handlerArgs          []string
+	sendersMu            sync.Mutex
+	senders              map[string]*amqp.Sender
+	eventEncoding        messaging.EventEncoding
 }
 
-// MessageCountDetails is a mirror of the SB SDK object but without pointers and things we don't need so logrus can
-// log the numbers correctly
-type MessageCountDetails struct {
-	// ActiveMessageCount - Number of active messages in the queue, topic, or subscription.
-	ActiveMessageCount int64
-	// DeadLetterMessageCount - Number of messages that are dead lettered.
-	DeadLetterMessageCount int64
-}
+//Check at compile time if we implement the interface
+var _ messaging.Broker = (*AmqpConnection)(nil)
 
 // GetQueueDepth returns the current length of the sb queue
-func (l *AmqpConnection) GetQueueDepth() (MessageCountDetails, error) {
+func (l *AmqpConnection) GetQueueDepth() (messaging.MessageCountDetails, error) {
 	sub, err := l.getSubscription()
 	if err != nil || sub.MessageCount == nil {
-		return MessageCountDetails{}, err
+		return messaging.MessageCountDetails{}, err
 	}
 
+	// Mirror the SB SDK object but without pointers so logrus can log the numbers correctly
 	details := sub.CountDetails
-	detailsPointerless := MessageCountDetails{}
+	detailsPointerless := messaging.MessageCountDetails{}
 	if details.ActiveMessageCount != nil {
 		detailsPointerless.ActiveMessageCount = *details.ActiveMessageCount
 	}
@@ -86,7 +102,15 @@ func NewAmqpConnection(ctx context.Context, config *types.Configuration) *AmqpCo
 
 	//Todo: close connection to amqp when context is cancelled/done
 
-	listener := AmqpConnection{}
+	eventEncoding, err := messaging.ParseEventEncoding(config.EventEncoding)
+	if err != nil {
+		log.WithError(err).Panic("Invalid event encoding")
+	}
+
+	listener := AmqpConnection{
+		senders:       map[string]*amqp.Sender{},
+		eventEncoding: eventEncoding,
+	}
 	auth := helpers.GetAzureADAuthorizer(config, azure.PublicCloud.ResourceManagerEndpoint)
 	subsClient := servicebus.NewSubscriptionsClient(config.SubscriptionID)
 	subsClient.Authorizer = auth
@@ -100,7 +124,7 @@ func NewAmqpConnection(ctx context.Context, config *types.Configuration) *AmqpCo
 	listener.subsClient = &subsClient
 
 	// Check if resource group exists
-	_, err := groupsClient.Get(ctx, config.ResourceGroup)
+	_, err = groupsClient.Get(ctx, config.ResourceGroup)
 	if err != nil {
 		log.WithField("config", types.RedactConfigSecrets(config)).Panicf("Failed getting resource group: %v", err)
 	}
@@ -121,6 +145,13 @@ func NewAmqpConnection(ctx context.Context, config *types.Configuration) *AmqpCo
 	}
 
 	listener.AccessKeys = keys
+	listener.handlerArgs = []string{
+		"--servicebuseventprovider.enabled=true",
+		"--servicebuseventprovider.namespace=" + config.ServiceBusNamespace,
+		"--servicebuseventprovider.topic=" + config.SubscribesToEvent,
+		"--servicebuseventprovider.key=" + *keys.PrimaryKey,
+		"--servicebuseventprovider.authorizationrulename=" + *keys.KeyName,
+	}
 	listener.AMQPConnectionString = getAmqpConnectionString(*keys.KeyName, *keys.SecondaryKey, *namespace.Name)
 
 	// Check Topic to listen on. Create a topic if missing
@@ -180,10 +211,18 @@ func NewAmqpConnection(ctx context.Context, config *types.Configuration) *AmqpCo
 		log.WithField("config", types.RedactConfigSecrets(config)).Panicf("Failed getting subscription: %v", err)
 	}
 	listener.SubscriptionName = *sub.Name
+
+	// Apply the module's filter as the subscription's rule so it only receives the events it can process
+	rulesClient := servicebus.NewRulesClient(config.SubscriptionID)
+	rulesClient.Authorizer = auth
+	err = applySubscriptionFilter(ctx, rulesClient, config, subName)
+	if err != nil {
+		log.WithField("config", types.RedactConfigSecrets(config)).Panicf("Failed applying subscription filter: %v", err)
+	}
 	listener.SubscriptionAmqpPath = getSubscriptionAmqpPath(config.SubscribesToEvent, config.ModuleName)
 
 	listener.Session = createAmqpSession(&listener)
-	listener.Receiver = createAmqpListener(&listener)
+	listener.Receiver = createAmqpListener(&listener, getLinkCredit(config.Job.MaxConcurrent))
 	listener.ManagementSender, listener.ManagementReceiver, err = listener.createAmqpSBManagementChannels(listener.TopicName, config.ModuleName)
 	if err != nil {
 		log.WithError(err).Error("failed to create management sender, without this renewal of message locks will fail")
@@ -192,10 +231,77 @@ func NewAmqpConnection(ctx context.Context, config *types.Configuration) *AmqpCo
 	return &listener
 }
 
+// Receive blocks until a message is received from the subscription. Messages prefetched by the
+// receiver link whose lock expired before they were received are skipped, ServiceBus redelivers them.
+func (l *AmqpConnection) Receive(ctx context.Context) (messaging.Message, error) {
+	for {
+		message, err := l.Receiver.Receive(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if message == nil {
+			return nil, fmt.Errorf("nil message received")
+		}
+		if lockExpired(message, time.Now()) {
+			log.WithField("lockedUntil", message.Annotations["x-opt-locked-until"]).Warn("skipping prefetched message whose lock has expired, it will be redelivered")
+			continue
+		}
+		return messaging.NewAmqpMessageWrapper(message), nil
+	}
+}
+
+// lockExpired returns true when the lock ServiceBus took on the message when it was delivered has expired
+func lockExpired(message *amqp.Message, now time.Time) bool {
+	lockedUntil, ok := message.Annotations["x-opt-locked-until"].(time.Time)
+	return ok && lockedUntil.Before(now)
+}
+
+// Publish sends the event to the topic for its type
+func (l *AmqpConnection) Publish(ctx context.Context, event common.Event) error {
+	encoded, err := messaging.EncodeEvent(event, l.eventEncoding)
+	if err != nil {
+		return err
+	}
+
+	l.sendersMu.Lock()
+	defer l.sendersMu.Unlock()
+	sender, ok := l.senders[event.Type]
+	if !ok {
+		sender, err = l.CreateAmqpSender(event.Type)
+		if err != nil {
+			return err
+		}
+		l.senders[event.Type] = sender
+	}
+	return sender.Send(ctx, messaging.NewAmqpEventMessage(encoded))
+}
+
+// HandlerArgs returns the args which configure the handler to publish events to ServiceBus
+func (l *AmqpConnection) HandlerArgs() []string {
+	return l.handlerArgs
+}
+
+// Close closes the links to ServiceBus
+func (l *AmqpConnection) Close() error {
+	ctx := context.Background()
+	l.sendersMu.Lock()
+	defer l.sendersMu.Unlock()
+	for _, sender := range l.senders {
+		sender.Close(ctx) //nolint: errcheck
+	}
+	return l.Receiver.Close(ctx)
+}
+
 //RenewLocks renews the locks on messages provided
-func (l *AmqpConnection) RenewLocks(ctx context.Context, messages []*amqp.Message) error {
+func (l *AmqpConnection) RenewLocks(ctx context.Context, messages []messaging.Message) error {
 	lockTokens := make([]amqp.UUID, 0, len(messages))
-	for _, m := range messages {
+	for _, message := range messages {
+		amqpMessage, ok := messaging.Unwrap(message).(*messaging.AmqpMessage)
+		if !ok {
+			log.WithField("messageID", message.ID()).Error("message wasn't received from servicebus, cannot renew lock")
+			continue
+		}
+		m := amqpMessage.GetAMQPMessage()
 		lockToken, ok := m.DeliveryAnnotations["x-opt-lock-token"]
 		if !ok {
 			log.WithField("message", m).Error("failed to get x-opt-locktoken from message annotations, cannot renew lock")
@@ -273,7 +379,18 @@ func (l *AmqpConnection) createAmqpSBManagementChannels(topic, eventname string)
 	return sender, reciever, nil
 }
 
-func createAmqpListener(listener *AmqpConnection) *amqp.Receiver {
+// getLinkCredit returns the number of messages the receiver link may prefetch.
+// Prefetched messages are locked on the subscription but aren't dispatched, so when
+// the dispatcher limits concurrent jobs only a single message is prefetched to avoid
+// holding locks on messages which can't be dispatched until a job completes.
+func getLinkCredit(maxConcurrent int) uint32 {
+	if maxConcurrent > 0 {
+		return 1
+	}
+	return amqp.DefaultLinkCredit
+}
+
+func createAmqpListener(listener *AmqpConnection, linkCredit uint32) *amqp.Receiver {
 	// Todo: how do we validate that the session is healthy?
 	if listener.Session == nil {
 		log.WithField("currentListener", listener).Panic("Cannot create amqp listener without a session already configured")
@@ -282,7 +399,7 @@ func createAmqpListener(listener *AmqpConnection) *amqp.Receiver {
 	// Create a receiver
 	receiver, err := listener.Session.NewReceiver(
 		amqp.LinkSourceAddress(listener.SubscriptionAmqpPath),
-		// amqp.LinkCredit(10), // Todo: Add config value to define how many inflight tasks the dispatcher can handle
+		amqp.LinkCredit(linkCredit),
 	)
 	if err != nil {
 		log.Fatal("Creating receiver:", err)
@@ -308,6 +425,59 @@ func (l *AmqpConnection) CreateAmqpSender(topic string) (*amqp.Sender, error) {
 	return sender, nil
 }
 
+// applySubscriptionFilter makes the module's filter the subscription's only rule. The filter's
+// rule is created before the other rules, such as the '$Default' rule which matches every
+// event, are deleted so there's no point at which the subscription has no rules and drops events.
+func applySubscriptionFilter(ctx context.Context, rulesClient servicebus.RulesClient, config *types.Configuration, subName string) error {
+	subscriptionFilter, err := filter.Parse(config.SubscriptionFilter)
+	if err != nil {
+		return err
+	}
+	sqlExpression := subscriptionFilter.SQL()
+	log.WithField("rule", sqlExpression).Debugf("applying subscription filter to %v", subName)
+
+	_, err = rulesClient.CreateOrUpdate(
+		ctx,
+		config.ResourceGroup,
+		config.ServiceBusNamespace,
+		config.SubscribesToEvent,
+		subName,
+		filterRuleName,
+		servicebus.Rule{
+			Ruleproperties: &servicebus.Ruleproperties{
+				FilterType: servicebus.FilterTypeSQLFilter,
+				SQLFilter: &servicebus.SQLFilter{
+					SQLExpression: to.StringPtr(sqlExpression),
+				},
+			},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed creating rule %s: %v", filterRuleName, err)
+	}
+
+	rules, err := rulesClient.ListBySubscriptionsComplete(ctx, config.ResourceGroup, config.ServiceBusNamespace, config.SubscribesToEvent, subName)
+	if err != nil {
+		return fmt.Errorf("failed listing rules: %v", err)
+	}
+	var staleRules []string
+	for rules.NotDone() {
+		if name := rules.Value().Name; name != nil && *name != filterRuleName {
+			staleRules = append(staleRules, *name)
+		}
+		if err := rules.Next(); err != nil {
+			return fmt.Errorf("failed listing rules: %v", err)
+		}
+	}
+	for _, ruleName := range staleRules {
+		_, err := rulesClient.Delete(ctx, config.ResourceGroup, config.ServiceBusNamespace, config.SubscribesToEvent, subName, ruleName)
+		if err != nil {
+			return fmt.Errorf("failed deleting rule %s: %v", ruleName, err)
+		}
+	}
+	return nil
+}
+
 func createTopic(ctx context.Context, topicsClient servicebus.TopicsClient, config *types.Configuration, topicName string) servicebus.SBTopic {
 	topic, err := topicsClient.Get(ctx, config.ResourceGroup, config.ServiceBusNamespace, topicName)
 	if err != nil && topic.Response.Response != nil && topic.Response.StatusCode == http.StatusNotFound {
@@ -81,8 +81,8 @@ func TestIntegrationNewListener(t *testing.T) {
 
 	go func() {
 		time.Sleep(time.Duration(45) * time.Second)
-		err := listener.RenewLocks(ctx, []*amqp.Message{
-			amqpMessage,
+		err := listener.RenewLocks(ctx, []messaging.Message{
+			message,
 		})
 		if err != nil {
 			t.Error(err)
@@ -2,6 +2,9 @@ package servicebus
 
 import (
 	"testing"
+	"time"
+
+	"pack.ag/amqp"
 )
 
 // TestNewListener performs an end-2-end integration test on the listener talking to Azure ServiceBus
@@ -40,3 +43,41 @@ func TestGetSubscriptionAmqpPath(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestGetLinkCredit(t *testing.T) {
+	testCases := []struct {
+		maxConcurrent int
+		expected      uint32
+	}{
+		{maxConcurrent: 0, expected: amqp.DefaultLinkCredit},
+		{maxConcurrent: 1, expected: 1},
+		{maxConcurrent: 50, expected: 1},
+	}
+
+	for _, test := range testCases {
+		actual := getLinkCredit(test.maxConcurrent)
+		if actual != test.expected {
+			t.Errorf("maxConcurrent: %d Got: %d Expected: %d", test.maxConcurrent, actual, test.expected)
+		}
+	}
+}
+
+func TestLockExpired(t *testing.T) {
+	now := time.Now()
+	testCases := []struct {
+		name        string
+		annotations amqp.Annotations
+		expected    bool
+	}{
+		{name: "locked", annotations: amqp.Annotations{"x-opt-locked-until": now.Add(time.Minute)}, expected: false},
+		{name: "expired", annotations: amqp.Annotations{"x-opt-locked-until": now.Add(-time.Second)}, expected: true},
+		{name: "no lock", annotations: nil, expected: false},
+	}
+
+	for _, test := range testCases {
+		actual := lockExpired(&amqp.Message{Annotations: test.annotations}, now)
+		if actual != test.expected {
+			t.Errorf("%s: Got: %v Expected: %v", test.name, actual, test.expected)
+		}
+	}
+}